@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Flags accepted for compatibility with similar tools (helm, gomplate,
+// ytt), so that their scripts can be migrated step by step. They are hidden
+// and print a deprecation warning naming the simplate equivalent.
+var (
+	templateFlag string
+	valuesFile   string
+)
+
+// flagAlias is a deprecated alias of a simplate flag.
+type flagAlias struct {
+	alias  string
+	target string
+}
+
+// flagAliases are the aliases of flags that set the same variable.
+var flagAliases = []flagAlias{
+	{"out-dir", "output-dir"},
+}
+
+// registerFlagAliases adds the deprecated aliases and the flag name
+// normalization to cmd.
+func registerFlagAliases(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	for _, a := range flagAliases {
+		target := flags.Lookup(a.target)
+		flags.AddFlag(&pflag.Flag{
+			Name:     a.alias,
+			Usage:    target.Usage,
+			Value:    target.Value,
+			DefValue: target.DefValue,
+		})
+		flags.MarkDeprecated(a.alias, fmt.Sprintf("use --%s instead", a.target))
+	}
+	flags.StringVarP(&templateFlag, "file", "f", "", "Template file")
+	flags.MarkDeprecated("file", "pass the template file as the first argument instead")
+	flags.StringVar(&valuesFile, "values", "", "Input data file")
+	flags.MarkDeprecated("values", "pass the data file as the second argument instead")
+
+	cmd.SetGlobalNormalizationFunc(normalizeFlagName)
+}
+
+// normalizeFlagName maps camelCase and snake_case spellings of long options
+// to the kebab-case names simplate uses, e.g. --outputDir and --output_dir
+// to --output-dir.
+func normalizeFlagName(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == '_':
+			b.WriteByte('-')
+		case unicode.IsUpper(r):
+			// Start a word after a lowercase letter or digit, and at the
+			// last capital of an acronym, as in allowHTTPHost
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('-')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return pflag.NormalizedName(b.String())
+}
+
+// aliasArgs returns the positional arguments with the template and data
+// files given by the --file and --values aliases added.
+func aliasArgs(args []string) ([]string, error) {
+	if templateFlag != "" {
+		args = append([]string{templateFlag}, args...)
+	}
+	if valuesFile != "" {
+		if len(args) > 1 {
+			return nil, fmt.Errorf("--values cannot be used with a data file argument")
+		}
+		args = append(args, valuesFile)
+	}
+	return args, nil
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeFlagName(t *testing.T) {
+	tests := map[string]string{
+		"output-dir":      "output-dir",
+		"outputDir":       "output-dir",
+		"output_dir":      "output-dir",
+		"OutputDir":       "output-dir",
+		"allowHTTPHost":   "allow-http-host",
+		"input-content":   "input-content",
+		"inputSchemaFile": "input-schema-file",
+		"sha256Sum":       "sha256-sum",
+	}
+	for name, want := range tests {
+		if got := string(normalizeFlagName(nil, name)); got != want {
+			t.Errorf("%s: expected %s, got %s", name, want, got)
+		}
+	}
+}
+
+func TestFlagAliases(t *testing.T) {
+	origOutputDir, origTemplate, origValues := outputDir, templateFlag, valuesFile
+	t.Cleanup(func() {
+		outputDir, templateFlag, valuesFile = origOutputDir, origTemplate, origValues
+		rootCmd.Flags().SetOutput(nil)
+	})
+
+	var stderr bytes.Buffer
+	flags := rootCmd.Flags()
+	flags.SetOutput(&stderr)
+	if err := flags.Parse([]string{"--out-dir", "build", "-f", "app.tmpl", "--values", "values.yaml"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if outputDir != "build" || templateFlag != "app.tmpl" || valuesFile != "values.yaml" {
+		t.Errorf("unexpected values %q, %q, %q", outputDir, templateFlag, valuesFile)
+	}
+	for _, want := range []string{"--out-dir has been deprecated, use --output-dir instead", "--file has been deprecated", "--values has been deprecated"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("expected warning %q, got %q", want, stderr.String())
+		}
+	}
+
+	if err := flags.Parse([]string{"--outputDir", "dist"}); err != nil || outputDir != "dist" {
+		t.Errorf("expected --outputDir to set the output directory, got %q, %v", outputDir, err)
+	}
+
+	args, err := aliasArgs(nil)
+	if err != nil || !reflect.DeepEqual(args, []string{"app.tmpl", "values.yaml"}) {
+		t.Errorf("unexpected arguments %v, %v", args, err)
+	}
+	templateFlag = ""
+	if _, err := aliasArgs([]string{"app.tmpl", "data.yaml"}); err == nil {
+		t.Error("expected --values with a data file argument to fail")
+	}
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/danarchy-io/simplate/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+// Values of the analyze --format flag.
+const (
+	analyzeFormatText = "text"
+	analyzeFormatJSON = "json"
+)
+
+var (
+	analyzeFormat string
+
+	analyzeCmd = &cobra.Command{
+		Use:   "analyze [flags] <template-file>",
+		Short: "Report the size and complexity of a template",
+		Long: `Analyze parses a template without rendering it and reports its size (lines,
+bytes, segments), the number of actions and data variables it references,
+the deepest nesting of if, range and with blocks, which segments and
+defined templates include which defined templates, and an estimated render
+cost, in which range and FILE-EACH blocks are assumed to iterate 10 times.
+Use it to spot templates that should be split before they become
+unmaintainable.`,
+		Args: usageArgs(cobra.ExactArgs(1)),
+		RunE: analyzeRunE,
+	}
+)
+
+func init() {
+	analyzeCmd.Flags().StringVar(&analyzeFormat, "format", analyzeFormatText, "Format of the report: text or json")
+	rootCmd.AddCommand(analyzeCmd)
+}
+
+func analyzeRunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one template file must be provided")
+	}
+	if analyzeFormat != analyzeFormatText && analyzeFormat != analyzeFormatJSON {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --format value %q: must be text or json", analyzeFormat))
+	}
+	if cmd != nil {
+		cmd.SilenceUsage = true
+	}
+
+	templateFile := args[0]
+	templateBytes, err := os.ReadFile(templateFile)
+	if err != nil {
+		return fmt.Errorf("failed to read template file '%s': %w", templateFile, err)
+	}
+	metrics, err := template.AnalyzeTemplate(templateFile, templateBytes)
+	if err != nil {
+		return err
+	}
+
+	if analyzeFormat == analyzeFormatJSON {
+		data, err := json.MarshalIndent(metrics, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+		_, err = fmt.Fprintf(os.Stdout, "%s\n", data)
+		return err
+	}
+	return writeAnalysis(os.Stdout, templateFile, metrics)
+}
+
+// writeAnalysis writes the text report of analyze for templateFile to w.
+func writeAnalysis(w io.Writer, templateFile string, metrics *template.TemplateMetrics) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\n", templateFile)
+	fmt.Fprintf(tw, "  lines:\t%d\n", metrics.Lines)
+	fmt.Fprintf(tw, "  bytes:\t%d\n", metrics.Bytes)
+	fmt.Fprintf(tw, "  segments:\t%d (%d FILE, %d DIR)\n", metrics.Segments, metrics.FileSegments, metrics.DirSegments)
+	fmt.Fprintf(tw, "  actions:\t%d\n", metrics.Actions)
+	fmt.Fprintf(tw, "  variables:\t%d\n", len(metrics.Variables))
+	fmt.Fprintf(tw, "  defines:\t%d\n", len(metrics.Defines))
+	fmt.Fprintf(tw, "  max depth:\t%d\n", metrics.MaxDepth)
+	fmt.Fprintf(tw, "  estimated cost:\t%d\n", metrics.Cost)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(metrics.Includes) > 0 {
+		fmt.Fprintln(w, "includes:")
+		for _, edge := range metrics.Includes {
+			fmt.Fprintf(w, "  %s -> %s (line %d)\n", edge.From, edge.To, edge.Line)
+		}
+	}
+	if len(metrics.Variables) > 0 {
+		fmt.Fprintln(w, "variables:")
+		for _, v := range metrics.Variables {
+			fmt.Fprintf(w, "  %s\n", v)
+		}
+	}
+	return nil
+}
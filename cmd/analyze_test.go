@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danarchy-io/simplate/pkg/template"
+)
+
+func TestAnalyzeRunE(t *testing.T) {
+	origFormat := analyzeFormat
+	t.Cleanup(func() { analyzeFormat = origFormat })
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "app.tmpl")
+	tmpl := "{{ define \"labels\" }}app: {{ .name }}{{ end }}\n#FILE:a.yaml#\n{{ range .items }}{{ include \"labels\" $ }}{{ end }}\n#FILE#\n"
+	if err := os.WriteFile(tmplFile, []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	brokenFile := filepath.Join(dir, "broken.tmpl")
+	if err := os.WriteFile(brokenFile, []byte("{{ if .x }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		format  string
+		args    []string
+		wantErr string
+		wantOut []string
+	}{
+		{name: "text", format: "text", args: []string{tmplFile}, wantOut: []string{"max depth:", "1\n", "FILE a.yaml -> labels (line 3)", "  .items\n"}},
+		{name: "json", format: "json", args: []string{tmplFile}, wantOut: []string{`"maxDepth": 1`}},
+		{name: "syntax error", format: "text", args: []string{brokenFile}, wantErr: "broken.tmpl:1"},
+		{name: "invalid format", format: "xml", args: []string{tmplFile}, wantErr: "invalid --format"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			analyzeFormat = tc.format
+
+			// capture stdout
+			origStdout := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			err := analyzeRunE(nil, tc.args)
+			w.Close()
+			out, _ := io.ReadAll(r)
+			os.Stdout = origStdout
+
+			if tc.wantErr != "" {
+				if err == nil || !bytes.Contains([]byte(err.Error()), []byte(tc.wantErr)) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, want := range tc.wantOut {
+				if !bytes.Contains(out, []byte(want)) {
+					t.Errorf("output %q does not contain %q", out, want)
+				}
+			}
+			if tc.format == "json" {
+				var metrics template.TemplateMetrics
+				if err := json.Unmarshal(out, &metrics); err != nil || len(metrics.Includes) != 1 {
+					t.Errorf("unexpected JSON report %s: %v", out, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,458 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultBatchConfig is the config file of batch without argument.
+const defaultBatchConfig = "simplate.yaml"
+
+var (
+	batchParallel  int
+	batchJobs      []string
+	batchKeepGoing bool
+	batchProfile   string
+
+	batchCmd = &cobra.Command{
+		Use:   "batch [flags] [config-file]",
+		Short: "Run the rendering jobs listed in a config file",
+		Long: `Batch runs every job listed in a YAML config file (` + defaultBatchConfig + ` by default),
+each one a simplate run with its own template, data, schema, output and
+flags, so that generation pipelines need no wrapper scripts:
+
+  parallel: 2
+  jobs:
+    - name: api
+      template: templates/service.tmpl
+      data: values/api.yaml
+      schema: schemas/service.json
+      outputDir: out/api
+      overrides:
+        replicas: 3
+      flags: [--format-output, --check-output]
+      profiles:
+        prod:
+          data: values/api-prod.yaml
+          outputDir: out/prod/api
+          overrides:
+            replicas: 5
+
+Paths are relative to the directory of the config file. overrides are
+deep-merged over the data, which the job then reads from its standard
+input. --profile runs the jobs with the settings of one of their
+profiles, which replace the data, schema and outputs of the job, add to
+its flags and are merged over its overrides. Jobs run one after the other
+unless parallel (or --parallel) allows more at once. Batch stops starting
+jobs after the first failure, unless --keep-going is set, and exits with
+the exit code of the first failed job.`,
+		Args: usageArgs(cobra.MaximumNArgs(1)),
+		RunE: batchRunE,
+	}
+)
+
+func init() {
+	batchCmd.Flags().IntVar(&batchParallel, "parallel", 0, "Run up to N jobs at once (default: the parallel setting of the config file, or 1)")
+	batchCmd.Flags().StringSliceVar(&batchJobs, "job", nil, "Run only the job with this name (repeatable)")
+	batchCmd.Flags().BoolVar(&batchKeepGoing, "keep-going", false, "Start the remaining jobs after a job failed")
+	batchCmd.Flags().StringVar(&batchProfile, "profile", "", "Run the jobs with the settings of this profile, e.g. prod")
+	rootCmd.AddCommand(batchCmd)
+}
+
+// batchConfig is the config file of batch.
+type batchConfig struct {
+	// Parallel is the number of jobs run at once, 1 if 0.
+	Parallel int        `yaml:"parallel"`
+	Jobs     []batchJob `yaml:"jobs"`
+}
+
+// batchJob is a simplate run of a batch. Paths are relative to the
+// directory of the config file.
+type batchJob struct {
+	Name      string `yaml:"name"`
+	Template  string `yaml:"template"`
+	Data      string `yaml:"data"`
+	Schema    string `yaml:"schema"`
+	OutputDir string `yaml:"outputDir"`
+	Output    string `yaml:"output"`
+	// Overrides are deep-merged over the data, taking precedence.
+	Overrides map[string]any `yaml:"overrides"`
+	// Flags are further command-line flags of the run, e.g. --format-output.
+	Flags []string `yaml:"flags"`
+	// Profiles are variants of the job, e.g. per environment, selected
+	// with --profile.
+	Profiles map[string]batchJobProfile `yaml:"profiles"`
+}
+
+// batchJobProfile is a variant of a batch job. Its set fields replace those of
+// the job, except for Overrides, merged over the overrides of the job, and
+// Flags, added to the flags of the job.
+type batchJobProfile struct {
+	Data      string         `yaml:"data"`
+	Schema    string         `yaml:"schema"`
+	OutputDir string         `yaml:"outputDir"`
+	Output    string         `yaml:"output"`
+	Overrides map[string]any `yaml:"overrides"`
+	Flags     []string       `yaml:"flags"`
+}
+
+// withProfile returns job with the settings of its profile name. Every job
+// must define the profiles it is run with, possibly as an empty mapping,
+// so that a missing profile does not silently produce the base outputs.
+func (job batchJob) withProfile(name string) (batchJob, error) {
+	profile, ok := job.Profiles[name]
+	if !ok {
+		return job, withExitCode(ExitUsage, fmt.Errorf("job %q has no profile %q", job.Name, name))
+	}
+	if profile.Data != "" {
+		job.Data = profile.Data
+	}
+	if profile.Schema != "" {
+		job.Schema = profile.Schema
+	}
+	if profile.OutputDir != "" {
+		job.OutputDir = profile.OutputDir
+	}
+	if profile.Output != "" {
+		job.Output = profile.Output
+	}
+	if len(profile.Overrides) > 0 {
+		job.Overrides = mergeOverrides(job.Overrides, profile.Overrides)
+	}
+	job.Flags = append(slices.Clip(job.Flags), profile.Flags...)
+	return job, nil
+}
+
+// loadBatchConfig reads and checks the batch config file path. Jobs without
+// a name are named after their position, "job 1" for the first.
+func loadBatchConfig(path string) (*batchConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, withExitCode(ExitData, fmt.Errorf("failed to read batch config '%s': %w", path, err))
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var config batchConfig
+	if err := dec.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, withExitCode(ExitData, fmt.Errorf("invalid batch config '%s': %w", path, err))
+	}
+	if len(config.Jobs) == 0 {
+		return nil, withExitCode(ExitData, fmt.Errorf("invalid batch config '%s': no jobs", path))
+	}
+	if config.Parallel < 0 {
+		return nil, withExitCode(ExitData, fmt.Errorf("invalid batch config '%s': parallel must not be negative", path))
+	}
+	names := map[string]bool{}
+	for i := range config.Jobs {
+		job := &config.Jobs[i]
+		if job.Name == "" {
+			job.Name = fmt.Sprintf("job %d", i+1)
+		}
+		if names[job.Name] {
+			return nil, withExitCode(ExitData, fmt.Errorf("invalid batch config '%s': duplicate job name %q", path, job.Name))
+		}
+		names[job.Name] = true
+		if job.Template == "" {
+			return nil, withExitCode(ExitData, fmt.Errorf("invalid batch config '%s': job %q has no template", path, job.Name))
+		}
+	}
+	return &config, nil
+}
+
+// args returns the command-line arguments of the simplate run of job,
+// relative to dir, and its standard input. Flags shared by all commands are
+// passed on. Data with overrides is passed on standard input rather than
+// with --input-content, which would be limited in size and visible to other
+// users of the machine.
+func (job batchJob) args(dir string) ([]string, []byte, error) {
+	var args []string
+	if quiet {
+		args = append(args, "--quiet")
+	}
+	if verbose {
+		args = append(args, "--verbose", "--log-format", logFormat)
+	}
+	if errorFormat != errorFormatText {
+		args = append(args, "--error-format", errorFormat)
+	}
+	args = append(args, job.Flags...)
+	if job.Schema != "" {
+		args = append(args, "--input-schema-file", job.Schema)
+	}
+	if job.OutputDir != "" {
+		args = append(args, "--output-dir", job.OutputDir)
+	}
+	if job.Output != "" {
+		args = append(args, "--output", job.Output)
+	}
+
+	args = append(args, "--", job.Template)
+	if len(job.Overrides) > 0 {
+		content, err := job.mergedData(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return append(args, "-"), content, nil
+	}
+	if job.Data != "" {
+		args = append(args, job.Data)
+	}
+	return args, nil, nil
+}
+
+// mergedData returns the data of job, if any, with its overrides merged
+// over it, as YAML. The rest of the data, tags and anchors included, is
+// kept as is.
+func (job batchJob) mergedData(dir string) ([]byte, error) {
+	var doc yaml.Node
+	if job.Data != "" {
+		path := job.Data
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, withExitCode(ExitData, fmt.Errorf("failed to read YAML data from file '%s': %w", job.Data, err))
+		}
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return nil, withExitCode(ExitData, fmt.Errorf("failed to parse YAML data from file '%s': %w", job.Data, err))
+		}
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, withExitCode(ExitData, fmt.Errorf("cannot apply the overrides of job %q: the data of '%s' is not a mapping", job.Name, job.Data))
+	}
+	if err := mergeOverridesNode(doc.Content[0], job.Overrides); err != nil {
+		return nil, fmt.Errorf("failed to encode the overrides of job %q: %w", job.Name, err)
+	}
+	content, err := yaml.Marshal(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the data of job %q: %w", job.Name, err)
+	}
+	return content, nil
+}
+
+// mergeOverridesNode deep-merges overrides over the YAML mapping node like
+// mergeOverrides. Aliased mappings are copied before overrides are merged
+// into them, so that their anchor keeps its value.
+func mergeOverridesNode(node *yaml.Node, overrides map[string]any) error {
+	keys := slices.Sorted(maps.Keys(overrides))
+	for _, key := range keys {
+		value := overrides[key]
+		i := -1
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == key {
+				i = j
+				break
+			}
+		}
+
+		if override, ok := value.(map[string]any); ok && i >= 0 {
+			existing := node.Content[i+1]
+			if existing.Kind == yaml.AliasNode && existing.Alias.Kind == yaml.MappingNode {
+				copied := *existing.Alias
+				copied.Anchor = ""
+				copied.Content = slices.Clone(copied.Content)
+				node.Content[i+1], existing = &copied, &copied
+			}
+			if existing.Kind == yaml.MappingNode {
+				if err := mergeOverridesNode(existing, override); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		valueNode := &yaml.Node{}
+		if err := valueNode.Encode(value); err != nil {
+			return err
+		}
+		if i >= 0 {
+			node.Content[i+1] = valueNode
+		} else {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, valueNode)
+		}
+	}
+	return nil
+}
+
+// mergeOverrides returns a copy of data with overrides deep-merged over it:
+// nested maps are merged, other values of overrides replace those of data.
+func mergeOverrides(data, overrides map[string]any) map[string]any {
+	result := make(map[string]any, len(data)+len(overrides))
+	for key, value := range data {
+		result[key] = value
+	}
+	for key, value := range overrides {
+		existing, ok1 := result[key].(map[string]any)
+		override, ok2 := value.(map[string]any)
+		if ok1 && ok2 {
+			result[key] = mergeOverrides(existing, override)
+		} else {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// runBatchJob runs simplate with args in dir, with stdin, if not nil, as
+// standard input. It is a variable so that tests can run jobs in process.
+var runBatchJob = func(ctx context.Context, dir string, args []string, stdin []byte, stdout, stderr io.Writer) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the simplate executable: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Dir = dir
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	return cmd.Run()
+}
+
+func batchRunE(cmd *cobra.Command, args []string) error {
+	configFile := defaultBatchConfig
+	if len(args) == 1 {
+		configFile = args[0]
+	}
+	if batchParallel < 0 {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --parallel value %d: must not be negative", batchParallel))
+	}
+	if cmd != nil {
+		cmd.SilenceUsage = true
+	}
+	logger := newLogger(os.Stderr)
+
+	config, err := loadBatchConfig(configFile)
+	if err != nil {
+		return err
+	}
+	jobs := config.Jobs
+	if len(batchJobs) > 0 {
+		jobs = nil
+		for _, name := range batchJobs {
+			i := slices.IndexFunc(config.Jobs, func(job batchJob) bool { return job.Name == name })
+			if i < 0 {
+				return withExitCode(ExitUsage, fmt.Errorf("no job named %q in '%s'", name, configFile))
+			}
+			jobs = append(jobs, config.Jobs[i])
+		}
+	}
+	if batchProfile != "" {
+		for i, job := range jobs {
+			if jobs[i], err = job.withProfile(batchProfile); err != nil {
+				return err
+			}
+		}
+	}
+	parallel := max(cmp.Or(batchParallel, config.Parallel), 1)
+	dir := filepath.Dir(configFile)
+
+	ctx := context.Background()
+	if cmd != nil && cmd.Context() != nil {
+		ctx = cmd.Context()
+	}
+	var (
+		mu     sync.Mutex // guards failed, stopped and the output of parallel jobs
+		failed []batchFailure
+		wg     sync.WaitGroup
+	)
+	stopped := false
+	slots := make(chan struct{}, parallel)
+	for i, job := range jobs {
+		mu.Lock()
+		stop := stopped
+		mu.Unlock()
+		if stop {
+			logger.Info("job skipped", "job", job.Name)
+			continue
+		}
+		jobArgs, jobStdin, err := job.args(dir)
+		if err != nil {
+			mu.Lock()
+			failed = append(failed, batchFailure{index: i, name: job.Name, err: err})
+			stopped = !batchKeepGoing
+			mu.Unlock()
+			fmt.Fprintf(os.Stderr, "job %s: %v\n", job.Name, err)
+			continue
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			logger.Info("job started", "job", job.Name, "template", job.Template, "profile", batchProfile)
+			started := time.Now()
+
+			// Parallel jobs are buffered so that their outputs do not interleave
+			var stdout, stderr io.Writer = os.Stdout, os.Stderr
+			var outBuf, errBuf bytes.Buffer
+			if parallel > 1 {
+				stdout, stderr = &outBuf, &errBuf
+			}
+			err := runBatchJob(ctx, dir, jobArgs, jobStdin, stdout, stderr)
+
+			mu.Lock()
+			defer mu.Unlock()
+			os.Stdout.Write(outBuf.Bytes())
+			os.Stderr.Write(errBuf.Bytes())
+			if err != nil {
+				failed = append(failed, batchFailure{index: i, name: job.Name, err: err})
+				stopped = !batchKeepGoing
+				fmt.Fprintf(os.Stderr, "job %s failed: %v\n", job.Name, err)
+				return
+			}
+			logger.Info("job finished", "job", job.Name, "duration", time.Since(started))
+		}()
+		if parallel == 1 {
+			// Wait for the job, so that a failure stops the next one
+			wg.Wait()
+		}
+	}
+	wg.Wait()
+
+	if len(failed) == 0 {
+		return nil
+	}
+	// Report the first failed job in config order, with its exit code
+	first := failed[0]
+	names := make([]string, len(failed))
+	for i, f := range failed {
+		if f.index < first.index {
+			first = f
+		}
+		names[i] = f.name
+	}
+	code := ExitCode(first.err)
+	var exitErr *exec.ExitError
+	if errors.As(first.err, &exitErr) {
+		code = exitErr.ExitCode()
+	}
+	return withExitCode(code, fmt.Errorf("%d of %d jobs failed: %s", len(failed), len(jobs), strings.Join(names, ", ")))
+}
+
+// batchFailure is a failed job of a batch, at index in the jobs run.
+type batchFailure struct {
+	index int
+	name  string
+	err   error
+}
@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// batchChildEnv makes the test binary run as simplate, so that batch jobs can
+// run it as a subprocess.
+const batchChildEnv = "SIMPLATE_TEST_BATCH_CHILD"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(batchChildEnv) == "1" {
+		os.Exit(ExitCode(Execute()))
+	}
+	os.Exit(m.Run())
+}
+
+func saveBatchFlags(t *testing.T) {
+	origParallel, origJobs, origKeepGoing, origProfile, origQuiet := batchParallel, batchJobs, batchKeepGoing, batchProfile, quiet
+	t.Cleanup(func() {
+		batchParallel, batchJobs, batchKeepGoing, batchProfile, quiet = origParallel, origJobs, origKeepGoing, origProfile, origQuiet
+	})
+	batchParallel, batchJobs, batchKeepGoing, batchProfile, quiet = 0, nil, false, "", true
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBatchRunE(t *testing.T) {
+	saveBatchFlags(t)
+	t.Setenv(batchChildEnv, "1")
+	batchKeepGoing = true
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"render.yaml": `parallel: 2
+jobs:
+  - name: api
+    template: service.tmpl
+    data: values/api.yaml
+    outputDir: out/api
+  - name: worker
+    template: service.tmpl
+    data: values/api.yaml
+    schema: service.json
+    outputDir: out/worker
+    overrides:
+      name: worker
+      limits: {cpu: 2}
+  - name: broken
+    template: service.tmpl
+    data: values/api.yaml
+    schema: service.json
+    overrides:
+      replicas: many
+`,
+		"service.tmpl":    "#FILE:{{ .name }}.txt#{{ .name }} {{ .replicas }} {{ .limits.cpu }}/{{ .limits.memory }}\n#FILE#",
+		"values/api.yaml": "name: api\nreplicas: 1\nlimits: {cpu: 1, memory: 1Gi}\n",
+		"service.json":    `{"type": "object", "properties": {"replicas": {"type": "integer"}}}`,
+	})
+
+	// Jobs run with the directory of the config file as working directory
+	origStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	err := batchRunE(nil, []string{filepath.Join(dir, "render.yaml")})
+	w.Close()
+	stderr, _ := io.ReadAll(r)
+	os.Stderr = origStderr
+
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 jobs failed: broken") {
+		t.Fatalf("expected the broken job to fail, got %v", err)
+	}
+	if code := ExitCode(err); code != ExitValidation {
+		t.Errorf("expected exit code %d, got %d", ExitValidation, code)
+	}
+	if !strings.Contains(string(stderr), "job broken failed") {
+		t.Errorf("expected the failure on stderr, got %q", stderr)
+	}
+	for path, want := range map[string]string{
+		"out/api/api.txt":       "api 1 1/1Gi\n",
+		"out/worker/worker.txt": "worker 1 2/1Gi\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestBatchRunE_Scheduling(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "simplate.yaml")
+	writeTestFiles(t, dir, map[string]string{
+		"simplate.yaml": "jobs:\n  - {name: a, template: a.tmpl}\n  - {name: b, template: b.tmpl}\n  - {template: c.tmpl}\n",
+	})
+
+	cases := []struct {
+		name      string
+		jobs      []string
+		profile   string
+		keepGoing bool
+		fail      string
+		wantRun   []string
+		wantErr   string
+	}{
+		{name: "all", wantRun: []string{"a.tmpl", "b.tmpl", "c.tmpl"}},
+		{name: "selected", jobs: []string{"job 3", "a"}, wantRun: []string{"c.tmpl", "a.tmpl"}},
+		{name: "unknown job", jobs: []string{"d"}, wantErr: `no job named "d"`},
+		{name: "missing profile", profile: "prod", wantErr: `job "a" has no profile "prod"`},
+		{name: "stop after failure", fail: "a.tmpl", wantRun: []string{"a.tmpl"}, wantErr: "1 of 3 jobs failed: a"},
+		{name: "keep going", keepGoing: true, fail: "b.tmpl", wantRun: []string{"a.tmpl", "b.tmpl", "c.tmpl"}, wantErr: "1 of 3 jobs failed: b"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			saveBatchFlags(t)
+			batchJobs, batchProfile, batchKeepGoing = tc.jobs, tc.profile, tc.keepGoing
+
+			var (
+				mu  sync.Mutex
+				run []string
+			)
+			origRun := runBatchJob
+			t.Cleanup(func() { runBatchJob = origRun })
+			runBatchJob = func(_ context.Context, jobDir string, args []string, _ []byte, _, _ io.Writer) error {
+				if jobDir != dir {
+					t.Errorf("job run in %s, want %s", jobDir, dir)
+				}
+				tmpl := args[len(args)-1]
+				mu.Lock()
+				run = append(run, tmpl)
+				mu.Unlock()
+				if tmpl == tc.fail {
+					return withExitCode(ExitTemplate, errors.New("boom"))
+				}
+				return nil
+			}
+
+			origStderr := os.Stderr
+			_, w, _ := os.Pipe()
+			os.Stderr = w
+			err := batchRunE(nil, []string{config})
+			w.Close()
+			os.Stderr = origStderr
+
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.fail != "" && ExitCode(err) != ExitTemplate {
+				t.Errorf("expected exit code %d, got %d", ExitTemplate, ExitCode(err))
+			}
+			if !reflect.DeepEqual(run, tc.wantRun) {
+				t.Errorf("jobs run = %v, want %v", run, tc.wantRun)
+			}
+		})
+	}
+}
+
+func TestBatchJob_WithProfile(t *testing.T) {
+	job := batchJob{
+		Name:      "api",
+		Template:  "service.tmpl",
+		Data:      "api.yaml",
+		OutputDir: "out/api",
+		Overrides: map[string]any{"replicas": 1, "limits": map[string]any{"cpu": 1}},
+		Flags:     []string{"--format-output"},
+		Profiles: map[string]batchJobProfile{
+			"dev": {},
+			"prod": {
+				Data:      "api-prod.yaml",
+				OutputDir: "out/prod/api",
+				Overrides: map[string]any{"limits": map[string]any{"memory": "1Gi"}},
+				Flags:     []string{"--check-output"},
+			},
+		},
+	}
+
+	dev, err := job.withProfile("dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(dev, job) {
+		t.Errorf("empty profile changed the job: %+v", dev)
+	}
+
+	prod, err := job.withProfile("prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := job
+	want.Data, want.OutputDir = "api-prod.yaml", "out/prod/api"
+	want.Overrides = map[string]any{"replicas": 1, "limits": map[string]any{"cpu": 1, "memory": "1Gi"}}
+	want.Flags = []string{"--format-output", "--check-output"}
+	if !reflect.DeepEqual(prod, want) {
+		t.Errorf("withProfile = %+v, want %+v", prod, want)
+	}
+	if len(job.Flags) != 1 || job.Overrides["limits"].(map[string]any)["memory"] != nil {
+		t.Error("withProfile modified the base job")
+	}
+
+	if _, err := job.withProfile("staging"); err == nil || ExitCode(err) != ExitUsage {
+		t.Errorf("expected a usage error for a missing profile, got %v", err)
+	}
+}
+
+func TestLoadBatchConfig_Invalid(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{name: "no jobs", config: "parallel: 2\n", wantErr: "no jobs"},
+		{name: "unknown profile key", config: "jobs:\n  - {template: a.tmpl, profiles: {prod: {template: b.tmpl}}}\n", wantErr: "field template not found"},
+		{name: "unknown key", config: "jobs:\n  - {template: a.tmpl, ouput: x}\n", wantErr: "field ouput not found"},
+		{name: "no template", config: "jobs:\n  - {name: a}\n", wantErr: `job "a" has no template`},
+		{name: "duplicate name", config: "jobs:\n  - {name: a, template: a.tmpl}\n  - {name: a, template: b.tmpl}\n", wantErr: `duplicate job name "a"`},
+		{name: "negative parallel", config: "parallel: -1\njobs:\n  - {template: a.tmpl}\n", wantErr: "parallel must not be negative"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "simplate.yaml")
+			if err := os.WriteFile(path, []byte(tc.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadBatchConfig(path)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+			if ExitCode(err) != ExitData {
+				t.Errorf("expected exit code %d, got %d", ExitData, ExitCode(err))
+			}
+		})
+	}
+}
+
+func TestBatchJob_Args(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"values.yaml": "# values\npassword: !vault |\n  $ANSIBLE_VAULT;1.1;AES256\n  3132\ndefaults: &defaults\n  cpu: 1\n  memory: 1Gi\nlimits: *defaults\nname: api\n",
+	})
+
+	job := batchJob{Name: "api", Template: "t.tmpl", Data: "values.yaml"}
+	args, stdin, err := job.args(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(args, " ") != "-- t.tmpl values.yaml" || stdin != nil {
+		t.Errorf("expected the data file as argument, got %q with stdin %q", args, stdin)
+	}
+
+	job.Overrides = map[string]any{"name": "worker", "limits": map[string]any{"cpu": 2}, "replicas": 3}
+	args, stdin, err = job.args(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(args, " ") != "-- t.tmpl -" {
+		t.Errorf("expected the data on stdin, got %q", args)
+	}
+	want := `# values
+password: !vault |
+    $ANSIBLE_VAULT;1.1;AES256
+    3132
+defaults: &defaults
+    cpu: 1
+    memory: 1Gi
+limits:
+    cpu: 2
+    memory: 1Gi
+name: worker
+replicas: 3
+`
+	if string(stdin) != want {
+		t.Errorf("unexpected merged data:\n%s\nwant:\n%s", stdin, want)
+	}
+
+	job.Data = "missing.yaml"
+	if _, _, err := job.args(dir); ExitCode(err) != ExitData {
+		t.Errorf("expected a data error, got %v", err)
+	}
+}
+
+func TestMergeOverrides(t *testing.T) {
+	data := map[string]any{"a": 1, "m": map[string]any{"x": 1, "y": 2}, "l": []any{1}}
+	got := mergeOverrides(data, map[string]any{"m": map[string]any{"y": 3, "z": 4}, "l": []any{2}, "b": true})
+	want := map[string]any{"a": 1, "m": map[string]any{"x": 1, "y": 3, "z": 4}, "l": []any{2}, "b": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeOverrides = %v, want %v", got, want)
+	}
+	if data["m"].(map[string]any)["y"] != 2 {
+		t.Error("mergeOverrides modified the data")
+	}
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/danarchy-io/simplate/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+var (
+	encryptKeyFiles []string
+
+	encryptCmd = &cobra.Command{
+		Use:   "encrypt --key-file [id=]path < secret",
+		Short: "Encrypt a value for use in data files",
+		Long: `Encrypt reads a secret from stdin, without its trailing newline, and prints
+it encrypted as an ENC[...] value to paste into a YAML data file. Runs given
+the same key with --key-file decrypt the value while loading the data, so
+that data files mixing public values and secrets stay diffable while the
+secrets stay encrypted at rest.
+
+With --key-file id=path the value records the key ID, so that files can mix
+values encrypted with different keys, e.g. per environment.`,
+		Args: usageArgs(cobra.NoArgs),
+		RunE: encryptRunE,
+	}
+)
+
+func init() {
+	encryptCmd.Flags().StringArrayVar(&encryptKeyFiles, "key-file", nil, "File holding the key (a password or random bytes), optionally with the key ID as id=path")
+	rootCmd.AddCommand(encryptCmd)
+}
+
+func encryptRunE(cmd *cobra.Command, args []string) error {
+	if len(encryptKeyFiles) != 1 {
+		return withExitCode(ExitUsage, fmt.Errorf("exactly one --key-file must be provided"))
+	}
+	id, path, err := parseKeyFile(encryptKeyFiles[0])
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	if cmd != nil {
+		cmd.SilenceUsage = true
+	}
+
+	key, err := readKeyFile(path)
+	if err != nil {
+		return withExitCode(ExitData, err)
+	}
+	secret, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return withExitCode(ExitData, fmt.Errorf("failed to read the secret from stdin: %w", err))
+	}
+	secret = bytes.TrimSuffix(bytes.TrimSuffix(secret, []byte("\n")), []byte("\r"))
+	value, err := template.EncryptValue(secret, key, id)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// parseKeyFile splits a --key-file value into its optional key ID and path.
+func parseKeyFile(value string) (id, path string, err error) {
+	id, path, ok := strings.Cut(value, "=")
+	if !ok {
+		return "", value, nil
+	}
+	if id == "" || path == "" {
+		return "", "", fmt.Errorf("invalid --key-file value %q: expected a path or id=path", value)
+	}
+	return id, path, nil
+}
+
+// readKeyFile returns the key in path, without a trailing newline.
+func readKeyFile(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file '%s': %w", path, err)
+	}
+	key = bytes.TrimRight(key, "\r\n")
+	if len(key) == 0 {
+		return nil, fmt.Errorf("key file '%s' is empty", path)
+	}
+	return key, nil
+}
+
+// keyFileProvider returns the KeyProvider of the --key-file values. Key
+// files are read when a value needs them. Values with a key ID without a
+// key file use the key without ID, like ansible-vault tries the password
+// it was given for every vault ID.
+func keyFileProvider(values []string) (template.KeyProvider, error) {
+	paths := map[string]string{}
+	for _, value := range values {
+		id, path, err := parseKeyFile(value)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := paths[id]; ok {
+			if id == "" {
+				return nil, fmt.Errorf("more than one --key-file without key ID")
+			}
+			return nil, fmt.Errorf("more than one --key-file for key ID %q", id)
+		}
+		paths[id] = path
+	}
+
+	keys := map[string][]byte{}
+	return func(id string) ([]byte, error) {
+		name := id
+		path, ok := paths[name]
+		if !ok {
+			name = ""
+			if path, ok = paths[name]; !ok {
+				if id == "" {
+					return nil, fmt.Errorf("no key for values without key ID: pass it with --key-file <path>")
+				}
+				return nil, fmt.Errorf("no key for key ID %q: pass it with --key-file %s=<path>", id, id)
+			}
+		}
+		if key, ok := keys[name]; ok {
+			return key, nil
+		}
+		key, err := readKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		keys[name] = key
+		return key, nil
+	}, nil
+}
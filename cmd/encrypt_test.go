@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danarchy-io/simplate/pkg/template"
+)
+
+func TestEncryptRunE(t *testing.T) {
+	origKeyFiles := encryptKeyFiles
+	t.Cleanup(func() { encryptKeyFiles = origKeyFiles })
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "prod.key")
+	if err := os.WriteFile(keyFile, []byte("s3cret key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	secretFile := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretFile, []byte("p@ss\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	encryptKeyFiles = []string{"prod=" + keyFile}
+	stdin, err := os.Open(secretFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	origStdin, origStdout := os.Stdin, os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdin, os.Stdout = stdin, w
+	err = encryptRunE(nil, nil)
+	w.Close()
+	out, _ := io.ReadAll(r)
+	os.Stdin, os.Stdout = origStdin, origStdout
+	if err != nil {
+		t.Fatalf("encryptRunE returned error: %v", err)
+	}
+
+	value := strings.TrimSpace(string(out))
+	if !strings.HasSuffix(value, ",key:prod]") {
+		t.Fatalf("expected a value with the key ID, got %q", value)
+	}
+	keys, err := keyFileProvider([]string{"prod=" + keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := template.DecryptingYamlProvider([]byte("password: "+value), keys)()
+	if err != nil {
+		t.Fatalf("failed to decrypt %s: %v", value, err)
+	}
+	if got := data.(map[string]any)["password"]; got != "p@ss" {
+		t.Errorf("decrypted %q, want %q", got, "p@ss")
+	}
+
+	encryptKeyFiles = nil
+	if err := encryptRunE(nil, nil); err == nil || ExitCode(err) != ExitUsage {
+		t.Errorf("expected a usage error without --key-file, got %v", err)
+	}
+}
+
+func TestKeyFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"default.key": "default\r\n", "prod.key": "prod", "empty.key": "\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	cases := []struct {
+		name    string
+		files   []string
+		id      string
+		want    string
+		wantErr string
+	}{
+		{name: "default", files: []string{path("default.key")}, want: "default"},
+		{name: "by ID", files: []string{path("default.key"), "prod=" + path("prod.key")}, id: "prod", want: "prod"},
+		{name: "ID falls back to default", files: []string{path("default.key")}, id: "staging", want: "default"},
+		{name: "no default key", files: []string{"prod=" + path("prod.key")}, id: "", wantErr: "no key for values without key ID"},
+		{name: "missing ID", files: []string{"prod=" + path("prod.key")}, id: "staging", wantErr: `no key for key ID "staging": pass it with --key-file staging=<path>`},
+		{name: "empty key", files: []string{path("empty.key")}, wantErr: "is empty"},
+		{name: "missing file", files: []string{path("nope.key")}, wantErr: "failed to read key file"},
+		{name: "duplicate ID", files: []string{"a=x", "a=y"}, wantErr: `more than one --key-file for key ID "a"`},
+		{name: "invalid value", files: []string{"=x"}, wantErr: "expected a path or id=path"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			keys, err := keyFileProvider(tc.files)
+			var key []byte
+			if err == nil {
+				key, err = keys(tc.id)
+			}
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(key) != tc.want {
+				t.Errorf("key = %q, want %q", key, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/danarchy-io/simplate/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+// Values of the --error-format flag.
+const (
+	errorFormatText = "text"
+	errorFormatJSON = "json"
+)
+
+// jsonErrors is set once --error-format json has been accepted; from then on
+// cobra's text error and usage output is silenced and Execute prints errors
+// as JSON instead. Errors in the command line itself are always text.
+var jsonErrors bool
+
+// jsonError is the --error-format json representation of a failed command.
+type jsonError struct {
+	Error      string                     `json:"error"`
+	Violations []template.SchemaViolation `json:"violations,omitempty"`
+	Template   *jsonTemplateLocation      `json:"template,omitempty"`
+	Errors     []jsonError                `json:"errors,omitempty"` // Every failure with --keep-going
+}
+
+// jsonTemplateLocation locates a template parse or execution error.
+type jsonTemplateLocation struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// checkErrorFormat validates the --error-format flag and switches to JSON
+// errors when requested.
+func checkErrorFormat(cmd *cobra.Command, args []string) error {
+	switch errorFormat {
+	case errorFormatText:
+		return nil
+	case errorFormatJSON:
+		jsonErrors = true
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return nil
+	default:
+		return fmt.Errorf("invalid --error-format value %q: must be text or json", errorFormat)
+	}
+}
+
+// printJSONError writes err to w as a single JSON object.
+func printJSONError(w io.Writer, err error) {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(newJSONError(err))
+}
+
+// newJSONError returns the JSON representation of err.
+func newJSONError(err error) jsonError {
+	out := jsonError{Error: err.Error()}
+	var renderErrs template.RenderErrors
+	if errors.As(err, &renderErrs) {
+		for _, e := range renderErrs {
+			out.Errors = append(out.Errors, newJSONError(e))
+		}
+		return out
+	}
+	var schemaErr *template.SchemaError
+	if errors.As(err, &schemaErr) {
+		out.Violations = schemaErr.Violations
+	}
+	var templErr *template.TemplateError
+	if errors.As(err, &templErr) {
+		out.Template = &jsonTemplateLocation{File: templErr.Name, Line: templErr.Line, Column: templErr.Column, Message: templErr.Msg}
+	}
+	return out
+}
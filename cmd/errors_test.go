@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danarchy-io/simplate/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+func TestPrintError_JSON(t *testing.T) {
+	origContent, origSchema := inputContent, inputSchemaFile
+	t.Cleanup(func() { inputContent, inputSchemaFile = origContent, origSchema })
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "t.tmpl")
+	if err := os.WriteFile(tmplFile, []byte("port={{.port}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	schemaFile := filepath.Join(dir, "schema.json")
+	if err := os.WriteFile(schemaFile, []byte(`{"properties":{"port":{"type":"integer"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent, inputSchemaFile = "name: api\nport: http\n", schemaFile
+
+	err := runE(nil, []string{tmplFile})
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+
+	var buf bytes.Buffer
+	printJSONError(&buf, err)
+	var got jsonError
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+	if len(got.Violations) != 1 {
+		t.Fatalf("expected one violation, got %+v", got.Violations)
+	}
+	v := got.Violations[0]
+	if v.Path != ".port" || v.Pointer != "/port" || v.Line != 2 || !strings.Contains(v.Message, "expected integer") {
+		t.Errorf("unexpected violation %+v", v)
+	}
+}
+
+func TestCheckErrorFormat(t *testing.T) {
+	origFormat, origJSON := errorFormat, jsonErrors
+	t.Cleanup(func() { errorFormat, jsonErrors = origFormat, origJSON })
+
+	for _, tc := range []struct {
+		format   string
+		wantErr  bool
+		wantJSON bool
+	}{
+		{format: "text"},
+		{format: "json", wantJSON: true},
+		{format: "xml", wantErr: true},
+	} {
+		errorFormat, jsonErrors = tc.format, false
+		cmd := &cobra.Command{}
+		err := checkErrorFormat(cmd, nil)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: unexpected error %v", tc.format, err)
+		}
+		if jsonErrors != tc.wantJSON || cmd.SilenceErrors != tc.wantJSON {
+			t.Errorf("%s: expected JSON errors %v, got %v", tc.format, tc.wantJSON, jsonErrors)
+		}
+	}
+}
+
+func TestNewJSONError_RenderErrors(t *testing.T) {
+	err := template.RenderErrors{
+		&template.TemplateError{Name: "t.tmpl", Line: 3, Column: 5, Msg: "boom"},
+		errors.New("other"),
+	}
+	got := newJSONError(err)
+	if len(got.Errors) != 2 {
+		t.Fatalf("expected 2 nested errors, got %+v", got)
+	}
+	if loc := got.Errors[0].Template; loc == nil || loc.File != "t.tmpl" || loc.Line != 3 || loc.Column != 5 {
+		t.Errorf("unexpected template location %+v", loc)
+	}
+	if got.Errors[1].Error != "other" {
+		t.Errorf("unexpected second error %+v", got.Errors[1])
+	}
+}
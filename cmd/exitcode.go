@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/danarchy-io/simplate/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes returned by the simplate command.
+const (
+	ExitOK         = 0 // Success
+	ExitFailure    = 1 // Any other error
+	ExitUsage      = 2 // Invalid command line: arguments, flags or flag values
+	ExitData       = 3 // Input data could not be read or parsed
+	ExitValidation = 4 // Input data does not match the schema
+	ExitTemplate   = 5 // Template could not be parsed or rendered
+	ExitWrite      = 6 // Output could not be written
+)
+
+// exitError assigns an exit code to errors detected by the CLI itself.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode returns err with the given exit code, or nil if err is nil.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// usageArgs wraps a cobra argument validator so that its errors exit with
+// ExitUsage.
+func usageArgs(args cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, a []string) error {
+		return withExitCode(ExitUsage, args(cmd, a))
+	}
+}
+
+// flagError makes command line parsing errors exit with ExitUsage.
+func flagError(cmd *cobra.Command, err error) error {
+	return withExitCode(ExitUsage, err)
+}
+
+// ExitCode returns the process exit code for an error returned by Execute.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	var schemaErr *template.SchemaError
+	switch {
+	case errors.Is(err, template.ErrValidation), errors.As(err, &schemaErr):
+		return ExitValidation
+	case errors.Is(err, template.ErrInput):
+		return ExitData
+	case errors.Is(err, template.ErrTemplate):
+		return ExitTemplate
+	case errors.Is(err, template.ErrWrite):
+		return ExitWrite
+	}
+	return ExitFailure
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	origContent, origSchema := inputContent, inputSchemaFile
+	t.Cleanup(func() { inputContent, inputSchemaFile = origContent, origSchema })
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	okTmpl := write("ok.tmpl", "port={{.port}}")
+	badTmpl := write("bad.tmpl", "port={{.port")
+	schema := write("schema.json", `{"properties":{"port":{"type":"integer"}}}`)
+
+	cases := []struct {
+		name    string
+		content string
+		schema  string
+		args    []string
+		want    int
+	}{
+		{name: "success", content: "port: 80", args: []string{okTmpl}, want: ExitOK},
+		{name: "usage", args: []string{}, want: ExitUsage},
+		{name: "data parse", content: "port: [", args: []string{okTmpl}, want: ExitData},
+		{name: "validation", content: "port: http", schema: schema, args: []string{okTmpl}, want: ExitValidation},
+		{name: "template", content: "port: 80", args: []string{badTmpl}, want: ExitTemplate},
+		{name: "missing template file", content: "port: 80", args: []string{filepath.Join(dir, "nope.tmpl")}, want: ExitFailure},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			inputContent, inputSchemaFile = tc.content, tc.schema
+			devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+			origStdout := os.Stdout
+			os.Stdout = devNull
+			err := runE(nil, tc.args)
+			os.Stdout = origStdout
+			devNull.Close()
+
+			if got := ExitCode(err); got != tc.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExitCode_Wrapped(t *testing.T) {
+	err := fmt.Errorf("context: %w", withExitCode(ExitWrite, errors.New("disk full")))
+	if got := ExitCode(err); got != ExitWrite {
+		t.Errorf("ExitCode = %d, want %d", got, ExitWrite)
+	}
+	if withExitCode(ExitWrite, nil) != nil {
+		t.Error("withExitCode(nil) must be nil")
+	}
+}
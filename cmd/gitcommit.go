@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// defaultCommitMessage is the message of --git-commit commits without
+// --message.
+const defaultCommitMessage = "Regenerate files with simplate"
+
+// commitGenerated stages paths, the files written by the run, and the
+// deletion of removed, the files pruned by the run, and commits exactly them
+// in the git work tree holding dir, leaving other changes, staged or not,
+// out of the commit. Files ignored by git, e.g. through --gitignore, are
+// left out as well, and so are removed files git does not track. Nothing is
+// committed if the files did not change. With sign, the commit is GPG signed
+// (git commit -S). The files are unstaged again if the commit fails.
+func commitGenerated(dir string, paths, removed []string, message string, sign bool, logger *slog.Logger) error {
+	if len(paths) == 0 && len(removed) == 0 {
+		logger.Info("nothing to commit")
+		return nil
+	}
+	if _, err := runGit(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return fmt.Errorf("--git-commit requires a git work tree: %w", err)
+	}
+	abs, err := absPaths(paths)
+	if err != nil {
+		return err
+	}
+	removedAbs, err := absPaths(removed)
+	if err != nil {
+		return err
+	}
+
+	// Work out what to commit before staging anything
+	if len(abs) > 0 {
+		ignored, err := gitLines(dir, 1, abs, "check-ignore", "--stdin")
+		if err != nil {
+			return err
+		}
+		if len(ignored) > 0 {
+			abs = slices.DeleteFunc(abs, func(p string) bool { return slices.Contains(ignored, p) })
+			logger.Info("ignored files not committed", "files", len(ignored))
+		}
+	}
+	var tracked []string
+	if len(removedAbs) > 0 {
+		if tracked, err = gitLines(dir, 0, nil, append([]string{"ls-files", "--"}, removedAbs...)...); err != nil {
+			return err
+		}
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	for i, p := range tracked {
+		// ls-files prints paths relative to the directory it runs in
+		tracked[i] = filepath.Join(absDir, p)
+	}
+	all := append(slices.Clip(abs), tracked...)
+	if len(all) == 0 {
+		logger.Info("nothing to commit")
+		return nil
+	}
+
+	if len(abs) > 0 {
+		if _, err := runGit(dir, append([]string{"add", "--"}, abs...)...); err != nil {
+			return err
+		}
+	}
+	if len(tracked) > 0 {
+		if _, err := runGit(dir, append([]string{"rm", "--cached", "--quiet", "--"}, tracked...)...); err != nil {
+			unstage(dir, all)
+			return err
+		}
+	}
+	// diff --quiet exits with 1 when the staged files differ from HEAD
+	if _, err := runGit(dir, append([]string{"diff", "--cached", "--quiet", "--"}, all...)...); err == nil {
+		logger.Info("nothing to commit")
+		return nil
+	}
+	args := []string{"commit", "--quiet", "--message", message}
+	if sign {
+		args = append(args, "--gpg-sign")
+	}
+	if _, err := runGit(dir, append(append(args, "--"), all...)...); err != nil {
+		unstage(dir, all)
+		return err
+	}
+	commit, err := runGit(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	logger.Info("changes committed", "commit", commit, "files", len(all))
+	return nil
+}
+
+// absPaths returns the absolute form of paths.
+func absPaths(paths []string) ([]string, error) {
+	abs := make([]string, len(paths))
+	for i, p := range paths {
+		var err error
+		if abs[i], err = filepath.Abs(p); err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", p, err)
+		}
+	}
+	return abs, nil
+}
+
+// gitLines runs a git command listing paths, such as check-ignore or
+// ls-files, with -z and returns the paths it printed. stdin, if any, is
+// passed NUL-separated on standard input. Exit code quiet, e.g. 1 for
+// check-ignore when no path is ignored, means an empty list.
+func gitLines(dir string, quiet int, stdin []string, args ...string) ([]string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir, args[0], "-z"}, args[1:]...)...)
+	if stdin != nil {
+		cmd.Stdin = strings.NewReader(strings.Join(stdin, "\x00") + "\x00")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if quiet != 0 && errors.As(err, &exitErr) && exitErr.ExitCode() == quiet {
+			return nil, nil
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	var lines []string
+	for _, line := range strings.Split(stdout.String(), "\x00") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// unstage restores the index entries of paths to HEAD after a failed
+// commit. Errors are ignored, as the commit error is the one to report.
+func unstage(dir string, paths []string) {
+	runGit(dir, append([]string{"reset", "--quiet", "--"}, paths...)...)
+}
+
+// runGit runs git with args in dir and returns its trimmed standard output.
+// Errors include what git printed on standard error.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if msg := strings.TrimSpace(stderr.String()); msg != "" && errors.As(err, &exitErr) {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/danarchy-io/simplate/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+// Values of the graph --format flag.
+const (
+	graphFormatDOT     = "dot"
+	graphFormatMermaid = "mermaid"
+)
+
+var (
+	graphFormat string
+
+	graphCmd = &cobra.Command{
+		Use:   "graph [flags] <template-file>...",
+		Short: "Draw the include graph of templates",
+		Long: `Graph prints the include graph of the given templates in Graphviz DOT or
+Mermaid syntax: an edge leads from every segment and defined template to the
+defined templates it uses with include or {{template}}, labeled with the
+lines of the calls. Each template file is a cluster. Templates that are used
+but not defined are dashed, and the edges of include cycles are red; each
+cycle is also reported as a warning.
+
+  simplate graph deploy.tmpl | dot -Tsvg > deploy.svg`,
+		Args: usageArgs(cobra.MinimumNArgs(1)),
+		RunE: graphRunE,
+	}
+)
+
+func init() {
+	graphCmd.Flags().StringVar(&graphFormat, "format", graphFormatDOT, "Format of the graph: dot or mermaid")
+	rootCmd.AddCommand(graphCmd)
+}
+
+func graphRunE(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("at least one template file must be provided")
+	}
+	if graphFormat != graphFormatDOT && graphFormat != graphFormatMermaid {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --format value %q: must be dot or mermaid", graphFormat))
+	}
+	if cmd != nil {
+		cmd.SilenceUsage = true
+	}
+
+	var graphs []includeGraph
+	for _, templateFile := range args {
+		templateBytes, err := os.ReadFile(templateFile)
+		if err != nil {
+			return fmt.Errorf("failed to read template file '%s': %w", templateFile, err)
+		}
+		metrics, err := template.AnalyzeTemplate(templateFile, templateBytes)
+		if err != nil {
+			return err
+		}
+		graph := newIncludeGraph(templateFile, metrics)
+		for _, cycle := range graph.cycles {
+			fmt.Fprintf(messageOutput(), "warning: include cycle in %s: %s\n", templateFile, strings.Join(cycle, ", "))
+		}
+		graphs = append(graphs, graph)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if graphFormat == graphFormatMermaid {
+		writeMermaid(w, graphs)
+	} else {
+		writeDOT(w, graphs)
+	}
+	return w.Flush()
+}
+
+// includeGraph is the include graph of a template file.
+type includeGraph struct {
+	file   string
+	nodes  []graphNode
+	edges  []graphEdge
+	cycles [][]string
+}
+
+// graphNode is a segment or (possibly undefined) template of an
+// includeGraph.
+type graphNode struct {
+	name      string
+	segment   bool
+	undefined bool
+}
+
+// graphEdge is an edge between the nodes with indexes from and to, for
+// calls on lines.
+type graphEdge struct {
+	from, to int
+	lines    []int
+	cycle    bool
+}
+
+// newIncludeGraph returns the include graph of templateFile from its
+// metrics. Nodes are the defined templates, in order, then the segments and
+// undefined templates, in order of appearance. Edges between the same
+// nodes are merged.
+func newIncludeGraph(templateFile string, metrics *template.TemplateMetrics) includeGraph {
+	g := includeGraph{file: templateFile, cycles: template.IncludeCycles(metrics.Includes)}
+	ids := map[string]int{}
+	node := func(name string, n graphNode) int {
+		if id, ok := ids[name]; ok {
+			return id
+		}
+		n.name = name
+		ids[name] = len(g.nodes)
+		g.nodes = append(g.nodes, n)
+		return ids[name]
+	}
+	for _, name := range metrics.Defines {
+		node(name, graphNode{})
+	}
+	inCycle := map[string]int{}
+	for i, cycle := range g.cycles {
+		for _, name := range cycle {
+			inCycle[name] = i + 1
+		}
+	}
+	edges := map[[2]int]int{}
+	for _, e := range metrics.Includes {
+		from := node(e.From, graphNode{segment: true})
+		to := node(e.To, graphNode{undefined: true})
+		i, ok := edges[[2]int{from, to}]
+		if !ok {
+			i = len(g.edges)
+			edges[[2]int{from, to}] = i
+			cycle := inCycle[e.From] != 0 && inCycle[e.From] == inCycle[e.To]
+			g.edges = append(g.edges, graphEdge{from: from, to: to, cycle: cycle})
+		}
+		g.edges[i].lines = append(g.edges[i].lines, e.Line)
+	}
+	return g
+}
+
+// edgeLabel returns the label of edge: the lines of its calls.
+func edgeLabel(edge graphEdge) string {
+	lines := slices.Compact(slices.Sorted(slices.Values(edge.lines)))
+	words := make([]string, len(lines))
+	for i, line := range lines {
+		words[i] = strconv.Itoa(line)
+	}
+	return strings.Join(words, ", ")
+}
+
+// writeDOT writes graphs as a Graphviz digraph.
+func writeDOT(w io.Writer, graphs []includeGraph) {
+	fmt.Fprintln(w, "digraph simplate {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for i, g := range graphs {
+		fmt.Fprintf(w, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(w, "    label=%s;\n", dotQuote(g.file))
+		for j, n := range g.nodes {
+			var attrs []string
+			if n.segment {
+				attrs = append(attrs, "shape=note")
+			}
+			if n.undefined {
+				attrs = append(attrs, "style=dashed")
+			}
+			fmt.Fprintf(w, "    n%d_%d [%s];\n", i, j, strings.Join(append([]string{"label=" + dotQuote(n.name)}, attrs...), ", "))
+		}
+		fmt.Fprintln(w, "  }")
+		for _, e := range g.edges {
+			attrs := "label=" + dotQuote(edgeLabel(e))
+			if e.cycle {
+				attrs += ", color=red"
+			}
+			fmt.Fprintf(w, "  n%d_%d -> n%d_%d [%s];\n", i, e.from, i, e.to, attrs)
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// dotQuote returns s as a DOT quoted string.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// writeMermaid writes graphs as a Mermaid flowchart.
+func writeMermaid(w io.Writer, graphs []includeGraph) {
+	fmt.Fprintln(w, "flowchart LR")
+	fmt.Fprintln(w, "  classDef undefined stroke-dasharray: 5 5")
+	var undefined []string
+	var cycleLinks []string
+	link := 0
+	for i, g := range graphs {
+		fmt.Fprintf(w, "  subgraph g%d [%s]\n", i, mermaidQuote(g.file))
+		for j, n := range g.nodes {
+			id := fmt.Sprintf("n%d_%d", i, j)
+			if n.segment {
+				// Segments are drawn as parallelograms
+				fmt.Fprintf(w, "    %s[/%s/]\n", id, mermaidQuote(n.name))
+			} else {
+				fmt.Fprintf(w, "    %s[%s]\n", id, mermaidQuote(n.name))
+			}
+			if n.undefined {
+				undefined = append(undefined, id)
+			}
+		}
+		fmt.Fprintln(w, "  end")
+		for _, e := range g.edges {
+			fmt.Fprintf(w, "  n%d_%d -->|%s| n%d_%d\n", i, e.from, mermaidQuote(edgeLabel(e)), i, e.to)
+			if e.cycle {
+				cycleLinks = append(cycleLinks, strconv.Itoa(link))
+			}
+			link++
+		}
+	}
+	if len(undefined) > 0 {
+		fmt.Fprintf(w, "  class %s undefined\n", strings.Join(undefined, ","))
+	}
+	if len(cycleLinks) > 0 {
+		fmt.Fprintf(w, "  linkStyle %s stroke:red\n", strings.Join(cycleLinks, ","))
+	}
+}
+
+// mermaidQuote returns s as a quoted Mermaid label, with quotes as entity
+// codes.
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGraphRunE(t *testing.T) {
+	origFormat, origQuiet := graphFormat, quiet
+	t.Cleanup(func() { graphFormat, quiet = origFormat, origQuiet })
+	quiet = true
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "app.tmpl")
+	tmpl := "{{ define \"a\" }}{{ include \"b\" . }}{{ end }}{{ define \"b\" }}{{ template \"a\" . }}{{ end }}\n" +
+		"#FILE:say \"hi\".txt#\n{{ include \"a\" . }}{{ include \"a\" . }}\n{{ include \"a\" . }}{{ include \"nope\" . }}\n#FILE#\n"
+	if err := os.WriteFile(tmplFile, []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		format  string
+		wantErr string
+		wantOut []string
+	}{
+		{name: "dot", format: "dot", wantOut: []string{
+			`label="` + tmplFile + `";`,
+			`n0_2 [label="FILE say \"hi\".txt", shape=note];`,
+			`n0_3 [label="nope", style=dashed];`,
+			`n0_2 -> n0_0 [label="3, 4"];`,
+			`n0_0 -> n0_1 [label="1", color=red];`,
+		}},
+		{name: "mermaid", format: "mermaid", wantOut: []string{
+			`n0_2[/"FILE say #quot;hi#quot;.txt"/]`,
+			`n0_2 -->|"3, 4"| n0_0`,
+			"class n0_3 undefined",
+			"linkStyle 2,3 stroke:red",
+		}},
+		{name: "invalid format", format: "svg", wantErr: "invalid --format"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			graphFormat = tc.format
+
+			// capture stdout
+			origStdout := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			err := graphRunE(nil, []string{tmplFile})
+			w.Close()
+			out, _ := io.ReadAll(r)
+			os.Stdout = origStdout
+
+			if tc.wantErr != "" {
+				if err == nil || !bytes.Contains([]byte(err.Error()), []byte(tc.wantErr)) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, want := range tc.wantOut {
+				if !bytes.Contains(out, []byte(want)) {
+					t.Errorf("output does not contain %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
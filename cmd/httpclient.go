@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+var (
+	caFile             string
+	insecureSkipVerify bool
+)
+
+// newHTTPClient returns the client of the httpGet and httpGetJSON functions.
+// It honors HTTPS_PROXY and NO_PROXY and uses the TLS settings of the
+// --ca-file and --insecure-skip-verify flags.
+func newHTTPClient() (*http.Client, error) {
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// newTLSConfig returns the TLS configuration for --ca-file and
+// --insecure-skip-verify, nil for the system defaults.
+func newTLSConfig() (*tls.Config, error) {
+	if insecureSkipVerify {
+		fmt.Fprintln(messageOutput(), "warning: --insecure-skip-verify disables TLS certificate verification: responses of remote sources can be forged by anyone on the network path")
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+	if caFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file '%v': %w", caFile, err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, withExitCode(ExitUsage, fmt.Errorf("invalid CA file '%v': no PEM certificates found", caFile))
+	}
+	return &tls.Config{RootCAs: pool}, nil
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewHTTPClient_TLS(t *testing.T) {
+	origCAFile, origInsecure, origQuiet := caFile, insecureSkipVerify, quiet
+	t.Cleanup(func() {
+		caFile, insecureSkipVerify, quiet = origCAFile, origInsecure, origQuiet
+	})
+	quiet = true
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // Rejected handshakes are expected
+	server.StartTLS()
+	defer server.Close()
+	get := func() error {
+		client, err := newHTTPClient()
+		if err != nil {
+			t.Fatalf("newHTTPClient returned error: %v", err)
+		}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caPath, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	caFile, insecureSkipVerify = "", false
+	if err := get(); err == nil {
+		t.Error("expected the test server certificate to be rejected by default")
+	}
+	caFile = caPath
+	if err := get(); err != nil {
+		t.Errorf("expected --ca-file to trust the test server: %v", err)
+	}
+	caFile, insecureSkipVerify = "", true
+	if err := get(); err != nil {
+		t.Errorf("expected --insecure-skip-verify to accept the test server: %v", err)
+	}
+
+	caFile = caPath
+	if err := checkFlagConflicts(); err == nil || err.Error() != "--ca-file cannot be used with --insecure-skip-verify" {
+		t.Errorf("expected a conflict error, got %v", err)
+	}
+
+	caFile, insecureSkipVerify = filepath.Join(dir, "empty.pem"), false
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newHTTPClient(); ExitCode(err) != ExitUsage {
+		t.Errorf("expected a usage error for a CA file without certificates, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Values of the --log-format flag.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+var (
+	quiet     bool
+	verbose   bool
+	logFormat string
+)
+
+// checkLogFlags validates the --quiet, --verbose and --log-format flags.
+func checkLogFlags() error {
+	if quiet && verbose {
+		return fmt.Errorf("--quiet and --verbose cannot be used together")
+	}
+	switch logFormat {
+	case logFormatText, logFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid --log-format value %q: must be text or json", logFormat)
+	}
+}
+
+// newLogger returns the logger for --verbose, writing to w in the
+// --log-format format. Without --verbose nothing is logged.
+func newLogger(w io.Writer) *slog.Logger {
+	if !verbose {
+		return slog.New(slog.DiscardHandler)
+	}
+	handlerOpts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	if logFormat == logFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, handlerOpts))
+	}
+	return slog.New(slog.NewTextHandler(w, handlerOpts))
+}
+
+// messageOutput returns where informational messages and warnings go:
+// stderr, or nowhere with --quiet.
+func messageOutput() io.Writer {
+	if quiet {
+		return io.Discard
+	}
+	return os.Stderr
+}
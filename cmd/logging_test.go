@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCheckLogFlags(t *testing.T) {
+	origQuiet, origVerbose, origFormat := quiet, verbose, logFormat
+	t.Cleanup(func() { quiet, verbose, logFormat = origQuiet, origVerbose, origFormat })
+
+	cases := []struct {
+		quiet, verbose bool
+		format         string
+		wantErr        string
+	}{
+		{format: "text"},
+		{verbose: true, format: "json"},
+		{quiet: true, format: "text"},
+		{quiet: true, verbose: true, format: "text", wantErr: "cannot be used together"},
+		{format: "xml", wantErr: "invalid --log-format"},
+	}
+	for _, tc := range cases {
+		quiet, verbose, logFormat = tc.quiet, tc.verbose, tc.format
+		err := checkLogFlags()
+		if tc.wantErr == "" && err != nil {
+			t.Errorf("%+v: unexpected error %v", tc, err)
+		}
+		if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("%+v: expected error containing %q, got %v", tc, tc.wantErr, err)
+		}
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	origVerbose, origFormat := verbose, logFormat
+	t.Cleanup(func() { verbose, logFormat = origVerbose, origFormat })
+
+	var buf bytes.Buffer
+	verbose, logFormat = false, logFormatText
+	newLogger(&buf).Info("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("expected no logs without --verbose, got %q", buf.String())
+	}
+
+	verbose, logFormat = true, logFormatJSON
+	newLogger(&buf).Debug("file written", "path", "a.txt", "bytes", 3)
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log is not JSON: %v\n%s", err, buf.String())
+	}
+	if entry["msg"] != "file written" || entry["path"] != "a.txt" || entry["bytes"] != float64(3) {
+		t.Errorf("unexpected log entry %v", entry)
+	}
+}
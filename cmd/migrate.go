@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/danarchy-io/simplate/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateFromSchema string
+	migrateToSchema   string
+	migrateWrite      bool
+
+	migrateCmd = &cobra.Command{
+		Use:   "migrate [flags] <input-file | ->",
+		Short: "Upgrade a data file to a new schema version",
+		Long: `Migrate upgrades a YAML data file written for one JSON Schema to another.
+The data is validated against the --from schema, the moves declared in the
+--to schema under "` + template.MigrationsKeyword + `" are applied, missing
+properties with a default in the --to schema are added, and the result is
+validated against the --to schema. Comments and key order are preserved.
+
+The migrated data is printed to stdout, or written back to the input file
+with --write.`,
+		Args: usageArgs(cobra.ExactArgs(1)),
+		RunE: migrateRunE,
+	}
+)
+
+func init() {
+	migrateCmd.Flags().StringVar(&migrateFromSchema, "from", "", "JSON Schema the data currently conforms to")
+	migrateCmd.Flags().StringVar(&migrateToSchema, "to", "", "JSON Schema to migrate the data to (required)")
+	migrateCmd.Flags().BoolVarP(&migrateWrite, "write", "w", false, "Write the migrated data back to the input file")
+	rootCmd.AddCommand(migrateCmd)
+}
+
+func migrateRunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one input file must be provided")
+	}
+	if migrateToSchema == "" {
+		return withExitCode(ExitUsage, fmt.Errorf("no target schema provided. Use the --to flag"))
+	}
+	inputFile := args[0]
+	if migrateWrite && inputFile == "-" {
+		return withExitCode(ExitUsage, fmt.Errorf("--write cannot be used when reading from stdin"))
+	}
+	if cmd != nil {
+		cmd.SilenceUsage = true
+	}
+
+	var dataBytes []byte
+	var err error
+	if inputFile == "-" {
+		dataBytes, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return withExitCode(ExitData, fmt.Errorf("failed to read data from stdin: %w", err))
+		}
+	} else {
+		dataBytes, err = os.ReadFile(inputFile)
+		if err != nil {
+			return withExitCode(ExitData, fmt.Errorf("failed to read YAML data from file '%s': %w", inputFile, err))
+		}
+	}
+
+	var fromBytes []byte
+	if migrateFromSchema != "" {
+		fromBytes, err = os.ReadFile(migrateFromSchema)
+		if err != nil {
+			return fmt.Errorf("failed to read schema file '%v': %w", migrateFromSchema, err)
+		}
+	}
+	toBytes, err := os.ReadFile(migrateToSchema)
+	if err != nil {
+		return fmt.Errorf("failed to read schema file '%v': %w", migrateToSchema, err)
+	}
+
+	migrated, err := template.MigrateYAML(dataBytes, fromBytes, toBytes)
+	if err != nil {
+		return fmt.Errorf("%s cannot be migrated: %w", inputFile, err)
+	}
+
+	if migrateWrite {
+		info, err := os.Stat(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to stat '%s': %w", inputFile, err)
+		}
+		if err := os.WriteFile(inputFile, migrated, info.Mode().Perm()); err != nil {
+			return withExitCode(ExitWrite, fmt.Errorf("failed to write migrated data to '%s': %w", inputFile, err))
+		}
+		return nil
+	}
+	_, err = os.Stdout.Write(migrated)
+	return err
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	migrateTestFromSchema = `{
+	"type":"object",
+	"properties":{"name":{"type":"string"}},
+	"required":["name"]
+}`
+	migrateTestToSchema = `{
+	"x-simplate-migrations":[{"from":"name","to":"app.name"}],
+	"type":"object",
+	"properties":{
+		"app":{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]},
+		"port":{"type":"integer","default":8080}
+	},
+	"required":["app","port"]
+}`
+)
+
+func TestMigrateRunE(t *testing.T) {
+	origFrom, origTo, origWrite := migrateFromSchema, migrateToSchema, migrateWrite
+	t.Cleanup(func() { migrateFromSchema, migrateToSchema, migrateWrite = origFrom, origTo, origWrite })
+
+	dir := t.TempDir()
+	fromFile := filepath.Join(dir, "v1.json")
+	toFile := filepath.Join(dir, "v2.json")
+	if err := os.WriteFile(fromFile, []byte(migrateTestFromSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(toFile, []byte(migrateTestToSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	const want = "app:\n  # service\n  name: api\nport: 8080\n"
+
+	cases := []struct {
+		name     string
+		data     string
+		from     string
+		to       string
+		write    bool
+		wantErr  []string
+		wantOut  string
+		wantFile string
+	}{
+		{name: "prints migrated data", data: "# service\nname: api\n", from: fromFile, to: toFile, wantOut: want, wantFile: "# service\nname: api\n"},
+		{name: "writes in place", data: "# service\nname: api\n", from: fromFile, to: toFile, write: true, wantFile: want},
+		{name: "without source schema", data: "# service\nname: api\n", to: toFile, wantOut: want},
+		{name: "invalid source data", data: "name: 42\n", from: fromFile, to: toFile, wantErr: []string{"cannot be migrated", ".name: expected string"}},
+		{name: "invalid result", data: "other: x\n", to: toFile, wantErr: []string{"cannot be migrated", "app"}},
+		{name: "no target schema", data: "name: api\n", wantErr: []string{"no target schema provided"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			migrateFromSchema, migrateToSchema, migrateWrite = tc.from, tc.to, tc.write
+			dataFile := filepath.Join(t.TempDir(), "data.yml")
+			if err := os.WriteFile(dataFile, []byte(tc.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// capture stdout
+			origStdout := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			err := migrateRunE(nil, []string{dataFile})
+			w.Close()
+			out, _ := io.ReadAll(r)
+			os.Stdout = origStdout
+
+			if len(tc.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("expected error containing %q, got nil", tc.wantErr)
+				}
+				for _, want := range tc.wantErr {
+					if !bytes.Contains([]byte(err.Error()), []byte(want)) {
+						t.Errorf("error %q does not contain %q", err.Error(), want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(out) != tc.wantOut {
+				t.Errorf("output = %q, want %q", out, tc.wantOut)
+			}
+			if tc.wantFile != "" {
+				got, err := os.ReadFile(dataFile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tc.wantFile {
+					t.Errorf("file = %q, want %q", got, tc.wantFile)
+				}
+			}
+		})
+	}
+}
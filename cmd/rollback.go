@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/danarchy-io/simplate/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+// historyDirName is the directory inside the output directory in which
+// --history records runs.
+const historyDirName = ".simplate"
+
+var (
+	rollbackOutputDir string
+	rollbackList      bool
+
+	rollbackCmd = &cobra.Command{
+		Use:   "rollback [flags] [run-id]",
+		Short: "Restore the files generated by a previous run",
+		Long: `Rollback restores the files written by a run recorded with --history to the
+content they had after that run. Without a run ID, the run before the most
+recent one is restored, undoing the last run. The rollback is recorded as a
+new run itself, so it can be undone the same way.`,
+		Args: usageArgs(cobra.MaximumNArgs(1)),
+		RunE: rollbackRunE,
+	}
+)
+
+func init() {
+	rollbackCmd.Flags().StringVarP(&rollbackOutputDir, "output-dir", "o", "", "Output directory the runs were generated in (default: current directory)")
+	rollbackCmd.Flags().BoolVar(&rollbackList, "list", false, "List the recorded runs instead of restoring one")
+	rootCmd.AddCommand(rollbackCmd)
+}
+
+// historyFor returns the run history kept in the given output directory.
+func historyFor(outputDir string) *template.History {
+	return &template.History{Dir: filepath.Join(outputDir, historyDirName)}
+}
+
+func rollbackRunE(cmd *cobra.Command, args []string) error {
+	if cmd != nil {
+		cmd.SilenceUsage = true
+	}
+
+	history := historyFor(rollbackOutputDir)
+	runs, err := history.Runs()
+	if err != nil {
+		return err
+	}
+
+	if rollbackList {
+		for _, run := range runs {
+			fmt.Fprintf(os.Stdout, "%s\t%s\t%d files\n", run.ID, run.Time.Local().Format("2006-01-02 15:04:05"), len(run.Files))
+		}
+		return nil
+	}
+
+	var id string
+	if len(args) == 1 {
+		id = args[0]
+	} else {
+		if len(runs) < 2 {
+			return fmt.Errorf("no previous run to roll back to in %s", history.Dir)
+		}
+		id = runs[len(runs)-2].ID
+	}
+
+	fileWriter := &template.DefaultFileWriter{}
+	if rollbackOutputDir != "" {
+		if err := fileWriter.SetBaseDir(rollbackOutputDir); err != nil {
+			return fmt.Errorf("invalid output directory: %w", err)
+		}
+	}
+	recorder := history.Recorder(fileWriter)
+	manifest, err := history.Rollback(id, recorder)
+	if err != nil {
+		return err
+	}
+	if _, err := recorder.Save(); err != nil {
+		return err
+	}
+
+	if !quiet {
+		fmt.Fprintf(os.Stdout, "restored %d files from run %s\n", len(manifest.Files), manifest.ID)
+	}
+	return nil
+}
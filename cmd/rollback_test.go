@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRollbackRunE(t *testing.T) {
+	origContent, origOutputDir, origHistory := inputContent, outputDir, recordHistory
+	origRollbackDir, origList := rollbackOutputDir, rollbackList
+	t.Cleanup(func() {
+		inputContent, outputDir, recordHistory = origContent, origOutputDir, origHistory
+		rollbackOutputDir, rollbackList = origRollbackDir, origList
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:app.conf#\nversion={{.version}}\n#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputDir = filepath.Join(dir, "out")
+	recordHistory = true
+	rollbackOutputDir = outputDir
+	rollbackList = false
+
+	readConf := func() string {
+		content, err := os.ReadFile(filepath.Join(outputDir, "app.conf"))
+		if err != nil {
+			t.Fatalf("failed to read app.conf: %v", err)
+		}
+		return string(content)
+	}
+
+	// Nothing to roll back to yet
+	if err := rollbackRunE(nil, nil); err == nil {
+		t.Error("expected error without history")
+	}
+
+	for _, version := range []string{"1", "2"} {
+		inputContent = "version: " + version
+		if err := runE(nil, []string{tmplFile}); err != nil {
+			t.Fatalf("runE returned error: %v", err)
+		}
+	}
+	if got := readConf(); got != "\nversion=2\n" {
+		t.Fatalf("unexpected app.conf %q", got)
+	}
+
+	if err := rollbackRunE(nil, nil); err != nil {
+		t.Fatalf("rollbackRunE returned error: %v", err)
+	}
+	if got := readConf(); got != "\nversion=1\n" {
+		t.Errorf("expected version 1 after rollback, got %q", got)
+	}
+
+	// The rollback is itself a run, so rolling back again restores version 2
+	if err := rollbackRunE(nil, nil); err != nil {
+		t.Fatalf("rollbackRunE returned error: %v", err)
+	}
+	if got := readConf(); got != "\nversion=2\n" {
+		t.Errorf("expected version 2 after undoing the rollback, got %q", got)
+	}
+
+	if err := rollbackRunE(nil, []string{"unknown"}); err == nil {
+		t.Error("expected error for unknown run ID")
+	}
+}
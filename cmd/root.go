@@ -1,9 +1,24 @@
 package cmd
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/danarchy-io/simplate/pkg/template"
 	"github.com/spf13/cobra"
@@ -12,7 +27,66 @@ import (
 var (
 	inputContent    string
 	inputSchemaFile string
+	lintSchemaFile  string
+	keyFiles        []string
 	outputDir       string
+	outputFile      string
+	fromEnvPrefix   string
+	envSeparator    string
+	envFile         string
+	exportEnvFile   bool
+	httpAllowHosts  []string
+	fsReadDirs      []string
+	envAllowlist    []string
+	pluginPaths     []string
+	wasmPlugins     []string
+	httpTimeout     time.Duration
+	enableDNS       bool
+	dnsTimeout      time.Duration
+	enableCloud     bool
+	onFuncError     string
+	funcTimeouts    map[string]string
+	funcDefaults    map[string]string
+	noClobber       bool
+	skipEmpty       bool
+	ensureNewline   bool
+	stripTrailingWS bool
+	stripBOM        bool
+	editorConfig    bool
+	formatOutput    bool
+	checkOutput     bool
+	checkShell      bool
+	htmlEscaping    bool
+	strictPathsCase bool
+	checkPortable   bool
+	noPreserve      bool
+	skipUnchanged   bool
+	backupSuffix    string
+	symlinkPolicy   string
+	dirMode         string
+	fileMode        string
+	dedup           bool
+	signKeyFile     string
+	attestationFile string
+	manifestPath    string
+	gitignoreFile   string
+	gitattrsFile    string
+	gitCommit       bool
+	commitMessage   string
+	gitSign         bool
+	prPayloadFile   string
+	prune           bool
+	outputArchive   string
+	frozenTime      string
+	sandbox         bool
+	datasources     map[string]string
+	compat          []string
+	storeDir        string
+	recordHistory   bool
+	parallel        int
+	segmentTimeout  time.Duration
+	keepGoing       bool
+	errorFormat     string
 	appVersion      = "dev"
 
 	rootCmd = &cobra.Command{
@@ -21,8 +95,10 @@ var (
 		Long: `Simplate CLI is a straightforward template engine. It takes a template
 file and a YAML data file as input, then uses the data to fill in your
 template and produce the final output.`,
-		Args: cobra.RangeArgs(1, 2),
+		Args: usageArgs(cobra.MaximumNArgs(2)),
 		RunE: runE,
+
+		PersistentPreRunE: persistentPreRunE,
 	}
 
 	versionCmd = &cobra.Command{
@@ -36,14 +112,242 @@ template and produce the final output.`,
 
 func init() {
 
+	rootCmd.PersistentFlags().StringVar(&errorFormat, "error-format", errorFormatText, "Format of error messages on stderr: text or json")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Suppress warnings and informational messages")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log each step (data source, validation, segments, files written) to stderr")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logFormatText, "Format of --verbose logs: text or json")
 	rootCmd.Flags().StringVarP(&inputContent, "input-content", "c", "", "Input content")
 	rootCmd.Flags().StringVarP(&inputSchemaFile, "input-schema-file", "s", "", "Input jsonschema file")
+	rootCmd.Flags().StringArrayVar(&keyFiles, "key-file", nil, "File holding the key of the encrypted values (!vault or ENC[...]) of the data, as path or id=path for values with a key ID (repeatable)")
+	rootCmd.Flags().StringVar(&lintSchemaFile, "lint-schema", "", "JSON Schema whose violations are printed as warnings without failing")
 	rootCmd.Flags().StringVarP(&outputDir, "output-dir", "o", "", "Output directory for FILE directives (default: current directory)")
+	rootCmd.Flags().StringVar(&outputFile, "output", "", "Write content outside FILE directives to this file (atomically) instead of stdout")
+	rootCmd.Flags().BoolVar(&noClobber, "no-clobber", false, "Do not overwrite files that already exist")
+	rootCmd.Flags().BoolVar(&skipEmpty, "skip-empty", false, "Do not create files whose rendered content is empty or whitespace only")
+	rootCmd.Flags().BoolVar(&ensureNewline, "ensure-trailing-newline", false, "End every generated file that is not empty with a newline")
+	rootCmd.Flags().BoolVar(&stripTrailingWS, "strip-trailing-whitespace", false, "Remove spaces and tabs at the end of every line of generated files")
+	rootCmd.Flags().BoolVar(&stripBOM, "strip-bom", false, "Remove a UTF-8 byte order mark at the start of generated files")
+	rootCmd.Flags().BoolVar(&htmlEscaping, "html", false, "Render with html/template, escaping values according to their HTML, URL, JavaScript or CSS context")
+	rootCmd.Flags().BoolVar(&formatOutput, "format-output", false, "Format generated .go, .json, .yaml and .yml files canonically")
+	rootCmd.Flags().BoolVar(&checkOutput, "check-output", false, "Fail the run if a generated .json, .yaml, .yml or .toml file does not parse")
+	rootCmd.Flags().BoolVar(&checkShell, "check-shell", false, "With --check-output, also check the syntax of generated .sh and .bash files with sh -n and bash -n")
+	rootCmd.Flags().BoolVar(&editorConfig, "editorconfig", false, "Normalize generated files according to the .editorconfig files of the output directory and its parents")
+	rootCmd.Flags().BoolVar(&skipUnchanged, "skip-unchanged", false, "Leave files that already have the generated content and mode untouched, keeping their modification time")
+	rootCmd.Flags().StringVar(&backupSuffix, "backup", "", "Keep the previous version of overwritten files as <file>~, <file><suffix> with --backup=<suffix>, or <file>.<time>~ with --backup=timestamp")
+	rootCmd.Flags().Lookup("backup").NoOptDefVal = "~"
+	rootCmd.Flags().BoolVar(&noPreserve, "no-preserve-metadata", false, "Replace overwritten files without keeping their mode, owner and extended attributes")
+	rootCmd.Flags().StringVar(&fileMode, "file-mode", "", "Octal permissions of generated files without a mode in their FILE directive, e.g. 0600 (default 0644 for new files, overwritten files keep theirs)")
+	rootCmd.Flags().StringVar(&dirMode, "dir-mode", "0755", "Octal permissions of the directories created for generated files, e.g. 0750 (the umask applies)")
+	rootCmd.Flags().StringVar(&symlinkPolicy, "symlinks", string(template.SymlinkRefuse), "How to treat existing symbolic links at or above generated files: refuse, replace (the link, not its target) or follow")
+	rootCmd.Flags().StringVar(&signKeyFile, "sign-key", "", "Write a detached signature <file>"+template.SignatureExtension+" for every generated file using this Ed25519 private key (PEM)")
+	rootCmd.Flags().StringVar(&outputArchive, "output-archive", "", "Write the generated files to a .tar, .tar.gz, .tgz or .zip archive instead of the output directory")
+	rootCmd.Flags().StringVar(&attestationFile, "attestation", "", "Write an in-toto attestation (SLSA provenance) of the generated files and their inputs to this file")
+	rootCmd.Flags().StringVar(&manifestPath, "manifest", "", "Write a manifest of the generated files (path, size, sha256, source segment) to this file, as YAML for .yaml/.yml and JSON otherwise")
+	rootCmd.Flags().StringVar(&gitignoreFile, "gitignore", "", "Append the paths of generated files missing from this .gitignore file to it")
+	rootCmd.Flags().StringVar(&gitattrsFile, "gitattributes", "", "Mark the paths of generated files as linguist-generated in this .gitattributes file")
+	rootCmd.Flags().BoolVar(&gitCommit, "git-commit", false, "After a successful run, stage exactly the generated files and commit them in the enclosing git work tree")
+	rootCmd.Flags().StringVarP(&commitMessage, "message", "m", defaultCommitMessage, "Message of the --git-commit commit and title of the --pr-payload pull request")
+	rootCmd.Flags().BoolVar(&gitSign, "git-sign", false, "GPG-sign the --git-commit commit")
+	rootCmd.Flags().StringVar(&prPayloadFile, "pr-payload", "", "Write the changed files, their diffs and a run report to this JSON file for opening a pull request through the GitHub or GitLab API")
+	rootCmd.Flags().BoolVar(&prune, "prune", false, "Delete files listed in the previous --manifest that the template no longer generates (unless they were modified)")
+	rootCmd.Flags().BoolVar(&dedup, "dedup", false, "Hard link generated files with identical content and mode instead of writing copies")
+	rootCmd.Flags().StringVar(&storeDir, "store", "", "Keep generated files in a content-addressed store in this directory and hard link outputs to it")
+	rootCmd.Flags().BoolVar(&recordHistory, "history", false, "Record the generated files in "+historyDirName+"/ inside the output directory so that the run can be rolled back")
+	rootCmd.Flags().BoolVar(&keepGoing, "keep-going", false, "Render every segment even after failures and report all errors together (nothing is written)")
+	rootCmd.Flags().DurationVar(&segmentTimeout, "segment-timeout", 0, "Abort rendering a segment (filename and content) and its running network and plugin calls after this duration, e.g. 10s (0 = no limit)")
+	rootCmd.Flags().IntVar(&parallel, "parallel", 1, "Render and write FILE segments using up to N workers (0 = one per CPU)")
+	rootCmd.Flags().BoolVar(&checkPortable, "check-portability", false, "Fail if a generated path is not usable on Windows (too long, invalid characters, trailing dots or spaces, reserved names)")
+	rootCmd.Flags().BoolVar(&strictPathsCase, "strict-paths-case", false, "Fail instead of warning when output paths differ only in letter case")
+	rootCmd.Flags().StringVar(&fromEnvPrefix, "from-env", "", "Build input data from environment variables starting with this prefix")
+	rootCmd.Flags().StringVar(&envSeparator, "env-separator", "_", "Nesting separator for --from-env variable names")
+	rootCmd.Flags().StringVar(&envFile, "env-file", "", "Read input data from a dotenv file")
+	rootCmd.Flags().BoolVar(&exportEnvFile, "export-env", false, "Also export --env-file variables to the process environment for the env function")
+	rootCmd.Flags().StringSliceVar(&httpAllowHosts, "allow-http-host", nil, "Enable httpGet/httpGetJSON for the given hosts (repeatable, supports *.domain)")
+	rootCmd.Flags().DurationVar(&httpTimeout, "http-timeout", 10*time.Second, "Timeout for each httpGet/httpGetJSON request")
+	rootCmd.Flags().StringVar(&caFile, "ca-file", "", "Also trust the CA certificates (PEM) in this file for httpGet/httpGetJSON requests, e.g. behind a TLS-intercepting proxy")
+	rootCmd.Flags().BoolVar(&insecureSkipVerify, "insecure-skip-verify", false, "Do not verify TLS certificates of httpGet/httpGetJSON requests (insecure)")
+	rootCmd.Flags().StringSliceVar(&envAllowlist, "allow-env", nil, "Restrict env and envOrDefault to these variables (repeatable, supports PREFIX_*)")
+	rootCmd.Flags().StringSliceVar(&fsReadDirs, "allow-fs-read", nil, "Enable readFile for files in the given directories (repeatable)")
+	rootCmd.Flags().StringSliceVar(&pluginPaths, "plugin", nil, "Register the template functions of a plugin executable speaking the JSON-over-stdio protocol (repeatable)")
+	rootCmd.Flags().StringSliceVar(&wasmPlugins, "wasm-plugin", nil, "Register the template functions of a WebAssembly plugin, given by its manifest (repeatable)")
+	rootCmd.Flags().StringToStringVar(&datasources, "datasource", nil, "Enable the gomplate datasource, ds and datasourceExists functions for a file or directory, e.g. config=config.yaml (repeatable)")
+	rootCmd.Flags().StringSliceVar(&compat, "compat", nil, "Enable compatibility functions for templates written for other tools: gomplate or ytt (repeatable)")
+	rootCmd.Flags().BoolVar(&sandbox, "sandbox", false, "Render untrusted templates: remove the env, envOrDefault, readFile, datasource and ds functions and all network and plugin functions")
+	rootCmd.Flags().StringVar(&frozenTime, "frozen-time", "", "Make the now and date functions use this fixed time (RFC 3339, e.g. 2024-01-02T15:04:05Z) for reproducible output")
+	rootCmd.Flags().BoolVar(&enableDNS, "enable-dns", false, "Enable the dnsA, dnsCNAME and dnsTXT template functions")
+	rootCmd.Flags().DurationVar(&dnsTimeout, "dns-timeout", 5*time.Second, "Timeout for each DNS lookup")
+	rootCmd.Flags().BoolVar(&enableCloud, "enable-cloud-metadata", false, "Enable the cloudProvider, instanceID, region, zone and tags template functions (AWS/GCP)")
+	rootCmd.Flags().StringVar(&onFuncError, "on-function-error", "fail", "Behavior when a blocking function (httpGet, dns*, cloud metadata) fails: fail, empty or default")
+	rootCmd.Flags().StringToStringVar(&funcTimeouts, "function-timeout", nil, "Per-function timeout, e.g. httpGet=2s (repeatable)")
+	rootCmd.Flags().StringToStringVar(&funcDefaults, "function-default", nil, "Per-function fallback value for --on-function-error=default, e.g. dnsCNAME=localhost (repeatable)")
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.SetFlagErrorFunc(flagError)
+	registerFlagAliases(rootCmd)
+}
+
+// flagUse is a flag and whether it was set.
+type flagUse struct {
+	flag string
+	set  bool
+}
+
+// checkFlagConflicts rejects flags that have no effect together with
+// --sandbox or --output-archive, since they would silently be ignored.
+func checkFlagConflicts() error {
+	if sandbox {
+		err := rejectFlags("--sandbox", []flagUse{
+			{"--allow-env", len(envAllowlist) > 0},
+			{"--allow-fs-read", len(fsReadDirs) > 0},
+			{"--allow-http-host", len(httpAllowHosts) > 0},
+			{"--datasource", len(datasources) > 0},
+			{"--enable-dns", enableDNS},
+			{"--enable-cloud-metadata", enableCloud},
+			{"--plugin", len(pluginPaths) > 0},
+			{"--wasm-plugin", len(wasmPlugins) > 0},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if outputArchive != "" {
+		err := rejectFlags("--output-archive", []flagUse{
+			{"--store", storeDir != ""},
+			{"--history", recordHistory},
+			{"--dedup", dedup},
+			{"--prune", prune},
+			{"--backup", backupSuffix != ""},
+			{"--gitignore", gitignoreFile != ""},
+			{"--gitattributes", gitattrsFile != ""},
+			{"--git-commit", gitCommit},
+			{"--pr-payload", prPayloadFile != ""},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if insecureSkipVerify {
+		if err := rejectFlags("--insecure-skip-verify", []flagUse{{"--ca-file", caFile != ""}}); err != nil {
+			return err
+		}
+	}
+	if storeDir != "" {
+		err := rejectFlags("--store", []flagUse{
+			{"--skip-unchanged", skipUnchanged},
+			{"--backup", backupSuffix != ""},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(keyFiles) > 0 {
+		// Only YAML data holds encrypted values
+		err := rejectFlags("--key-file", []flagUse{
+			{"--from-env", fromEnvPrefix != ""},
+			{"--env-file", envFile != ""},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if prune && manifestPath == "" {
+		return fmt.Errorf("--prune requires --manifest")
+	}
+	if checkShell && !checkOutput {
+		return fmt.Errorf("--check-shell requires --check-output")
+	}
+	if !gitCommit && gitSign {
+		return fmt.Errorf("--git-sign requires --git-commit")
+	}
+	if !gitCommit && prPayloadFile == "" && commitMessage != defaultCommitMessage {
+		return fmt.Errorf("--message requires --git-commit or --pr-payload")
+	}
+	return nil
+}
+
+// rejectFlags returns an error naming the first of uses that is set.
+func rejectFlags(flag string, uses []flagUse) error {
+	for _, u := range uses {
+		if u.set {
+			return fmt.Errorf("%s cannot be used with %s", u.flag, flag)
+		}
+	}
+	return nil
+}
+
+// parseMode parses the octal value s of the permission flag named flag,
+// such as --dir-mode.
+func parseMode(flag, s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("invalid %s value %q: expected octal permissions such as 0750", flag, s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// compatOptions returns the options enabling the --compat function sets
+// and the --datasource datasources.
+func compatOptions() ([]template.Option, error) {
+	var gomplate, ytt bool
+	for _, c := range compat {
+		switch c {
+		case "gomplate":
+			gomplate = true
+		case "ytt":
+			ytt = true
+		default:
+			return nil, fmt.Errorf("invalid --compat value %q: must be gomplate or ytt", c)
+		}
+	}
+	var opts []template.Option
+	if gomplate || len(datasources) > 0 {
+		opts = append(opts, template.WithGomplateFuncs(template.GomplateConfig{Datasources: datasources}))
+	}
+	if ytt {
+		opts = append(opts, template.WithOverlayFuncs())
+	}
+	return opts, nil
+}
+
+// archiveWriter is a FileWriter that produces an archive when closed.
+type archiveWriter interface {
+	template.FileWriter
+	Close() error
+}
+
+// newArchiveWriter returns the writer for the --output-archive file path,
+// chosen by its extension, that writes the archive to out. A non-zero
+// modTime is recorded for every file; fileMode and dirMode are the modes of
+// the file and directory entries, 0 for the defaults.
+func newArchiveWriter(path string, out io.Writer, modTime time.Time, fileMode, dirMode os.FileMode) (archiveWriter, error) {
+	name := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(name, ".tar"), strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		w := template.NewTarFileWriter(out)
+		w.Gzip = !strings.HasSuffix(name, ".tar")
+		w.ModTime, w.FileMode, w.DirMode = modTime, fileMode, dirMode
+		return w, nil
+	case strings.HasSuffix(name, ".zip"):
+		w := template.NewZipFileWriter(out)
+		w.ModTime, w.FileMode, w.DirMode = modTime, fileMode, dirMode
+		return w, nil
+	}
+	return nil, fmt.Errorf("unsupported --output-archive format %q: use .tar, .tar.gz, .tgz or .zip", path)
+}
+
+// persistentPreRunE validates the flags shared by all commands.
+func persistentPreRunE(cmd *cobra.Command, args []string) error {
+	if err := checkErrorFormat(cmd, args); err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	return withExitCode(ExitUsage, checkLogFlags())
 }
 
 func Execute() error {
-	return rootCmd.Execute()
+	err := rootCmd.Execute()
+	if err != nil && jsonErrors {
+		printJSONError(os.Stderr, err)
+	}
+	return err
 }
 
 func SetVersion(v string) {
@@ -52,81 +356,599 @@ func SetVersion(v string) {
 
 func runE(cmd *cobra.Command, args []string) error {
 
+	args, err := aliasArgs(args)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
 	if len(args) < 1 {
-		return fmt.Errorf("no template file provided")
+		return withExitCode(ExitUsage, fmt.Errorf("no template file provided"))
 	}
 	if len(args) > 2 {
-		return fmt.Errorf("too many arguments provided")
+		return withExitCode(ExitUsage, fmt.Errorf("too many arguments provided"))
+	}
+	if err := checkFlagConflicts(); err != nil {
+		return withExitCode(ExitUsage, err)
 	}
 
 	templateFile := args[0] // Template file is the first required arg
+	logger := newLogger(os.Stderr)
+	started := time.Now()
+
+	// Inputs of the run, recorded with --attestation
+	var inputs []template.AttestationInput
 
 	// --- Determine Input Source ---
+	var provider template.InputProvider
 	var dataBytes []byte
-	var err error
 	var inputSourceType string // For better logging messages
 
 	// 1. Highest priority: --content flag
 	if inputContent != "" {
 		dataBytes = []byte(inputContent)
 		inputSourceType = "content flag"
+	} else if fromEnvPrefix != "" {
+		// 2. Next priority: --from-env flag
+		provider = template.EnvProvider(fromEnvPrefix, envSeparator)
+		inputSourceType = "environment"
+	} else if envFile != "" {
+		// 3. Next priority: --env-file flag
+		envBytes, err := os.ReadFile(envFile)
+		if err != nil {
+			return withExitCode(ExitData, fmt.Errorf("failed to read env file '%s': %w", envFile, err))
+		}
+		if exportEnvFile {
+			vars, err := template.ParseDotenv(envBytes)
+			if err != nil {
+				return withExitCode(ExitData, fmt.Errorf("failed to parse env file '%s': %w", envFile, err))
+			}
+			for k, v := range vars {
+				if err := os.Setenv(k, v); err != nil {
+					return fmt.Errorf("failed to export %s from env file: %w", k, err)
+				}
+			}
+		}
+		provider = template.DotenvProvider(envBytes)
+		inputs = append(inputs, template.AttestationInput{Name: envFile, Content: envBytes})
+		inputSourceType = "env file"
 	} else if len(args) == 2 && args[1] == "-" {
-		// 2. Next priority: Explicit '-' argument for stdin
+		// 4. Next priority: Explicit '-' argument for stdin
 		dataBytes, err = io.ReadAll(os.Stdin)
 		if err != nil {
-			return fmt.Errorf("failed to read data from stdin (via '-'): %w", err)
+			return withExitCode(ExitData, fmt.Errorf("failed to read data from stdin (via '-'): %w", err))
 		}
 		inputSourceType = "explicit stdin ('-')"
 	} else {
-		// 3. Next priority: Implicit stdin (pipe/redirect)
+		// 5. Next priority: Implicit stdin (pipe/redirect)
 		stat, _ := os.Stdin.Stat()
 		if (stat.Mode() & os.ModeCharDevice) == 0 { // If stdin is NOT a character device
 			dataBytes, err = io.ReadAll(os.Stdin)
 			if err != nil {
-				return fmt.Errorf("failed to read YAML data from stdin: %w", err)
+				return withExitCode(ExitData, fmt.Errorf("failed to read YAML data from stdin: %w", err))
 			}
 			inputSourceType = "implicit stdin (pipe/redirect)"
 		} else if len(args) == 2 {
-			// 4. Lowest priority: Positional argument (yaml-data-file)
+			// 6. Lowest priority: Positional argument (yaml-data-file)
 			dataFilePath := args[1]
 			dataBytes, err = os.ReadFile(dataFilePath)
 			if err != nil {
-				return fmt.Errorf("failed to read YAML data from file '%s': %w", dataFilePath, err)
+				return withExitCode(ExitData, fmt.Errorf("failed to read YAML data from file '%s': %w", dataFilePath, err))
 			}
+			inputs = append(inputs, template.AttestationInput{Name: dataFilePath, Content: dataBytes})
 			inputSourceType = "file argument"
 		} else {
-			// No input source found (no --content, no stdin, no file arg)
-			return fmt.Errorf("no data provided. Use a data file argument, the '-' argument for stdin, --content flag, or pipe via stdin")
+			// No input source found (no --content, no --from-env, no --env-file, no stdin, no file arg)
+			return withExitCode(ExitUsage, fmt.Errorf("no data provided. Use a data file argument, the '-' argument for stdin, --content flag, --from-env or --env-file flag, or pipe via stdin"))
 		}
 	}
 
-	if len(dataBytes) == 0 {
-		return fmt.Errorf("no input provided from %s", inputSourceType)
+	if provider == nil {
+		if len(dataBytes) == 0 {
+			return withExitCode(ExitData, fmt.Errorf("no input provided from %s", inputSourceType))
+		}
+		provider = template.YamlProvider(dataBytes)
+		if len(keyFiles) > 0 {
+			keys, err := keyFileProvider(keyFiles)
+			if err != nil {
+				return withExitCode(ExitUsage, err)
+			}
+			provider = template.DecryptingYamlProvider(dataBytes, keys)
+		}
+		if len(inputs) == 0 {
+			inputs = append(inputs, template.AttestationInput{Name: inputSourceType, Content: dataBytes})
+		}
 	}
+	logger.Info("data source selected", "source", inputSourceType)
 
 	templateBytes, err := os.ReadFile(templateFile)
 	if err != nil {
 		return fmt.Errorf("failed to read template file '%s': %w", templateFile, err)
 	}
+	logger.Info("template loaded", "template", templateFile, "bytes", len(templateBytes))
+	inputs = append(inputs, template.AttestationInput{Name: templateFile, Content: templateBytes})
+
+	var frozenNow time.Time
+	if frozenTime != "" {
+		if frozenNow, err = time.Parse(time.RFC3339, frozenTime); err != nil {
+			return withExitCode(ExitUsage, fmt.Errorf("invalid --frozen-time value %q: expected an RFC 3339 time such as 2024-01-02T15:04:05Z", frozenTime))
+		}
+	}
+
+	symlinks, err := template.ParseSymlinkPolicy(symlinkPolicy)
+	if err != nil {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --symlinks value %q: must be refuse, replace or follow", symlinkPolicy))
+	}
+
+	// Read the previous manifest before the render replaces the files it
+	// lists; without one there is nothing to prune
+	var previous *template.Manifest
+	if prune {
+		if _, err := os.Stat(manifestPath); err == nil {
+			if previous, err = template.ReadManifest(manifestPath); err != nil {
+				return withExitCode(ExitData, err)
+			}
+		}
+	}
+
+	dirPerm, err := parseMode("--dir-mode", dirMode)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	var filePerm os.FileMode
+	if fileMode != "" {
+		if filePerm, err = parseMode("--file-mode", fileMode); err != nil {
+			return withExitCode(ExitUsage, err)
+		}
+	}
+	if backupSuffix != "" {
+		if err := template.ValidateBackupSuffix(backupSuffix); err != nil {
+			return withExitCode(ExitUsage, fmt.Errorf("invalid --backup value: %w", err))
+		}
+	}
 
 	// Create file writer for FILE directive support
-	fileWriter := &template.DefaultFileWriter{}
+	var fileWriter template.FileWriter = &template.DefaultFileWriter{NoPreserveMetadata: noPreserve, Dedup: dedup, Symlinks: symlinks, FileMode: filePerm, DirMode: dirPerm, SkipUnchanged: skipUnchanged, Backup: backupSuffix}
+	if storeDir != "" {
+		fileWriter = &template.StoreFileWriter{Store: storeDir, FileMode: filePerm, DirMode: dirPerm}
+	}
+	var archive archiveWriter
+	var archiveBuf bytes.Buffer
+	if outputArchive != "" {
+		if archive, err = newArchiveWriter(outputArchive, &archiveBuf, frozenNow, filePerm, dirPerm); err != nil {
+			return withExitCode(ExitUsage, err)
+		}
+		fileWriter = archive
+	}
 
 	// Set output directory if provided
 	if outputDir != "" {
 		if err := fileWriter.SetBaseDir(outputDir); err != nil {
-			return fmt.Errorf("invalid output directory: %w", err)
+			return withExitCode(ExitWrite, fmt.Errorf("invalid output directory: %w", err))
 		}
 	}
 
+	// Innermost, to read the previous content of files before any write
+	var changes *template.ChangeRecorder
+	if prPayloadFile != "" {
+		changes = template.NewChangeRecorder(fileWriter, nil, outputDir)
+		fileWriter = changes
+	}
+
+	var recorder *template.HistoryRecorder
+	if recordHistory {
+		recorder = historyFor(outputDir).Recorder(fileWriter)
+		fileWriter = recorder
+	}
+	var outputs *template.ManifestRecorder
+	if attestationFile != "" || manifestPath != "" || gitignoreFile != "" || gitattrsFile != "" || gitCommit || prPayloadFile != "" {
+		outputs = template.NewManifestRecorder(fileWriter)
+		fileWriter = outputs
+	}
+
+	// With --output, stdout content is collected and written once the render
+	// has succeeded, so the file is either replaced completely or untouched
+	var stdout io.Writer = os.Stdout
+	var stdoutBuf bytes.Buffer
+	if outputFile != "" {
+		stdout = &stdoutBuf
+	}
+
+	opts := []template.Option{
+		template.WithOutput(stdout),
+		template.WithWriter(fileWriter),
+		template.WithWarnings(messageOutput()),
+		template.WithTemplateName(templateFile),
+		template.WithLogger(logger),
+	}
 	if inputSchemaFile != "" {
 		inputSchemaBytes, err := os.ReadFile(inputSchemaFile)
 		if err != nil {
 			return fmt.Errorf("failed to read schema file '%v': %w", inputSchemaFile, err)
 		}
-		return template.ExecuteWithFiles(template.YamlProvider(dataBytes), templateBytes, os.Stdout, fileWriter,
-			template.WithJsonSchemaValidation(inputSchemaBytes))
+		opts = append(opts, template.WithJsonSchemaValidation(inputSchemaBytes))
+		inputs = append(inputs, template.AttestationInput{Name: inputSchemaFile, Content: inputSchemaBytes})
+		logger.Info("schema applied", "schema", inputSchemaFile)
+	}
+	if lintSchemaFile != "" {
+		lintSchemaBytes, err := os.ReadFile(lintSchemaFile)
+		if err != nil {
+			return fmt.Errorf("failed to read lint schema file '%v': %w", lintSchemaFile, err)
+		}
+		opts = append(opts, template.WithLintSchema(lintSchemaBytes))
+		inputs = append(inputs, template.AttestationInput{Name: lintSchemaFile, Content: lintSchemaBytes})
+		logger.Info("lint schema applied", "schema", lintSchemaFile)
+	}
+	if len(httpAllowHosts) > 0 {
+		client, err := newHTTPClient()
+		if err != nil {
+			return err
+		}
+		opts = append(opts, template.WithHTTPFuncs(template.HTTPConfig{
+			AllowedHosts: httpAllowHosts,
+			Timeout:      httpTimeout,
+			Client:       client,
+		}))
+	}
+
+	if formatOutput {
+		opts = append(opts, template.WithFormatters(template.DefaultFormatters()))
+	}
+	if editorConfig {
+		// After formatting and before signing, so that signatures cover the normalized files
+		opts = append(opts, template.WithEditorConfig(cmp.Or(outputDir, ".")))
+	}
+	if checkOutput {
+		checkers := template.DefaultCheckers()
+		if checkShell {
+			maps.Copy(checkers, template.ShellCheckers())
+		}
+		opts = append(opts, template.WithOutputChecks(checkers))
+	}
+	if signKeyFile != "" {
+		// Last of the BeforeWrite hooks, so that signatures cover the written files
+		keyBytes, err := os.ReadFile(signKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read signing key '%v': %w", signKeyFile, err)
+		}
+		key, err := template.ParsePrivateKey(keyBytes)
+		if err != nil {
+			return withExitCode(ExitUsage, fmt.Errorf("invalid signing key '%v': %w", signKeyFile, err))
+		}
+		opts = append(opts, template.WithSigning(key))
+	}
+	if len(envAllowlist) > 0 {
+		opts = append(opts, template.WithEnvAllowlist(envAllowlist...))
+	}
+	if len(fsReadDirs) > 0 {
+		opts = append(opts, template.WithFileFuncs(template.FileReadConfig{
+			AllowedDirs: fsReadDirs,
+		}))
+	}
+	compatOpts, err := compatOptions()
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	opts = append(opts, compatOpts...)
+	if !frozenNow.IsZero() {
+		opts = append(opts, template.WithClock(template.FixedClock(frozenNow)))
+	}
+
+	if enableDNS {
+		opts = append(opts, template.WithDNSFuncs(template.DNSConfig{Timeout: dnsTimeout}))
+	}
+
+	if enableCloud {
+		opts = append(opts, template.WithCloudFuncs(template.CloudConfig{}))
+	}
+	if noClobber {
+		opts = append(opts, template.WithNoClobber())
+	}
+	if skipEmpty {
+		opts = append(opts, template.WithSkipEmpty())
+	}
+	if ensureNewline {
+		opts = append(opts, template.WithEnsureTrailingNewline())
+	}
+	if stripTrailingWS {
+		opts = append(opts, template.WithStripTrailingWhitespace())
+	}
+	if stripBOM {
+		opts = append(opts, template.WithStripBOM())
+	}
+	if htmlEscaping {
+		opts = append(opts, template.WithHTMLEscaping())
+	}
+	if strictPathsCase {
+		opts = append(opts, template.WithStrictPathsCase())
+	}
+	if checkPortable {
+		opts = append(opts, template.WithPortabilityCheck())
+	}
+	if parallel != 1 {
+		opts = append(opts, template.WithParallelism(parallel))
+	}
+	if keepGoing {
+		opts = append(opts, template.WithKeepGoing())
+	}
+	if segmentTimeout > 0 {
+		opts = append(opts, template.WithSegmentTimeout(segmentTimeout))
+	}
+	if sandbox {
+		opts = append(opts, template.WithSandbox())
+	}
+	policy, err := functionPolicy()
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	opts = append(opts, template.WithFunctionPolicy(policy))
+
+	// Cancel the render on Ctrl-C or SIGTERM so that pending network calls
+	// are aborted and no partially written files are left behind
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, path := range pluginPaths {
+		plugin, err := template.LoadPlugin(ctx, path)
+		if err != nil {
+			return err
+		}
+		defer plugin.Close()
+		opts = append(opts, template.WithPlugin(plugin))
+		logger.Info("plugin loaded", "plugin", path, "functions", len(plugin.Functions))
+	}
+	for _, path := range wasmPlugins {
+		plugin, err := template.LoadWasmPlugin(ctx, path)
+		if err != nil {
+			return err
+		}
+		defer plugin.Close()
+		opts = append(opts, template.WithWasmPlugin(plugin))
+		logger.Info("wasm plugin loaded", "plugin", path, "functions", len(plugin.Functions))
+	}
+
+	report, err := template.NewEngine(opts...).RenderWithReport(ctx, template.ContextProvider(provider), templateBytes)
+	if err != nil {
+		var schemaErr *template.SchemaError
+		if errors.As(err, &schemaErr) && dataBytes != nil {
+			schemaErr.SetLines(dataBytes)
+		}
+		return err
+	}
+	if outputFile != "" {
+		if err := writeOutputFile(outputFile, stdoutBuf.Bytes(), filePerm); err != nil {
+			return err
+		}
+		logger.Info("output file written", "path", outputFile, "bytes", stdoutBuf.Len())
+	}
+	if archive != nil {
+		if err := archive.Close(); err != nil {
+			return withExitCode(ExitWrite, err)
+		}
+		if err := writeOutputFile(outputArchive, archiveBuf.Bytes(), filePerm); err != nil {
+			return err
+		}
+		logger.Info("archive written", "path", outputArchive, "bytes", archiveBuf.Len())
+	}
+	if recorder != nil {
+		manifest, err := recorder.Save()
+		if err != nil {
+			return err
+		}
+		logger.Info("run recorded", "id", manifest.ID, "files", len(manifest.Files))
+	}
+	var pruned []string
+	if previous != nil {
+		if pruned, err = pruneStale(previous, report, logger); err != nil {
+			return err
+		}
+	}
+	if manifestPath != "" {
+		if err := writeManifest(outputs, frozenNow); err != nil {
+			return err
+		}
+		logger.Info("manifest written", "path", manifestPath)
+	}
+	if gitignoreFile != "" || gitattrsFile != "" {
+		if err := updateGitFiles(outputs.Files(), logger); err != nil {
+			return err
+		}
+	}
+	if attestationFile != "" {
+		files := outputs.Files()
+		if outputFile != "" {
+			sum := sha256.Sum256(stdoutBuf.Bytes())
+			files = append(files, template.ManifestFile{Path: outputFile, Size: stdoutBuf.Len(), SHA256: hex.EncodeToString(sum[:])})
+		}
+		if err := writeAttestation(templateFile, files, inputs, started); err != nil {
+			return err
+		}
+		logger.Info("attestation written", "path", attestationFile)
+	}
+	if prPayloadFile != "" {
+		payload := template.NewPullRequestPayload(commitMessage, templateFile, outputDir, len(outputs.Files()), changes.Changes())
+		if err := writePRPayload(payload); err != nil {
+			return err
+		}
+		logger.Info("pull request payload written", "path", prPayloadFile, "changes", len(payload.Files))
+	}
+	if gitCommit {
+		var paths []string
+		for _, f := range outputs.Files() {
+			paths = append(paths, filepath.Join(outputDir, f.Path))
+		}
+		for _, file := range []string{manifestPath, gitignoreFile, gitattrsFile, attestationFile} {
+			if file != "" {
+				paths = append(paths, file)
+			}
+		}
+		if err := commitGenerated(cmp.Or(outputDir, "."), paths, pruned, commitMessage, gitSign, logger); err != nil {
+			return withExitCode(ExitWrite, err)
+		}
+	}
+	return nil
+}
+
+// writeAttestation writes the --attestation file for a run of templateFile
+// that wrote files from inputs. Paths of generated files are relative to
+// --output-dir, while the --output file keeps its own path.
+func writeAttestation(templateFile string, files []template.ManifestFile, inputs []template.AttestationInput, started time.Time) error {
+	parameters := map[string]any{"template": templateFile}
+	if outputDir != "" {
+		parameters["outputDir"] = outputDir
+	}
+	if frozenTime != "" {
+		parameters["frozenTime"] = frozenTime
+	}
+	attestation := template.NewAttestation(files, inputs, parameters, appVersion, started, time.Now())
+	data, err := json.MarshalIndent(attestation, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode attestation: %w", err)
+	}
+	abs, err := filepath.Abs(attestationFile)
+	if err != nil {
+		return fmt.Errorf("failed to resolve attestation file '%s': %w", attestationFile, err)
+	}
+	w := &template.DefaultFileWriter{NoPreserveMetadata: noPreserve, Symlinks: template.SymlinkPolicy(symlinkPolicy)}
+	if err := w.WriteFile(abs, append(data, '\n'), 0); err != nil {
+		return withExitCode(ExitWrite, fmt.Errorf("failed to write attestation '%s': %w", attestationFile, err))
+	}
+	return nil
+}
+
+// updateGitFiles adds the generated files, with paths relative to
+// --output-dir, to the --gitignore and --gitattributes files.
+func updateGitFiles(files []template.ManifestFile, logger *slog.Logger) error {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = filepath.Join(outputDir, f.Path)
+	}
+	for _, update := range []struct {
+		file string
+		fn   func(template.FS, string, []string) ([]string, error)
+	}{
+		{gitignoreFile, template.UpdateGitignore},
+		{gitattrsFile, template.UpdateGitattributes},
+	} {
+		if update.file == "" {
+			continue
+		}
+		added, err := update.fn(nil, update.file, paths)
+		if err != nil {
+			return withExitCode(ExitWrite, err)
+		}
+		logger.Info("git file updated", "path", update.file, "added", len(added))
+	}
+	return nil
+}
+
+// writeManifest writes the --manifest file listing the files recorded by
+// outputs, made at now or the current time if now is zero. Paths are
+// relative to --output-dir, which the manifest records; the --output file is
+// not part of it.
+func writeManifest(outputs *template.ManifestRecorder, now time.Time) error {
+	if now.IsZero() {
+		now = time.Now()
+	}
+	manifest := outputs.Manifest(now)
+	manifest.Dir = outputDir
+	data, err := template.MarshalManifest(manifest, manifestPath)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve manifest file '%s': %w", manifestPath, err)
+	}
+	w := &template.DefaultFileWriter{NoPreserveMetadata: noPreserve, Symlinks: template.SymlinkPolicy(symlinkPolicy)}
+	if err := w.WriteFile(abs, data, 0); err != nil {
+		return withExitCode(ExitWrite, fmt.Errorf("failed to write manifest '%s': %w", manifestPath, err))
+	}
+	return nil
+}
+
+// writePRPayload writes payload to the --pr-payload file as JSON.
+func writePRPayload(payload *template.PullRequestPayload) error {
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode pull request payload: %w", err)
 	}
+	abs, err := filepath.Abs(prPayloadFile)
+	if err != nil {
+		return fmt.Errorf("failed to resolve pull request payload file '%s': %w", prPayloadFile, err)
+	}
+	w := &template.DefaultFileWriter{NoPreserveMetadata: noPreserve, Symlinks: template.SymlinkPolicy(symlinkPolicy)}
+	if err := w.WriteFile(abs, append(data, '\n'), 0); err != nil {
+		return withExitCode(ExitWrite, fmt.Errorf("failed to write pull request payload '%s': %w", prPayloadFile, err))
+	}
+	return nil
+}
 
-	return template.ExecuteWithFiles(template.YamlProvider(dataBytes), templateBytes, os.Stdout, fileWriter)
+// pruneStale deletes the files of the previous manifest that the run of
+// report did not generate again, written or skipped, logging them to
+// logger, and returns the paths of the deleted files relative to the
+// current directory. A manifest of another output directory is ignored.
+func pruneStale(previous *template.Manifest, report *template.RenderReport, logger *slog.Logger) ([]string, error) {
+	if filepath.Clean(previous.Dir) != filepath.Clean(outputDir) {
+		fmt.Fprintf(messageOutput(), "warning: not pruning: %s was written for output directory %q\n", manifestPath, previous.Dir)
+		return nil, nil
+	}
+	generated := make([]string, len(report.Files))
+	for i, f := range report.Files {
+		generated[i] = f.Path
+	}
+	result, err := template.Prune(nil, outputDir, previous, generated)
+	var removed []string
+	if result != nil {
+		for _, path := range result.Removed {
+			logger.Info("stale file removed", "path", path)
+			removed = append(removed, filepath.Join(outputDir, path))
+		}
+		for _, path := range result.Modified {
+			fmt.Fprintf(messageOutput(), "warning: not pruning modified file %s\n", path)
+		}
+	}
+	if err != nil {
+		return removed, withExitCode(ExitWrite, err)
+	}
+	return removed, nil
+}
+
+// writeOutputFile atomically writes the stdout content of a render to path,
+// which is relative to the current directory rather than --output-dir, with
+// mode or, if 0, the default mode.
+func writeOutputFile(path string, content []byte, mode os.FileMode) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve output file '%s': %w", path, err)
+	}
+	w := &template.DefaultFileWriter{NoPreserveMetadata: noPreserve, Symlinks: template.SymlinkPolicy(symlinkPolicy), SkipUnchanged: skipUnchanged}
+	if err := w.WriteFile(abs, content, mode); err != nil {
+		return withExitCode(ExitWrite, fmt.Errorf("failed to write output file '%s': %w", path, err))
+	}
+	return nil
+}
+
+// functionPolicy builds the blocking function policy from the
+// --on-function-error, --function-timeout and --function-default flags.
+func functionPolicy() (template.FunctionPolicy, error) {
+	policy := template.FunctionPolicy{
+		OnError:  template.FunctionErrorPolicy(onFuncError),
+		Timeouts: make(map[string]time.Duration, len(funcTimeouts)),
+		Defaults: make(map[string]any, len(funcDefaults)),
+	}
+	switch policy.OnError {
+	case template.FunctionErrorFail, template.FunctionErrorEmpty, template.FunctionErrorDefault:
+	default:
+		return policy, fmt.Errorf("invalid --on-function-error value %q: must be fail, empty or default", onFuncError)
+	}
+	for name, value := range funcTimeouts {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return policy, fmt.Errorf("invalid --function-timeout for %s: %w", name, err)
+		}
+		policy.Timeouts[name] = timeout
+	}
+	for name, value := range funcDefaults {
+		policy.Defaults[name] = value
+	}
+	return policy, nil
 }
@@ -1,11 +1,24 @@
 package cmd
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/danarchy-io/simplate/pkg/template"
 )
 
 func TestRunE_Errors(t *testing.T) {
@@ -179,3 +192,1112 @@ func TestRunE_ExplicitStdin_Success(t *testing.T) {
 		t.Errorf("output = %q; want %q", got, want)
 	}
 }
+
+func TestRunE_FromEnv_Success(t *testing.T) {
+	origContent := inputContent
+	origSchema := inputSchemaFile
+	origPrefix := fromEnvPrefix
+	origSeparator := envSeparator
+	t.Cleanup(func() {
+		inputContent = origContent
+		inputSchemaFile = origSchema
+		fromEnvPrefix = origPrefix
+		envSeparator = origSeparator
+	})
+
+	// create template
+	tmplFile := filepath.Join(t.TempDir(), "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("{{.db.host}}:{{.db.port}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SIMPLATETEST_DB_HOST", "localhost")
+	t.Setenv("SIMPLATETEST_DB_PORT", "5432")
+	inputContent, inputSchemaFile = "", ""
+	fromEnvPrefix, envSeparator = "SIMPLATETEST", "_"
+
+	// capture stdout
+	origStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := runE(nil, []string{tmplFile})
+	w.Close()
+	out, _ := io.ReadAll(r)
+	os.Stdout = origStdout
+
+	if err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	got := string(bytes.TrimSpace(out))
+	want := "localhost:5432"
+	if got != want {
+		t.Errorf("output = %q; want %q", got, want)
+	}
+}
+
+func TestRunE_EnvFile_Export(t *testing.T) {
+	origContent := inputContent
+	origEnvFile := envFile
+	origExport := exportEnvFile
+	t.Cleanup(func() {
+		inputContent = origContent
+		envFile = origEnvFile
+		exportEnvFile = origExport
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte(`{{.NAME}} {{env "SIMPLATETEST_EXPORTED"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dotenv := filepath.Join(dir, ".env")
+	if err := os.WriteFile(dotenv, []byte("NAME=app\nSIMPLATETEST_EXPORTED=yes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// register the variable with t.Setenv so it is restored after the test
+	t.Setenv("SIMPLATETEST_EXPORTED", "")
+	inputContent = ""
+	envFile, exportEnvFile = dotenv, true
+
+	// capture stdout
+	origStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := runE(nil, []string{tmplFile})
+	w.Close()
+	out, _ := io.ReadAll(r)
+	os.Stdout = origStdout
+
+	if err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	got := string(bytes.TrimSpace(out))
+	want := "app yes"
+	if got != want {
+		t.Errorf("output = %q; want %q", got, want)
+	}
+}
+
+func TestRunE_OutputFile(t *testing.T) {
+	origContent, origOutput := inputContent, outputFile
+	t.Cleanup(func() { inputContent, outputFile = origContent, origOutput })
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("Hello {{.Name}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "Name: Alice"
+	outputFile = filepath.Join(dir, "out", "hello.txt")
+
+	// capture stdout
+	origStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := runE(nil, []string{tmplFile})
+	w.Close()
+	out, _ := io.ReadAll(r)
+	os.Stdout = origStdout
+
+	if err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	if len(out) != 0 {
+		t.Errorf("expected nothing on stdout, got %q", out)
+	}
+	got, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Hello Alice" {
+		t.Errorf("output file = %q; want %q", got, "Hello Alice")
+	}
+
+	// A failed render leaves the previous output in place
+	if err := os.WriteFile(tmplFile, []byte("Hello {{.Name"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runE(nil, []string{tmplFile}); err == nil {
+		t.Fatal("expected parse error")
+	}
+	if got, _ := os.ReadFile(outputFile); string(got) != "Hello Alice" {
+		t.Errorf("output file changed to %q after a failed render", got)
+	}
+}
+
+func TestRunE_Attestation(t *testing.T) {
+	origContent, origOutputDir, origOutput, origAttestation := inputContent, outputDir, outputFile, attestationFile
+	t.Cleanup(func() {
+		inputContent, outputDir, outputFile, attestationFile = origContent, origOutputDir, origOutput, origAttestation
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("summary#FILE:app.conf#name={{.name}}#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "name: api"
+	outputDir = filepath.Join(dir, "out")
+	outputFile = filepath.Join(dir, "summary.txt")
+	attestationFile = filepath.Join(dir, "attestation.json")
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(attestationFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attestation template.Attestation
+	if err := json.Unmarshal(data, &attestation); err != nil {
+		t.Fatalf("invalid attestation: %v", err)
+	}
+	digest := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	wantSubjects := []template.ResourceDescriptor{
+		{Name: "app.conf", Digest: map[string]string{"sha256": digest("name=api")}},
+		{Name: outputFile, Digest: map[string]string{"sha256": digest("summary")}},
+	}
+	if !reflect.DeepEqual(attestation.Subject, wantSubjects) {
+		t.Errorf("expected subjects %v, got %v", wantSubjects, attestation.Subject)
+	}
+	deps := attestation.Predicate.BuildDefinition.ResolvedDependencies
+	if len(deps) != 2 || deps[0].Name != "content flag" || deps[1].Name != tmplFile {
+		t.Errorf("unexpected dependencies %v", deps)
+	}
+}
+
+func TestRunE_Manifest(t *testing.T) {
+	origContent, origOutputDir, origOutput, origManifest := inputContent, outputDir, outputFile, manifestPath
+	t.Cleanup(func() {
+		inputContent, outputDir, outputFile, manifestPath = origContent, origOutputDir, origOutput, origManifest
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("summary\n#FILE:b.conf#b#FILE#\n#FILE:a.conf:0600#name={{.name}}#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "name: api"
+	outputDir = filepath.Join(dir, "out")
+	outputFile = filepath.Join(dir, "summary.txt")
+	for _, name := range []string{"simplate.lock", "manifest.yaml"} {
+		manifestPath = filepath.Join(dir, name)
+		if err := runE(nil, []string{tmplFile}); err != nil {
+			t.Fatalf("runE returned error: %v", err)
+		}
+		manifest, err := template.ReadManifest(manifestPath)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if manifest.Dir != outputDir {
+			t.Errorf("%s: expected dir %q, got %q", name, outputDir, manifest.Dir)
+		}
+		sum := sha256.Sum256([]byte("name=api"))
+		want := []template.ManifestFile{
+			{Path: "a.conf", Size: 8, Mode: 0600, SHA256: hex.EncodeToString(sum[:]), Source: &template.ManifestSource{Template: tmplFile, Line: 3}},
+			{Path: "b.conf", Size: 1, SHA256: manifest.Files[1].SHA256, Source: &template.ManifestSource{Template: tmplFile, Line: 2}},
+		}
+		if !reflect.DeepEqual(manifest.Files, want) {
+			t.Errorf("%s: expected files %+v, got %+v", name, want, manifest.Files)
+		}
+	}
+}
+
+func TestRunE_DedupManifest(t *testing.T) {
+	origContent, origOutputDir, origManifest, origDedup := inputContent, outputDir, manifestPath, dedup
+	t.Cleanup(func() {
+		inputContent, outputDir, manifestPath, dedup = origContent, origOutputDir, origManifest, origDedup
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:a.conf#same#FILE#\n#FILE:b.conf#same#FILE#\n#FILE:c.conf#other#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "name: api"
+	outputDir = filepath.Join(dir, "out")
+	manifestPath = filepath.Join(dir, "manifest.yaml")
+	dedup = true
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+
+	a, errA := os.Stat(filepath.Join(outputDir, "a.conf"))
+	b, errB := os.Stat(filepath.Join(outputDir, "b.conf"))
+	if errA != nil || errB != nil || !os.SameFile(a, b) {
+		t.Fatalf("expected b.conf to be a hard link to a.conf (%v, %v)", errA, errB)
+	}
+	manifest, err := template.ReadManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := make(map[string]string)
+	for _, f := range manifest.Files {
+		links[f.Path] = f.LinkedTo
+	}
+	if want := map[string]string{"a.conf": "", "b.conf": "a.conf", "c.conf": ""}; !reflect.DeepEqual(links, want) {
+		t.Errorf("expected links %v, got %v", want, links)
+	}
+}
+
+func TestRunE_Prune(t *testing.T) {
+	origContent, origOutputDir, origManifest, origPrune := inputContent, outputDir, manifestPath, prune
+	t.Cleanup(func() {
+		inputContent, outputDir, manifestPath, prune = origContent, origOutputDir, origManifest, origPrune
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	render := func(tmpl string) {
+		t.Helper()
+		if err := os.WriteFile(tmplFile, []byte(tmpl), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := runE(nil, []string{tmplFile}); err != nil {
+			t.Fatalf("runE returned error: %v", err)
+		}
+	}
+	inputContent = "{}"
+	outputDir = filepath.Join(dir, "out")
+	manifestPath = filepath.Join(dir, "simplate.lock")
+	prune = true
+	render("#FILE:conf/old.conf#old#FILE##FILE:kept.conf#kept#FILE#")
+	render("#FILE:conf/new.conf#new#FILE##FILE:kept.conf#kept#FILE#")
+
+	if _, err := os.Stat(filepath.Join(outputDir, "conf", "old.conf")); !os.IsNotExist(err) {
+		t.Errorf("expected old.conf to be pruned, got %v", err)
+	}
+	for _, name := range []string{"conf/new.conf", "kept.conf"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+		}
+	}
+
+	// Files skipped because they exist are still generated
+	render("#FILE:keep.txt if-missing#keep#FILE##FILE:empty.txt skip-empty# #FILE#")
+	render("#FILE:keep.txt if-missing#keep#FILE##FILE:empty.txt skip-empty# #FILE#")
+	if _, err := os.Stat(filepath.Join(outputDir, "keep.txt")); err != nil {
+		t.Errorf("expected the if-missing file to be kept: %v", err)
+	}
+
+	manifestPath = ""
+	if err := runE(nil, []string{tmplFile}); err == nil || ExitCode(err) != ExitUsage {
+		t.Errorf("expected a usage error without --manifest, got %v", err)
+	}
+}
+
+func TestRunE_FrozenTime(t *testing.T) {
+	origContent, origOutput, origFrozen := inputContent, outputFile, frozenTime
+	t.Cleanup(func() {
+		inputContent, outputFile, frozenTime = origContent, origOutput, origFrozen
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte(`{{ date "2006-01-02T15:04" }} {{ now.Year }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "{}"
+	outputFile = filepath.Join(dir, "out.txt")
+	frozenTime = "2024-02-29T08:15:00Z"
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(outputFile); string(got) != "2024-02-29T08:15 2024" {
+		t.Errorf("unexpected output %q", got)
+	}
+
+	frozenTime = "yesterday"
+	err := runE(nil, []string{tmplFile})
+	if err == nil || ExitCode(err) != ExitUsage {
+		t.Errorf("expected a usage error, got %v", err)
+	}
+}
+
+func TestRunE_Symlinks(t *testing.T) {
+	origContent, origOutputDir, origSymlinks := inputContent, outputDir, symlinkPolicy
+	t.Cleanup(func() {
+		inputContent, outputDir, symlinkPolicy = origContent, origOutputDir, origSymlinks
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:app.conf#generated#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(dir, "outside.conf")
+	if err := os.WriteFile(outside, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputDir = filepath.Join(dir, "out")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(outputDir, "app.conf")); err != nil {
+		t.Skipf("symbolic links not supported: %v", err)
+	}
+	inputContent = "{}"
+
+	err := runE(nil, []string{tmplFile})
+	if err == nil || ExitCode(err) != ExitWrite {
+		t.Errorf("expected a write error, got %v", err)
+	}
+
+	symlinkPolicy = "ignore"
+	if err := runE(nil, []string{tmplFile}); err == nil || ExitCode(err) != ExitUsage {
+		t.Errorf("expected a usage error, got %v", err)
+	}
+
+	symlinkPolicy = "replace"
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(outside); string(got) != "original" {
+		t.Errorf("expected the link target to be untouched, got %q", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(outputDir, "app.conf")); string(got) != "generated" {
+		t.Errorf("expected app.conf to be replaced, got %q", got)
+	}
+}
+
+func TestRunE_DirMode(t *testing.T) {
+	origContent, origOutputDir, origDirMode := inputContent, outputDir, dirMode
+	t.Cleanup(func() {
+		inputContent, outputDir, dirMode = origContent, origOutputDir, origDirMode
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:conf/app.conf#x#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "{}"
+	outputDir = filepath.Join(dir, "out")
+	dirMode = "0750"
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	for _, d := range []string{outputDir, filepath.Join(outputDir, "conf")} {
+		info, err := os.Stat(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The umask may only remove permissions
+		if extra := info.Mode().Perm() &^ 0750; extra != 0 {
+			t.Errorf("%s: unexpected permissions %04o", d, info.Mode().Perm())
+		}
+	}
+
+	for _, value := range []string{"rwx", "0", "1777", "9"} {
+		dirMode = value
+		if err := runE(nil, []string{tmplFile}); err == nil || ExitCode(err) != ExitUsage {
+			t.Errorf("%s: expected a usage error, got %v", value, err)
+		}
+	}
+}
+
+func TestRunE_FileMode(t *testing.T) {
+	origContent, origOutputDir, origOutput, origFileMode := inputContent, outputDir, outputFile, fileMode
+	t.Cleanup(func() {
+		inputContent, outputDir, outputFile, fileMode = origContent, origOutputDir, origOutput, origFileMode
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("out#FILE:db.env#x#FILE##FILE:run.sh:0755#y#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "{}"
+	outputDir = filepath.Join(dir, "out")
+	outputFile = filepath.Join(dir, "stdout.txt")
+	fileMode = "0600"
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	want := map[string]os.FileMode{
+		filepath.Join(outputDir, "db.env"): 0600,
+		filepath.Join(outputDir, "run.sh"): 0755,
+		outputFile:                         0600,
+	}
+	for path, mode := range want {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("%s: expected %04o, got %04o", path, mode, info.Mode().Perm())
+		}
+	}
+
+	fileMode = "rw"
+	if err := runE(nil, []string{tmplFile}); err == nil || ExitCode(err) != ExitUsage || !strings.Contains(err.Error(), "--file-mode") {
+		t.Errorf("expected a usage error, got %v", err)
+	}
+}
+
+func TestRunE_Whitespace(t *testing.T) {
+	origContent, origOutputDir, origNewline, origStrip, origBOM := inputContent, outputDir, ensureNewline, stripTrailingWS, stripBOM
+	t.Cleanup(func() {
+		inputContent, outputDir, ensureNewline, stripTrailingWS, stripBOM = origContent, origOutputDir, origNewline, origStrip, origBOM
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:values.yaml#\ufeffa: 1  \nb: 2\t#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "{}"
+	outputDir = filepath.Join(dir, "out")
+	ensureNewline, stripTrailingWS, stripBOM = true, true, true
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(outputDir, "values.yaml")); string(got) != "a: 1\nb: 2\n" {
+		t.Errorf("expected cleaned content, got %q", got)
+	}
+}
+
+func TestRunE_HTML(t *testing.T) {
+	origContent, origOutputDir, origHTML := inputContent, outputDir, htmlEscaping
+	t.Cleanup(func() {
+		inputContent, outputDir, htmlEscaping = origContent, origOutputDir, origHTML
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:index.html#<h1>{{.title}}</h1>#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "title: <img src=x onerror=alert(1)>"
+	outputDir = filepath.Join(dir, "out")
+	htmlEscaping = true
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(outputDir, "index.html")); string(got) != "<h1>&lt;img src=x onerror=alert(1)&gt;</h1>" {
+		t.Errorf("expected escaped content, got %q", got)
+	}
+}
+
+func TestRunE_GitCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	origContent, origOutputDir, origCommit, origMessage := inputContent, outputDir, gitCommit, commitMessage
+	t.Cleanup(func() {
+		inputContent, outputDir, gitCommit, commitMessage = origContent, origOutputDir, origCommit, origMessage
+	})
+	for _, kv := range [][2]string{
+		{"GIT_CONFIG_GLOBAL", os.DevNull}, {"GIT_CONFIG_NOSYSTEM", "1"},
+		{"GIT_AUTHOR_NAME", "bot"}, {"GIT_AUTHOR_EMAIL", "bot@example.com"},
+		{"GIT_COMMITTER_NAME", "bot"}, {"GIT_COMMITTER_EMAIL", "bot@example.com"},
+	} {
+		t.Setenv(kv[0], kv[1])
+	}
+
+	dir := t.TempDir()
+	if _, err := runGit(dir, "init", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	// A staged change that is not generated must stay out of the commit
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("wip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(dir, "add", "notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+	tmplFile := filepath.Join(t.TempDir(), "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:app.conf#name={{.name}}#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "name: api"
+	outputDir = filepath.Join(dir, "gen")
+	gitCommit, commitMessage = true, "regenerate configs"
+	for range 2 {
+		if err := runE(nil, []string{tmplFile}); err != nil {
+			t.Fatalf("runE returned error: %v", err)
+		}
+	}
+
+	// The second run has nothing to commit
+	if count, _ := runGit(dir, "rev-list", "--count", "HEAD"); count != "1" {
+		t.Errorf("expected 1 commit, got %s", count)
+	}
+	if files, _ := runGit(dir, "show", "--name-only", "--format=%s", "HEAD"); files != "regenerate configs\n\ngen/app.conf" {
+		t.Errorf("unexpected commit %q", files)
+	}
+	if staged, _ := runGit(dir, "diff", "--cached", "--name-only"); staged != "notes.txt" {
+		t.Errorf("expected notes.txt to stay staged, got %q", staged)
+	}
+
+	outputDir = t.TempDir()
+	if err := runE(nil, []string{tmplFile}); err == nil || !strings.Contains(err.Error(), "requires a git work tree") {
+		t.Errorf("expected an error outside a work tree, got %v", err)
+	}
+}
+
+func TestRunE_GitCommitIgnoredAndPruned(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	origContent, origOutputDir, origCommit, origMessage := inputContent, outputDir, gitCommit, commitMessage
+	origManifest, origPrune, origIgnore := manifestPath, prune, gitignoreFile
+	t.Cleanup(func() {
+		inputContent, outputDir, gitCommit, commitMessage = origContent, origOutputDir, origCommit, origMessage
+		manifestPath, prune, gitignoreFile = origManifest, origPrune, origIgnore
+	})
+	for _, kv := range [][2]string{
+		{"GIT_CONFIG_GLOBAL", os.DevNull}, {"GIT_CONFIG_NOSYSTEM", "1"},
+		{"GIT_AUTHOR_NAME", "bot"}, {"GIT_AUTHOR_EMAIL", "bot@example.com"},
+		{"GIT_COMMITTER_NAME", "bot"}, {"GIT_COMMITTER_EMAIL", "bot@example.com"},
+	} {
+		t.Setenv(kv[0], kv[1])
+	}
+
+	dir := t.TempDir()
+	if _, err := runGit(dir, "init", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	tmplFile := filepath.Join(t.TempDir(), "tmpl.txt")
+	writeTemplate := func(content string) {
+		if err := os.WriteFile(tmplFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inputContent = "name: api"
+	outputDir = filepath.Join(dir, "gen")
+	manifestPath, prune = filepath.Join(dir, "simplate.lock"), true
+	gitCommit, commitMessage = true, "regenerate configs"
+
+	writeTemplate("#FILE:app.conf#name={{.name}}#FILE##FILE:old.conf#old#FILE#")
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+
+	// The new file is listed in .gitignore, so it is left out of the
+	// commit, while the pruned file is deleted in it
+	gitignoreFile = filepath.Join(dir, ".gitignore")
+	writeTemplate("#FILE:app.conf#name={{.name}}!#FILE##FILE:new.conf#new#FILE#")
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	want := "M\tgen/app.conf\nD\tgen/old.conf\nA\t.gitignore\nM\tsimplate.lock"
+	got, _ := runGit(dir, "show", "--name-status", "--format=", "HEAD")
+	if strings.Join(sortedLines(got), "\n") != strings.Join(sortedLines(want), "\n") {
+		t.Errorf("unexpected commit:\n%s\nwant:\n%s", got, want)
+	}
+	if staged, _ := runGit(dir, "diff", "--cached", "--name-only"); staged != "" {
+		t.Errorf("expected nothing left staged, got %q", staged)
+	}
+}
+
+// sortedLines returns the lines of s in sorted order.
+func sortedLines(s string) []string {
+	lines := strings.Split(s, "\n")
+	slices.Sort(lines)
+	return lines
+}
+
+func TestRunE_GitFiles(t *testing.T) {
+	origContent, origOutputDir, origIgnore, origAttrs := inputContent, outputDir, gitignoreFile, gitattrsFile
+	t.Cleanup(func() {
+		inputContent, outputDir, gitignoreFile, gitattrsFile = origContent, origOutputDir, origIgnore, origAttrs
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:api.go#package api#FILE##FILE:empty.go skip-empty##FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "{}"
+	outputDir = filepath.Join(dir, "gen")
+	gitignoreFile = filepath.Join(dir, ".gitignore")
+	gitattrsFile = filepath.Join(dir, ".gitattributes")
+	for range 2 {
+		if err := runE(nil, []string{tmplFile}); err != nil {
+			t.Fatalf("runE returned error: %v", err)
+		}
+	}
+	if got, _ := os.ReadFile(gitignoreFile); string(got) != "/gen/api.go\n" {
+		t.Errorf("unexpected .gitignore %q", got)
+	}
+	if got, _ := os.ReadFile(gitattrsFile); string(got) != "/gen/api.go linguist-generated=true\n" {
+		t.Errorf("unexpected .gitattributes %q", got)
+	}
+}
+
+func TestRunE_FormatOutput(t *testing.T) {
+	origContent, origOutputDir, origFormat := inputContent, outputDir, formatOutput
+	t.Cleanup(func() {
+		inputContent, outputDir, formatOutput = origContent, origOutputDir, origFormat
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:main.go#package main\nvar  x={{.x}}\n#FILE##FILE:bad.json#{#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "x: 1"
+	outputDir = filepath.Join(dir, "out")
+	formatOutput = true
+	err := runE(nil, []string{tmplFile})
+	if err == nil || !strings.Contains(err.Error(), "failed to format bad.json") {
+		t.Fatalf("expected a format error, got %v", err)
+	}
+
+	if err := os.WriteFile(tmplFile, []byte("#FILE:main.go#package main\nvar  x={{.x}}\n#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(outputDir, "main.go")); string(got) != "package main\n\nvar x = 1\n" {
+		t.Errorf("expected formatted Go code, got %q", got)
+	}
+}
+
+func TestRunE_CheckOutput(t *testing.T) {
+	origContent, origOutputDir, origCheck, origShell := inputContent, outputDir, checkOutput, checkShell
+	t.Cleanup(func() {
+		inputContent, outputDir, checkOutput, checkShell = origContent, origOutputDir, origCheck, origShell
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:app.toml#name = {{.name}}\n#FILE##FILE:run.sh#if true; then\n#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "name: api"
+	outputDir = filepath.Join(dir, "out")
+	checkOutput = true
+	err := runE(nil, []string{tmplFile})
+	if err == nil || !strings.Contains(err.Error(), "generated file app.toml (line 1) is invalid: toml: line 1: invalid value api") {
+		t.Fatalf("expected a check error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "app.toml")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written, got %v", err)
+	}
+
+	// Shell scripts are only checked with --check-shell
+	inputContent = "name: '\"api\"'"
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not installed")
+	}
+	checkShell = true
+	if err := runE(nil, []string{tmplFile}); err == nil || !strings.Contains(err.Error(), "generated file run.sh") {
+		t.Errorf("expected a shell check error, got %v", err)
+	}
+}
+
+func TestRunE_KeyFile(t *testing.T) {
+	origContent, origKeyFiles, origFromEnv := inputContent, keyFiles, fromEnvPrefix
+	t.Cleanup(func() {
+		inputContent, keyFiles, fromEnvPrefix = origContent, origKeyFiles, origFromEnv
+	})
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte("k3y\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("{{ .user }}:{{ .password }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	value, err := template.EncryptValue([]byte("p@ss"), []byte("k3y"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := func() (string, error) {
+		origStdout := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+		err := runE(nil, []string{tmplFile})
+		w.Close()
+		out, _ := io.ReadAll(r)
+		os.Stdout = origStdout
+		return string(out), err
+	}
+
+	// Decryption is opt-in: without --key-file, values are plain strings
+	inputContent = "user: ENC[v1]\npassword: \"$ANSIBLE_VAULT;1.1;AES256\""
+	out, err := render()
+	if err != nil {
+		t.Fatalf("runE returned error without --key-file: %v", err)
+	}
+	if out != "ENC[v1]:$ANSIBLE_VAULT;1.1;AES256" {
+		t.Errorf("expected the values unchanged, got %q", out)
+	}
+
+	inputContent = "user: app\npassword: " + value
+	keyFiles = []string{keyFile}
+	out, err = render()
+	if err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	if out != "app:p@ss" {
+		t.Errorf("expected the decrypted value, got %q", out)
+	}
+
+	// With --key-file, a value that cannot be decrypted fails the run
+	keyFiles = []string{"other=" + keyFile}
+	_, err = render()
+	if err == nil || !strings.Contains(err.Error(), "failed to decrypt the value of .password (line 2)") {
+		t.Fatalf("expected a decryption error, got %v", err)
+	}
+	if code := ExitCode(err); code != ExitData {
+		t.Errorf("expected exit code %d, got %d", ExitData, code)
+	}
+	keyFiles = []string{keyFile}
+
+	fromEnvPrefix = "APP"
+	if err := runE(nil, []string{tmplFile}); err == nil || !strings.Contains(err.Error(), "--from-env cannot be used with --key-file") {
+		t.Errorf("expected a flag conflict, got %v", err)
+	}
+}
+
+func TestRunE_EditorConfig(t *testing.T) {
+	origContent, origOutputDir, origEditorConfig := inputContent, outputDir, editorConfig
+	t.Cleanup(func() {
+		inputContent, outputDir, editorConfig = origContent, origOutputDir, origEditorConfig
+	})
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte("root = true\n[*.yaml]\nindent_style = space\nindent_size = 2\nend_of_line = crlf\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:values.yaml#a:\n\tb: 1\n#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "{}"
+	outputDir = filepath.Join(dir, "out")
+	editorConfig = true
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(outputDir, "values.yaml")); string(got) != "a:\r\n  b: 1\r\n" {
+		t.Errorf("expected normalized content, got %q", got)
+	}
+}
+
+func TestRunE_Dir(t *testing.T) {
+	origContent, origOutputDir := inputContent, outputDir
+	t.Cleanup(func() {
+		inputContent, outputDir = origContent, origOutputDir
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#DIR:{{.name}}/logs#\n#DIR:plugins:0700#\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "name: api"
+	outputDir = filepath.Join(dir, "out")
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	for path, mode := range map[string]os.FileMode{"api/logs": 0755, "plugins": 0700} {
+		info, err := os.Stat(filepath.Join(outputDir, path))
+		if err != nil || !info.IsDir() || info.Mode().Perm() != mode {
+			t.Errorf("expected directory %s with mode %04o, got %v, %v", path, mode, info, err)
+		}
+	}
+}
+
+func TestRunE_SkipUnchanged(t *testing.T) {
+	origContent, origOutputDir, origOutput, origSkip := inputContent, outputDir, outputFile, skipUnchanged
+	t.Cleanup(func() {
+		inputContent, outputDir, outputFile, skipUnchanged = origContent, origOutputDir, origOutput, origSkip
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("summary#FILE:app.conf#name={{.name}}#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "name: api"
+	outputDir = filepath.Join(dir, "out")
+	outputFile = filepath.Join(dir, "summary.txt")
+	skipUnchanged = true
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+
+	// Backdate the outputs so that a rewrite is visible in the mtime
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, path := range []string{filepath.Join(outputDir, "app.conf"), outputFile} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	for _, path := range []string{filepath.Join(outputDir, "app.conf"), outputFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(old) {
+			t.Errorf("%s: expected the modification time to be kept, got %v", path, info.ModTime())
+		}
+	}
+
+	storeDir = filepath.Join(dir, "store")
+	t.Cleanup(func() { storeDir = "" })
+	if err := runE(nil, []string{tmplFile}); err == nil || ExitCode(err) != ExitUsage {
+		t.Errorf("expected a usage error with --store, got %v", err)
+	}
+}
+
+func TestRunE_Backup(t *testing.T) {
+	origContent, origOutputDir, origBackup := inputContent, outputDir, backupSuffix
+	t.Cleanup(func() {
+		inputContent, outputDir, backupSuffix = origContent, origOutputDir, origBackup
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:app.conf#generated#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputDir = filepath.Join(dir, "out")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(outputDir, "app.conf")
+	if err := os.WriteFile(target, []byte("tweaked by hand"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "{}"
+	backupSuffix = ".orig"
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(target + ".orig"); string(got) != "tweaked by hand" {
+		t.Errorf("expected the previous version to be backed up, got %q", got)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "generated" {
+		t.Errorf("expected app.conf to be replaced, got %q", got)
+	}
+
+	backupSuffix = "../escape"
+	if err := runE(nil, []string{tmplFile}); err == nil || ExitCode(err) != ExitUsage {
+		t.Errorf("expected a usage error, got %v", err)
+	}
+}
+
+func TestRunE_Sandbox(t *testing.T) {
+	origContent, origOutput, origSandbox, origDirs := inputContent, outputFile, sandbox, fsReadDirs
+	t.Cleanup(func() {
+		inputContent, outputFile, sandbox, fsReadDirs = origContent, origOutput, origSandbox, origDirs
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte(`{{ env "HOME" }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "{}"
+	outputFile = filepath.Join(dir, "out.txt")
+	sandbox = true
+	err := runE(nil, []string{tmplFile})
+	if err == nil || !strings.Contains(err.Error(), `function "env" not defined`) {
+		t.Errorf("expected env to be undefined, got %v", err)
+	}
+
+	fsReadDirs = []string{dir}
+	err = runE(nil, []string{tmplFile})
+	if err == nil || ExitCode(err) != ExitUsage || !strings.Contains(err.Error(), "--allow-fs-read cannot be used with --sandbox") {
+		t.Errorf("expected a usage error, got %v", err)
+	}
+}
+
+func TestRunE_Compat(t *testing.T) {
+	origContent, origOutput, origSources, origCompat := inputContent, outputFile, datasources, compat
+	t.Cleanup(func() {
+		inputContent, outputFile, datasources, compat = origContent, origOutput, origSources, origCompat
+	})
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("replicas: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	tmpl := `{{ $c := overlay (ds "config") (dict "replicas" 3) }}{{ (ds "config").replicas }} {{ $c.replicas }}`
+	if err := os.WriteFile(tmplFile, []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "{}"
+	outputFile = filepath.Join(dir, "out.txt")
+	datasources = map[string]string{"config": filepath.Join(dir, "config.yaml")}
+	compat = []string{"ytt"}
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(outputFile); string(got) != "2 3" {
+		t.Errorf("expected %q, got %q", "2 3", got)
+	}
+
+	compat = []string{"helm"}
+	err := runE(nil, []string{tmplFile})
+	if err == nil || ExitCode(err) != ExitUsage || !strings.Contains(err.Error(), `invalid --compat value "helm"`) {
+		t.Errorf("expected a usage error, got %v", err)
+	}
+}
+
+func TestRunE_AllowEnv(t *testing.T) {
+	origContent, origOutput, origAllow := inputContent, outputFile, envAllowlist
+	t.Cleanup(func() {
+		inputContent, outputFile, envAllowlist = origContent, origOutput, origAllow
+	})
+	t.Setenv("SIMPLATE_TEST_STAGE", "prod")
+	t.Setenv("SIMPLATE_TEST_SECRET", "s3cr3t")
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte(`{{ env "SIMPLATE_TEST_STAGE" }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "{}"
+	outputFile = filepath.Join(dir, "out.txt")
+	envAllowlist = []string{"SIMPLATE_TEST_STAGE"}
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(outputFile); string(got) != "prod" {
+		t.Errorf("unexpected output %q", got)
+	}
+
+	if err := os.WriteFile(tmplFile, []byte(`{{ env "SIMPLATE_TEST_SECRET" }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := runE(nil, []string{tmplFile})
+	if err == nil || !strings.Contains(err.Error(), `variable "SIMPLATE_TEST_SECRET" is not allowed`) {
+		t.Errorf("expected the variable to be denied, got %v", err)
+	}
+}
+
+func TestRunE_OutputArchive(t *testing.T) {
+	origContent, origOutputDir, origArchive, origStore := inputContent, outputDir, outputArchive, storeDir
+	t.Cleanup(func() {
+		inputContent, outputDir, outputArchive, storeDir = origContent, origOutputDir, origArchive, origStore
+	})
+
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:conf/{{.name}}.yaml#name: {{.name}}#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "name: api"
+	outputDir = "release" // Directory inside the archive
+	outputArchive = filepath.Join(dir, "bundle.tar.gz")
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Errorf("expected the output directory not to be created, got %v", err)
+	}
+
+	f, err := os.Open(outputArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("expected a gzip archive: %v", err)
+	}
+	var names []string
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid archive: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+	want := []string{"release/", "release/conf/", "release/conf/api.yaml"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("expected entries %v, got %v", want, names)
+	}
+
+	storeDir = filepath.Join(dir, "store")
+	err = runE(nil, []string{tmplFile})
+	if err == nil || ExitCode(err) != ExitUsage || !strings.Contains(err.Error(), "--store cannot be used with --output-archive") {
+		t.Errorf("expected a usage error, got %v", err)
+	}
+
+	storeDir = ""
+	outputArchive = filepath.Join(dir, "bundle.zip")
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+	zipReader, err := zip.OpenReader(outputArchive)
+	if err != nil {
+		t.Fatalf("expected a zip archive: %v", err)
+	}
+	defer zipReader.Close()
+	names = nil
+	for _, f := range zipReader.File {
+		names = append(names, f.Name)
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("expected zip entries %v, got %v", want, names)
+	}
+
+	outputArchive = filepath.Join(dir, "bundle.rar")
+	if err := runE(nil, []string{tmplFile}); err == nil || ExitCode(err) != ExitUsage {
+		t.Errorf("expected a usage error for an unknown format, got %v", err)
+	}
+}
+
+func TestRunE_PRPayload(t *testing.T) {
+	origContent, origOutputDir, origPayload, origMessage := inputContent, outputDir, prPayloadFile, commitMessage
+	t.Cleanup(func() {
+		inputContent, outputDir, prPayloadFile, commitMessage = origContent, origOutputDir, origPayload, origMessage
+	})
+	tmplFile := filepath.Join(t.TempDir(), "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:app.conf#name={{.name}}\n#FILE##FILE:static.txt#static\n#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputDir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(outputDir, "static.txt"), []byte("static\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prPayloadFile = filepath.Join(t.TempDir(), "pr.json")
+	commitMessage = "Bump app config"
+
+	for i, name := range []string{"api", "web"} {
+		inputContent = "name: " + name
+		if err := runE(nil, []string{tmplFile}); err != nil {
+			t.Fatalf("runE returned error: %v", err)
+		}
+		data, err := os.ReadFile(prPayloadFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payload template.PullRequestPayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			t.Fatalf("invalid payload: %v", err)
+		}
+		if payload.Title != "Bump app config" || len(payload.Files) != 1 || payload.Files[0].Path != "app.conf" || payload.Report.Unchanged != 1 {
+			t.Fatalf("unexpected payload %s", data)
+		}
+		if i == 1 && (payload.Files[0].Action != "update" || !strings.Contains(payload.Files[0].Diff, "-name=api\n+name=web\n")) {
+			t.Errorf("expected an update from api to web, got %+v", payload.Files[0])
+		}
+	}
+}
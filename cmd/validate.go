@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/danarchy-io/simplate/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+var (
+	validateSchemaFile string
+	validateLintFile   string
+	validateKeyFiles   []string
+
+	validateCmd = &cobra.Command{
+		Use:   "validate [flags] <input-file | ->",
+		Short: "Validate input data against a JSON Schema",
+		Long: `Validate loads a YAML data file (or stdin when the argument is '-') and
+validates it against a JSON Schema without rendering any template. All
+violations are reported and the command exits non-zero on failure.
+Violations of the --lint-schema are printed as warnings without failing.`,
+		Args: usageArgs(cobra.ExactArgs(1)),
+		RunE: validateRunE,
+	}
+)
+
+func init() {
+	validateCmd.Flags().StringVarP(&validateSchemaFile, "input-schema-file", "s", "", "Input jsonschema file")
+	validateCmd.Flags().StringVar(&validateLintFile, "lint-schema", "", "JSON Schema whose violations are printed as warnings without failing")
+	validateCmd.Flags().StringArrayVar(&validateKeyFiles, "key-file", nil, "File holding the key of the encrypted values of the data, as path or id=path (repeatable)")
+	rootCmd.AddCommand(validateCmd)
+}
+
+func validateRunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one input file must be provided")
+	}
+	if validateSchemaFile == "" && validateLintFile == "" {
+		return withExitCode(ExitUsage, fmt.Errorf("no schema provided. Use the --input-schema-file or --lint-schema flag"))
+	}
+	if cmd != nil {
+		cmd.SilenceUsage = true
+	}
+
+	inputFile := args[0]
+	var dataBytes []byte
+	var err error
+	if inputFile == "-" {
+		dataBytes, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return withExitCode(ExitData, fmt.Errorf("failed to read data from stdin: %w", err))
+		}
+		inputFile = "stdin"
+	} else {
+		dataBytes, err = os.ReadFile(inputFile)
+		if err != nil {
+			return withExitCode(ExitData, fmt.Errorf("failed to read YAML data from file '%s': %w", inputFile, err))
+		}
+	}
+
+	provider := template.YamlProvider(dataBytes)
+	if len(validateKeyFiles) > 0 {
+		keys, err := keyFileProvider(validateKeyFiles)
+		if err != nil {
+			return withExitCode(ExitUsage, err)
+		}
+		provider = template.DecryptingYamlProvider(dataBytes, keys)
+	}
+	data, err := provider()
+	if err != nil {
+		return withExitCode(ExitData, err)
+	}
+
+	if validateSchemaFile != "" {
+		schemaBytes, err := os.ReadFile(validateSchemaFile)
+		if err != nil {
+			return fmt.Errorf("failed to read schema file '%v': %w", validateSchemaFile, err)
+		}
+		if err := template.WithJsonSchemaValidation(schemaBytes)(data); err != nil {
+			var schemaErr *template.SchemaError
+			if errors.As(err, &schemaErr) {
+				schemaErr.SetLines(dataBytes)
+			}
+			return fmt.Errorf("%s is invalid: %w", inputFile, err)
+		}
+	}
+
+	if validateLintFile != "" {
+		lintBytes, err := os.ReadFile(validateLintFile)
+		if err != nil {
+			return fmt.Errorf("failed to read lint schema file '%v': %w", validateLintFile, err)
+		}
+		warnings, err := template.LintJsonSchema(data, lintBytes)
+		if err != nil {
+			return err
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(messageOutput(), "warning: lint: %s\n", w)
+		}
+	}
+
+	if !quiet {
+		fmt.Fprintf(os.Stdout, "%s is valid\n", inputFile)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const validateTestSchema = `{
+	"type":"object",
+	"properties":{
+		"name":{"type":"string"},
+		"port":{"type":"integer"}
+	},
+	"required":["name","port"]
+}`
+
+func TestValidateRunE(t *testing.T) {
+	origSchema, origLint := validateSchemaFile, validateLintFile
+	t.Cleanup(func() { validateSchemaFile, validateLintFile = origSchema, origLint })
+
+	dir := t.TempDir()
+	schemaFile := filepath.Join(dir, "schema.json")
+	if err := os.WriteFile(schemaFile, []byte(validateTestSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	validFile := filepath.Join(dir, "valid.yml")
+	if err := os.WriteFile(validFile, []byte("name: api\nport: 8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lintFile := filepath.Join(dir, "lint.json")
+	if err := os.WriteFile(lintFile, []byte(`{"required":["owner"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalidFile := filepath.Join(dir, "invalid.yml")
+	if err := os.WriteFile(invalidFile, []byte("name: 42\nport: http\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		schema  string
+		lint    string
+		args    []string
+		wantErr []string
+		wantOut string
+	}{
+		{name: "valid", schema: schemaFile, args: []string{validFile}, wantOut: "is valid"},
+		{name: "reports all violations", schema: schemaFile, args: []string{invalidFile}, wantErr: []string{".name: expected string, but got number (line 1)", ".port: expected integer, but got string (line 2)"}},
+		{name: "lint violations only warn", schema: schemaFile, lint: lintFile, args: []string{validFile}, wantOut: "is valid"},
+		{name: "lint schema alone", lint: lintFile, args: []string{validFile}, wantOut: "is valid"},
+		{name: "no schema", schema: "", args: []string{validFile}, wantErr: []string{"no schema provided"}},
+		{name: "missing data file", schema: schemaFile, args: []string{filepath.Join(dir, "nope.yml")}, wantErr: []string{"failed to read YAML data"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			validateSchemaFile, validateLintFile = tc.schema, tc.lint
+
+			// capture stdout
+			origStdout := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			err := validateRunE(nil, tc.args)
+			w.Close()
+			out, _ := io.ReadAll(r)
+			os.Stdout = origStdout
+
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !bytes.Contains(out, []byte(tc.wantOut)) {
+					t.Errorf("output %q does not contain %q", out, tc.wantOut)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error containing %q, got nil", tc.wantErr)
+			}
+			for _, want := range tc.wantErr {
+				if !bytes.Contains([]byte(err.Error()), []byte(want)) {
+					t.Errorf("error %q does not contain %q", err.Error(), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"cmp"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danarchy-io/simplate/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyKeyFile   string
+	verifyOutputDir string
+
+	verifyCmd = &cobra.Command{
+		Use:   "verify-outputs [flags] <file>...",
+		Short: "Verify the signatures of generated files",
+		Long: `Verify-outputs checks that generated files were not changed since they were
+signed with --sign-key. Each file is verified against its detached signature
+<file>` + template.SignatureExtension + ` using the matching Ed25519 public key. Signatures cover the path
+of each file relative to the output directory, so pass the directory the
+files were generated in with --output-dir. All files are checked and the
+command exits non-zero if any of them fails.`,
+		Args: usageArgs(cobra.MinimumNArgs(1)),
+		RunE: verifyRunE,
+	}
+)
+
+func init() {
+	verifyCmd.Flags().StringVarP(&verifyKeyFile, "key", "k", "", "Ed25519 public key (PEM) matching the signing key")
+	verifyCmd.Flags().StringVarP(&verifyOutputDir, "output-dir", "o", "", "Output directory the files were generated in (default: current directory)")
+	rootCmd.AddCommand(verifyCmd)
+}
+
+func verifyRunE(cmd *cobra.Command, args []string) error {
+	if verifyKeyFile == "" {
+		return withExitCode(ExitUsage, fmt.Errorf("no public key provided. Use the --key flag"))
+	}
+	if cmd != nil {
+		cmd.SilenceUsage = true
+	}
+
+	keyBytes, err := os.ReadFile(verifyKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read public key '%v': %w", verifyKeyFile, err)
+	}
+	key, err := template.ParsePublicKey(keyBytes)
+	if err != nil {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid public key '%v': %w", verifyKeyFile, err))
+	}
+
+	failed := 0
+	for _, file := range args {
+		if err := verifyFile(key, file); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			failed++
+			continue
+		}
+		if !quiet {
+			fmt.Fprintf(os.Stdout, "%s: OK\n", file)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed verification", failed, len(args))
+	}
+	return nil
+}
+
+// verifyFile checks file against its detached signature file.
+func verifyFile(key ed25519.PublicKey, file string) error {
+	dir, err := filepath.Abs(cmp.Or(verifyOutputDir, "."))
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	path, err := filepath.Rel(dir, abs)
+	if err != nil || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("not inside the output directory %s", dir)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	signature, err := os.ReadFile(file + template.SignatureExtension)
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+	return template.VerifySignature(key, path, content, signature)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyRunE(t *testing.T) {
+	origContent, origOutputDir, origSignKey, origVerifyKey, origVerifyDir := inputContent, outputDir, signKeyFile, verifyKeyFile, verifyOutputDir
+	t.Cleanup(func() {
+		inputContent, outputDir, signKeyFile, verifyKeyFile, verifyOutputDir = origContent, origOutputDir, origSignKey, origVerifyKey, origVerifyDir
+	})
+
+	dir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDER, _ := x509.MarshalPKCS8PrivateKey(priv)
+	pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+	signKeyFile = filepath.Join(dir, "key.pem")
+	verifyKeyFile = filepath.Join(dir, "key.pub")
+	os.WriteFile(signKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600)
+	os.WriteFile(verifyKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644)
+
+	tmplFile := filepath.Join(dir, "tmpl.txt")
+	if err := os.WriteFile(tmplFile, []byte("#FILE:a.conf#a={{.a}}#FILE##FILE:b.conf#b#FILE#"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputContent = "a: 1"
+	outputDir = filepath.Join(dir, "out")
+	if err := runE(nil, []string{tmplFile}); err != nil {
+		t.Fatalf("runE returned error: %v", err)
+	}
+
+	files := []string{filepath.Join(outputDir, "a.conf"), filepath.Join(outputDir, "b.conf")}
+	verifyOutputDir = outputDir
+	if err := verifyRunE(nil, files); err != nil {
+		t.Fatalf("verifyRunE returned error: %v", err)
+	}
+
+	// Signatures cover the path, so a signed file cannot replace another
+	swapped := filepath.Join(outputDir, "swapped.conf")
+	copyFile(t, files[1], swapped)
+	copyFile(t, files[1]+".sig", swapped+".sig")
+	if err := verifyRunE(nil, []string{swapped}); err == nil {
+		t.Error("expected a moved file to fail verification")
+	}
+	verifyOutputDir = dir
+	if err := verifyRunE(nil, files); err == nil || err.Error() != "2 of 2 files failed verification" {
+		t.Errorf("expected a verification failure with another output directory, got %v", err)
+	}
+	verifyOutputDir = outputDir
+
+	if err := os.WriteFile(files[0], []byte("a=2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyRunE(nil, files); err == nil || err.Error() != "1 of 2 files failed verification" {
+		t.Errorf("expected a verification failure, got %v", err)
+	}
+
+	verifyKeyFile = ""
+	if err := verifyRunE(nil, files); ExitCode(err) != ExitUsage {
+		t.Errorf("expected a usage error without --key, got %v", err)
+	}
+}
+
+// copyFile copies the file src to dst.
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
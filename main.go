@@ -11,6 +11,6 @@ var version = "dev" // Set via ldflags during build
 func main() {
 	cmd.SetVersion(version)
 	if err := cmd.Execute(); err != nil {
-		os.Exit(1)
+		os.Exit(cmd.ExitCode(err))
 	}
 }
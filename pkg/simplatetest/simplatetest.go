@@ -0,0 +1,205 @@
+// Package simplatetest helps projects that embed simplate to unit-test their
+// templates: templates are rendered in memory, environment variables, the
+// time and random values can be fixed, and results can be compared with
+// golden files.
+//
+//	func TestConfig(t *testing.T) {
+//		result := simplatetest.Render(t, tmpl, data, simplatetest.WithEnv(map[string]string{"STAGE": "dev"}))
+//		simplatetest.AssertGolden(t, "testdata/config", result)
+//	}
+package simplatetest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	gotemplate "text/template"
+	"time"
+
+	"github.com/danarchy-io/simplate/pkg/template"
+)
+
+// UpdateEnv is the environment variable that makes AssertGolden write the
+// golden files instead of comparing against them, e.g.
+// SIMPLATE_UPDATE_GOLDEN=1 go test ./...
+const UpdateEnv = "SIMPLATE_UPDATE_GOLDEN"
+
+// Result is the output of a render: the stdout content and the files the
+// template generated, by path.
+type Result struct {
+	Stdout string
+	Files  map[string]string
+	Modes  map[string]os.FileMode // Requested mode per file (0 = default)
+}
+
+// Render renders templ with data entirely in memory and fails the test if
+// rendering fails. Options are passed to the engine as given.
+func Render(t testing.TB, templ []byte, data any, opts ...template.Option) *Result {
+	t.Helper()
+	result, err := TryRender(templ, data, opts...)
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	return result
+}
+
+// TryRender is like Render but returns the error, e.g. to test that invalid
+// data is rejected.
+func TryRender(templ []byte, data any, opts ...template.Option) (*Result, error) {
+	var stdout bytes.Buffer
+	writer := &template.MemoryFileWriter{}
+	if err := template.ExecuteWithFiles(template.AnyProvider(data), templ, &stdout, writer, opts...); err != nil {
+		return nil, err
+	}
+	result := &Result{Stdout: stdout.String(), Files: make(map[string]string), Modes: make(map[string]os.FileMode)}
+	for path, content := range writer.Files {
+		result.Files[path] = string(content)
+		result.Modes[path] = writer.Modes[path]
+	}
+	return result, nil
+}
+
+// WithEnv returns an Option that makes the env and envOrDefault template
+// functions read vars instead of the process environment. It is a shortcut
+// for template.WithEnviron.
+func WithEnv(vars map[string]string) template.Option {
+	return template.WithEnviron(vars)
+}
+
+// WithTime returns an Option that makes the now and date template functions
+// return t instead of the current time. It is a shortcut for
+// template.WithClock(template.FixedClock(t)).
+func WithTime(t time.Time) template.Option {
+	return template.WithClock(template.FixedClock(t))
+}
+
+// WithFixedUUIDs returns an Option that makes uuidv4 return predictable
+// UUIDs, numbered from 1 in the order of the calls:
+// 00000000-0000-4000-8000-000000000001, 00000000-0000-4000-8000-000000000002
+// and so on. Numbering restarts with every render, also when the option is
+// reused. Segments rendered concurrently with template.WithParallel call
+// uuidv4 in no fixed order, so render sequentially for predictable UUIDs.
+func WithFixedUUIDs() template.Option {
+	return template.WithRenderFuncs(func() gotemplate.FuncMap {
+		var mu sync.Mutex
+		n := 0
+		return gotemplate.FuncMap{
+			"uuidv4": func() string {
+				mu.Lock()
+				defer mu.Unlock()
+				n++
+				return fmt.Sprintf("00000000-0000-4000-8000-%012d", n)
+			},
+		}
+	})
+}
+
+// AssertGolden compares result with the golden files in dir: dir/stdout
+// holds the expected stdout content (absent if stdout is empty) and
+// dir/files/ the expected generated files. Missing, unexpected and
+// different files are reported as test errors. With SIMPLATE_UPDATE_GOLDEN
+// set, the golden files are written from result instead.
+func AssertGolden(t testing.TB, dir string, result *Result) {
+	t.Helper()
+	if os.Getenv(UpdateEnv) != "" {
+		if err := writeGolden(dir, result); err != nil {
+			t.Fatalf("failed to update golden files: %v", err)
+		}
+		return
+	}
+
+	want, err := readGolden(dir)
+	if err != nil {
+		t.Fatalf("failed to read golden files (set %s=1 to create them): %v", UpdateEnv, err)
+	}
+	if result.Stdout != want.Stdout {
+		t.Errorf("stdout differs from %s:\n got: %q\nwant: %q", filepath.Join(dir, "stdout"), result.Stdout, want.Stdout)
+	}
+	for _, path := range sortedKeys(want.Files) {
+		got, ok := result.Files[path]
+		switch {
+		case !ok:
+			t.Errorf("expected file %s was not generated", path)
+		case got != want.Files[path]:
+			t.Errorf("file %s differs from %s:\n got: %q\nwant: %q", path, filepath.Join(dir, "files", path), got, want.Files[path])
+		}
+	}
+	for _, path := range sortedKeys(result.Files) {
+		if _, ok := want.Files[path]; !ok {
+			t.Errorf("unexpected file %s was generated", path)
+		}
+	}
+}
+
+// writeGolden replaces the golden files in dir with result.
+func writeGolden(dir string, result *Result) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if result.Stdout != "" {
+		if err := os.WriteFile(filepath.Join(dir, "stdout"), []byte(result.Stdout), 0644); err != nil {
+			return err
+		}
+	}
+	for path, content := range result.Files {
+		golden := filepath.Join(dir, "files", filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(golden, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readGolden reads the golden files in dir.
+func readGolden(dir string) (*Result, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	want := &Result{Files: make(map[string]string)}
+	stdout, err := os.ReadFile(filepath.Join(dir, "stdout"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	want.Stdout = string(stdout)
+
+	filesDir := filepath.Join(dir, "files")
+	err = filepath.WalkDir(filesDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(filesDir, path)
+		if err != nil {
+			return err
+		}
+		want.Files[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return want, nil
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
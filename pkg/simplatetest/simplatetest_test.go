@@ -0,0 +1,79 @@
+package simplatetest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	tmpl := []byte(`stage={{ env "STAGE" }} region={{ envOrDefault "REGION" "eu" }} day={{ date "2006-01-02" }}
+#FILE:ids/{{ .name }}.txt:0600#{{ uuidv4 }} {{ uuidv4 }}#FILE#`)
+	result := Render(t, tmpl, map[string]any{"name": "api"},
+		WithEnv(map[string]string{"STAGE": "dev"}), WithFixedUUIDs(),
+		WithTime(time.Date(2024, 5, 17, 9, 0, 0, 0, time.UTC)))
+
+	if result.Stdout != "stage=dev region=eu day=2024-05-17\n" {
+		t.Errorf("unexpected stdout %q", result.Stdout)
+	}
+	want := "00000000-0000-4000-8000-000000000001 00000000-0000-4000-8000-000000000002"
+	if got := result.Files["ids/api.txt"]; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if result.Modes["ids/api.txt"] != 0600 {
+		t.Errorf("unexpected mode %v", result.Modes["ids/api.txt"])
+	}
+
+	if _, err := TryRender([]byte("{{ .name.key }}"), map[string]any{"name": "api"}); err == nil {
+		t.Error("expected a render error")
+	}
+}
+
+func TestWithFixedUUIDs_Reused(t *testing.T) {
+	uuids := WithFixedUUIDs()
+	for i := 0; i < 2; i++ {
+		result := Render(t, []byte("{{ uuidv4 }}"), map[string]any{}, uuids)
+		if want := "00000000-0000-4000-8000-000000000001"; result.Stdout != want {
+			t.Errorf("render %d: expected %q, got %q", i+1, want, result.Stdout)
+		}
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "golden")
+	result := &Result{Stdout: "summary\n", Files: map[string]string{"a.txt": "a", "sub/b.txt": "b"}}
+
+	t.Setenv(UpdateEnv, "1")
+	AssertGolden(t, dir, result)
+	if content, err := os.ReadFile(filepath.Join(dir, "files", "sub", "b.txt")); err != nil || string(content) != "b" {
+		t.Fatalf("expected golden file to be written, got %q, %v", content, err)
+	}
+
+	t.Setenv(UpdateEnv, "")
+	AssertGolden(t, dir, result)
+
+	// Differences are reported as errors of the test passed in
+	for name, changed := range map[string]*Result{
+		"stdout":     {Stdout: "other\n", Files: result.Files},
+		"content":    {Stdout: result.Stdout, Files: map[string]string{"a.txt": "x", "sub/b.txt": "b"}},
+		"missing":    {Stdout: result.Stdout, Files: map[string]string{"a.txt": "a"}},
+		"unexpected": {Stdout: result.Stdout, Files: map[string]string{"a.txt": "a", "sub/b.txt": "b", "c.txt": "c"}},
+	} {
+		inner := &fakeTB{}
+		AssertGolden(inner, dir, changed)
+		if !inner.failed {
+			t.Errorf("%s: expected AssertGolden to fail", name)
+		}
+	}
+}
+
+// fakeTB records failures instead of failing the test.
+type fakeTB struct {
+	testing.TB
+	failed bool
+}
+
+func (f *fakeTB) Helper()                        {}
+func (f *fakeTB) Errorf(format string, a ...any) { f.failed = true }
+func (f *fakeTB) Fatalf(format string, a ...any) { f.failed = true }
@@ -0,0 +1,289 @@
+package template
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// assumedIterations is the number of elements a range or FILE-EACH list is
+// assumed to have when estimating the render cost of a template.
+const assumedIterations = 10
+
+// TemplateMetrics describes the size and complexity of a template, see
+// AnalyzeTemplate.
+type TemplateMetrics struct {
+	Lines        int `json:"lines"`
+	Bytes        int `json:"bytes"`
+	Segments     int `json:"segments"`
+	FileSegments int `json:"fileSegments"`
+	DirSegments  int `json:"dirSegments"`
+	// Actions is the number of {{ }} actions, including control structures.
+	Actions int `json:"actions"`
+	// Variables are the distinct data fields referenced, e.g. ".app.name",
+	// as written: inside range and with, they are relative to the element.
+	Variables []string `json:"variables"`
+	// Defines are the names of the templates defined with define or block.
+	Defines []string `json:"defines"`
+	// MaxDepth is the deepest nesting of if, range and with blocks.
+	MaxDepth int `json:"maxDepth"`
+	// Includes is the include graph: which segments and defined templates
+	// use which defined templates, with include or template.
+	Includes []IncludeEdge `json:"includes"`
+	// Cost estimates the work of a render, in nodes evaluated: nodes in a
+	// range or FILE-EACH block count assumedIterations times, and include
+	// and template calls add the cost of the called template. It is meant
+	// for comparing templates, not as a time.
+	Cost int `json:"cost"`
+}
+
+// IncludeEdge is an edge of the include graph of a template.
+type IncludeEdge struct {
+	// From is the name of the defined template, or the name of the segment
+	// (see SegmentName), using To.
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Line is the line of the template where the call is.
+	Line int `json:"line"`
+}
+
+// SegmentName names a segment in reports: "FILE <filename>" or
+// "DIR <path>" with the unrendered path, or "stdout:<line>".
+func SegmentName(s Segment) string {
+	switch s.Type {
+	case SegmentFile:
+		return "FILE " + string(s.Filename)
+	case SegmentDir:
+		return "DIR " + string(s.Filename)
+	}
+	return fmt.Sprintf("stdout:%d", s.Line)
+}
+
+// AnalyzeTemplate returns metrics of the template, named name in errors,
+// without rendering it, to spot templates that should be split. Functions
+// are not checked, so templates using plugin functions can be analyzed.
+// Syntax errors are returned as *TemplateError values.
+func AnalyzeTemplate(name string, templateBytes []byte) (*TemplateMetrics, error) {
+	segments, err := ParseSegments(templateBytes)
+	if err != nil {
+		return nil, err
+	}
+	a := &analyzer{
+		metrics: &TemplateMetrics{
+			Lines:     strings.Count(string(templateBytes), "\n"),
+			Bytes:     len(templateBytes),
+			Segments:  len(segments),
+			Variables: []string{},
+			Defines:   []string{},
+			Includes:  []IncludeEdge{},
+		},
+		variables: map[string]bool{},
+		defines:   map[string]*parse.Tree{},
+		starts:    map[*parse.Tree]position{},
+		costs:     map[string]int{},
+	}
+	if len(templateBytes) > 0 && templateBytes[len(templateBytes)-1] != '\n' {
+		a.metrics.Lines++
+	}
+
+	type parsedSegment struct {
+		segment        Segment
+		filename, body *parse.Tree
+	}
+	var parsed []parsedSegment
+	for _, segment := range segments {
+		p := parsedSegment{segment: segment}
+		switch segment.Type {
+		case SegmentFile:
+			a.metrics.FileSegments++
+		case SegmentDir:
+			a.metrics.DirSegments++
+		}
+		if segment.Type != SegmentStdout {
+			if p.filename, err = a.parse(name, segment.Filename, segment.filenamePos()); err != nil {
+				return nil, err
+			}
+		}
+		if p.body, err = a.parse(name, segment.Content, segment.contentPos()); err != nil {
+			return nil, err
+		}
+		if len(segment.Each) > 0 {
+			a.variables[string(segment.Each)] = true
+		}
+		parsed = append(parsed, p)
+	}
+
+	for _, p := range parsed {
+		from := SegmentName(p.segment)
+		iterations := 1
+		if len(p.segment.Each) > 0 {
+			iterations = assumedIterations
+		}
+		for _, tree := range []*parse.Tree{p.filename, p.body} {
+			if tree != nil && tree.Root != nil {
+				a.metrics.Cost += iterations * a.walk(from, tree, tree.Root, 0, true)
+			}
+		}
+	}
+	for name := range a.defines {
+		a.metrics.Defines = append(a.metrics.Defines, name)
+	}
+	sort.Strings(a.metrics.Defines)
+	for _, name := range a.metrics.Defines {
+		tree := a.defines[name]
+		a.walk(name, tree, tree.Root, 0, true)
+	}
+	for v := range a.variables {
+		a.metrics.Variables = append(a.metrics.Variables, v)
+	}
+	sort.Strings(a.metrics.Variables)
+	return a.metrics, nil
+}
+
+// analyzer collects the metrics of AnalyzeTemplate.
+type analyzer struct {
+	metrics   *TemplateMetrics
+	variables map[string]bool
+	defines   map[string]*parse.Tree   // The first definition of a name wins, as in collectDefines
+	starts    map[*parse.Tree]position // Where the text of trees starts in the template
+	costs     map[string]int           // Costs of defined templates, -1 while computing
+}
+
+// parse parses src, starting at start in the template named name, without
+// checking functions, and collects its definitions.
+func (a *analyzer) parse(name string, src []byte, start position) (*parse.Tree, error) {
+	tree := parse.New(name)
+	tree.Mode = parse.SkipFuncCheck
+	treeSet := map[string]*parse.Tree{}
+	if _, err := tree.Parse(string(src), "", "", treeSet); err != nil {
+		return nil, locateError(err, name, start)
+	}
+	a.starts[tree] = start
+	for defName, def := range treeSet {
+		if def == tree {
+			continue
+		}
+		a.starts[def] = start
+		if _, ok := a.defines[defName]; !ok {
+			a.defines[defName] = def
+		}
+	}
+	return tree, nil
+}
+
+// walk visits node, nested depth blocks deep in tree, which belongs to
+// from (see IncludeEdge), and returns its cost. With count, its actions,
+// variables, depth and include edges are recorded; called templates are
+// walked for their cost only.
+func (a *analyzer) walk(from string, tree *parse.Tree, node parse.Node, depth int, count bool) int {
+	if count && depth > a.metrics.MaxDepth {
+		a.metrics.MaxDepth = depth
+	}
+	switch n := node.(type) {
+	case *parse.ListNode:
+		cost := 0
+		if n != nil {
+			for _, child := range n.Nodes {
+				cost += a.walk(from, tree, child, depth, count)
+			}
+		}
+		return cost
+	case *parse.ActionNode:
+		if count {
+			a.metrics.Actions++
+		}
+		return 1 + a.walk(from, tree, n.Pipe, depth, count)
+	case *parse.IfNode:
+		return a.walkBranch(from, tree, &n.BranchNode, depth, 1, count)
+	case *parse.WithNode:
+		return a.walkBranch(from, tree, &n.BranchNode, depth, 1, count)
+	case *parse.RangeNode:
+		return a.walkBranch(from, tree, &n.BranchNode, depth, assumedIterations, count)
+	case *parse.TemplateNode:
+		if count {
+			a.metrics.Actions++
+			a.addEdge(from, n.Name, tree, n)
+		}
+		return 1 + a.walk(from, tree, n.Pipe, depth, count) + a.defineCost(n.Name)
+	case *parse.PipeNode:
+		cost := 0
+		if n != nil {
+			for _, cmd := range n.Cmds {
+				cost += a.walk(from, tree, cmd, depth, count)
+			}
+		}
+		return cost
+	case *parse.CommandNode:
+		cost := 0
+		for i, arg := range n.Args {
+			cost += a.walk(from, tree, arg, depth, count)
+			// include "name" data
+			if id, ok := arg.(*parse.IdentifierNode); ok && id.Ident == "include" && i+1 < len(n.Args) {
+				if s, ok := n.Args[i+1].(*parse.StringNode); ok {
+					if count {
+						a.addEdge(from, s.Text, tree, s)
+					}
+					cost += a.defineCost(s.Text)
+				}
+			}
+		}
+		return cost
+	case *parse.FieldNode:
+		if count {
+			a.variables["."+strings.Join(n.Ident, ".")] = true
+		}
+	case *parse.VariableNode:
+		// $.a.b is the field .a.b of the data
+		if count && n.Ident[0] == "$" && len(n.Ident) > 1 {
+			a.variables["."+strings.Join(n.Ident[1:], ".")] = true
+		}
+	case *parse.ChainNode:
+		return a.walk(from, tree, n.Node, depth, count)
+	}
+	return 1
+}
+
+// walkBranch walks an if, with or range block whose body runs iterations
+// times, and returns its cost.
+func (a *analyzer) walkBranch(from string, tree *parse.Tree, n *parse.BranchNode, depth, iterations int, count bool) int {
+	if count {
+		a.metrics.Actions++
+	}
+	cost := 1 + a.walk(from, tree, n.Pipe, depth, count)
+	cost += iterations * a.walk(from, tree, n.List, depth+1, count)
+	if n.ElseList != nil {
+		cost += a.walk(from, tree, n.ElseList, depth+1, count)
+	}
+	return cost
+}
+
+// addEdge records that from uses the defined template to at node.
+func (a *analyzer) addEdge(from, to string, tree *parse.Tree, node parse.Node) {
+	edge := IncludeEdge{From: from, To: to}
+	// ErrorContext returns "name:line:col", with the line in the tree's text
+	location, _ := tree.ErrorContext(node)
+	if parts := strings.Split(location, ":"); len(parts) >= 3 {
+		if line, err := strconv.Atoi(parts[len(parts)-2]); err == nil {
+			edge.Line = a.starts[tree].line + line - 1
+		}
+	}
+	a.metrics.Includes = append(a.metrics.Includes, edge)
+}
+
+// defineCost returns the cost of the defined template name. Recursive
+// calls and undefined templates cost nothing.
+func (a *analyzer) defineCost(name string) int {
+	if cost, ok := a.costs[name]; ok {
+		return max(cost, 0)
+	}
+	tree, ok := a.defines[name]
+	if !ok || tree.Root == nil {
+		return 0
+	}
+	a.costs[name] = -1
+	cost := a.walk(name, tree, tree.Root, 0, false)
+	a.costs[name] = cost
+	return cost
+}
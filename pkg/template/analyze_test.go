@@ -0,0 +1,86 @@
+package template
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeTemplate(t *testing.T) {
+	tmpl := []byte(`{{ define "labels" }}app: {{ .app.name }}{{ template "name" . }}{{ end }}
+{{- define "name" }}{{ .app.name }}{{ end -}}
+header {{ $.version }}
+#DIR:logs#
+#FILE-EACH:.services:deploy/{{ .name }}.yaml#
+{{ include "labels" $ }}
+{{ range .ports }}{{ if .public }}{{ with .host }}{{ . }}{{ end }}{{ end }}{{ end }}
+#FILE#
+`)
+	metrics, err := AnalyzeTemplate("app.tmpl", tmpl)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if metrics.Lines != 8 || metrics.Bytes != len(tmpl) {
+		t.Errorf("expected 8 lines and %d bytes, got %d and %d", len(tmpl), metrics.Lines, metrics.Bytes)
+	}
+	if metrics.Segments != 3 || metrics.FileSegments != 1 || metrics.DirSegments != 1 {
+		t.Errorf("unexpected segment counts %+v", metrics)
+	}
+	if metrics.MaxDepth != 3 {
+		t.Errorf("expected depth 3, got %d", metrics.MaxDepth)
+	}
+	if metrics.Actions != 10 {
+		t.Errorf("expected 10 actions, got %d", metrics.Actions)
+	}
+	if want := []string{".app.name", ".host", ".name", ".ports", ".public", ".services", ".version"}; !reflect.DeepEqual(metrics.Variables, want) {
+		t.Errorf("expected variables %v, got %v", want, metrics.Variables)
+	}
+	if want := []string{"labels", "name"}; !reflect.DeepEqual(metrics.Defines, want) {
+		t.Errorf("expected defines %v, got %v", want, metrics.Defines)
+	}
+	wantEdges := []IncludeEdge{
+		{From: "FILE deploy/{{ .name }}.yaml", To: "labels", Line: 6},
+		{From: "labels", To: "name", Line: 1},
+	}
+	if !reflect.DeepEqual(metrics.Includes, wantEdges) {
+		t.Errorf("expected includes %+v, got %+v", wantEdges, metrics.Includes)
+	}
+	if metrics.Cost <= 0 {
+		t.Errorf("expected a positive cost, got %d", metrics.Cost)
+	}
+}
+
+func TestAnalyzeTemplate_Cost(t *testing.T) {
+	cost := func(tmpl string) int {
+		t.Helper()
+		metrics, err := AnalyzeTemplate("t", []byte(tmpl))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return metrics.Cost
+	}
+	flat := cost("{{ .a }}")
+	if ranged := cost("{{ range .l }}{{ .a }}{{ end }}"); ranged <= assumedIterations*flat {
+		t.Errorf("expected range to multiply the cost of %d, got %d", flat, ranged)
+	}
+	if each := cost("#FILE-EACH:.l:f#{{ .a }}#FILE#"); each != assumedIterations*(flat+1) {
+		t.Errorf("expected FILE-EACH to multiply the cost, got %d", each)
+	}
+	// Recursion must terminate
+	if recursive := cost(`{{ define "r" }}{{ template "r" . }}{{ end }}{{ template "r" . }}`); recursive <= 0 {
+		t.Errorf("expected a positive cost, got %d", recursive)
+	}
+}
+
+func TestAnalyzeTemplate_Errors(t *testing.T) {
+	// The unclosed if is reported at the end of the segment
+	_, err := AnalyzeTemplate("app.tmpl", []byte("ok\n#FILE:a#\n{{ if .x }}\n#FILE#"))
+	var terr *TemplateError
+	if !errors.As(err, &terr) || terr.Line != 4 {
+		t.Fatalf("expected an error at line 4, got %v", err)
+	}
+	// Unknown functions, e.g. from plugins, are not errors
+	if _, err := AnalyzeTemplate("app.tmpl", []byte("{{ myPluginFunc .x }}")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+package template
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"cmp"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archiveEntry is a file collected for an archive.
+type archiveEntry struct {
+	path    string // Slash-separated path inside the archive
+	content []byte
+	mode    os.FileMode // Permission bits
+	dirMode os.FileMode // Permission bits of the parent directories, 0 for 0755
+	modTime time.Time
+}
+
+// archiveFiles collects the files written to an archive writer, so that the
+// archive can be written in a stable order once the render is complete.
+type archiveFiles struct {
+	baseDir string
+
+	mu      sync.Mutex // guards entries and dirs
+	entries map[string]archiveEntry
+	dirs    map[string]archiveEntry // Directories of DIR directives, without trailing slash
+}
+
+// setBaseDir sets the directory inside the archive that files are placed in.
+func (a *archiveFiles) setBaseDir(dir string) error {
+	if dir == "" {
+		a.baseDir = ""
+		return nil
+	}
+	clean, err := archivePath("", dir)
+	if err != nil {
+		return err
+	}
+	a.baseDir = clean
+	return nil
+}
+
+// archivePath validates filename and returns its slash-separated path inside
+// the archive, below baseDir.
+func archivePath(baseDir, filename string) (string, error) {
+	if filename == "" {
+		return "", fmt.Errorf("filename cannot be empty")
+	}
+	if strings.Contains(filename, "..") {
+		return "", fmt.Errorf("path traversal not allowed in filename: %s", filename)
+	}
+	clean := strings.TrimLeft(path.Clean(filepath.ToSlash(filename)), "/")
+	if clean == "" || clean == "." {
+		return "", fmt.Errorf("invalid filename: %s", filename)
+	}
+	if baseDir != "" {
+		clean = baseDir + "/" + clean
+	}
+	return clean, nil
+}
+
+// add records a file, replacing an earlier file with the same path. A zero
+// modTime stands for the current time.
+func (a *archiveFiles) add(filename string, content []byte, mode, dirMode os.FileMode, modTime time.Time) error {
+	name, err := archivePath(a.baseDir, filename)
+	if err != nil {
+		return err
+	}
+	if mode == 0 {
+		mode = defaultFileMode
+	}
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.entries == nil {
+		a.entries = make(map[string]archiveEntry)
+	}
+	a.entries[name] = archiveEntry{path: name, content: content, mode: mode.Perm(), dirMode: dirMode.Perm(), modTime: modTime}
+	return nil
+}
+
+// addDir records a directory declared by a DIR directive. A zero modTime
+// stands for the current time.
+func (a *archiveFiles) addDir(dirname string, mode os.FileMode, modTime time.Time) error {
+	name, err := archivePath(a.baseDir, dirname)
+	if err != nil {
+		return err
+	}
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.dirs == nil {
+		a.dirs = make(map[string]archiveEntry)
+	}
+	a.dirs[name] = archiveEntry{path: name + "/", mode: mode.Perm(), modTime: modTime}
+	return nil
+}
+
+// exists reports whether a file has been recorded under filename.
+func (a *archiveFiles) exists(filename string) (bool, error) {
+	name, err := archivePath(a.baseDir, filename)
+	if err != nil {
+		return false, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.entries[name]
+	return ok, nil
+}
+
+// sorted returns the directories of DIR directives and the parent
+// directories of the collected files followed by the files, in path order.
+// Directories have a trailing slash. Parent directories take the most recent
+// modification time of the files, and the directory mode of the first file
+// found in them, unless a DIR directive declared them.
+func (a *archiveFiles) sorted() (dirs, files []archiveEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	seen := make(map[string]int)
+	addParents := func(p string, mode os.FileMode, modTime time.Time) {
+		if mode == 0 {
+			mode = defaultDirMode
+		}
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			if i, ok := seen[dir]; ok {
+				if _, declared := a.dirs[dir]; !declared && modTime.After(dirs[i].modTime) {
+					dirs[i].modTime = modTime
+				}
+				continue
+			}
+			seen[dir] = len(dirs)
+			if d, declared := a.dirs[dir]; declared {
+				dirs = append(dirs, d)
+			} else {
+				dirs = append(dirs, archiveEntry{path: dir + "/", mode: mode, modTime: modTime})
+			}
+		}
+	}
+	for name, d := range a.dirs {
+		// Declared directories are their own first "parent"
+		addParents(name+"/x", d.mode, d.modTime)
+	}
+	for _, e := range a.entries {
+		files = append(files, e)
+		addParents(e.path, e.dirMode, e.modTime)
+	}
+	for i := range dirs {
+		if dirs[i].mode == 0 {
+			dirs[i].mode = defaultDirMode
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].path < dirs[j].path })
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return dirs, files
+}
+
+// TarFileWriter is a FileWriter that produces a tar archive of the generated
+// files instead of writing them to the filesystem, e.g. to upload or
+// distribute a multi-file render as a single artifact. Files are collected in
+// memory and written, sorted by path and preceded by their parent
+// directories and the directories of DIR directives, when Close is called.
+// It is safe for concurrent use.
+type TarFileWriter struct {
+	// Gzip compresses the archive (.tar.gz).
+	Gzip bool
+	// ModTime is the modification time of the archived files; if zero, the
+	// time each file was written is used. Set it for reproducible archives.
+	ModTime time.Time
+	// FileMode is the mode of files written without a requested mode,
+	// 0644 if 0.
+	FileMode os.FileMode
+	// DirMode is the mode of the directory entries, 0755 if 0.
+	DirMode os.FileMode
+
+	out   io.Writer
+	files archiveFiles
+}
+
+// NewTarFileWriter returns a TarFileWriter that writes the archive to out
+// when it is closed.
+func NewTarFileWriter(out io.Writer) *TarFileWriter {
+	return &TarFileWriter{out: out}
+}
+
+// SetBaseDir places the files inside dir in the archive. It does not touch
+// the filesystem.
+func (w *TarFileWriter) SetBaseDir(dir string) error {
+	return w.files.setBaseDir(dir)
+}
+
+// WriteFile adds a file to the archive, with the given mode, or FileMode if
+// mode is 0. Filenames are validated like in DefaultFileWriter.
+func (w *TarFileWriter) WriteFile(filename string, content []byte, mode os.FileMode) error {
+	return w.WriteSegment(filename, content, SegmentInfo{Mode: mode})
+}
+
+// WriteSegment is WriteFile with the mode and the mode of the parent
+// directory entries taken from info.
+func (w *TarFileWriter) WriteSegment(filename string, content []byte, info SegmentInfo) error {
+	return w.files.add(filename, content, cmp.Or(info.Mode, w.FileMode), cmp.Or(info.DirMode, w.DirMode), w.ModTime)
+}
+
+// WriteDir adds a directory entry to the archive, with the given mode, or
+// DirMode if mode is 0.
+func (w *TarFileWriter) WriteDir(dirname string, mode os.FileMode) error {
+	return w.files.addDir(dirname, cmp.Or(mode, w.DirMode), w.ModTime)
+}
+
+// Exists reports whether a file has already been added under filename.
+func (w *TarFileWriter) Exists(filename string) (bool, error) {
+	return w.files.exists(filename)
+}
+
+// Close writes the archive. It does not close the underlying writer.
+func (w *TarFileWriter) Close() error {
+	out := w.out
+	var zw *gzip.Writer
+	if w.Gzip {
+		zw = gzip.NewWriter(out)
+		out = zw
+	}
+	tw := tar.NewWriter(out)
+	dirs, files := w.files.sorted()
+	for _, d := range dirs {
+		hdr := &tar.Header{Typeflag: tar.TypeDir, Name: d.path, Mode: int64(d.mode), ModTime: d.modTime}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	for _, f := range files {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: f.path, Mode: int64(f.mode), Size: int64(len(f.content)), ModTime: f.modTime}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+		if _, err := tw.Write(f.content); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	return nil
+}
+
+// ZipFileWriter is a FileWriter that produces a zip archive of the generated
+// files, e.g. for bundles used on Windows. It works like TarFileWriter: files
+// are collected in memory and written, sorted by path and preceded by their
+// parent directories, when Close is called. Entries record their
+// modification time and Unix permissions and are compressed with Deflate.
+// It is safe for concurrent use.
+type ZipFileWriter struct {
+	// ModTime is the modification time of the archived files; if zero, the
+	// time each file was written is used. Set it for reproducible archives.
+	ModTime time.Time
+	// FileMode is the mode of files written without a requested mode,
+	// 0644 if 0.
+	FileMode os.FileMode
+	// DirMode is the mode of the directory entries, 0755 if 0.
+	DirMode os.FileMode
+
+	out   io.Writer
+	files archiveFiles
+}
+
+// NewZipFileWriter returns a ZipFileWriter that writes the archive to out
+// when it is closed.
+func NewZipFileWriter(out io.Writer) *ZipFileWriter {
+	return &ZipFileWriter{out: out}
+}
+
+// SetBaseDir places the files inside dir in the archive. It does not touch
+// the filesystem.
+func (w *ZipFileWriter) SetBaseDir(dir string) error {
+	return w.files.setBaseDir(dir)
+}
+
+// WriteFile adds a file to the archive, with the given mode, or FileMode if
+// mode is 0. Filenames are validated like in DefaultFileWriter.
+func (w *ZipFileWriter) WriteFile(filename string, content []byte, mode os.FileMode) error {
+	return w.WriteSegment(filename, content, SegmentInfo{Mode: mode})
+}
+
+// WriteSegment is WriteFile with the mode and the mode of the parent
+// directory entries taken from info.
+func (w *ZipFileWriter) WriteSegment(filename string, content []byte, info SegmentInfo) error {
+	return w.files.add(filename, content, cmp.Or(info.Mode, w.FileMode), cmp.Or(info.DirMode, w.DirMode), w.ModTime)
+}
+
+// WriteDir adds a directory entry to the archive, with the given mode, or
+// DirMode if mode is 0.
+func (w *ZipFileWriter) WriteDir(dirname string, mode os.FileMode) error {
+	return w.files.addDir(dirname, cmp.Or(mode, w.DirMode), w.ModTime)
+}
+
+// Exists reports whether a file has already been added under filename.
+func (w *ZipFileWriter) Exists(filename string) (bool, error) {
+	return w.files.exists(filename)
+}
+
+// Close writes the archive. It does not close the underlying writer.
+func (w *ZipFileWriter) Close() error {
+	zw := zip.NewWriter(w.out)
+	dirs, files := w.files.sorted()
+	for _, d := range dirs {
+		hdr := &zip.FileHeader{Name: d.path, Method: zip.Store, Modified: d.modTime}
+		hdr.SetMode(os.ModeDir | d.mode)
+		if _, err := zw.CreateHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	for _, f := range files {
+		hdr := &zip.FileHeader{Name: f.path, Method: zip.Deflate, Modified: f.modTime}
+		hdr.SetMode(f.mode)
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+		if _, err := fw.Write(f.content); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
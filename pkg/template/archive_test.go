@@ -0,0 +1,198 @@
+package template
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// tarEntry is a file or directory read back from a tar archive.
+type tarEntry struct {
+	name    string
+	mode    os.FileMode
+	content string
+	modTime time.Time
+}
+
+// readTar returns the entries of a tar archive in order.
+func readTar(t *testing.T, r io.Reader) []tarEntry {
+	t.Helper()
+	var entries []tarEntry
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatalf("invalid archive: %v", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("invalid archive: %v", err)
+		}
+		entries = append(entries, tarEntry{name: hdr.Name, mode: os.FileMode(hdr.Mode), content: string(content), modTime: hdr.ModTime})
+	}
+}
+
+func TestTarFileWriter(t *testing.T) {
+	modTime := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, compressed := range []bool{false, true} {
+		var buf bytes.Buffer
+		writer := NewTarFileWriter(&buf)
+		writer.Gzip = compressed
+		writer.ModTime = modTime
+		if err := writer.SetBaseDir("release"); err != nil {
+			t.Fatal(err)
+		}
+		tmpl := []byte("#FILE:conf/b.yaml#b#FILE##FILE:run.sh:0755#a#FILE##FILE:conf/a.yaml#a#FILE#")
+		if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &bytes.Buffer{}, writer, WithParallelism(4)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if exists, err := writer.Exists("run.sh"); err != nil || !exists {
+			t.Errorf("expected run.sh to exist, got %v, %v", exists, err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var r io.Reader = &buf
+		if compressed {
+			zr, err := gzip.NewReader(&buf)
+			if err != nil {
+				t.Fatalf("expected a gzip archive: %v", err)
+			}
+			r = zr
+		}
+		want := []tarEntry{
+			{name: "release/", mode: 0755, modTime: modTime},
+			{name: "release/conf/", mode: 0755, modTime: modTime},
+			{name: "release/conf/a.yaml", mode: 0644, content: "a", modTime: modTime},
+			{name: "release/conf/b.yaml", mode: 0644, content: "b", modTime: modTime},
+			{name: "release/run.sh", mode: 0755, content: "a", modTime: modTime},
+		}
+		got := readTar(t, r)
+		if len(got) != len(want) {
+			t.Fatalf("expected %d entries, got %+v", len(want), got)
+		}
+		for i := range want {
+			if got[i].name != want[i].name || got[i].mode != want[i].mode || got[i].content != want[i].content || !got[i].modTime.Equal(want[i].modTime) {
+				t.Errorf("entry %d: expected %+v, got %+v", i, want[i], got[i])
+			}
+		}
+	}
+}
+
+func TestTarFileWriter_Modes(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewTarFileWriter(&buf)
+	writer.FileMode, writer.DirMode = 0600, 0700
+	tmpl := []byte("#FILE:conf/app.env#a#FILE##FILE:bin/run.sh:0755#b#FILE#")
+	if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &bytes.Buffer{}, writer, WithDirMode(0750)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]os.FileMode{"bin/": 0750, "bin/run.sh": 0755, "conf/": 0750, "conf/app.env": 0600}
+	for _, e := range readTar(t, &buf) {
+		if e.mode != want[e.name] {
+			t.Errorf("%s: expected %04o, got %04o", e.name, want[e.name], e.mode)
+		}
+	}
+}
+
+func TestTarFileWriter_Dirs(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewTarFileWriter(&buf)
+	writer.DirMode = 0700
+	tmpl := []byte("#DIR:var/log#\n#DIR:plugins:0750#\n#FILE:var/app.env#a#FILE#")
+	if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &bytes.Buffer{}, writer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []tarEntry{
+		{name: "plugins/", mode: 0750},
+		{name: "var/", mode: 0700},
+		{name: "var/log/", mode: 0700},
+		{name: "var/app.env", mode: 0644, content: "a"},
+	}
+	got := readTar(t, &buf)
+	if len(got) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i].name != want[i].name || got[i].mode != want[i].mode || got[i].content != want[i].content {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestTarFileWriter_PathTraversal(t *testing.T) {
+	writer := NewTarFileWriter(io.Discard)
+	for _, name := range []string{"../escape.txt", "a/../../b", "", "/"} {
+		if err := writer.WriteFile(name, []byte("x"), 0); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+	if err := writer.WriteFile("/abs/file.txt", []byte("x"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exists, _ := writer.Exists("abs/file.txt"); !exists {
+		t.Error("expected absolute paths to be stored relative to the archive root")
+	}
+}
+
+func TestZipFileWriter(t *testing.T) {
+	modTime := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	writer := NewZipFileWriter(&buf)
+	writer.ModTime = modTime
+	if err := writer.SetBaseDir("release"); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := []byte("#FILE:conf/b.yaml#b#FILE##FILE:run.sh:0755#a#FILE##FILE:conf/a.yaml#a#FILE#")
+	if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &bytes.Buffer{}, writer, WithParallelism(4)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid archive: %v", err)
+	}
+	want := []tarEntry{
+		{name: "release/", mode: os.ModeDir | 0755, modTime: modTime},
+		{name: "release/conf/", mode: os.ModeDir | 0755, modTime: modTime},
+		{name: "release/conf/a.yaml", mode: 0644, content: "a", modTime: modTime},
+		{name: "release/conf/b.yaml", mode: 0644, content: "b", modTime: modTime},
+		{name: "release/run.sh", mode: 0755, content: "a", modTime: modTime},
+	}
+	if len(zr.File) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(zr.File))
+	}
+	for i, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("invalid archive: %v", err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("invalid archive: %v", err)
+		}
+		got := tarEntry{name: f.Name, mode: f.Mode(), content: string(content), modTime: f.Modified}
+		if got.name != want[i].name || got.mode != want[i].mode || got.content != want[i].content || !got.modTime.Equal(want[i].modTime) {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want[i], got)
+		}
+	}
+}
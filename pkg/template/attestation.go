@@ -0,0 +1,105 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	// StatementType is the in-toto statement type of attestations.
+	StatementType = "https://in-toto.io/Statement/v1"
+	// ProvenancePredicateType is the SLSA provenance predicate type used by
+	// attestations.
+	ProvenancePredicateType = "https://slsa.dev/provenance/v1"
+	// BuildType identifies a simplate render in provenance predicates.
+	BuildType = "https://github.com/danarchy-io/simplate/render/v1"
+	// BuilderID identifies simplate as the builder in provenance predicates.
+	BuilderID = "https://github.com/danarchy-io/simplate"
+)
+
+// Attestation is an in-toto statement with a SLSA provenance predicate. It
+// describes the files a run produced (the subjects) and the inputs they
+// were generated from, so that generated artifacts can take part in
+// supply-chain verification.
+type Attestation struct {
+	Type          string               `json:"_type"`
+	Subject       []ResourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     Provenance           `json:"predicate"`
+}
+
+// ResourceDescriptor identifies an artifact by name and digest.
+type ResourceDescriptor struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Provenance is a SLSA provenance v1 predicate.
+type Provenance struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+// BuildDefinition describes the inputs of a run.
+type BuildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   map[string]any       `json:"externalParameters"`
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+// RunDetails describes the tool that performed a run and when.
+type RunDetails struct {
+	Builder  Builder       `json:"builder"`
+	Metadata BuildMetadata `json:"metadata"`
+}
+
+// Builder identifies the tool and its version.
+type Builder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+// BuildMetadata holds the start and end time of a run.
+type BuildMetadata struct {
+	StartedOn  time.Time `json:"startedOn"`
+	FinishedOn time.Time `json:"finishedOn"`
+}
+
+// AttestationInput is an input of a run, such as the template, data or
+// schema file, identified by name and content.
+type AttestationInput struct {
+	Name    string
+	Content []byte
+}
+
+// NewAttestation returns an attestation for a run that wrote outputs (see
+// ManifestRecorder) from inputs. toolVersion is the simplate version, and
+// parameters are recorded as the external parameters of the run, e.g. the
+// command line flags that affect the output.
+func NewAttestation(outputs []ManifestFile, inputs []AttestationInput, parameters map[string]any, toolVersion string, started, finished time.Time) *Attestation {
+	a := &Attestation{
+		Type:          StatementType,
+		Subject:       []ResourceDescriptor{},
+		PredicateType: ProvenancePredicateType,
+		Predicate: Provenance{
+			BuildDefinition: BuildDefinition{BuildType: BuildType, ExternalParameters: parameters},
+			RunDetails: RunDetails{
+				Builder:  Builder{ID: BuilderID, Version: map[string]string{"simplate": toolVersion}},
+				Metadata: BuildMetadata{StartedOn: started.UTC(), FinishedOn: finished.UTC()},
+			},
+		},
+	}
+	if a.Predicate.BuildDefinition.ExternalParameters == nil {
+		a.Predicate.BuildDefinition.ExternalParameters = map[string]any{}
+	}
+	for _, f := range outputs {
+		a.Subject = append(a.Subject, ResourceDescriptor{Name: f.Path, Digest: map[string]string{"sha256": f.SHA256}})
+	}
+	for _, in := range inputs {
+		sum := sha256.Sum256(in.Content)
+		a.Predicate.BuildDefinition.ResolvedDependencies = append(a.Predicate.BuildDefinition.ResolvedDependencies,
+			ResourceDescriptor{Name: in.Name, Digest: map[string]string{"sha256": hex.EncodeToString(sum[:])}})
+	}
+	return a
+}
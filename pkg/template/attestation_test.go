@@ -0,0 +1,49 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifestRecorder(t *testing.T) {
+	recorder := NewManifestRecorder(&MemoryFileWriter{})
+	tmpl := []byte("#FILE:b.txt#b#FILE##FILE:a.sh:0755#a#FILE#")
+	if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &bytes.Buffer{}, recorder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	files := recorder.Files()
+	if len(files) != 2 || files[0].Path != "a.sh" || files[1].Path != "b.txt" {
+		t.Fatalf("expected a.sh and b.txt sorted by path, got %+v", files)
+	}
+	if files[0].Mode != 0755 || files[0].Size != 1 || files[0].SHA256 != sha256sum("a") {
+		t.Errorf("unexpected record %+v", files[0])
+	}
+}
+
+func TestNewAttestation(t *testing.T) {
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	outputs := []ManifestFile{{Path: "app.conf", SHA256: sha256sum("x")}}
+	inputs := []AttestationInput{{Name: "data.yaml", Content: []byte("a: 1")}, {Name: "app.tmpl", Content: []byte("{{.a}}")}}
+
+	a := NewAttestation(outputs, inputs, nil, "1.2.3", started, started.Add(time.Second))
+	data, err := json.Marshal(a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		`"_type":"https://in-toto.io/Statement/v1"`,
+		`"subject":[{"name":"app.conf","digest":{"sha256":"` + sha256sum("x") + `"}}]`,
+		`"predicateType":"https://slsa.dev/provenance/v1"`,
+		`"externalParameters":{}`,
+		`{"name":"data.yaml","digest":{"sha256":"` + sha256sum("a: 1") + `"}}`,
+		`"builder":{"id":"https://github.com/danarchy-io/simplate","version":{"simplate":"1.2.3"}}`,
+		`"startedOn":"2024-05-01T10:00:00Z","finishedOn":"2024-05-01T10:00:01Z"`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected attestation to contain %s, got %s", want, data)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// BackupTimestamp is the DefaultFileWriter.Backup value that names backups
+// after the time the file was replaced, e.g. app.conf.20240601T120000Z~, so
+// that every earlier version is kept.
+const BackupTimestamp = "timestamp"
+
+// backupTimeLayout is the layout of the time in timestamped backup names.
+const backupTimeLayout = "20060102T150405Z"
+
+// ValidateBackupSuffix returns an error if suffix cannot be used as
+// DefaultFileWriter.Backup because it would place backups in another
+// directory.
+func ValidateBackupSuffix(suffix string) error {
+	if suffix == "" || strings.ContainsAny(suffix, `/\`) || strings.Contains(suffix, "..") {
+		return fmt.Errorf("invalid backup suffix %q: must be non-empty and cannot contain path separators or ..", suffix)
+	}
+	return nil
+}
+
+// backupPath returns the name of the backup of path.
+func (w *DefaultFileWriter) backupPath(path string) string {
+	if w.Backup == BackupTimestamp {
+		return path + "." + time.Now().UTC().Format(backupTimeLayout) + "~"
+	}
+	return path + w.Backup
+}
+
+// backup copies the existing regular file path, described by info, to its
+// backup name if backups are enabled. An earlier backup of the same name is
+// replaced. The copy keeps the permissions of the file.
+func (w *DefaultFileWriter) backup(fsys FS, path string, info os.FileInfo) error {
+	if w.Backup == "" {
+		return nil
+	}
+	if err := ValidateBackupSuffix(w.Backup); err != nil {
+		return err
+	}
+	content, err := readFile(fsys, path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s for backup: %w", path, err)
+	}
+	target := w.backupPath(path)
+	if err := removeStaleSymlink(fsys, target); err != nil {
+		return err
+	}
+	perm := info.Mode().Perm()
+	if err := writeFile(fsys, target, content, perm); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	if err := fsys.Chmod(target, perm); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	return nil
+}
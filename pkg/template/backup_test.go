@@ -0,0 +1,79 @@
+package template
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultFileWriter_Backup(t *testing.T) {
+	fsys := &MemFS{}
+	writer := &DefaultFileWriter{FS: fsys, Backup: "~"}
+	if err := writer.WriteFile("app.conf", []byte("v1"), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := fsys.Stat("app.conf~"); err == nil {
+		t.Error("expected no backup for a new file")
+	}
+	for _, version := range []string{"v2", "v3"} {
+		if err := writer.WriteFile("app.conf", []byte(version), 0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if content, _ := fsys.ReadFile("app.conf~"); string(content) != "v2" {
+		t.Errorf("expected the backup to hold the previous version, got %q", content)
+	}
+	if info, err := fsys.Stat("app.conf~"); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the backup to keep mode 0600, got %v, %v", info, err)
+	}
+
+	// Unchanged files are not backed up again
+	writer.SkipUnchanged = true
+	if err := writer.WriteFile("app.conf", []byte("v3"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content, _ := fsys.ReadFile("app.conf~"); string(content) != "v2" {
+		t.Errorf("expected the backup to be kept, got %q", content)
+	}
+}
+
+func TestDefaultFileWriter_BackupTimestamp(t *testing.T) {
+	fsys := &MemFS{}
+	writer := &DefaultFileWriter{FS: fsys, Backup: BackupTimestamp}
+	for _, version := range []string{"v1", "v2"} {
+		if err := writer.WriteFile("app.conf", []byte(version), 0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	var backups []string
+	for name := range fsys.nodes {
+		if strings.HasPrefix(name, "app.conf.") && strings.HasSuffix(name, "~") {
+			backups = append(backups, name)
+		}
+	}
+	if len(backups) != 1 || len(backups[0]) != len("app.conf.20060102T150405Z~") {
+		t.Fatalf("expected one timestamped backup, got %v", backups)
+	}
+	if content, _ := fsys.ReadFile(backups[0]); string(content) != "v1" {
+		t.Errorf("expected the backup to hold v1, got %q", content)
+	}
+}
+
+func TestValidateBackupSuffix(t *testing.T) {
+	for _, suffix := range []string{"~", ".bak", ".orig~", BackupTimestamp} {
+		if err := ValidateBackupSuffix(suffix); err != nil {
+			t.Errorf("%q: unexpected error: %v", suffix, err)
+		}
+	}
+	for _, suffix := range []string{"", "/x", `\x`, ".."} {
+		if err := ValidateBackupSuffix(suffix); err == nil {
+			t.Errorf("%q: expected an error", suffix)
+		}
+	}
+	writer := &DefaultFileWriter{FS: &MemFS{}, Backup: "/../../x"}
+	if err := writer.WriteFile("a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteFile("a", []byte("2"), 0); err == nil {
+		t.Error("expected an invalid suffix to fail the overwrite")
+	}
+}
@@ -0,0 +1,149 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Checker returns an error if the content of a generated file is not
+// syntactically valid.
+type Checker func(content []byte) error
+
+// Checkers maps lowercase file extensions, including the dot (e.g.
+// ".json"), to the Checker of the files ending in them.
+type Checkers map[string]Checker
+
+// DefaultCheckers returns the built-in checkers, which parse .json, .yaml,
+// .yml and .toml files. YAML files may hold several documents; duplicate
+// mapping keys are errors in YAML and TOML. Add ShellCheckers, or entries
+// for other extensions, to the returned map to check more files.
+func DefaultCheckers() Checkers {
+	return Checkers{
+		".json": checkJSON,
+		".yaml": checkYAML,
+		".yml":  checkYAML,
+		".toml": checkTOML,
+	}
+}
+
+// ShellCheckers returns checkers that parse .sh files with sh -n and .bash
+// files with bash -n, without running them. The shells must be installed.
+func ShellCheckers() Checkers {
+	return Checkers{
+		".sh":   shellChecker("sh"),
+		".bash": shellChecker("bash"),
+	}
+}
+
+// WithOutputChecks returns an Option that checks the generated files whose
+// extension has a checker in checkers, so that a template producing broken
+// YAML, JSON or scripts fails the run before anything is written. Every
+// invalid file is reported, and the error matches ErrTemplate. Stdout
+// content is not checked.
+//
+// Checks run as a BeforeWrite hook; give this option after the options
+// that change the content, such as WithFormatters and WithEditorConfig.
+func WithOutputChecks(checkers Checkers) Option {
+	return WithHooks(Hooks{
+		BeforeWrite: func(_ context.Context, outputs []RenderedOutput) ([]RenderedOutput, error) {
+			var failed []error
+			for _, out := range outputs {
+				if out.Segment.Type != SegmentFile || out.Skipped != "" {
+					continue
+				}
+				checker := checkers[strings.ToLower(filepath.Ext(out.Path))]
+				if checker == nil {
+					continue
+				}
+				if err := checker(out.Content); err != nil {
+					failed = append(failed, fmt.Errorf("generated file %s (line %d) is invalid: %w", out.Path, out.Segment.Line, err))
+				}
+			}
+			if err := errors.Join(failed...); err != nil {
+				return nil, withKind(ErrTemplate, err)
+			}
+			return outputs, nil
+		},
+	})
+}
+
+// checkJSON parses a JSON document, locating syntax errors.
+func checkJSON(content []byte) error {
+	var v any
+	err := json.Unmarshal(content, &v)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line := 1 + bytes.Count(content[:syntaxErr.Offset], []byte("\n"))
+		return fmt.Errorf("line %d: %w", line, err)
+	}
+	return err
+}
+
+// checkYAML parses every document of a YAML stream and rejects duplicate
+// mapping keys, which yaml.v3 only reports when decoding into Go values.
+func checkYAML(content []byte) error {
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := checkYAMLKeys(&doc); err != nil {
+			return err
+		}
+	}
+}
+
+// checkYAMLKeys returns an error for the first mapping below node with a
+// duplicate scalar key.
+func checkYAMLKeys(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		seen := map[string]bool{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if key.Kind != yaml.ScalarNode || key.Value == "<<" {
+				continue
+			}
+			if seen[key.Value] {
+				return fmt.Errorf("yaml: line %d: mapping key %q already defined", key.Line, key.Value)
+			}
+			seen[key.Value] = true
+		}
+	}
+	for _, child := range node.Content {
+		if err := checkYAMLKeys(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shellChecker returns a Checker parsing scripts with shell -n, which reads
+// the script from stdin.
+func shellChecker(shell string) Checker {
+	return func(content []byte) error {
+		cmd := exec.Command(shell, "-n")
+		cmd.Stdin = bytes.NewReader(content)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if msg := strings.TrimSpace(stderr.String()); msg != "" && errors.As(err, &exitErr) {
+				return errors.New(msg)
+			}
+			return fmt.Errorf("%s -n: %w", shell, err)
+		}
+		return nil
+	}
+}
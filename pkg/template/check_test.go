@@ -0,0 +1,79 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestDefaultCheckers(t *testing.T) {
+	tests := []struct {
+		ext     string
+		content string
+		want    string
+	}{
+		{ext: ".json", content: `{"a": [1, 2]}`},
+		{ext: ".json", content: "{\n  \"a\": 1,\n}", want: "line 3: invalid character '}'"},
+		{ext: ".json", content: `{"a": 1} {"b": 2}`, want: "invalid character '{' after top-level value"},
+		{ext: ".yaml", content: "a: 1\n---\nb: [1, 2]\n"},
+		{ext: ".yml", content: "a: 1\n  b: 2\n", want: "yaml: line 2"},
+		{ext: ".yaml", content: "a:\n  b: 1\n  b: 2\n", want: `yaml: line 3: mapping key "b" already defined`},
+		{ext: ".yaml", content: "base: &base {a: 1}\nx:\n  <<: *base\n  <<: *base\n"},
+		{ext: ".toml", content: "[a]\nb = 1\n"},
+		{ext: ".toml", content: "b = \n", want: "toml: line 1: expected a value"},
+	}
+	checkers := DefaultCheckers()
+	for _, tt := range tests {
+		t.Run(tt.ext+" "+tt.content, func(t *testing.T) {
+			err := checkers[tt.ext]([]byte(tt.content))
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestShellCheckers(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not installed")
+	}
+	check := ShellCheckers()[".sh"]
+	if err := check([]byte("#!/bin/sh\nif true; then\n  echo ok\nfi\n")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := check([]byte("#!/bin/sh\nif true; then\n  echo ok\n")); err == nil {
+		t.Error("expected an error for an unterminated if")
+	}
+	// The script is parsed, not run
+	if err := check([]byte("exit 3\n")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWithOutputChecks(t *testing.T) {
+	tmpl := []byte("#FILE:ok.json#{\"a\": {{ .a }}}#FILE#\n#FILE:bad.json#{\"a\": {{ .a }},}#FILE#\n#FILE:bad.yaml#a: [#FILE#\n#FILE:other.txt#{#FILE#")
+	writer := &MemoryFileWriter{}
+	err := ExecuteWithFiles(AnyProvider(map[string]any{"a": 1}), tmpl, &bytes.Buffer{}, writer, WithOutputChecks(DefaultCheckers()))
+	if !errors.Is(err, ErrTemplate) {
+		t.Fatalf("expected a template error, got %v", err)
+	}
+	for _, want := range []string{"generated file bad.json (line 2) is invalid", "generated file bad.yaml (line 3) is invalid"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "ok.json") || strings.Contains(err.Error(), "other.txt") {
+		t.Errorf("unexpected failures in %v", err)
+	}
+	if len(writer.Files) != 0 {
+		t.Errorf("expected nothing to be written, got %v", writer.Files)
+	}
+}
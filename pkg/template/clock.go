@@ -0,0 +1,96 @@
+package template
+
+import (
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// Clock provides the current time to the now and date template functions.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock used by default: the system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// fixedClock is a Clock that always returns the same time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// FixedClock returns a Clock that always returns t, so that templates using
+// the current time render the same output on every run.
+func FixedClock(t time.Time) Clock {
+	return fixedClock(t)
+}
+
+// WithClock returns an Option that makes the now and date template
+// functions read the time from clock instead of the system, e.g. to test
+// time-dependent templates or to make renders reproducible.
+func WithClock(clock Clock) Option {
+	return WithFuncs(clockFuncs(clock))
+}
+
+// clockFuncs returns the time functions reading the current time from clock.
+func clockFuncs(clock Clock) template.FuncMap {
+	return template.FuncMap{
+		"now": clock.Now,
+		"date": func(layout string, value ...any) (string, error) {
+			return date(clock, layout, value...)
+		},
+	}
+}
+
+// date formats a time with a Go layout, e.g. {{ date "2006-01-02" now }}.
+//
+// Parameters:
+//   - clock: the clock providing the current time.
+//   - layout: the Go time layout, see the time package.
+//   - value: optional time to format; defaults to the current time. It may
+//     be a time.Time, a Unix timestamp in seconds or an RFC 3339 string.
+//
+// Returns:
+//   - string: the formatted time.
+//   - error: non-nil if more than one value is given or the value is not a
+//     time.
+func date(clock Clock, layout string, value ...any) (string, error) {
+	if len(value) > 1 {
+		return "", fmt.Errorf("date: expected at most one time, got %d", len(value))
+	}
+	if len(value) == 0 {
+		return clock.Now().Format(layout), nil
+	}
+	t, err := toTime(value[0])
+	if err != nil {
+		return "", fmt.Errorf("date: %w", err)
+	}
+	return t.Format(layout), nil
+}
+
+// toTime converts a template value to a time, see date.
+func toTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case int:
+		return time.Unix(int64(v), 0), nil
+	case int64:
+		return time.Unix(v, 0), nil
+	case float64:
+		return time.Unix(int64(v), 0), nil
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q: expected RFC 3339", v)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("unsupported time type %T", value)
+}
@@ -0,0 +1,59 @@
+package template
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithClock(t *testing.T) {
+	frozen := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		template string
+		data     map[string]any
+		want     string
+		wantErr  string
+	}{
+		{name: "now", template: `{{ now.Year }}`, want: "2024"},
+		{name: "date defaults to now", template: `{{ date "2006-01-02" }}`, want: "2024-03-01"},
+		{name: "date of now", template: `{{ date "15:04" now }}`, want: "12:30"},
+		{name: "unix timestamp", template: `{{ date "2006-01-02" .ts }}`, data: map[string]any{"ts": 0}, want: "1970-01-01"},
+		{name: "RFC 3339 string", template: `{{ date "Jan 2" .ts }}`, data: map[string]any{"ts": "2023-12-24T10:00:00Z"}, want: "Dec 24"},
+		{name: "invalid string", template: `{{ date "2006" .ts }}`, data: map[string]any{"ts": "yesterday"}, wantErr: `date: invalid time "yesterday"`},
+		{name: "unsupported type", template: `{{ date "2006" .ts }}`, data: map[string]any{"ts": true}, wantErr: "date: unsupported time type bool"},
+		{name: "too many values", template: `{{ date "2006" now now }}`, wantErr: "date: expected at most one time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Execute(AnyProvider(tt.data), []byte(tt.template), &out, WithClock(FixedClock(frozen)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestNow_SystemClock(t *testing.T) {
+	before := time.Now()
+	var out bytes.Buffer
+	if err := Execute(AnyProvider(map[string]any{}), []byte(`{{ (now).Unix }}`), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := strconv.ParseInt(out.String(), 10, 64)
+	if err != nil || got < before.Unix() || got > time.Now().Unix() {
+		t.Errorf("expected the current time, got %q", out.String())
+	}
+}
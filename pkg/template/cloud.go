@@ -0,0 +1,285 @@
+package template
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCloudTimeout     = 2 * time.Second
+	defaultCloudDialTimeout = 500 * time.Millisecond
+	defaultAWSEndpoint      = "http://169.254.169.254"
+	defaultGCPEndpoint      = "http://metadata.google.internal"
+
+	cloudAWS = "aws"
+	cloudGCP = "gcp"
+)
+
+// CloudConfig configures the opt-in cloud metadata template functions.
+type CloudConfig struct {
+	// Timeout bounds each metadata request. Defaults to 2 seconds.
+	Timeout time.Duration
+	// Client is used to perform requests. Defaults to a client that
+	// connects directly, ignoring HTTP_PROXY and HTTPS_PROXY, as the
+	// metadata services are only reachable from the instance itself.
+	Client *http.Client
+	// AWSEndpoint is the base URL of the EC2 instance metadata service.
+	// Defaults to http://169.254.169.254.
+	AWSEndpoint string
+	// GCPEndpoint is the base URL of the GCE metadata server.
+	// Defaults to http://metadata.google.internal.
+	GCPEndpoint string
+}
+
+// WithCloudFuncs returns an Option that registers cloud metadata template
+// functions. The platform (AWS or GCP) is detected on first use by probing
+// the metadata services, and every value is fetched at most once per
+// execution:
+//
+//	{{ cloudProvider }}  // "aws" or "gcp"
+//	{{ instanceID }}
+//	{{ region }}         // e.g. "eu-west-1" or "europe-west1"
+//	{{ zone }}           // e.g. "eu-west-1a" or "europe-west1-b"
+//	{{ index tags "team" }}
+//
+// On AWS, tags are the instance tags (requires tags in instance metadata to
+// be enabled); on GCP they are the instance's custom metadata attributes.
+func WithCloudFuncs(cfg CloudConfig) Option {
+	return optionFunc(func(o *options) {
+		m := newCloudMetadata(cfg)
+		o.registerBlocking(map[string]any{
+			"cloudProvider": m.provider,
+			"instanceID":    m.instanceID,
+			"region":        m.region,
+			"zone":          m.zone,
+			"tags":          m.tags,
+		})
+	})
+}
+
+// cloudMetadata detects the cloud platform and caches metadata lookups.
+type cloudMetadata struct {
+	cfg    CloudConfig
+	client *http.Client
+
+	detectOnce sync.Once
+	platform   string
+	awsToken   string
+	detectErr  error
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+func newCloudMetadata(cfg CloudConfig) *cloudMetadata {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultCloudTimeout
+	}
+	if cfg.AWSEndpoint == "" {
+		cfg.AWSEndpoint = defaultAWSEndpoint
+	}
+	if cfg.GCPEndpoint == "" {
+		cfg.GCPEndpoint = defaultGCPEndpoint
+	}
+	client := http.Client{Transport: newCloudTransport()}
+	if cfg.Client != nil {
+		client = *cfg.Client
+	}
+	client.Timeout = cfg.Timeout
+	return &cloudMetadata{cfg: cfg, client: &client, cache: make(map[string]string)}
+}
+
+// newCloudTransport returns a transport for metadata requests that does not
+// use a proxy and gives up quickly on hosts that do not answer, e.g. the
+// metadata service of another platform.
+func newCloudTransport() *http.Transport {
+	dialer := &net.Dialer{Timeout: defaultCloudDialTimeout}
+	return &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   defaultCloudDialTimeout,
+		ResponseHeaderTimeout: defaultCloudTimeout,
+		MaxIdleConns:          2,
+		IdleConnTimeout:       30 * time.Second,
+	}
+}
+
+// detect probes the GCP and AWS metadata services once and records which
+// platform answered.
+func (m *cloudMetadata) detect(ctx context.Context) (string, error) {
+	m.detectOnce.Do(func() {
+		if _, err := m.getGCP(ctx, "/computeMetadata/v1/instance/id"); err == nil {
+			m.platform = cloudGCP
+			return
+		}
+		token, err := m.awsSessionToken(ctx)
+		if err == nil {
+			m.platform = cloudAWS
+			m.awsToken = token
+			return
+		}
+		m.detectErr = fmt.Errorf("no cloud metadata service detected")
+	})
+	return m.platform, m.detectErr
+}
+
+func (m *cloudMetadata) provider(ctx context.Context) (string, error) {
+	return m.detect(ctx)
+}
+
+func (m *cloudMetadata) instanceID(ctx context.Context) (string, error) {
+	platform, err := m.detect(ctx)
+	if err != nil {
+		return "", fmt.Errorf("instanceID: %w", err)
+	}
+	if platform == cloudGCP {
+		return m.cached(ctx, "/computeMetadata/v1/instance/id")
+	}
+	return m.cached(ctx, "/latest/meta-data/instance-id")
+}
+
+func (m *cloudMetadata) zone(ctx context.Context) (string, error) {
+	platform, err := m.detect(ctx)
+	if err != nil {
+		return "", fmt.Errorf("zone: %w", err)
+	}
+	if platform == cloudGCP {
+		// GCP returns projects/<number>/zones/<zone>
+		value, err := m.cached(ctx, "/computeMetadata/v1/instance/zone")
+		if err != nil {
+			return "", err
+		}
+		return value[strings.LastIndex(value, "/")+1:], nil
+	}
+	return m.cached(ctx, "/latest/meta-data/placement/availability-zone")
+}
+
+func (m *cloudMetadata) region(ctx context.Context) (string, error) {
+	platform, err := m.detect(ctx)
+	if err != nil {
+		return "", fmt.Errorf("region: %w", err)
+	}
+	if platform == cloudGCP {
+		// GCP zones are <region>-<letter>
+		zone, err := m.zone(ctx)
+		if err != nil {
+			return "", err
+		}
+		if idx := strings.LastIndex(zone, "-"); idx != -1 {
+			return zone[:idx], nil
+		}
+		return zone, nil
+	}
+	return m.cached(ctx, "/latest/meta-data/placement/region")
+}
+
+func (m *cloudMetadata) tags(ctx context.Context) (map[string]string, error) {
+	platform, err := m.detect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tags: %w", err)
+	}
+
+	tags := make(map[string]string)
+	if platform == cloudGCP {
+		body, err := m.cached(ctx, "/computeMetadata/v1/instance/attributes/?recursive=true")
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(body), &tags); err != nil {
+			return nil, fmt.Errorf("tags: failed to decode instance attributes: %w", err)
+		}
+		return tags, nil
+	}
+
+	keys, err := m.cached(ctx, "/latest/meta-data/tags/instance")
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range strings.Fields(keys) {
+		value, err := m.cached(ctx, "/latest/meta-data/tags/instance/"+key)
+		if err != nil {
+			return nil, err
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// cached fetches a metadata path for the detected platform, caching the
+// result for the lifetime of the execution.
+func (m *cloudMetadata) cached(ctx context.Context, path string) (string, error) {
+	m.mu.Lock()
+	value, ok := m.cache[path]
+	m.mu.Unlock()
+	if ok {
+		return value, nil
+	}
+
+	var err error
+	if m.platform == cloudGCP {
+		value, err = m.getGCP(ctx, path)
+	} else {
+		value, err = m.getAWS(ctx, path)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	m.cache[path] = value
+	m.mu.Unlock()
+	return value, nil
+}
+
+// awsSessionToken requests an IMDSv2 session token.
+func (m *cloudMetadata) awsSessionToken(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, m.cfg.AWSEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	return m.do(req)
+}
+
+func (m *cloudMetadata) getAWS(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.cfg.AWSEndpoint+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", m.awsToken)
+	return m.do(req)
+}
+
+func (m *cloudMetadata) getGCP(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.cfg.GCPEndpoint+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return m.do(req)
+}
+
+// do performs a metadata request and returns the response body.
+func (m *cloudMetadata) do(req *http.Request) (string, error) {
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("metadata request %s failed: %w", req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata request %s returned status %s", req.URL.Path, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, defaultHTTPMaxBodySize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read metadata response %s: %w", req.URL.Path, err)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,115 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newAWSMetadataServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	values := map[string]string{
+		"/latest/meta-data/instance-id":                 "i-0123456789",
+		"/latest/meta-data/placement/availability-zone": "eu-west-1a",
+		"/latest/meta-data/placement/region":            "eu-west-1",
+		"/latest/meta-data/tags/instance":               "Name\nteam",
+		"/latest/meta-data/tags/instance/Name":          "web",
+		"/latest/meta-data/tags/instance/team":          "platform",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+			fmt.Fprint(w, "token")
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		value, ok := values[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, value)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newGCPMetadataServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	values := map[string]string{
+		"/computeMetadata/v1/instance/id":          "4242",
+		"/computeMetadata/v1/instance/zone":        "projects/123/zones/europe-west1-b",
+		"/computeMetadata/v1/instance/attributes/": `{"team":"data"}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing header", http.StatusForbidden)
+			return
+		}
+		value, ok := values[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, value)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newUnreachableServer(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	return srv.URL
+}
+
+const cloudTestTemplate = `{{cloudProvider}} {{instanceID}} {{region}} {{zone}} {{index tags "team"}}`
+
+func TestCloudFuncs_AWS(t *testing.T) {
+	cfg := CloudConfig{AWSEndpoint: newAWSMetadataServer(t).URL, GCPEndpoint: newUnreachableServer(t)}
+	var out bytes.Buffer
+	if err := Execute(AnyProvider(map[string]any{}), []byte(cloudTestTemplate), &out, WithCloudFuncs(cfg)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "aws i-0123456789 eu-west-1 eu-west-1a platform"
+	if out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestCloudFuncs_GCP(t *testing.T) {
+	cfg := CloudConfig{AWSEndpoint: newUnreachableServer(t), GCPEndpoint: newGCPMetadataServer(t).URL}
+	var out bytes.Buffer
+	if err := Execute(AnyProvider(map[string]any{}), []byte(cloudTestTemplate), &out, WithCloudFuncs(cfg)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "gcp 4242 europe-west1 europe-west1-b data"
+	if out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestCloudFuncs_NotDetected(t *testing.T) {
+	cfg := CloudConfig{AWSEndpoint: newUnreachableServer(t), GCPEndpoint: newUnreachableServer(t)}
+	var out bytes.Buffer
+	if err := Execute(AnyProvider(map[string]any{}), []byte(`{{instanceID}}`), &out, WithCloudFuncs(cfg)); err == nil {
+		t.Fatal("expected detection error, got nil")
+	}
+}
+
+func TestNewCloudMetadata_IgnoresProxy(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://proxy.invalid:3128")
+	m := newCloudMetadata(CloudConfig{})
+	transport, ok := m.client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected a dedicated transport, got %T", m.client.Transport)
+	}
+	if transport.Proxy != nil {
+		t.Error("expected metadata requests not to use a proxy")
+	}
+}
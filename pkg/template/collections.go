@@ -0,0 +1,135 @@
+package template
+
+import (
+	"fmt"
+	"sort"
+)
+
+// dict builds a map from alternating keys and values, e.g.
+// {{ include "labels" (dict "name" .name "team" "core") }}.
+//
+// Parameters:
+//   - pairs: keys (strings) alternating with their values.
+//
+// Returns:
+//   - map[string]any: the new map.
+//   - error: non-nil if a key is missing its value or is not a string.
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: expected key and value pairs, got %d arguments", len(pairs))
+	}
+	result := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is a %T, not a string", pairs[i], pairs[i])
+		}
+		result[key] = pairs[i+1]
+	}
+	return result, nil
+}
+
+// list builds a list from its arguments, e.g. {{ range list "a" "b" }}.
+//
+// Parameters:
+//   - items: the elements.
+//
+// Returns:
+//   - []any: the new list, empty if there are no arguments.
+func list(items ...any) []any {
+	return append([]any{}, items...)
+}
+
+// merge deep-merges maps into a new map. Values of earlier maps take
+// precedence, so defaults go last: {{ merge .overrides .defaults }}. Nested
+// maps are merged recursively; the arguments are not modified.
+//
+// Parameters:
+//   - dst: the map with the highest precedence.
+//   - srcs: maps whose keys are added where dst has none.
+//
+// Returns:
+//   - map[string]any: the merged map.
+func merge(dst map[string]any, srcs ...map[string]any) map[string]any {
+	result := make(map[string]any, len(dst))
+	for _, m := range append([]map[string]any{dst}, srcs...) {
+		for key, value := range m {
+			existing, ok := result[key]
+			if !ok {
+				result[key] = value
+				continue
+			}
+			existingMap, ok1 := existing.(map[string]any)
+			valueMap, ok2 := value.(map[string]any)
+			if ok1 && ok2 {
+				result[key] = merge(existingMap, valueMap)
+			}
+		}
+	}
+	return result
+}
+
+// set returns a copy of d with key set to value. The input data is shared
+// between segments, so d itself is left unchanged; assign the result:
+// {{ $d = set $d "key" "value" }}.
+//
+// Parameters:
+//   - d: the map to copy, nil for an empty one.
+//   - key: the key to set.
+//   - value: the value to store.
+//
+// Returns:
+//   - map[string]any: the new map.
+func set(d map[string]any, key string, value any) map[string]any {
+	result := make(map[string]any, len(d)+1)
+	for k, v := range d {
+		result[k] = v
+	}
+	result[key] = value
+	return result
+}
+
+// hasKey reports whether d contains key, also when its value is empty.
+//
+// Parameters:
+//   - d: the map to look in.
+//   - key: the key to look for.
+//
+// Returns:
+//   - bool: true if the key is present.
+func hasKey(d map[string]any, key string) bool {
+	_, ok := d[key]
+	return ok
+}
+
+// keys returns the keys of d in sorted order, so that output built from
+// them is stable between runs.
+//
+// Parameters:
+//   - d: the map.
+//
+// Returns:
+//   - []string: the sorted keys.
+func keys(d map[string]any) []string {
+	result := make([]string, 0, len(d))
+	for key := range d {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// values returns the values of d in the order of their sorted keys.
+//
+// Parameters:
+//   - d: the map.
+//
+// Returns:
+//   - []any: the values.
+func values(d map[string]any) []any {
+	result := make([]any, 0, len(d))
+	for _, key := range keys(d) {
+		result = append(result, d[key])
+	}
+	return result
+}
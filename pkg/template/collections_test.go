@@ -0,0 +1,58 @@
+package template
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCollectionFuncs(t *testing.T) {
+	cases := []struct {
+		name string
+		tmpl string
+		want string
+	}{
+		{name: "dict", tmpl: `{{ $d := dict "b" 2 "a" .name }}{{ range $k, $v := $d }}{{ $k }}={{ $v }};{{ end }}`, want: "a=api;b=2;"},
+		{name: "list", tmpl: `{{ range list 1 "x" }}{{ . }};{{ end }}{{ len (list) }}`, want: "1;x;0"},
+		{name: "set", tmpl: `{{ $d := dict "a" 1 }}{{ $e := set $d "b" 2 }}{{ len $d }} {{ len $e }}`, want: "1 2"},
+		{name: "set reassign", tmpl: `{{ $d := dict }}{{ range list "x" "y" }}{{ $d = set $d . true }}{{ end }}{{ keys $d | join "," }}`, want: "x,y"},
+		{name: "hasKey", tmpl: `{{ hasKey .labels "team" }} {{ hasKey .labels "empty" }} {{ hasKey .labels "x" }}`, want: "true true false"},
+		{name: "keys values", tmpl: `{{ keys .labels | join "," }} {{ values .labels }}`, want: "empty,team [ core]"},
+	}
+	data := map[string]any{"name": "api", "labels": map[string]any{"team": "core", "empty": ""}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Execute(AnyProvider(data), []byte(tc.tmpl), &out); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, out.String())
+			}
+		})
+	}
+}
+
+func TestDict_Errors(t *testing.T) {
+	if _, err := dict("a"); err == nil || !strings.Contains(err.Error(), "pairs") {
+		t.Errorf("expected pairs error, got %v", err)
+	}
+	if _, err := dict(1, "a"); err == nil || !strings.Contains(err.Error(), "not a string") {
+		t.Errorf("expected key type error, got %v", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	overrides := map[string]any{"replicas": 3, "resources": map[string]any{"cpu": "2"}}
+	defaults := map[string]any{"replicas": 1, "image": "api", "resources": map[string]any{"cpu": "1", "memory": "1Gi"}}
+
+	got := merge(overrides, defaults)
+	want := map[string]any{"replicas": 3, "image": "api", "resources": map[string]any{"cpu": "2", "memory": "1Gi"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if len(overrides) != 2 || len(overrides["resources"].(map[string]any)) != 1 {
+		t.Errorf("merge modified its arguments: %v", overrides)
+	}
+}
@@ -0,0 +1,204 @@
+package template
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GomplateConfig configures the gomplate compatibility functions, see
+// WithGomplateFuncs.
+type GomplateConfig struct {
+	// Datasources maps aliases to files or directories, like gomplate's
+	// --datasource alias=path. file:// URLs are accepted as well.
+	Datasources map[string]string
+	// MaxSize limits the size of datasource files. Defaults to 1 MiB.
+	MaxSize int64
+}
+
+// WithGomplateFuncs returns an Option that registers gomplate's
+// datasource functions, so that gomplate templates can be moved to
+// simplate without rewriting every lookup at once:
+//
+//	{{ (datasource "config").db.host }}
+//	{{ range (ds "hosts" "prod.yaml").servers }}...{{ end }}
+//	{{ if datasourceExists "extra" }}...{{ end }}
+//
+// Only the datasources configured in cfg can be read. Files ending in
+// .yaml, .yml or .json are parsed, other files are returned as strings.
+// datasource and ds are removed by WithSandbox.
+func WithGomplateFuncs(cfg GomplateConfig) Option {
+	return optionFunc(func(o *options) {
+		d := &datasources{cfg: cfg}
+		if d.cfg.MaxSize <= 0 {
+			d.cfg.MaxSize = defaultReadFileMaxSize
+		}
+		o.funcs["datasource"] = d.read
+		o.funcs["ds"] = d.read
+		o.funcs["datasourceExists"] = d.exists
+	})
+}
+
+// datasources reads the datasources of a GomplateConfig.
+type datasources struct {
+	cfg GomplateConfig
+}
+
+// exists reports whether a datasource is defined for alias.
+func (d *datasources) exists(alias string) bool {
+	_, ok := d.cfg.Datasources[alias]
+	return ok
+}
+
+// read returns the parsed content of a datasource, like gomplate's
+// datasource function.
+//
+// Parameters:
+//   - alias: the name of the datasource.
+//   - subpath: optional file below a directory datasource, e.g.
+//     {{ ds "envs" "prod.yaml" }}.
+//
+// Returns:
+//   - any: the parsed YAML or JSON document, or the content as a string.
+//   - error: non-nil if the datasource is not defined or cannot be read
+//     or parsed.
+func (d *datasources) read(alias string, subpath ...string) (any, error) {
+	location, ok := d.cfg.Datasources[alias]
+	if !ok {
+		return nil, fmt.Errorf("datasource: undefined datasource %q", alias)
+	}
+	path := strings.TrimPrefix(location, "file://")
+	dir := filepath.Dir(path)
+	if len(subpath) > 1 {
+		return nil, fmt.Errorf("datasource: expected at most one sub-path, got %d", len(subpath))
+	}
+	if len(subpath) == 1 {
+		if strings.Contains(subpath[0], "..") || filepath.IsAbs(subpath[0]) {
+			return nil, fmt.Errorf("datasource: invalid sub-path %q", subpath[0])
+		}
+		dir = path
+		path = filepath.Join(path, subpath[0])
+	}
+
+	// Sub-paths, also through symbolic links, stay inside the datasource
+	r := newFileReader(FileReadConfig{AllowedDirs: []string{dir}, MaxSize: d.cfg.MaxSize})
+	r.name = "datasource " + alias
+	content, err := r.read(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		var value any
+		if err := yaml.Unmarshal([]byte(content), &value); err != nil {
+			return nil, fmt.Errorf("datasource %s: invalid %s: %w", alias, path, err)
+		}
+		return value, nil
+	}
+	return content, nil
+}
+
+// overlayRemoveMarker is the value returned by overlayRemove.
+type overlayRemoveMarker struct{}
+
+// WithOverlayFuncs returns an Option that registers functions applying
+// ytt-like overlays to data, so that layered configurations can be
+// expressed without ytt:
+//
+//	{{ $cfg := overlay .base .prod }}
+//	{{ $cfg := overlay .base (dict "debug" overlayRemove) }}
+//	{{ $cfg := overlayBy "id" .base .patch }}
+func WithOverlayFuncs() Option {
+	return optionFunc(func(o *options) {
+		o.funcs["overlay"] = func(base any, patches ...any) any {
+			return overlay("name", base, patches...)
+		}
+		o.funcs["overlayBy"] = func(key string, base any, patches ...any) any {
+			return overlay(key, base, patches...)
+		}
+		o.funcs["overlayRemove"] = func() any { return overlayRemoveMarker{} }
+	})
+}
+
+// overlay applies patches to base in order and returns the result; the
+// arguments are not modified. Maps are merged recursively, with patch
+// values replacing base values and overlayRemove deleting keys. Lists of
+// maps whose items all hold key are matched item by item on it: matching
+// items are overlaid and the others appended. Any other patch value,
+// including a list of scalars, replaces the base value.
+//
+// Parameters:
+//   - key: the map key identifying list items, "name" for overlay.
+//   - base: the data to overlay.
+//   - patches: the overlays, applied from first to last.
+//
+// Returns:
+//   - any: the overlaid data.
+func overlay(key string, base any, patches ...any) any {
+	result := base
+	for _, patch := range patches {
+		result = overlayValue(key, result, patch)
+	}
+	return result
+}
+
+// overlayValue overlays a single patch on base, see overlay.
+func overlayValue(key string, base, patch any) any {
+	switch p := patch.(type) {
+	case map[string]any:
+		b, ok := base.(map[string]any)
+		if !ok {
+			return overlayValue(key, map[string]any{}, p)
+		}
+		result := make(map[string]any, len(b)+len(p))
+		for k, v := range b {
+			result[k] = v
+		}
+		for k, v := range p {
+			if _, remove := v.(overlayRemoveMarker); remove {
+				delete(result, k)
+				continue
+			}
+			result[k] = overlayValue(key, result[k], v)
+		}
+		return result
+	case []any:
+		b, ok := base.([]any)
+		if !ok || !keyedList(key, b) || !keyedList(key, p) {
+			return p
+		}
+		result := append([]any{}, b...)
+		for _, item := range p {
+			id := item.(map[string]any)[key]
+			matched := false
+			for i, existing := range result {
+				if deepEqual(existing.(map[string]any)[key], id) {
+					result[i] = overlayValue(key, existing, item)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				result = append(result, item)
+			}
+		}
+		return result
+	}
+	return patch
+}
+
+// keyedList reports whether every item of items is a map holding key.
+func keyedList(key string, items []any) bool {
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return false
+		}
+		if _, ok := m[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package template
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGomplateFuncs(t *testing.T) {
+	dir := t.TempDir()
+	envs := filepath.Join(dir, "envs")
+	if err := os.MkdirAll(envs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"config.yaml":    "db:\n  host: db.internal\n",
+		"hosts.json":     `{"servers": ["a", "b"]}`,
+		"motd.txt":       "welcome",
+		"envs/prod.yaml": "replicas: 3\n",
+		"secret.txt":     "secret",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opt := WithGomplateFuncs(GomplateConfig{Datasources: map[string]string{
+		"config": filepath.Join(dir, "config.yaml"),
+		"hosts":  "file://" + filepath.Join(dir, "hosts.json"),
+		"motd":   filepath.Join(dir, "motd.txt"),
+		"envs":   envs,
+	}})
+
+	tests := []struct {
+		name    string
+		tmpl    string
+		want    string
+		wantErr string
+	}{
+		{name: "yaml", tmpl: `{{ (datasource "config").db.host }}`, want: "db.internal"},
+		{name: "json via ds", tmpl: `{{ range (ds "hosts").servers }}{{ . }}{{ end }}`, want: "ab"},
+		{name: "text", tmpl: `{{ ds "motd" }}`, want: "welcome"},
+		{name: "sub-path", tmpl: `{{ (ds "envs" "prod.yaml").replicas }}`, want: "3"},
+		{name: "exists", tmpl: `{{ datasourceExists "config" }} {{ datasourceExists "nope" }}`, want: "true false"},
+		{name: "undefined", tmpl: `{{ ds "nope" }}`, wantErr: `undefined datasource "nope"`},
+		{name: "traversal", tmpl: `{{ ds "envs" "../secret.txt" }}`, wantErr: "invalid sub-path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Execute(AnyProvider(map[string]any{}), []byte(tt.tmpl), &out, opt)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	base := map[string]any{
+		"replicas": 1,
+		"debug":    true,
+		"labels":   map[string]any{"app": "api", "tier": "web"},
+		"ports":    []any{80, 443},
+		"containers": []any{
+			map[string]any{"name": "app", "image": "app:1"},
+			map[string]any{"name": "sidecar", "image": "proxy:1"},
+		},
+	}
+	patch := map[string]any{
+		"replicas": 3,
+		"debug":    overlayRemoveMarker{},
+		"labels":   map[string]any{"tier": "backend"},
+		"ports":    []any{8080},
+		"containers": []any{
+			map[string]any{"name": "app", "image": "app:2"},
+			map[string]any{"name": "metrics", "image": "exporter:1"},
+		},
+	}
+	want := map[string]any{
+		"replicas": 3,
+		"labels":   map[string]any{"app": "api", "tier": "backend"},
+		"ports":    []any{8080},
+		"containers": []any{
+			map[string]any{"name": "app", "image": "app:2"},
+			map[string]any{"name": "sidecar", "image": "proxy:1"},
+			map[string]any{"name": "metrics", "image": "exporter:1"},
+		},
+	}
+	if got := overlay("name", base, patch); !deepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if _, ok := base["debug"]; !ok || base["replicas"] != 1 {
+		t.Errorf("expected the base to be left unchanged, got %v", base)
+	}
+
+	var out bytes.Buffer
+	tmpl := []byte(`{{ $c := overlayBy "id" .base (dict "items" (list (dict "id" 2 "v" "b"))) (dict "extra" overlayRemove) }}{{ toJson $c }}`)
+	data := map[string]any{"base": map[string]any{"items": []any{map[string]any{"id": 1, "v": "a"}, map[string]any{"id": 2, "v": "x"}}, "extra": 1}}
+	if err := Execute(AnyProvider(data), tmpl, &out, WithOverlayFuncs()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `{"items":[{"id":1,"v":"a"},{"id":2,"v":"b"}]}`; out.String() != want {
+		t.Errorf("expected %s, got %s", want, out.String())
+	}
+}
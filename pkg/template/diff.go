@@ -0,0 +1,180 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// deepEqual reports whether two data values are equal. Maps and lists are
+// compared element by element, and numbers by value, so that 1 from YAML
+// equals 1.0 from JSON.
+//
+// Parameters:
+//   - a: the first value.
+//   - b: the second value.
+//
+// Returns:
+//   - bool: true if the values are equal.
+func deepEqual(a, b any) bool {
+	return len(dataDiff(a, b)) == 0
+}
+
+// dataDiff lists the differences between two data values, e.g. to write
+// migration notes when two environments diverge:
+//
+//	{{ range dataDiff .prod .staging }}{{ .path }}: {{ .from }} -> {{ .to }}{{ end }}
+//
+// Each difference is a map with the keys "path" (e.g. ".db.hosts[1]", "."
+// for the values themselves), "change" ("added", "removed" or "changed"),
+// "from" (the value in a, nil when added) and "to" (the value in b, nil
+// when removed). Differences are ordered by path.
+//
+// Parameters:
+//   - a: the old value.
+//   - b: the new value.
+//
+// Returns:
+//   - []any: the differences, empty if the values are equal.
+func dataDiff(a, b any) []any {
+	diffs := []any{}
+	diffValues("", a, b, &diffs)
+	return diffs
+}
+
+// diffValues appends the differences between a and b, found at path, to
+// diffs.
+func diffValues(path string, a, b any, diffs *[]any) {
+	am, aIsMap := stringMap(a)
+	bm, bIsMap := stringMap(b)
+	if aIsMap && bIsMap {
+		keys := make([]string, 0, len(am)+len(bm))
+		for key := range am {
+			keys = append(keys, key)
+		}
+		for key := range bm {
+			if _, ok := am[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			av, inA := am[key]
+			bv, inB := bm[key]
+			keyPath := path + pathKey(key)
+			switch {
+			case !inB:
+				*diffs = append(*diffs, difference(keyPath, "removed", av, nil))
+			case !inA:
+				*diffs = append(*diffs, difference(keyPath, "added", nil, bv))
+			default:
+				diffValues(keyPath, av, bv, diffs)
+			}
+		}
+		return
+	}
+
+	al, aIsList := anyList(a)
+	bl, bIsList := anyList(b)
+	if aIsList && bIsList {
+		for i := 0; i < max(len(al), len(bl)); i++ {
+			indexPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(bl):
+				*diffs = append(*diffs, difference(indexPath, "removed", al[i], nil))
+			case i >= len(al):
+				*diffs = append(*diffs, difference(indexPath, "added", nil, bl[i]))
+			default:
+				diffValues(indexPath, al[i], bl[i], diffs)
+			}
+		}
+		return
+	}
+
+	if !scalarEqual(a, b) {
+		if path == "" {
+			path = "."
+		}
+		*diffs = append(*diffs, difference(path, "changed", a, b))
+	}
+}
+
+// difference builds a dataDiff entry.
+func difference(path, change string, from, to any) map[string]any {
+	return map[string]any{"path": path, "change": change, "from": from, "to": to}
+}
+
+// pathKey formats a map key as a path element, like pointerPath.
+func pathKey(key string) string {
+	if identifier.MatchString(key) {
+		return "." + key
+	}
+	return fmt.Sprintf("[%q]", key)
+}
+
+// stringMap returns v as a map[string]any if it is a map with string keys.
+func stringMap(v any) (map[string]any, bool) {
+	if m, ok := v.(map[string]any); ok {
+		return m, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	m := make(map[string]any, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		m[iter.Key().String()] = iter.Value().Interface()
+	}
+	return m, true
+}
+
+// anyList returns v as a []any if it is a slice or array.
+func anyList(v any) ([]any, bool) {
+	if l, ok := v.([]any); ok {
+		return l, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	l := make([]any, rv.Len())
+	for i := range l {
+		l[i] = rv.Index(i).Interface()
+	}
+	return l, true
+}
+
+// scalarEqual compares two values that are not both maps or both lists.
+// Numbers of different types are equal if their values are.
+func scalarEqual(a, b any) bool {
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	if isNumber(av) && isNumber(bv) {
+		switch {
+		case av.CanInt() && bv.CanInt():
+			return av.Int() == bv.Int()
+		case av.CanUint() && bv.CanUint():
+			return av.Uint() == bv.Uint()
+		default:
+			return toFloat(av) == toFloat(bv)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// isNumber reports whether v holds an integer or floating point number.
+func isNumber(v reflect.Value) bool {
+	return v.IsValid() && (v.CanInt() || v.CanUint() || v.CanFloat())
+}
+
+// toFloat converts a number to float64.
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
@@ -0,0 +1,71 @@
+package template
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDataDiff(t *testing.T) {
+	prod := map[string]any{
+		"replicas": 3,
+		"db":       map[string]any{"hosts": []any{"a", "b"}, "port": 5432},
+		"my key":   "x",
+	}
+	staging := map[string]any{
+		"replicas": 1,
+		"db":       map[string]any{"hosts": []any{"a"}, "port": 5432.0},
+		"debug":    true,
+	}
+
+	got := dataDiff(prod, staging)
+	want := []any{
+		difference(".db.hosts[1]", "removed", "b", nil),
+		difference(".debug", "added", nil, true),
+		difference(`["my key"]`, "removed", "x", nil),
+		difference(".replicas", "changed", 3, 1),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if diff := dataDiff("a", "b"); !reflect.DeepEqual(diff, []any{difference(".", "changed", "a", "b")}) {
+		t.Errorf("unexpected diff of scalars: %v", diff)
+	}
+	if diff := dataDiff(prod, prod); len(diff) != 0 {
+		t.Errorf("expected no differences, got %v", diff)
+	}
+}
+
+func TestDeepEqual(t *testing.T) {
+	cases := []struct {
+		a, b any
+		want bool
+	}{
+		{a: map[string]any{"a": []any{1, "x"}}, b: map[string]any{"a": []any{1.0, "x"}}, want: true},
+		{a: []string{"a"}, b: []any{"a"}, want: true},
+		{a: map[string]any{"a": nil}, b: map[string]any{}, want: false},
+		{a: 1, b: "1", want: false},
+		{a: nil, b: nil, want: true},
+	}
+	for _, tc := range cases {
+		if got := deepEqual(tc.a, tc.b); got != tc.want {
+			t.Errorf("deepEqual(%v, %v): expected %v, got %v", tc.a, tc.b, tc.want, got)
+		}
+	}
+}
+
+func TestDataDiff_Template(t *testing.T) {
+	tmpl := []byte(`{{ if not (deepEqual .prod .staging) }}{{ range dataDiff .prod .staging }}{{ .path }} {{ .change }}: {{ .from }} -> {{ .to }};{{ end }}{{ end }}`)
+	data := AnyProvider(map[string]any{
+		"prod":    map[string]any{"replicas": 3},
+		"staging": map[string]any{"replicas": 1},
+	})
+	var out bytes.Buffer
+	if err := Execute(data, tmpl, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := ".replicas changed: 3 -> 1;"; out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+}
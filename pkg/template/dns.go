@@ -0,0 +1,103 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+const defaultDNSTimeout = 5 * time.Second
+
+// DNSResolver is the subset of *net.Resolver used by the DNS template
+// functions.
+type DNSResolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DNSConfig configures the opt-in dnsA, dnsCNAME and dnsTXT template functions.
+type DNSConfig struct {
+	// Timeout bounds each lookup. Defaults to 5 seconds. Failed lookups
+	// are handled by the FunctionPolicy, see WithFunctionPolicy.
+	Timeout time.Duration
+	// Resolver performs the lookups. Defaults to net.DefaultResolver.
+	Resolver DNSResolver
+}
+
+// WithDNSFuncs returns an Option that registers the DNS template functions:
+//
+//	{{ range dnsA "api.example.com" }}allow {{ . }};{{ end }}
+//	{{ dnsCNAME "www.example.com" }}
+//	{{ range dnsTXT "example.com" }}{{ . }}{{ end }}
+//
+// dnsA returns the sorted IPv4 addresses of a host, dnsCNAME its canonical
+// name and dnsTXT its TXT records.
+func WithDNSFuncs(cfg DNSConfig) Option {
+	return optionFunc(func(o *options) {
+		l := newDNSLookup(cfg)
+		o.registerBlocking(map[string]any{
+			"dnsA":     l.a,
+			"dnsCNAME": l.cname,
+			"dnsTXT":   l.txt,
+		})
+	})
+}
+
+// dnsLookup implements the DNS template functions for a DNSConfig.
+type dnsLookup struct {
+	cfg DNSConfig
+}
+
+func newDNSLookup(cfg DNSConfig) *dnsLookup {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultDNSTimeout
+	}
+	if cfg.Resolver == nil {
+		cfg.Resolver = net.DefaultResolver
+	}
+	return &dnsLookup{cfg: cfg}
+}
+
+// a returns the IPv4 addresses of host in sorted order.
+func (l *dnsLookup) a(ctx context.Context, host string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.cfg.Timeout)
+	defer cancel()
+
+	ips, err := l.cfg.Resolver.LookupIP(ctx, "ip4", host)
+	if err != nil {
+		return nil, fmt.Errorf("dnsA: lookup of %s failed: %w", host, err)
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// cname returns the canonical name of host.
+func (l *dnsLookup) cname(ctx context.Context, host string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.cfg.Timeout)
+	defer cancel()
+
+	name, err := l.cfg.Resolver.LookupCNAME(ctx, host)
+	if err != nil {
+		return "", fmt.Errorf("dnsCNAME: lookup of %s failed: %w", host, err)
+	}
+	return name, nil
+}
+
+// txt returns the TXT records of host.
+func (l *dnsLookup) txt(ctx context.Context, host string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.cfg.Timeout)
+	defer cancel()
+
+	records, err := l.cfg.Resolver.LookupTXT(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("dnsTXT: lookup of %s failed: %w", host, err)
+	}
+	return records, nil
+}
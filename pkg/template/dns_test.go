@@ -0,0 +1,91 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+// fakeResolver answers DNS lookups from static tables.
+type fakeResolver struct {
+	ips    map[string][]net.IP
+	cnames map[string]string
+	txts   map[string][]string
+}
+
+var errNotFound = errors.New("no such host")
+
+func (r *fakeResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	if ips, ok := r.ips[host]; ok {
+		return ips, nil
+	}
+	return nil, errNotFound
+}
+
+func (r *fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if name, ok := r.cnames[host]; ok {
+		return name, nil
+	}
+	return "", errNotFound
+}
+
+func (r *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if records, ok := r.txts[name]; ok {
+		return records, nil
+	}
+	return nil, errNotFound
+}
+
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{
+		ips:    map[string][]net.IP{"api.example.com": {net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1")}},
+		cnames: map[string]string{"www.example.com": "cdn.example.net."},
+		txts:   map[string][]string{"example.com": {"v=spf1 -all"}},
+	}
+}
+
+func TestDNSFuncs_Lookups(t *testing.T) {
+	tmpl := []byte(`{{range dnsA "api.example.com"}}{{.}} {{end}}|{{dnsCNAME "www.example.com"}}|{{index (dnsTXT "example.com") 0}}`)
+	var out bytes.Buffer
+	err := Execute(AnyProvider(map[string]any{}), tmpl, &out, WithDNSFuncs(DNSConfig{Resolver: newFakeResolver()}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "10.0.0.1 10.0.0.2 |cdn.example.net.|v=spf1 -all"
+	if out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestDNSFuncs_FailureModes(t *testing.T) {
+	tmpl := []byte(`[{{range dnsA "missing.example.com"}}{{.}}{{end}}][{{dnsCNAME "missing.example.com"}}]`)
+
+	var out bytes.Buffer
+	err := Execute(AnyProvider(map[string]any{}), tmpl, &out, WithDNSFuncs(DNSConfig{Resolver: newFakeResolver()}))
+	if err == nil {
+		t.Fatal("expected lookup error with default failure mode, got nil")
+	}
+
+	out.Reset()
+	err = Execute(AnyProvider(map[string]any{}), tmpl, &out, WithDNSFuncs(DNSConfig{Resolver: newFakeResolver()}),
+		WithFunctionPolicy(FunctionPolicy{OnError: FunctionErrorEmpty}))
+	if err != nil {
+		t.Fatalf("unexpected error with empty failure mode: %v", err)
+	}
+	if out.String() != "[][]" {
+		t.Errorf("expected empty results, got %q", out.String())
+	}
+}
+
+func TestDNSFuncs_DefaultResolverLocalhost(t *testing.T) {
+	l := newDNSLookup(DNSConfig{})
+	addrs, err := l.a(context.Background(), "localhost")
+	if err != nil {
+		t.Skipf("localhost does not resolve in this environment: %v", err)
+	}
+	if len(addrs) == 0 {
+		t.Error("expected at least one address for localhost")
+	}
+}
@@ -0,0 +1,101 @@
+package template
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ParseDotenv parses dotenv-formatted input into a map of variable names to
+// values.
+//
+// Supported syntax:
+//   - KEY=value pairs, one per line, with an optional leading "export "
+//   - blank lines and lines starting with # are ignored
+//   - unquoted values are trimmed and may end with an inline " # comment"
+//   - single-quoted values are taken literally
+//   - double-quoted values support the escapes \n, \r, \t, \" and \\
+//
+// Returns an error identifying the line number of the first malformed entry.
+func ParseDotenv(input []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(input))
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing '=' in %q", lineNo, line)
+		}
+		key = strings.TrimSpace(key)
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", lineNo, key)
+		}
+
+		parsed, err := parseDotenvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		vars[key] = parsed
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dotenv input: %w", err)
+	}
+
+	return vars, nil
+}
+
+// parseDotenvValue interprets the right-hand side of a dotenv assignment.
+func parseDotenvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	switch value[0] {
+	case '\'':
+		end := strings.IndexByte(value[1:], '\'')
+		if end == -1 {
+			return "", fmt.Errorf("unterminated single-quoted value")
+		}
+		return value[1 : end+1], nil
+
+	case '"':
+		var sb strings.Builder
+		for i := 1; i < len(value); i++ {
+			c := value[i]
+			switch {
+			case c == '"':
+				return sb.String(), nil
+			case c == '\\' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 'r':
+					sb.WriteByte('\r')
+				case 't':
+					sb.WriteByte('\t')
+				default:
+					sb.WriteByte(value[i])
+				}
+			default:
+				sb.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated double-quoted value")
+	}
+
+	// Unquoted: strip an inline comment introduced by whitespace + #
+	if idx := strings.Index(value, " #"); idx != -1 {
+		value = value[:idx]
+	}
+	return strings.TrimSpace(value), nil
+}
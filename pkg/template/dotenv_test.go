@@ -0,0 +1,64 @@
+package template
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDotenv_Syntax(t *testing.T) {
+	input := []byte(`
+# database settings
+DB_HOST=localhost
+export DB_PORT=5432
+EMPTY=
+COMMENTED=value # trailing comment
+SINGLE='literal $HOME \n'
+DOUBLE="line1\nline2 \"quoted\""
+  SPACED = padded
+`)
+	want := map[string]string{
+		"DB_HOST":   "localhost",
+		"DB_PORT":   "5432",
+		"EMPTY":     "",
+		"COMMENTED": "value",
+		"SINGLE":    `literal $HOME \n`,
+		"DOUBLE":    "line1\nline2 \"quoted\"",
+		"SPACED":    "padded",
+	}
+
+	got, err := ParseDotenv(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParseDotenv_Errors(t *testing.T) {
+	cases := map[string]string{
+		"missing equals":    "NOVALUE",
+		"empty key":         "=value",
+		"unterminated '":    "KEY='open",
+		"unterminated \"":   `KEY="open`,
+		"space in var name": "MY KEY=value",
+	}
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseDotenv([]byte(input)); err == nil {
+				t.Fatalf("expected error for %q, got nil", input)
+			}
+		})
+	}
+}
+
+func TestDotenvProvider(t *testing.T) {
+	got, err := DotenvProvider([]byte("NAME=app\nPORT=8080\n"))()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]any{"NAME": "app", "PORT": "8080"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
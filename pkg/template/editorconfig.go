@@ -0,0 +1,492 @@
+package template
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// editorConfigName is the name of EditorConfig files.
+const editorConfigName = ".editorconfig"
+
+// WithEditorConfig returns an Option that normalizes generated files
+// according to the .editorconfig files that apply to them, so that
+// generated code follows the formatting rules of the project it is written
+// into. Files are located below dir, the output directory, and the
+// .editorconfig files of their directory and its parents are read up to the
+// first one declaring root = true, as editors do.
+//
+// The supported properties are indent_style (with indent_size and
+// tab_width), trim_trailing_whitespace, end_of_line, insert_final_newline
+// and charset (utf-8, utf-8-bom, latin1, utf-16be and utf-16le). Only the
+// indentation at the start of lines is changed. Unknown properties and
+// values are ignored, as are files containing NUL bytes.
+//
+// Normalization runs as a BeforeWrite hook; give this option before
+// WithSigning so that signatures cover the normalized content.
+func WithEditorConfig(dir string) Option {
+	return WithHooks(Hooks{
+		BeforeWrite: func(_ context.Context, outputs []RenderedOutput) ([]RenderedOutput, error) {
+			base, err := filepath.Abs(dir)
+			if err != nil {
+				return nil, fmt.Errorf("editorconfig: %w", err)
+			}
+			configs := editorConfigs{}
+			for i, out := range outputs {
+				if out.Segment.Type != SegmentFile || out.Skipped != "" {
+					continue
+				}
+				path := out.Path
+				if !filepath.IsAbs(path) {
+					path = filepath.Join(base, path)
+				}
+				props, err := configs.properties(path)
+				if err != nil {
+					return nil, err
+				}
+				if outputs[i].Content, err = props.normalize(out.Content); err != nil {
+					return nil, fmt.Errorf("editorconfig: %s: %w", out.Path, err)
+				}
+			}
+			return outputs, nil
+		},
+	})
+}
+
+// editorConfigFile is a parsed .editorconfig file.
+type editorConfigFile struct {
+	dir      string // Directory holding the file
+	root     bool
+	sections []editorConfigSection
+}
+
+// editorConfigSection is a [glob] section of an .editorconfig file.
+type editorConfigSection struct {
+	glob   *regexp.Regexp
+	ranges [][2]int // Bounds of the {n..m} patterns, one capture group each
+	props  map[string]string
+}
+
+// matches reports whether the section applies to rel, a slash-separated
+// path relative to the directory of its .editorconfig file.
+func (s editorConfigSection) matches(rel string) bool {
+	m := s.glob.FindStringSubmatch(rel)
+	if m == nil {
+		return false
+	}
+	for i, r := range s.ranges {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil || n < r[0] || n > r[1] {
+			return false
+		}
+	}
+	return true
+}
+
+// editorConfigs caches the .editorconfig files read during a run, keyed by
+// directory; nil means the directory has none.
+type editorConfigs map[string]*editorConfigFile
+
+// properties returns the EditorConfig properties that apply to path, an
+// absolute filename. Closer .editorconfig files and later sections take
+// precedence.
+func (c editorConfigs) properties(path string) (editorConfigProps, error) {
+	var files []*editorConfigFile
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		f, err := c.load(dir)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			files = append(files, f)
+			if f.root {
+				break
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+
+	props := editorConfigProps{}
+	for i := len(files) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(files[i].dir, path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, section := range files[i].sections {
+			if !section.matches(rel) {
+				continue
+			}
+			for k, v := range section.props {
+				props[k] = v
+			}
+		}
+	}
+	return props, nil
+}
+
+// load returns the .editorconfig file of dir, or nil if there is none.
+func (c editorConfigs) load(dir string) (*editorConfigFile, error) {
+	if f, ok := c[dir]; ok {
+		return f, nil
+	}
+	name := filepath.Join(dir, editorConfigName)
+	content, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		c[dir] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("editorconfig: failed to read %s: %w", name, err)
+	}
+	f, err := parseEditorConfig(dir, content)
+	if err != nil {
+		return nil, fmt.Errorf("editorconfig: %s:%w", name, err)
+	}
+	c[dir] = f
+	return f, nil
+}
+
+// parseEditorConfig parses the content of the .editorconfig file of dir.
+// Property names and values are lowercased; lines that are neither
+// sections nor properties are ignored, as the specification requires.
+func parseEditorConfig(dir string, content []byte) (*editorConfigFile, error) {
+	f := &editorConfigFile{dir: dir}
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(content, utf8BOM)))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "" || text[0] == '#' || text[0] == ';':
+		case text[0] == '[' && text[len(text)-1] == ']':
+			glob, ranges, err := editorConfigGlob(text[1 : len(text)-1])
+			if err != nil {
+				return nil, fmt.Errorf("%d: invalid section %s: %w", line, text, err)
+			}
+			f.sections = append(f.sections, editorConfigSection{glob: glob, ranges: ranges, props: map[string]string{}})
+		default:
+			key, value, ok := strings.Cut(text, "=")
+			if !ok {
+				continue
+			}
+			key = strings.ToLower(strings.TrimSpace(key))
+			value = strings.ToLower(strings.TrimSpace(value))
+			if len(f.sections) == 0 {
+				// Preamble: only root is meaningful
+				f.root = f.root || key == "root" && value == "true"
+				continue
+			}
+			f.sections[len(f.sections)-1].props[key] = value
+		}
+	}
+	return f, scanner.Err()
+}
+
+// editorConfigRange matches the numeric {n..m} pattern of a glob.
+var editorConfigRange = regexp.MustCompile(`^([+-]?\d+)\.\.([+-]?\d+)$`)
+
+// editorConfigGlob compiles an EditorConfig section glob to a regular
+// expression matching slash-separated paths relative to the directory of
+// the .editorconfig file. Globs without a slash match file names in any
+// subdirectory. It returns the bounds of the {n..m} patterns, which the
+// caller checks against the corresponding capture groups.
+func editorConfigGlob(glob string) (*regexp.Regexp, [][2]int, error) {
+	prefix := "(?:.*/)?"
+	if strings.Contains(glob, "/") {
+		prefix = ""
+		glob = strings.TrimPrefix(glob, "/")
+	}
+	var ranges [][2]int
+	re, err := regexp.Compile("^" + prefix + translateGlob(glob, &ranges) + "$")
+	if err != nil {
+		return nil, nil, err
+	}
+	return re, ranges, nil
+}
+
+// translateGlob translates glob to a regular expression, appending the
+// bounds of its {n..m} patterns to ranges.
+func translateGlob(glob string, ranges *[][2]int) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			class := ""
+			if end != -1 {
+				class = glob[i+1 : i+1+end]
+			}
+			if end == -1 || strings.Contains(class, "/") {
+				b.WriteString(`\[`)
+				continue
+			}
+			b.WriteByte('[')
+			if strings.HasPrefix(class, "!") {
+				b.WriteByte('^')
+				class = class[1:]
+			}
+			b.WriteString(strings.ReplaceAll(class, `\`, `\\`))
+			b.WriteByte(']')
+			i += end + 1
+		case '{':
+			end := matchingBrace(glob, i)
+			if end == -1 {
+				b.WriteString(`\{`)
+				continue
+			}
+			inner := glob[i+1 : end]
+			i = end
+			if m := editorConfigRange.FindStringSubmatch(inner); m != nil {
+				lo, _ := strconv.Atoi(m[1])
+				hi, _ := strconv.Atoi(m[2])
+				*ranges = append(*ranges, [2]int{min(lo, hi), max(lo, hi)})
+				b.WriteString(`([+-]?\d+)`)
+				continue
+			}
+			alternatives := splitAlternatives(inner)
+			if len(alternatives) == 1 {
+				// A single alternative is taken literally
+				b.WriteString(regexp.QuoteMeta("{" + inner + "}"))
+				continue
+			}
+			b.WriteString("(?:")
+			for j, alt := range alternatives {
+				if j > 0 {
+					b.WriteByte('|')
+				}
+				b.WriteString(translateGlob(alt, ranges))
+			}
+			b.WriteByte(')')
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String()
+}
+
+// matchingBrace returns the index of the } closing the { at open in glob,
+// or -1 if there is none.
+func matchingBrace(glob string, open int) int {
+	depth := 0
+	for i := open; i < len(glob); i++ {
+		switch glob[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitAlternatives splits the content of a {a,b} pattern on the commas
+// that are not nested in other braces.
+func splitAlternatives(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// editorConfigProps are the EditorConfig properties that apply to a file.
+type editorConfigProps map[string]string
+
+// normalize returns content formatted according to the properties.
+func (p editorConfigProps) normalize(content []byte) ([]byte, error) {
+	if len(p) == 0 || bytes.IndexByte(content, 0) != -1 {
+		return content, nil
+	}
+	hadBOM := bytes.HasPrefix(content, utf8BOM)
+	content = bytes.TrimPrefix(content, utf8BOM)
+
+	if p["trim_trailing_whitespace"] == "true" {
+		content = stripTrailingWhitespace(content)
+	}
+	if style := p["indent_style"]; style == "space" || style == "tab" {
+		content = reindent(content, style == "tab", p.indentSize(), p.tabWidth())
+	}
+
+	eol := map[string]string{"lf": "\n", "crlf": "\r\n", "cr": "\r"}[p["end_of_line"]]
+	if eol != "" {
+		content = convertLineEndings(content, eol)
+	}
+	switch p["insert_final_newline"] {
+	case "true":
+		if len(content) > 0 && content[len(content)-1] != '\n' && content[len(content)-1] != '\r' {
+			if eol == "" {
+				eol = "\n"
+				if bytes.Contains(content, []byte("\r\n")) {
+					eol = "\r\n"
+				}
+			}
+			content = append(content, eol...)
+		}
+	case "false":
+		content = bytes.TrimRight(content, "\r\n")
+	}
+
+	switch charset := p["charset"]; charset {
+	case "utf-8":
+	case "utf-8-bom":
+		content = append(append([]byte{}, utf8BOM...), content...)
+	case "latin1":
+		return encodeLatin1(content)
+	case "utf-16be", "utf-16le":
+		return encodeUTF16(content, charset == "utf-16be")
+	default:
+		if hadBOM {
+			content = append(append([]byte{}, utf8BOM...), content...)
+		}
+	}
+	return content, nil
+}
+
+// indentSize returns the number of columns of an indentation level.
+func (p editorConfigProps) indentSize() int {
+	if n, err := strconv.Atoi(p["indent_size"]); err == nil && n > 0 {
+		return n
+	}
+	return p.tabWidth()
+}
+
+// tabWidth returns the number of columns of a tab character, which defaults
+// to indent_size, then to 4.
+func (p editorConfigProps) tabWidth() int {
+	if n, err := strconv.Atoi(p["tab_width"]); err == nil && n > 0 {
+		return n
+	}
+	if n, err := strconv.Atoi(p["indent_size"]); err == nil && n > 0 {
+		return n
+	}
+	return 4
+}
+
+// reindent rewrites the leading spaces and tabs of every line: with tabs,
+// one tab per indentSize columns followed by spaces for the rest; without,
+// spaces only. Tabs are tabWidth columns wide.
+func reindent(content []byte, tabs bool, indentSize, tabWidth int) []byte {
+	out := make([]byte, 0, len(content))
+	for len(content) > 0 {
+		line, rest, found := bytes.Cut(content, []byte{'\n'})
+		columns, n := 0, 0
+		for ; n < len(line) && (line[n] == ' ' || line[n] == '\t'); n++ {
+			if line[n] == '\t' {
+				columns += tabWidth - columns%tabWidth
+			} else {
+				columns++
+			}
+		}
+		if n == len(line) || n == len(line)-1 && line[n] == '\r' {
+			// Whitespace-only lines are left alone
+			out = append(out, line...)
+		} else {
+			if tabs {
+				out = append(out, bytes.Repeat([]byte{'\t'}, columns/indentSize)...)
+				columns %= indentSize
+			}
+			out = append(out, bytes.Repeat([]byte{' '}, columns)...)
+			out = append(out, line[n:]...)
+		}
+		if found {
+			out = append(out, '\n')
+		}
+		content = rest
+	}
+	return out
+}
+
+// convertLineEndings replaces every LF, CRLF and CR line ending of content
+// with eol.
+func convertLineEndings(content []byte, eol string) []byte {
+	out := make([]byte, 0, len(content))
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; {
+		case c == '\r' && i+1 < len(content) && content[i+1] == '\n':
+			out = append(out, eol...)
+			i++
+		case c == '\r' || c == '\n':
+			out = append(out, eol...)
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// encodeLatin1 converts UTF-8 content to ISO-8859-1.
+func encodeLatin1(content []byte) ([]byte, error) {
+	out := make([]byte, 0, len(content))
+	for i := 0; i < len(content); {
+		r, size := utf8.DecodeRune(content[i:])
+		if r == utf8.RuneError && size == 1 {
+			return nil, fmt.Errorf("invalid UTF-8 at byte %d", i)
+		}
+		if r > 0xFF {
+			return nil, fmt.Errorf("character %q at byte %d cannot be encoded in latin1", r, i)
+		}
+		out = append(out, byte(r))
+		i += size
+	}
+	return out, nil
+}
+
+// encodeUTF16 converts UTF-8 content to UTF-16 with a byte order mark.
+func encodeUTF16(content []byte, bigEndian bool) ([]byte, error) {
+	if !utf8.Valid(content) {
+		return nil, fmt.Errorf("invalid UTF-8 content")
+	}
+	units := utf16.Encode(append([]rune{'\ufeff'}, []rune(string(content))...))
+	out := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		if bigEndian {
+			out = append(out, byte(u>>8), byte(u))
+		} else {
+			out = append(out, byte(u), byte(u>>8))
+		}
+	}
+	return out, nil
+}
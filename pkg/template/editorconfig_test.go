@@ -0,0 +1,131 @@
+package template
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEditorConfigGlob(t *testing.T) {
+	cases := []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		{"*", "main.go", true},
+		{"*", "pkg/main.go", true},
+		{"*.go", "pkg/main.go", true},
+		{"*.go", "main.go.txt", false},
+		{"*.{yaml,yml}", "deploy/app.yml", true},
+		{"*.{yaml,yml}", "deploy/app.json", false},
+		{"{single}", "{single}", true},
+		{"/Makefile", "Makefile", true},
+		{"/Makefile", "sub/Makefile", false},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/sub/a.md", false},
+		{"docs/**.md", "docs/sub/a.md", true},
+		{"lib/**/*.js", "lib/a/b/c.js", true},
+		{"file?.txt", "file1.txt", true},
+		{"file?.txt", "file12.txt", false},
+		{"[ab].txt", "b.txt", true},
+		{"[!ab].txt", "b.txt", false},
+		{"part{1..3}.txt", "part2.txt", true},
+		{"part{1..3}.txt", "part4.txt", false},
+		{"a\\*b", "a*b", true},
+		{"a\\*b", "axb", false},
+	}
+	for _, tc := range cases {
+		glob, ranges, err := editorConfigGlob(tc.glob)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.glob, err)
+		}
+		section := editorConfigSection{glob: glob, ranges: ranges}
+		if got := section.matches(tc.path); got != tc.match {
+			t.Errorf("%s on %s: expected %v, got %v", tc.glob, tc.path, tc.match, got)
+		}
+	}
+}
+
+func TestEditorConfigNormalize(t *testing.T) {
+	cases := []struct {
+		name    string
+		props   editorConfigProps
+		content string
+		want    string
+	}{
+		{"no properties", nil, "a \t\n", "a \t\n"},
+		{"spaces", editorConfigProps{"indent_style": "space", "indent_size": "2"}, "a:\n\tb:\n\t\tc: 1\n\t \n", "a:\n  b:\n    c: 1\n\t \n"},
+		{"tabs", editorConfigProps{"indent_style": "tab", "indent_size": "4"}, "func() {\n    x := 1\n      y\n}", "func() {\n\tx := 1\n\t  y\n}"},
+		{"tab width", editorConfigProps{"indent_style": "space", "indent_size": "2", "tab_width": "8"}, "\tx", "        x"},
+		{"trim", editorConfigProps{"trim_trailing_whitespace": "true"}, "a  \r\nb\t", "a\r\nb"},
+		{"crlf", editorConfigProps{"end_of_line": "crlf", "insert_final_newline": "true"}, "a\nb\r\nc", "a\r\nb\r\nc\r\n"},
+		{"final newline keeps crlf", editorConfigProps{"insert_final_newline": "true"}, "a\r\nb", "a\r\nb\r\n"},
+		{"no final newline", editorConfigProps{"insert_final_newline": "false"}, "a\n\n", "a"},
+		{"utf-8", editorConfigProps{"charset": "utf-8"}, "\ufeffa", "a"},
+		{"utf-8-bom", editorConfigProps{"charset": "utf-8-bom"}, "a", "\ufeffa"},
+		{"bom kept", editorConfigProps{"insert_final_newline": "true"}, "\ufeffa", "\ufeffa\n"},
+		{"latin1", editorConfigProps{"charset": "latin1"}, "caf\u00e9", "caf\xe9"},
+		{"utf-16le", editorConfigProps{"charset": "utf-16le"}, "a", "\xff\xfea\x00"},
+		{"binary", editorConfigProps{"end_of_line": "crlf"}, "a\x00\n", "a\x00\n"},
+	}
+	for _, tc := range cases {
+		got, err := tc.props.normalize([]byte(tc.content))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+
+	if _, err := (editorConfigProps{"charset": "latin1"}).normalize([]byte("\u20ac")); err == nil {
+		t.Error("expected an error for a character latin1 cannot encode")
+	}
+}
+
+func TestWithEditorConfig(t *testing.T) {
+	dir := t.TempDir()
+	outDir := filepath.Join(dir, "project", "out")
+	files := map[string]string{
+		".editorconfig":             "[*]\nindent_style = tab\n",
+		"project/.editorconfig":     "root = true\n\n[*]\nindent_style = space\nindent_size = 2\ninsert_final_newline = true\n\n[Makefile]\nindent_style = tab\n",
+		"project/out/.editorconfig": "[*.md]\ntrim_trailing_whitespace = true\ninsert_final_newline = false\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writer := &DefaultFileWriter{}
+	if err := writer.SetBaseDir(outDir); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := []byte("#FILE:app.yaml#a:\n\tb: 1#FILE##FILE:Makefile#all:\n  go build#FILE##FILE:README.md#title  \n#FILE#\ta\n")
+	var stdout bytes.Buffer
+	if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &stdout, writer, WithEditorConfig(outDir)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"app.yaml":  "a:\n  b: 1\n",
+		"Makefile":  "all:\n\tgo build\n",
+		"README.md": "title",
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: expected %q, got %q", name, content, got)
+		}
+	}
+	if stdout.String() != "\ta\n" {
+		t.Errorf("expected stdout to be left alone, got %q", stdout.String())
+	}
+}
@@ -0,0 +1,475 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"text/template"
+)
+
+// Engine renders templates containing FILE directives: it loads and
+// validates the input data, parses the template into segments, renders
+// filenames and contents, and dispatches stdout segments and files to the
+// configured writers. An Engine holds no per-render state and may be reused.
+//
+// Example:
+//
+//	engine := NewEngine(
+//		WithWriter(&MemoryFileWriter{}),
+//		WithFuncs(template.FuncMap{"upper": strings.ToUpper}),
+//		WithStrictMode(),
+//	)
+//	err := engine.Render(YamlProvider(input), templ)
+type Engine struct {
+	opts []Option
+}
+
+// NewEngine returns an Engine configured with the given options. Without
+// WithOutput and WithWriter, stdout segments go to os.Stdout and files are
+// written relative to the current directory.
+func NewEngine(opts ...Option) *Engine {
+	return &Engine{opts: opts}
+}
+
+// WithWriter returns an Option that sets the FileWriter receiving FILE
+// segments.
+func WithWriter(w FileWriter) Option {
+	return optionFunc(func(o *options) {
+		o.writer = w
+	})
+}
+
+// WithOutput returns an Option that sets the writer receiving stdout
+// segments (content outside FILE blocks).
+func WithOutput(w io.Writer) Option {
+	return optionFunc(func(o *options) {
+		o.output = w
+	})
+}
+
+// WithFuncs returns an Option that makes funcs available to templates.
+// Functions with the same name as a built-in function replace it.
+func WithFuncs(funcs template.FuncMap) Option {
+	return optionFunc(func(o *options) {
+		for name, fn := range funcs {
+			o.funcs[name] = fn
+		}
+	})
+}
+
+// WithRenderFuncs returns an Option that calls newFuncs at the start of
+// every render and makes the returned functions available to templates, as
+// WithFuncs does. Functions can so keep state for a single render, e.g. a
+// counter that restarts with every render of an Engine.
+func WithRenderFuncs(newFuncs func() template.FuncMap) Option {
+	return optionFunc(func(o *options) {
+		for name, fn := range newFuncs() {
+			o.funcs[name] = fn
+		}
+	})
+}
+
+// WithValidators returns an Option that runs the given validation functions
+// on the input data before rendering.
+func WithValidators(validators ...ValidateInputFunc) Option {
+	return optionFunc(func(o *options) {
+		o.validators = append(o.validators, validators...)
+	})
+}
+
+// WithStrictMode returns an Option that makes rendering fail when a template
+// references a map key missing from the data, instead of printing
+// "<no value>".
+func WithStrictMode() Option {
+	return optionFunc(func(o *options) {
+		o.strict = true
+	})
+}
+
+// newTemplate returns an empty template with the configured functions
+// (including include) and strict mode applied.
+func (o *options) newTemplate(name string) *template.Template {
+	tmpl := bindInclude(o.ctx, template.New(name).Funcs(o.funcs))
+	if o.strict {
+		tmpl.Option("missingkey=error")
+	}
+	return tmpl
+}
+
+// Render renders templ with the data returned by inputProvider, as described
+// for ExecuteWithFiles.
+func (e *Engine) Render(inputProvider InputProvider, templ []byte) error {
+	return e.RenderContext(context.Background(), ContextProvider(inputProvider), templ)
+}
+
+// RenderContext is like Render but stops when ctx is done, as described for
+// ExecuteContext. Cancellation is also checked before every segment is
+// rendered and before every file is written, so files are either written
+// completely or not at all. inputProvider is called with ctx; wrap providers
+// that do not block with ContextProvider.
+func (e *Engine) RenderContext(ctx context.Context, inputProvider InputProviderContext, templ []byte) error {
+	_, err := e.RenderWithReport(ctx, inputProvider, templ)
+	return err
+}
+
+// RenderWithReport is like RenderContext but also reports which files were
+// written or skipped, e.g. to tell which files the template still generates.
+func (e *Engine) RenderWithReport(ctx context.Context, inputProvider InputProviderContext, templ []byte) (*RenderReport, error) {
+	o := newOptions(ctx, e.opts)
+
+	// Get and validate input data
+	data, err := o.loadData(inputProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse template into segments
+	segments, err := ParseSegments(templ)
+	if err != nil {
+		var terr *TemplateError
+		if errors.As(err, &terr) {
+			terr.Name = o.templateName
+		}
+		return nil, withKind(ErrTemplate, fmt.Errorf("failed to parse template segments: %w", err))
+	}
+	o.logger.Debug("template parsed", "template", o.templateName, "segments", len(segments))
+	if segments, err = o.afterParse(segments); err != nil {
+		return nil, err
+	}
+
+	report, err := o.renderSegments(segments, data)
+	if err != nil {
+		return nil, err
+	}
+	o.logger.Debug("render complete", "files", len(report.Written()), "skipped", len(report.Files)-len(report.Written()), "stdout_bytes", report.StdoutBytes)
+	return report, nil
+}
+
+// SkipReason explains why a FILE segment was not written.
+type SkipReason string
+
+const (
+	// SkippedExists means the file already existed and the segment had the
+	// if-missing attribute (or WithNoClobber was set).
+	SkippedExists SkipReason = "exists"
+	// SkippedEmpty means the segment rendered to whitespace only and had the
+	// skip-empty attribute (or WithSkipEmpty was set).
+	SkippedEmpty SkipReason = "empty"
+)
+
+// FileResult describes the outcome of a single rendered FILE segment (or of
+// one element of a FILE-EACH segment).
+type FileResult struct {
+	Path    string      // Rendered filename as passed to the FileWriter
+	Line    int         // Template line of the FILE directive
+	Size    int         // Number of rendered content bytes
+	Mode    os.FileMode // Requested mode, 0 for the writer default
+	Skipped SkipReason  // Empty if the file was written
+	Status  WriteStatus // Reported by StatusWriters, empty otherwise or if skipped
+}
+
+// RenderReport summarizes what RenderSegments produced.
+type RenderReport struct {
+	Files       []FileResult // FILE outputs in template order
+	Dirs        []string     // Directories created by DIR directives, in template order
+	StdoutBytes int          // Number of bytes written to the stdout writer
+}
+
+// Written returns the results of the files that were not skipped,
+// including files a StatusWriter left unchanged.
+func (r *RenderReport) Written() []FileResult {
+	var written []FileResult
+	for _, f := range r.Files {
+		if f.Skipped == "" {
+			written = append(written, f)
+		}
+	}
+	return written
+}
+
+// RenderSegments renders already parsed segments (see ParseSegments) with
+// data, writing stdout segments to output and FILE segments through
+// fileWriter, and reports which files were written or skipped. Input data
+// and segments are used as is: validation functions and AfterLoad and
+// AfterParse hooks among opts are ignored.
+//
+// As with ExecuteWithFiles, every segment (including its filename template)
+// is rendered and path collisions are checked before anything is written.
+func RenderSegments(segments []Segment, data any, fileWriter FileWriter, output io.Writer, opts ...Option) (*RenderReport, error) {
+	all := make([]Option, 0, len(opts)+2)
+	all = append(all, opts...)
+	all = append(all, WithOutput(output), WithWriter(fileWriter))
+	return newOptions(context.Background(), all).renderSegments(segments, data)
+}
+
+// renderSegments implements RenderSegments with resolved options.
+func (o *options) renderSegments(segments []Segment, data any) (*RenderReport, error) {
+	o.defines = o.collectDefines(segments)
+
+	// Expand FILE-EACH segments into one job per list element
+	var jobs []renderJob
+	var failed RenderErrors
+	for i, segment := range segments {
+		items := []any{data}
+		if segment.Type == SegmentFile && segment.Each != nil {
+			var err error
+			if items, err = o.eachItems(segment.Each, data); err != nil {
+				err = withKind(ErrTemplate, fmt.Errorf("failed to resolve FILE-EACH list for segment %d: %w", i, err))
+				if !o.keepGoing {
+					return nil, err
+				}
+				failed = append(failed, err)
+			}
+		}
+		for _, item := range items {
+			jobs = append(jobs, renderJob{index: i, segment: segment, data: item})
+		}
+	}
+
+	// Render every segment before producing any output, so that problems
+	// such as path collisions are reported without partially written results
+	rendered := make([]renderedSegment, len(jobs))
+	if err := o.forEachAll(len(jobs), func(i int) (err error) {
+		if o.segmentTimeout > 0 {
+			rendered[i], err = o.renderJobWithTimeout(jobs[i])
+		} else {
+			rendered[i], err = o.renderJob(jobs[i], nil)
+		}
+		return withKind(ErrTemplate, err)
+	}); err != nil {
+		if renderErrs, ok := err.(RenderErrors); ok {
+			failed = append(failed, renderErrs...)
+		} else {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 1 && o.ctx.Err() != nil {
+		// Every pending segment fails the same way once the run is canceled
+		return nil, o.ctx.Err()
+	}
+	if err := failed.err(); err != nil {
+		return nil, err
+	}
+
+	rendered, err := o.beforeWrite(rendered)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.checkPathCollisions(rendered); err != nil {
+		return nil, withKind(ErrTemplate, err)
+	}
+	if o.portability {
+		if err := checkPortability(rendered); err != nil {
+			return nil, withKind(ErrTemplate, err)
+		}
+	}
+
+	// Sidecars of file outputs are written together with their files
+	filePaths := make(map[string]bool)
+	for _, r := range rendered {
+		if r.segment.Type == SegmentFile {
+			filePaths[r.filename] = true
+		}
+	}
+	sidecars := make(map[string][]int)
+	for i, r := range rendered {
+		if r.sidecarOf != "" && filePaths[r.sidecarOf] {
+			sidecars[r.sidecarOf] = append(sidecars[r.sidecarOf], i)
+		}
+	}
+
+	report := &RenderReport{}
+	results := make([]*FileResult, len(rendered))
+	dispatch := func(i int) error {
+		if err := o.ctx.Err(); err != nil {
+			return err
+		}
+		r := rendered[i]
+		if r.sidecarOf != "" && filePaths[r.sidecarOf] {
+			return nil
+		}
+		if r.segment.Type == SegmentStdout {
+			n, err := o.output.Write(r.content)
+			report.StdoutBytes += n
+			if err != nil {
+				return withKind(ErrWrite, fmt.Errorf("failed to write output: %w", err))
+			}
+			return nil
+		}
+		if r.segment.Type == SegmentDir {
+			if err := writeDir(o.writer, r.filename, o.segmentMode(r.segment)); err != nil {
+				return withKind(ErrWrite, fmt.Errorf("failed to create directory %s: %w", r.filename, err))
+			}
+			report.Dirs = append(report.Dirs, r.filename)
+			o.logger.Debug("directory created", "path", r.filename, "line", r.segment.Line)
+			return nil
+		}
+		result, err := o.writeRendered(r)
+		results[i] = result
+		if err != nil {
+			return err
+		}
+		for _, j := range sidecars[r.filename] {
+			if results[j], err = o.writeSidecar(rendered[j], result.Skipped); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if o.parallel > 1 {
+		// Stdout segments and directories are written in template order,
+		// files concurrently
+		var files []int
+		for i, r := range rendered {
+			if r.segment.Type == SegmentFile {
+				files = append(files, i)
+			} else if err = dispatch(i); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = o.forEach(len(files), func(i int) error { return dispatch(files[i]) })
+		}
+	} else {
+		// Dispatch rendered segments in template order
+		err = o.forEach(len(rendered), dispatch)
+	}
+
+	for _, result := range results {
+		if result != nil {
+			report.Files = append(report.Files, *result)
+		}
+	}
+	return report, err
+}
+
+// renderJob is a segment to render with the given data: the input data, or
+// a list element for FILE-EACH segments.
+type renderJob struct {
+	index   int
+	segment Segment
+	data    any
+}
+
+// renderJob renders the filename (FILE and DIR segments) and content (FILE
+// and stdout segments) of a job.
+// The rendered filename is stored in filename, if not nil, before the
+// content is rendered.
+func (o *options) renderJob(job renderJob, filename *atomic.Pointer[string]) (renderedSegment, error) {
+	if err := o.ctx.Err(); err != nil {
+		return renderedSegment{}, err
+	}
+	segment := job.segment
+	if segment.Type == SegmentStdout {
+		var contentBuf bytes.Buffer
+		if err := o.renderSegment(segment.Content, segment.contentPos(), job.data, &contentBuf); err != nil {
+			return renderedSegment{}, fmt.Errorf("failed to render stdout segment %d: %w", job.index, err)
+		}
+		return renderedSegment{segment: segment, content: contentBuf.Bytes()}, nil
+	}
+
+	// Render filename template
+	var filenameBuf bytes.Buffer
+	if err := o.renderTemplate(segment.Filename, segment.filenamePos(), job.data, &filenameBuf, false); err != nil {
+		return renderedSegment{}, fmt.Errorf("failed to render filename template for segment %d: %w", job.index, err)
+	}
+	name := filenameBuf.String()
+	if filename != nil {
+		filename.Store(&name)
+	}
+	if segment.Type == SegmentDir {
+		return renderedSegment{segment: segment, filename: name}, nil
+	}
+
+	// Render file content template
+	var contentBuf bytes.Buffer
+	if err := o.renderSegment(segment.Content, segment.contentPos(), job.data, &contentBuf); err != nil {
+		return renderedSegment{}, fmt.Errorf("failed to render file content for %s: %w", name, err)
+	}
+	r := renderedSegment{segment: segment, filename: name, content: o.cleanWhitespace(segment, contentBuf.Bytes())}
+	if (segment.SkipEmpty || o.skipEmpty) && len(bytes.TrimSpace(r.content)) == 0 {
+		r.skipped = SkippedEmpty
+	}
+	return r, nil
+}
+
+// writeRendered writes a rendered FILE segment unless it is skipped, and
+// returns its result. The result is nil if writing failed.
+func (o *options) writeRendered(r renderedSegment) (*FileResult, error) {
+	result := o.fileResult(r)
+	if result.Skipped == "" && (r.segment.IfMissing || o.noClobber) {
+		exists, err := fileExists(o.writer, r.filename)
+		if err != nil {
+			return nil, withKind(ErrWrite, fmt.Errorf("failed to check file %s: %w", r.filename, err))
+		}
+		if exists {
+			result.Skipped = SkippedExists
+		}
+	}
+	return o.writeResult(r, result)
+}
+
+// writeSidecar writes the sidecar r of a file, see RenderedOutput.SidecarOf,
+// unless it or its file, skipped for fileSkipped, is skipped.
+func (o *options) writeSidecar(r renderedSegment, fileSkipped SkipReason) (*FileResult, error) {
+	result := o.fileResult(r)
+	if result.Skipped == "" {
+		result.Skipped = fileSkipped
+	}
+	return o.writeResult(r, result)
+}
+
+// fileResult returns the result of writing r, before it is written.
+func (o *options) fileResult(r renderedSegment) *FileResult {
+	return &FileResult{Path: r.filename, Line: r.segment.Line, Size: len(r.content), Mode: o.segmentMode(r.segment), Skipped: r.skipped}
+}
+
+// writeResult writes r unless result is skipped, and returns result
+// completed with the write status.
+func (o *options) writeResult(r renderedSegment, result *FileResult) (*FileResult, error) {
+	if result.Skipped != "" {
+		o.logger.Debug("file skipped", "path", r.filename, "line", r.segment.Line, "reason", string(result.Skipped))
+		return result, nil
+	}
+	status, err := writeSegment(o.writer, r.filename, r.content, o.segmentInfo(r.segment))
+	if err != nil {
+		return nil, withKind(ErrWrite, fmt.Errorf("failed to write file %s: %w", r.filename, err))
+	}
+	result.Status = status
+	if status == WriteUnchanged {
+		o.logger.Debug("file unchanged", "path", r.filename, "line", r.segment.Line, "bytes", len(r.content))
+		return result, nil
+	}
+	o.logger.Debug("file written", "path", r.filename, "line", r.segment.Line, "bytes", len(r.content), "status", string(status))
+	return result, nil
+}
+
+// segmentMode returns the mode requested for the files of segment, see
+// WithFileMode, or for the directory of a DIR segment, see WithDirMode.
+func (o *options) segmentMode(segment Segment) os.FileMode {
+	if segment.Mode == 0 {
+		if segment.Type == SegmentDir {
+			return o.dirMode
+		}
+		return o.fileMode
+	}
+	return segment.Mode
+}
+
+// segmentInfo returns the metadata of segment passed to SegmentWriters.
+func (o *options) segmentInfo(segment Segment) SegmentInfo {
+	return SegmentInfo{
+		Template:  o.templateName,
+		Line:      segment.Line,
+		Mode:      o.segmentMode(segment),
+		DirMode:   o.dirMode,
+		IfMissing: segment.IfMissing,
+		SkipEmpty: segment.SkipEmpty,
+		Each:      string(segment.Each),
+	}
+}
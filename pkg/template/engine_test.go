@@ -0,0 +1,248 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestEngine_Render(t *testing.T) {
+	var stdout bytes.Buffer
+	memWriter := &MemoryFileWriter{}
+	engine := NewEngine(
+		WithOutput(&stdout),
+		WithWriter(memWriter),
+		WithFuncs(template.FuncMap{"shout": strings.ToUpper}),
+	)
+
+	tmpl := []byte("Hello {{ shout .name }}\n#FILE:{{.name}}.txt#\n{{.name}}\n#FILE#")
+	for _, name := range []string{"api", "web"} {
+		if err := engine.Render(AnyProvider(map[string]any{"name": name}), tmpl); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if stdout.String() != "Hello API\nHello WEB\n" {
+		t.Errorf("unexpected stdout %q", stdout.String())
+	}
+	if string(memWriter.Files["api.txt"]) != "\napi\n" || string(memWriter.Files["web.txt"]) != "\nweb\n" {
+		t.Errorf("unexpected files: %v", memWriter.Files)
+	}
+}
+
+func TestEngine_WithValidators(t *testing.T) {
+	failing := func(input any) error { return fmt.Errorf("bad input") }
+	engine := NewEngine(WithOutput(&bytes.Buffer{}), WithWriter(&MemoryFileWriter{}), WithValidators(failing))
+
+	err := engine.Render(AnyProvider(map[string]any{}), []byte("x"))
+	if err == nil || !strings.Contains(err.Error(), "bad input") {
+		t.Errorf("expected validation error, got %v", err)
+	}
+}
+
+func TestEngine_WithStrictMode(t *testing.T) {
+	tmpl := []byte("#FILE:out.txt#\n{{ .missing }}\n#FILE#")
+	data := AnyProvider(map[string]any{"present": true})
+
+	memWriter := &MemoryFileWriter{}
+	if err := NewEngine(WithWriter(memWriter)).Render(data, tmpl); err != nil {
+		t.Fatalf("unexpected error without strict mode: %v", err)
+	}
+	if string(memWriter.Files["out.txt"]) != "\n<no value>\n" {
+		t.Errorf("unexpected content %q", memWriter.Files["out.txt"])
+	}
+
+	memWriter = &MemoryFileWriter{}
+	err := NewEngine(WithWriter(memWriter), WithStrictMode()).Render(data, tmpl)
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected missing key error in strict mode, got %v", err)
+	}
+	if len(memWriter.Files) != 0 {
+		t.Errorf("expected no files in strict mode, got %d", len(memWriter.Files))
+	}
+}
+
+func TestRenderSegments_Report(t *testing.T) {
+	segments, err := ParseSegments([]byte(`Header
+#FILE:{{.name}}.yml:0600#
+name: {{.name}}
+#FILE#
+#FILE:existing.yml if-missing#
+x
+#FILE#
+#FILE:empty.yml skip-empty#
+{{ if false }}x{{ end }}
+#FILE#`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	memWriter := &MemoryFileWriter{Files: map[string][]byte{"existing.yml": []byte("keep")}}
+	report, err := RenderSegments(segments, map[string]any{"name": "api"}, memWriter, &stdout)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []FileResult{
+		{Path: "api.yml", Line: 2, Size: 11, Mode: 0600},
+		{Path: "existing.yml", Line: 5, Size: 3, Skipped: SkippedExists},
+		{Path: "empty.yml", Line: 8, Size: 2, Skipped: SkippedEmpty},
+	}
+	if !reflect.DeepEqual(report.Files, expected) {
+		t.Errorf("unexpected report files:\n got %+v\nwant %+v", report.Files, expected)
+	}
+	if report.StdoutBytes != stdout.Len() || stdout.String() != "Header\n\n\n" {
+		t.Errorf("unexpected stdout %q (%d bytes reported)", stdout.String(), report.StdoutBytes)
+	}
+	if written := report.Written(); len(written) != 1 || written[0].Path != "api.yml" {
+		t.Errorf("unexpected written files: %+v", written)
+	}
+	if string(memWriter.Files["existing.yml"]) != "keep" {
+		t.Errorf("expected existing.yml to be left untouched")
+	}
+}
+
+func TestRenderSegments_Dir(t *testing.T) {
+	segments, err := ParseSegments([]byte(`#DIR:logs#
+#DIR:{{.name}}/plugins:0750#
+#FILE:{{.name}}/app.conf#
+x
+#FILE#`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	memWriter := &MemoryFileWriter{}
+	report, err := RenderSegments(segments, map[string]any{"name": "api"}, memWriter, io.Discard, WithDirMode(0700))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := map[string]os.FileMode{"logs": 0700, "api/plugins": 0750}; !reflect.DeepEqual(memWriter.Dirs, expected) {
+		t.Errorf("expected directories %v, got %v", expected, memWriter.Dirs)
+	}
+	if expected := []string{"logs", "api/plugins"}; !reflect.DeepEqual(report.Dirs, expected) {
+		t.Errorf("expected reported directories %v, got %v", expected, report.Dirs)
+	}
+	if len(report.Files) != 1 {
+		t.Errorf("expected 1 file result, got %+v", report.Files)
+	}
+
+	// The writer creates the directories, refusing to replace files
+	fsys := &MemFS{}
+	writer := &DefaultFileWriter{FS: fsys}
+	if err := writer.SetBaseDir("/out"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RenderSegments(segments, map[string]any{"name": "api"}, writer, io.Discard); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for path, mode := range map[string]os.FileMode{"/out/logs": 0755, "/out/api/plugins": 0750} {
+		info, err := fsys.Stat(path)
+		if err != nil || !info.IsDir() || info.Mode().Perm() != mode {
+			t.Errorf("expected directory %s with mode %04o, got %v, %v", path, mode, info, err)
+		}
+	}
+	if err := writer.WriteFile("data", []byte("x"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteDir("data", 0); err == nil || !strings.Contains(err.Error(), "a file with that name exists") {
+		t.Errorf("expected an error creating a directory over a file, got %v", err)
+	}
+}
+
+func TestRenderSegments_DirErrors(t *testing.T) {
+	cases := []struct {
+		template string
+		writer   FileWriter
+		msg      string
+	}{
+		{"#DIR:conf#\n#FILE:conf#\nx\n#FILE#", &MemoryFileWriter{}, "conf is a file of the FILE directive at line 2 and a directory of the DIR directive at line 1"},
+		{"#DIR:logs#", struct{ FileWriter }{&MemoryFileWriter{}}, "does not support DIR directives"},
+	}
+	for _, tc := range cases {
+		segments, err := ParseSegments([]byte(tc.template))
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.template, err)
+		}
+		_, err = RenderSegments(segments, nil, tc.writer, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), tc.msg) {
+			t.Errorf("%q: expected error containing %q, got %v", tc.template, tc.msg, err)
+		}
+	}
+}
+
+func TestEngine_RenderContext_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	memWriter := &MemoryFileWriter{}
+	err := NewEngine(WithWriter(memWriter)).RenderContext(ctx, ContextProvider(AnyProvider(map[string]any{})), []byte("#FILE:a.txt#\nx\n#FILE#"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(memWriter.Files) != 0 {
+		t.Errorf("expected no files to be written, got %d", len(memWriter.Files))
+	}
+}
+
+func TestEngine_RenderContext_ProviderContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	provider := func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	err := NewEngine(WithWriter(&MemoryFileWriter{})).RenderContext(ctx, provider, []byte("x"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestEngine_Logger(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	tmpl := []byte("hi\n#FILE:a.txt#abc#FILE#\n#FILE:b.txt skip-empty# #FILE#")
+
+	engine := NewEngine(WithWriter(&MemoryFileWriter{}), WithOutput(io.Discard), WithLogger(logger))
+	if err := engine.Render(AnyProvider(map[string]any{}), tmpl); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`msg="template parsed" template=template segments=4`,
+		`msg="file written" path=a.txt line=2 bytes=3`,
+		`msg="file skipped" path=b.txt line=3 reason=empty`,
+		`msg="render complete" files=1 skipped=1`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("expected logs to contain %q, got:\n%s", want, logs.String())
+		}
+	}
+}
+
+func TestWithFuncs_ReplacesBuiltin(t *testing.T) {
+	var out bytes.Buffer
+	funcs := template.FuncMap{"unique": func(any) string { return "custom" }, "domain": func() string { return "example.com" }}
+	if err := Execute(AnyProvider(map[string]any{}), []byte(`{{ unique 1 }} {{ domain }}`), &out, WithFuncs(funcs)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "custom example.com" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	builtins := BuiltinFuncs()
+	delete(builtins, "toYaml")
+	if _, ok := BuiltinFuncs()["toYaml"]; !ok {
+		t.Error("BuiltinFuncs must return a copy")
+	}
+}
@@ -0,0 +1,61 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithEnvAllowlist returns an Option that restricts the env and envOrDefault
+// template functions to the given variable names, so that templates cannot
+// read arbitrary secrets from the environment of the renderer. A name ending
+// in "*" allows every variable with that prefix, e.g. "APP_*". Reading any
+// other variable fails the render. Multiple allowlists are combined, and the
+// restriction applies regardless of the order in which the options are
+// passed, including to the functions installed by WithEnviron.
+func WithEnvAllowlist(names ...string) Option {
+	return optionFunc(func(o *options) {
+		if o.envAllow == nil {
+			o.envAllow = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.envAllow[name] = true
+		}
+	})
+}
+
+// envAllowed reports whether the allowlist permits reading key.
+func (o *options) envAllowed(key string) bool {
+	if o.envAllow[key] {
+		return true
+	}
+	for name := range o.envAllow {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok && strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEnvAllowlist wraps the env and envOrDefault functions so that they
+// fail for variables missing from the allowlist, if one is configured.
+func (o *options) applyEnvAllowlist() {
+	if o.envAllow == nil {
+		return
+	}
+	if env, ok := o.funcs["env"].(func(string) string); ok {
+		o.funcs["env"] = func(key string) (string, error) {
+			if !o.envAllowed(key) {
+				return "", fmt.Errorf("env: variable %q is not allowed", key)
+			}
+			return env(key), nil
+		}
+	}
+	if envOrDefault, ok := o.funcs["envOrDefault"].(func(string, string) string); ok {
+		o.funcs["envOrDefault"] = func(key, defaultValue string) (string, error) {
+			if !o.envAllowed(key) {
+				return "", fmt.Errorf("envOrDefault: variable %q is not allowed", key)
+			}
+			return envOrDefault(key, defaultValue), nil
+		}
+	}
+}
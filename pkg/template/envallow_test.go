@@ -0,0 +1,61 @@
+package template
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWithEnvAllowlist(t *testing.T) {
+	t.Setenv("SIMPLATE_TEST_STAGE", "prod")
+	t.Setenv("SIMPLATE_TEST_SECRET", "s3cr3t")
+	t.Setenv("APP_REGION", "eu")
+
+	tests := []struct {
+		name     string
+		template string
+		opts     []Option
+		want     string
+		wantErr  string
+	}{
+		{name: "allowed", template: `{{ env "SIMPLATE_TEST_STAGE" }}`, want: "prod"},
+		{name: "prefix", template: `{{ env "APP_REGION" }}`, want: "eu"},
+		{name: "default", template: `{{ envOrDefault "APP_ZONE" "a" }}`, want: "a"},
+		{name: "denied", template: `{{ env "SIMPLATE_TEST_SECRET" }}`, wantErr: `env: variable "SIMPLATE_TEST_SECRET" is not allowed`},
+		{name: "denied with default", template: `{{ envOrDefault "SIMPLATE_TEST_SECRET" "x" }}`, wantErr: `envOrDefault: variable "SIMPLATE_TEST_SECRET" is not allowed`},
+		{
+			name:     "environ",
+			template: `{{ env "SIMPLATE_TEST_STAGE" }}{{ env "SIMPLATE_TEST_SECRET" }}`,
+			opts:     []Option{WithEnviron(map[string]string{"SIMPLATE_TEST_STAGE": "dev", "SIMPLATE_TEST_SECRET": "x"})},
+			wantErr:  `env: variable "SIMPLATE_TEST_SECRET" is not allowed`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			opts := append([]Option{WithEnvAllowlist("SIMPLATE_TEST_STAGE"), WithEnvAllowlist("APP_*")}, tt.opts...)
+			err := Execute(AnyProvider(map[string]any{}), []byte(tt.template), &out, opts...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestWithEnvAllowlist_Empty(t *testing.T) {
+	t.Setenv("SIMPLATE_TEST_STAGE", "prod")
+	var out bytes.Buffer
+	err := Execute(AnyProvider(map[string]any{}), []byte(`{{ env "SIMPLATE_TEST_STAGE" }}`), &out, WithEnvAllowlist())
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Errorf("expected every variable to be denied, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Error kinds. Errors returned by Execute, ExecuteWithFiles and the Engine
+// match one of them with errors.Is, so callers can tell failures apart
+// without parsing messages. The error text itself is not changed.
+var (
+	// ErrInput means the input data could not be read or parsed.
+	ErrInput = errors.New("input error")
+	// ErrValidation means a validation function rejected the input data.
+	ErrValidation = errors.New("validation error")
+	// ErrTemplate means the template could not be parsed or executed, or
+	// its FILE directives are invalid or render to conflicting paths.
+	ErrTemplate = errors.New("template error")
+	// ErrWrite means rendered output could not be written.
+	ErrWrite = errors.New("write error")
+)
+
+// kindError tags err with one of the error kinds above.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.err, e.kind}
+}
+
+// withKind tags err with kind. It returns nil if err is nil and leaves
+// context cancellation and already classified errors unchanged.
+func withKind(kind, err error) error {
+	if err == nil || isKind(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// isKind reports whether err already carries an error kind.
+func isKind(err error) bool {
+	for _, kind := range []error{ErrInput, ErrValidation, ErrTemplate, ErrWrite} {
+		if errors.Is(err, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithKeepGoing returns an Option that renders every segment even after one
+// has failed, and reports all failures together as RenderErrors. Nothing is
+// written when any segment fails, as without the option.
+func WithKeepGoing() Option {
+	return optionFunc(func(o *options) {
+		o.keepGoing = true
+	})
+}
+
+// RenderErrors lists the failures of every segment that could not be
+// rendered with WithKeepGoing, in template order. errors.Is and errors.As
+// match any of them.
+type RenderErrors []error
+
+func (e RenderErrors) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d segments failed to render:", len(e))
+	for _, err := range e {
+		sb.WriteString("\n  - ")
+		sb.WriteString(strings.ReplaceAll(err.Error(), "\n", "\n    "))
+	}
+	return sb.String()
+}
+
+func (e RenderErrors) Unwrap() []error {
+	return e
+}
+
+// err returns nil for no failures, the failure itself when there is one,
+// and e otherwise.
+func (e RenderErrors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	default:
+		return e
+	}
+}
@@ -0,0 +1,88 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestErrorKinds(t *testing.T) {
+	cases := []struct {
+		name  string
+		input InputProvider
+		tmpl  string
+		opts  []Option
+		want  error
+	}{
+		{name: "input", input: YamlProvider([]byte("a: [")), tmpl: "x", want: ErrInput},
+		{name: "validation", input: AnyProvider(map[string]any{"a": "x"}), tmpl: "x", opts: []Option{WithJsonSchemaValidation([]byte(`{"properties":{"a":{"type":"integer"}}}`))}, want: ErrValidation},
+		{name: "template parse", input: AnyProvider(map[string]any{}), tmpl: "{{.a", want: ErrTemplate},
+		{name: "directive", input: AnyProvider(map[string]any{}), tmpl: "#FILE:a.txt#x", want: ErrTemplate},
+		{name: "collision", input: AnyProvider(map[string]any{}), tmpl: "#FILE:a#x#FILE##FILE:a#y#FILE#", want: ErrTemplate},
+		{name: "write", input: AnyProvider(map[string]any{}), tmpl: "#FILE:../a.txt#x#FILE#", want: ErrWrite},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ExecuteWithFiles(tc.input, []byte(tc.tmpl), io.Discard, &DefaultFileWriter{baseDir: t.TempDir()}, tc.opts...)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+
+	// Execute without FILE directives
+	if err := Execute(AnyProvider(map[string]any{}), []byte("{{.a.b}}"), io.Discard, WithStrictMode()); !errors.Is(err, ErrTemplate) {
+		t.Errorf("expected ErrTemplate from Execute, got %v", err)
+	}
+}
+
+func TestWithKind(t *testing.T) {
+	if withKind(ErrWrite, nil) != nil {
+		t.Error("withKind(nil) must be nil")
+	}
+	if err := withKind(ErrWrite, context.Canceled); err != context.Canceled {
+		t.Errorf("cancellation must not be classified, got %v", err)
+	}
+	err := withKind(ErrWrite, withKind(ErrTemplate, errors.New("boom")))
+	if errors.Is(err, ErrWrite) || !errors.Is(err, ErrTemplate) || err.Error() != "boom" {
+		t.Errorf("expected the innermost kind to win and the message to be unchanged, got %v", err)
+	}
+}
+
+func TestWithKeepGoing(t *testing.T) {
+	tmpl := []byte("{{.a.b}}\n#FILE:ok.txt#fine#FILE#\n#FILE-EACH:.items:{{.}}.txt#{{.x.y}}#FILE#\n#FILE-EACH:.name:n.txt#x#FILE#")
+	data := AnyProvider(map[string]any{"items": []any{"p", "q"}, "name": "api"})
+
+	for _, parallel := range []int{1, 4} {
+		memWriter := &MemoryFileWriter{}
+		err := ExecuteWithFiles(data, tmpl, io.Discard, memWriter, WithKeepGoing(), WithStrictMode(), WithParallelism(parallel))
+		var renderErrs RenderErrors
+		if !errors.As(err, &renderErrs) {
+			t.Fatalf("parallel %d: expected RenderErrors, got %v", parallel, err)
+		}
+		if len(renderErrs) != 4 {
+			t.Fatalf("parallel %d: expected 4 failures, got %d: %v", parallel, len(renderErrs), err)
+		}
+		// FILE-EACH list errors come first, then render errors in template order
+		for i, want := range []string{"FILE-EACH list for segment 5", "stdout segment 0", "p.txt", "q.txt"} {
+			if !strings.Contains(renderErrs[i].Error(), want) {
+				t.Errorf("parallel %d: failure %d should mention %q, got %v", parallel, i, want, renderErrs[i])
+			}
+		}
+		if !errors.Is(err, ErrTemplate) {
+			t.Errorf("expected RenderErrors to match ErrTemplate")
+		}
+		if len(memWriter.Files) != 0 {
+			t.Errorf("expected no files to be written, got %d", len(memWriter.Files))
+		}
+	}
+
+	// Without the option the first failure stops the render
+	err := ExecuteWithFiles(data, tmpl, io.Discard, &MemoryFileWriter{}, WithStrictMode())
+	var renderErrs RenderErrors
+	if err == nil || errors.As(err, &renderErrs) {
+		t.Errorf("expected a single error, got %v", err)
+	}
+}
@@ -1,19 +1,117 @@
 package template
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"text/template"
+	"text/template/parse"
+	"time"
 
 	"github.com/santhosh-tekuri/jsonschema/v5"
 	"gopkg.in/yaml.v3"
 )
 
 type InputProvider func() (any, error)
+
+// InputProviderContext is an InputProvider that receives the context of the
+// render, so that providers doing blocking work (e.g. fetching the input
+// over the network) stop when it is done. See ExecuteContext and
+// Engine.RenderContext.
+type InputProviderContext func(ctx context.Context) (any, error)
 type ValidateInputFunc func(input any) error
 
+// Option configures how a template is executed. ValidateInputFunc values are
+// options as well, so validators and other options can be passed together to
+// Execute and ExecuteWithFiles.
+type Option interface {
+	apply(*options)
+}
+
+// options holds the resolved configuration for a single execution.
+type options struct {
+	ctx         context.Context
+	validators  []ValidateInputFunc
+	lintSchemas [][]byte
+	funcs       template.FuncMap
+	blocking    []string
+	unbound     map[string]any // Blocking functions before bindBlocking binds them to ctx
+	policy      *FunctionPolicy
+	noClobber   bool
+	skipEmpty   bool
+	fileMode    os.FileMode // Mode of FILE segments without one; 0 = writer default
+	dirMode     os.FileMode // Mode of created directories; 0 = writer default
+	strictCase  bool
+	portability bool
+	strict      bool
+	html        bool // Render content with html/template, see WithHTMLEscaping
+	parallel    int
+	keepGoing   bool
+	sandbox     bool
+	envAllow    map[string]bool        // Allowed environment variables; nil = all
+	defines     map[string]*parse.Tree // Named templates shared by all segments
+	hooks       []Hooks
+	warnings    io.Writer
+	output      io.Writer
+	writer      FileWriter
+
+	templateName   string
+	logger         *slog.Logger
+	segmentTimeout time.Duration // Per-segment render deadline; 0 = none
+
+	// Whitespace clean-up of generated files, see cleanWhitespace
+	ensureTrailingNewline   bool
+	stripTrailingWhitespace bool
+	stripBOM                bool
+}
+
+// optionFunc adapts a plain function to the Option interface.
+type optionFunc func(*options)
+
+func (f optionFunc) apply(o *options) { f(o) }
+
+// apply registers the validation function with the execution options.
+func (f ValidateInputFunc) apply(o *options) {
+	o.validators = append(o.validators, f)
+}
+
+// newOptions returns the execution options for a run bound to ctx, resulting
+// from applying opts on top of the defaults (built-in template functions, no
+// validation, output to os.Stdout and files relative to the current
+// directory).
+func newOptions(ctx context.Context, opts []Option) *options {
+	o := &options{
+		ctx:      ctx,
+		funcs:    builtinFuncs(),
+		warnings: io.Discard,
+		output:   os.Stdout,
+		writer:   &DefaultFileWriter{},
+
+		templateName: defaultTemplateName,
+		logger:       slog.New(slog.DiscardHandler),
+	}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	o.applySandbox()
+	o.applyEnvAllowlist()
+	o.applyFunctionPolicy()
+	return o
+}
+
+// ContextProvider returns an InputProviderContext that calls p and ignores
+// the context, for providers that do not block.
+func ContextProvider(p InputProvider) InputProviderContext {
+	return func(context.Context) (any, error) {
+		return p()
+	}
+}
+
 // AnyProvider returns an InputProvider that simply wraps the given Go value.
 // When the returned provider is invoked, it returns the original input value.
 // If the input is nil, the provider returns an error instead.
@@ -54,12 +152,109 @@ func YamlProvider(input []byte) InputProvider {
 	}
 }
 
+// EnvProvider returns an InputProvider that builds the input data from the
+// process environment. Only variables named PREFIX<separator>KEY are used;
+// the remaining name is split on separator and lowercased to form a nested
+// map, so with prefix "APP" and separator "_" the variable APP_DB_HOST becomes
+// available as .db.host. If prefix already ends with separator it is not
+// repeated. An empty separator disables nesting.
+//
+// Example:
+//
+//	// APP_DB_HOST=localhost APP_DB_PORT=5432
+//	provider := EnvProvider("APP", "_")
+//	data, err := provider()
+//	// data == map[string]any{"db": map[string]any{"host":"localhost","port":"5432"}}, err == nil
+func EnvProvider(prefix, separator string) InputProvider {
+	return func() (any, error) {
+		match := prefix
+		if match != "" && separator != "" && !strings.HasSuffix(match, separator) {
+			match += separator
+		}
+
+		data := make(map[string]any)
+		for _, kv := range os.Environ() {
+			name, value, ok := strings.Cut(kv, "=")
+			if !ok || !strings.HasPrefix(name, match) {
+				continue
+			}
+			key := strings.ToLower(strings.TrimPrefix(name, match))
+			if key == "" {
+				continue
+			}
+			path := []string{key}
+			if separator != "" {
+				path = strings.Split(key, separator)
+			}
+			if err := setNested(data, path, value); err != nil {
+				return nil, fmt.Errorf("environment variable %s: %w", name, err)
+			}
+		}
+		return data, nil
+	}
+}
+
+// DotenvProvider returns an InputProvider that parses the provided dotenv
+// bytes (see ParseDotenv) into a flat map[string]any of variable names to
+// string values.
+//
+// Example:
+//
+//	provider := DotenvProvider([]byte("DB_HOST=localhost\nDB_PORT=5432\n"))
+//	data, err := provider()
+//	// data == map[string]any{"DB_HOST":"localhost","DB_PORT":"5432"}, err == nil
+func DotenvProvider(input []byte) InputProvider {
+	return func() (any, error) {
+		vars, err := ParseDotenv(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse dotenv input: %w", err)
+		}
+		data := make(map[string]any, len(vars))
+		for k, v := range vars {
+			data[k] = v
+		}
+		return data, nil
+	}
+}
+
+// setNested stores value in data under the given key path, creating
+// intermediate maps as needed. It fails if a path element is empty or if
+// a key is used both as a value and as a parent of other keys.
+func setNested(data map[string]any, path []string, value any) error {
+	for i, key := range path {
+		if key == "" {
+			return fmt.Errorf("empty key segment in %q", strings.Join(path, "."))
+		}
+		if i == len(path)-1 {
+			if _, exists := data[key]; exists {
+				return fmt.Errorf("key %q conflicts with a nested key", strings.Join(path, "."))
+			}
+			data[key] = value
+			return nil
+		}
+		next, exists := data[key]
+		if !exists {
+			child := make(map[string]any)
+			data[key] = child
+			data = child
+			continue
+		}
+		child, ok := next.(map[string]any)
+		if !ok {
+			return fmt.Errorf("key %q conflicts with an existing value", strings.Join(path[:i+1], "."))
+		}
+		data = child
+	}
+	return nil
+}
+
 // WithJsonSchemaValidation returns a ValidateInputFunc that validates
 // a parsed YAML input (the result of yaml.Unmarshal) against the
 // provided JSON Schema.
 // The schema parameter must be the JSON Schema definition as raw bytes.
 // The returned function compiles this schema and applies it to the input,
-// returning an error if schema compilation or validation fails.
+// returning an error if schema compilation or validation fails. Validation
+// failures are reported as a *SchemaError listing every violation.
 func WithJsonSchemaValidation(schema []byte) ValidateInputFunc {
 	return func(input any) error {
 		schema, err := jsonschema.CompileString("schema.json", string(schema))
@@ -67,10 +262,108 @@ func WithJsonSchemaValidation(schema []byte) ValidateInputFunc {
 			return fmt.Errorf("failed to compile JSONSchema: %w", err)
 		}
 
-		return schema.Validate(input)
+		return newSchemaError(schema.Validate(input))
 	}
 }
 
+// WithNoClobber returns an Option that makes ExecuteWithFiles leave existing
+// files untouched, as if every FILE directive had the if-missing attribute.
+func WithNoClobber() Option {
+	return optionFunc(func(o *options) {
+		o.noClobber = true
+	})
+}
+
+// WithSkipEmpty returns an Option that makes ExecuteWithFiles skip FILE
+// segments rendering to whitespace only, as if every FILE directive had the
+// skip-empty attribute.
+func WithSkipEmpty() Option {
+	return optionFunc(func(o *options) {
+		o.skipEmpty = true
+	})
+}
+
+// WithFileMode returns an Option that writes the files of FILE directives
+// without an explicit mode (such as #FILE:run.sh:0755#) with mode, e.g. 0600
+// for secrets, instead of the writer's default. The mode is passed to the
+// FileWriter like a mode requested by the directive.
+func WithFileMode(mode os.FileMode) Option {
+	return optionFunc(func(o *options) {
+		o.fileMode = mode.Perm()
+	})
+}
+
+// WithDirMode returns an Option that asks the FileWriter to create the
+// parent directories of generated files with mode instead of its default.
+// It is passed in SegmentInfo.DirMode, so it only applies to SegmentWriters
+// such as DefaultFileWriter; directories that already exist, including a
+// base directory created by SetBaseDir, keep their permissions.
+func WithDirMode(mode os.FileMode) Option {
+	return optionFunc(func(o *options) {
+		o.dirMode = mode.Perm()
+	})
+}
+
+// WithStrictPathsCase returns an Option that turns output paths differing
+// only in letter case (which collide on case-insensitive filesystems such as
+// the macOS and Windows defaults) from a warning into an error.
+func WithStrictPathsCase() Option {
+	return optionFunc(func(o *options) {
+		o.strictCase = true
+	})
+}
+
+// WithWarnings returns an Option that writes non-fatal warnings, one per
+// line, to w. Warnings are discarded by default.
+func WithWarnings(w io.Writer) Option {
+	return optionFunc(func(o *options) {
+		o.warnings = w
+	})
+}
+
+// WithLogger returns an Option that logs the steps of a render (validation,
+// segments found, files written or skipped with their sizes) to logger at
+// debug level. Nothing is logged by default.
+func WithLogger(logger *slog.Logger) Option {
+	return optionFunc(func(o *options) {
+		o.logger = logger
+	})
+}
+
+// warnf writes a formatted warning line to the configured warnings writer.
+func (o *options) warnf(format string, args ...any) {
+	fmt.Fprintf(o.warnings, "warning: "+format+"\n", args...)
+}
+
+// loadData returns the input data from inputProvider after running the
+// validation functions, lint schemas and AfterLoad hooks on it. It stops early
+// if the context is done.
+func (o *options) loadData(inputProvider InputProviderContext) (any, error) {
+	if err := o.ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, err := inputProvider(o.ctx)
+	if err != nil {
+		return nil, withKind(ErrInput, fmt.Errorf("failed to get input data: %w", err))
+	}
+
+	for _, validateFunc := range o.validators {
+		if err := o.ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := validateFunc(data); err != nil {
+			return nil, withKind(ErrValidation, fmt.Errorf("input validation failed: %w", err))
+		}
+	}
+	if len(o.validators) > 0 {
+		o.logger.Debug("input validated", "validators", len(o.validators))
+	}
+	if data, err = o.lint(data); err != nil {
+		return nil, err
+	}
+	return o.afterLoad(data)
+}
+
 // Execute parses the given YAML input, optionally validates it,
 // then applies a Go html/template and writes the result to output.
 //
@@ -79,37 +372,61 @@ func WithJsonSchemaValidation(schema []byte) ValidateInputFunc {
 //     or []interface{}).
 //   - template: Go text/template source as bytes.
 //   - output: destination io.Writer for the rendered template.
-//   - validateInputFuncs: zero or more validation functions (ValidateInputFunc)
-//     which are invoked on the unmarshaled data before rendering.
+//   - opts: zero or more options, including validation functions
+//     (ValidateInputFunc) which are invoked on the unmarshaled data before
+//     rendering.
 //
 // It returns an error if any of the following steps fail:
 //  1. YAML unmarshalling of input
 //  2. any validation function
 //  3. parsing the template
 //  4. executing the template
-func Execute(inputProvider InputProvider, templ []byte, output io.Writer, validateInputFuncs ...ValidateInputFunc) error {
+func Execute(inputProvider InputProvider, templ []byte, output io.Writer, opts ...Option) error {
+	return ExecuteContext(context.Background(), ContextProvider(inputProvider), templ, output, opts...)
+}
 
-	data, err := inputProvider()
+// ExecuteContext is like Execute but stops when ctx is done: before reading
+// or validating the input, while the template writes output, and inside
+// network-backed template functions such as httpGet. The returned error then
+// wraps ctx.Err(). inputProvider is called with ctx; wrap providers that do
+// not block with ContextProvider.
+func ExecuteContext(ctx context.Context, inputProvider InputProviderContext, templ []byte, output io.Writer, opts ...Option) error {
+	o := newOptions(ctx, opts)
+
+	data, err := o.loadData(inputProvider)
 	if err != nil {
-		return fmt.Errorf("failed to get input data: %w", err)
+		return err
 	}
 
-	for _, validateFunc := range validateInputFuncs {
-		if err := validateFunc(data); err != nil {
-			return fmt.Errorf("input validation failed: %w", err)
-		}
+	start := position{line: 1, column: 1}
+	var tmpl templateExecutor
+	if o.html {
+		tmpl, err = o.parseHTML(o.templateName, string(templ))
+	} else {
+		tmpl, err = o.newTemplate(o.templateName).Parse(string(templ))
 	}
-
-	tmpl, err := template.New("generator").Funcs(template.FuncMap{
-		"env":          os.Getenv,
-		"envOrDefault": envOrDefault,
-		"unique":       unique,
-	}).Parse(string(templ))
 	if err != nil {
-		return fmt.Errorf("failed to parse template: %w", err)
+		return withKind(ErrTemplate, fmt.Errorf("failed to parse template: %w", locateError(err, o.templateName, start)))
+	}
+
+	if err := tmpl.Execute(contextWriter{ctx: ctx, w: output}, data); err != nil {
+		return withKind(ErrTemplate, locateError(err, o.templateName, start))
 	}
+	return nil
+}
+
+// contextWriter fails writes once its context is done, which aborts a
+// running template execution.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
 
-	return tmpl.Execute(output, data)
+func (c contextWriter) Write(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.w.Write(p)
 }
 
 // ExecuteWithFiles parses the given template for FILE directives, validates input,
@@ -122,13 +439,17 @@ func Execute(inputProvider InputProvider, templ []byte, output io.Writer, valida
 //	content for this file
 //	#FILE#
 //
+// A #FILE-EACH:.list:filename# directive renders its block once per element
+// of the list at the given data path, with the element as dot.
+//
 // Parameters:
 //   - inputProvider: provider function that returns the input data
 //   - templ: Go text/template source as bytes, may contain FILE directives
 //   - output: destination io.Writer for stdout segments (content outside FILE blocks)
 //   - fileWriter: FileWriter implementation for writing file segments
-//   - validateInputFuncs: zero or more validation functions (ValidateInputFunc)
-//     which are invoked on the unmarshaled data before rendering.
+//   - opts: zero or more options, including validation functions
+//     (ValidateInputFunc) which are invoked on the unmarshaled data before
+//     rendering.
 //
 // Features:
 //   - Filenames can contain template expressions (e.g., #FILE:output-{{.id}}.txt#)
@@ -136,88 +457,146 @@ func Execute(inputProvider InputProvider, templ []byte, output io.Writer, valida
 //   - Content outside FILE blocks is rendered to the output writer
 //   - Parent directories are automatically created for file paths
 //   - Templates without FILE directives work identically to Execute()
+//   - All segments are rendered before any output is written
 //
 // It returns an error if any of the following steps fail:
 //  1. Getting input data from the provider
 //  2. Any validation function
 //  3. Parsing FILE directives (malformed syntax, unclosed blocks, etc.)
 //  4. Parsing or executing templates (for filenames or content)
-//  5. Writing files
+//  5. Two FILE segments rendering to the same path
+//  6. Writing files
 func ExecuteWithFiles(
 	inputProvider InputProvider,
 	templ []byte,
 	output io.Writer,
 	fileWriter FileWriter,
-	validateInputFuncs ...ValidateInputFunc,
+	opts ...Option,
 ) error {
-	// Get input data
-	data, err := inputProvider()
-	if err != nil {
-		return fmt.Errorf("failed to get input data: %w", err)
-	}
+	engineOpts := make([]Option, 0, len(opts)+2)
+	engineOpts = append(engineOpts, opts...)
+	engineOpts = append(engineOpts, WithOutput(output), WithWriter(fileWriter))
+	return NewEngine(engineOpts...).Render(inputProvider, templ)
+}
 
-	// Run validation functions
-	for _, validateFunc := range validateInputFuncs {
-		if err := validateFunc(data); err != nil {
-			return fmt.Errorf("input validation failed: %w", err)
-		}
-	}
+// renderedSegment is a segment whose filename (FILE and DIR segments) and
+// content (FILE and stdout segments) have been rendered.
+type renderedSegment struct {
+	segment  Segment
+	filename string
+	content  []byte
+	skipped  SkipReason // Set if the segment is known not to be written
+	// sidecarOf is the path of the file this output accompanies, see
+	// RenderedOutput.SidecarOf
+	sidecarOf string
+}
 
-	// Parse template into segments
-	segments, err := ParseSegments(templ)
-	if err != nil {
-		return fmt.Errorf("failed to parse template segments: %w", err)
+// checkPathCollisions returns an error if two FILE segments rendered to the
+// same output path, or a DIR segment to the path of a file, naming the
+// template lines of both directives. Paths that
+// differ only in letter case produce a warning, or an error in strict mode.
+func (o *options) checkPathCollisions(rendered []renderedSegment) error {
+	seen := make(map[string]Segment)
+	seenFold := make(map[string]string)
+	dirs := make(map[string]Segment)
+	for _, r := range rendered {
+		if r.segment.Type == SegmentDir {
+			dirs[filepath.Clean(r.filename)] = r.segment
+		}
 	}
-
-	// Process each segment
-	for i, segment := range segments {
-		switch segment.Type {
-		case SegmentStdout:
-			// Render stdout segment
-			if err := renderSegment(segment.Content, data, output); err != nil {
-				return fmt.Errorf("failed to render stdout segment %d: %w", i, err)
-			}
-
-		case SegmentFile:
-			// Render filename template
-			var filenameBuf bytes.Buffer
-			if err := renderSegment(segment.Filename, data, &filenameBuf); err != nil {
-				return fmt.Errorf("failed to render filename template for segment %d: %w", i, err)
-			}
-			filename := filenameBuf.String()
-
-			// Render file content template
-			var contentBuf bytes.Buffer
-			if err := renderSegment(segment.Content, data, &contentBuf); err != nil {
-				return fmt.Errorf("failed to render file content for %s: %w", filename, err)
+	for _, r := range rendered {
+		if r.segment.Type != SegmentFile || r.skipped != "" {
+			continue
+		}
+		path := filepath.Clean(r.filename)
+		if dir, exists := dirs[path]; exists {
+			return fmt.Errorf("output path collision: %s is a file of the FILE directive at line %d and a directory of the DIR directive at line %d", path, r.segment.Line, dir.Line)
+		}
+		if first, exists := seen[path]; exists {
+			if first.Line == r.segment.Line {
+				return fmt.Errorf("output path collision: %s is written more than once by the FILE-EACH directive at line %d", path, first.Line)
 			}
-
-			// Write file
-			if err := fileWriter.WriteFile(filename, contentBuf.Bytes()); err != nil {
-				return fmt.Errorf("failed to write file %s: %w", filename, err)
+			return fmt.Errorf("output path collision: %s is written by the FILE directives at line %d and line %d", path, first.Line, r.segment.Line)
+		}
+		folded := strings.ToLower(path)
+		if other, exists := seenFold[folded]; exists {
+			msg := fmt.Sprintf("output paths %s (line %d) and %s (line %d) differ only in case and collide on case-insensitive filesystems",
+				other, seen[other].Line, path, r.segment.Line)
+			if o.strictCase {
+				return fmt.Errorf("%s", msg)
 			}
+			o.warnf("%s", msg)
 		}
+		seen[path] = r.segment
+		seenFold[folded] = path
 	}
-
 	return nil
 }
 
-// renderSegment parses and executes a template segment with the given data,
-// writing the result to the provided writer.
-func renderSegment(templateContent []byte, data any, output io.Writer) error {
-	tmpl, err := template.New("segment").Funcs(template.FuncMap{
-		"env":          os.Getenv,
-		"envOrDefault": envOrDefault,
-		"unique":       unique,
-	}).Parse(string(templateContent))
+// eachItems evaluates the data path of a FILE-EACH segment (any template
+// pipeline, usually a field chain such as .services) against data and
+// returns the elements of the resulting slice or array. A missing or nil
+// value yields no elements.
+func (o *options) eachItems(path []byte, data any) ([]any, error) {
+	var value any
+	capture := template.FuncMap{"simplateEach": func(v any) string {
+		value = v
+		return ""
+	}}
+	tmpl, err := o.newTemplate("each").Funcs(capture).Parse("{{ simplateEach (" + string(path) + ") }}")
 	if err != nil {
-		return fmt.Errorf("failed to parse template: %w", err)
+		return nil, fmt.Errorf("failed to parse list path %s: %w", path, err)
+	}
+	if err := tmpl.Execute(io.Discard, data); err != nil {
+		return nil, fmt.Errorf("failed to evaluate list path %s: %w", path, err)
 	}
 
-	if err := tmpl.Execute(output, data); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+	if value == nil {
+		return nil, nil
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%s is a %T, not a list", path, value)
+	}
+	items := make([]any, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
 	}
+	return items, nil
+}
 
-	return nil
+// renderSegment renders templateContent, the content of a segment starting
+// at start in the template file, with html/template if WithHTMLEscaping is
+// set.
+func (o *options) renderSegment(templateContent []byte, start position, data any, output io.Writer) error {
+	return o.renderTemplate(templateContent, start, data, output, o.html)
 }
 
+// renderTemplate parses templateContent and executes it with data, writing
+// the result to output. Positions in errors are relative to start, the
+// position of the template text in the template file. With html, the
+// template is an html/template.
+func (o *options) renderTemplate(templateContent []byte, start position, data any, output io.Writer, html bool) error {
+	var tmpl templateExecutor
+	if html {
+		var err error
+		if tmpl, err = o.parseHTML(o.templateName, string(templateContent)); err != nil {
+			return fmt.Errorf("failed to parse template: %w", o.locateError(err, start))
+		}
+	} else {
+		text, err := o.newTemplate(o.templateName).Parse(string(templateContent))
+		if err != nil {
+			return fmt.Errorf("failed to parse template: %w", o.locateError(err, start))
+		}
+		if err := o.addDefines(text); err != nil {
+			return fmt.Errorf("failed to parse template: %w", err)
+		}
+		tmpl = text
+	}
+
+	if err := tmpl.Execute(contextWriter{ctx: o.ctx, w: output}, data); err != nil {
+		return fmt.Errorf("failed to execute template: %w", o.locateError(err, start))
+	}
+
+	return nil
+}
@@ -2,7 +2,10 @@ package template
 
 import (
 	"bytes"
+	"io"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -367,27 +370,32 @@ func TestExecuteWithFiles_WriteError(t *testing.T) {
 	}
 }
 
-// TestExecuteWithFiles_DuplicateFilenames tests that duplicate filenames overwrite.
+// TestExecuteWithFiles_DuplicateFilenames tests that duplicate filenames are
+// reported as a collision naming both directives, and nothing is written.
 func TestExecuteWithFiles_DuplicateFilenames(t *testing.T) {
-	data := map[string]interface{}{}
-	tmpl := []byte(`#FILE:same.txt#
+	data := map[string]interface{}{"name": "same"}
+	tmpl := []byte(`before
+#FILE:same.txt#
 first
 #FILE#
-#FILE:same.txt#
+#FILE:./{{.name}}.txt#
 second
 #FILE#`)
 	var stdout bytes.Buffer
 	memWriter := &MemoryFileWriter{Files: make(map[string][]byte)}
 
 	err := ExecuteWithFiles(AnyProvider(data), tmpl, &stdout, memWriter)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	if err == nil {
+		t.Fatal("expected collision error, got nil")
+	}
+	for _, want := range []string{"same.txt", "line 2", "line 5"} {
+		if !contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err.Error(), want)
+		}
 	}
 
-	// Last write should win
-	content := string(memWriter.Files["same.txt"])
-	if content != "\nsecond\n" {
-		t.Errorf("expected last write to win with 'second', got %q", content)
+	if stdout.Len() != 0 || len(memWriter.Files) != 0 {
+		t.Errorf("expected no output on collision, got stdout %q and files %v", stdout.String(), mapKeys(memWriter.Files))
 	}
 }
 
@@ -455,3 +463,271 @@ func TestExecuteWithFiles_CustomFunctions(t *testing.T) {
 		t.Errorf("expected unique items, got %q", content)
 	}
 }
+
+// TestEnvProvider_Nested verifies that prefixed variables are nested on the separator.
+func TestEnvProvider_Nested(t *testing.T) {
+	t.Setenv("SIMPLATETEST_DB_HOST", "localhost")
+	t.Setenv("SIMPLATETEST_DB_PORT", "5432")
+	t.Setenv("SIMPLATETEST_NAME", "app")
+	t.Setenv("OTHER_NAME", "ignored")
+
+	got, err := EnvProvider("SIMPLATETEST", "_")()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]any{
+		"db":   map[string]any{"host": "localhost", "port": "5432"},
+		"name": "app",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// TestEnvProvider_CustomSeparator verifies that a multi-character separator
+// keeps single underscores inside keys.
+func TestEnvProvider_CustomSeparator(t *testing.T) {
+	t.Setenv("SIMPLATETEST__DB__MAX_CONNS", "10")
+
+	got, err := EnvProvider("SIMPLATETEST", "__")()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]any{"db": map[string]any{"max_conns": "10"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// TestEnvProvider_Conflict verifies that a key used as both value and parent is rejected.
+func TestEnvProvider_Conflict(t *testing.T) {
+	t.Setenv("SIMPLATETEST_DB", "value")
+	t.Setenv("SIMPLATETEST_DB_HOST", "localhost")
+
+	if _, err := EnvProvider("SIMPLATETEST", "_")(); err == nil {
+		t.Fatal("expected conflict error, got nil")
+	}
+}
+
+// TestExecuteWithFiles_FileMode verifies that a mode suffix reaches the writer.
+func TestExecuteWithFiles_FileMode(t *testing.T) {
+	data := map[string]interface{}{"name": "deploy"}
+	tmpl := []byte("#FILE:bin/{{.name}}.sh:0755#\n#!/bin/sh\n#FILE#")
+	var stdout bytes.Buffer
+	memWriter := &MemoryFileWriter{Files: make(map[string][]byte)}
+
+	if err := ExecuteWithFiles(AnyProvider(data), tmpl, &stdout, memWriter); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, exists := memWriter.Files["bin/deploy.sh"]; !exists {
+		t.Fatalf("expected file bin/deploy.sh to exist, got files: %v", memWriter.Files)
+	}
+	if memWriter.Modes["bin/deploy.sh"] != 0755 {
+		t.Errorf("expected mode 0755, got %04o", memWriter.Modes["bin/deploy.sh"])
+	}
+}
+
+// TestExecuteWithFiles_IfMissing verifies that if-missing FILE segments and
+// WithNoClobber leave existing files untouched.
+func TestExecuteWithFiles_IfMissing(t *testing.T) {
+	tmpl := []byte("#FILE:custom.yml if-missing#\ngenerated\n#FILE#\n#FILE:managed.yml#\ngenerated\n#FILE#")
+
+	cases := []struct {
+		name        string
+		opts        []Option
+		wantCustom  string
+		wantManaged string
+	}{
+		{name: "if-missing attribute", wantCustom: "customized", wantManaged: "\ngenerated\n"},
+		{name: "no clobber", opts: []Option{WithNoClobber()}, wantCustom: "customized", wantManaged: "customized"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			memWriter := &MemoryFileWriter{Files: map[string][]byte{
+				"custom.yml":  []byte("customized"),
+				"managed.yml": []byte("customized"),
+			}}
+			var stdout bytes.Buffer
+			if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &stdout, memWriter, tc.opts...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := string(memWriter.Files["custom.yml"]); got != tc.wantCustom {
+				t.Errorf("custom.yml: expected %q, got %q", tc.wantCustom, got)
+			}
+			if got := string(memWriter.Files["managed.yml"]); got != tc.wantManaged {
+				t.Errorf("managed.yml: expected %q, got %q", tc.wantManaged, got)
+			}
+		})
+	}
+
+	// Missing files are still created
+	memWriter := &MemoryFileWriter{}
+	var stdout bytes.Buffer
+	if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &stdout, memWriter, WithNoClobber()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(memWriter.Files) != 2 {
+		t.Errorf("expected 2 files to be created, got %v", mapKeys(memWriter.Files))
+	}
+}
+
+// basicFileWriter is a FileWriter implementing none of the optional
+// interfaces.
+type basicFileWriter struct {
+	files map[string][]byte
+}
+
+func (w *basicFileWriter) WriteFile(filename string, content []byte, mode os.FileMode) error {
+	w.files[filename] = content
+	return nil
+}
+
+func (w *basicFileWriter) SetBaseDir(dir string) error { return nil }
+
+// TestExecuteWithFiles_IfMissingWithoutExistsChecker verifies that files of
+// writers that are not ExistsCheckers are looked up in the current directory.
+func TestExecuteWithFiles_IfMissingWithoutExistsChecker(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("custom.yml", []byte("customized"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := []byte("#FILE:custom.yml if-missing#\ngenerated\n#FILE#\n#FILE:other.yml if-missing#\ngenerated\n#FILE#")
+
+	writer := &basicFileWriter{files: map[string][]byte{}}
+	var stdout bytes.Buffer
+	if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &stdout, writer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := writer.files["custom.yml"]; ok {
+		t.Error("expected existing custom.yml to be skipped")
+	}
+	if _, ok := writer.files["other.yml"]; !ok {
+		t.Error("expected missing other.yml to be written")
+	}
+}
+
+// TestExecuteWithFiles_CaseCollision verifies that paths differing only in
+// case produce a warning, or an error with WithStrictPathsCase.
+func TestExecuteWithFiles_CaseCollision(t *testing.T) {
+	tmpl := []byte("#FILE:Config.yaml#\nA\n#FILE#\n#FILE:config.yaml#\nB\n#FILE#")
+
+	var stdout, warnings bytes.Buffer
+	memWriter := &MemoryFileWriter{}
+	if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &stdout, memWriter, WithWarnings(&warnings)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !contains(warnings.String(), "differ only in case") {
+		t.Errorf("expected case collision warning, got %q", warnings.String())
+	}
+	if len(memWriter.Files) != 2 {
+		t.Errorf("expected both files to be written, got %v", mapKeys(memWriter.Files))
+	}
+
+	memWriter = &MemoryFileWriter{}
+	err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &stdout, memWriter, WithStrictPathsCase())
+	if err == nil || !contains(err.Error(), "line 1") || !contains(err.Error(), "line 4") {
+		t.Fatalf("expected strict case collision error naming both lines, got %v", err)
+	}
+	if len(memWriter.Files) != 0 {
+		t.Errorf("expected no files in strict mode, got %v", mapKeys(memWriter.Files))
+	}
+}
+
+// TestExecuteWithFiles_SkipEmpty verifies that whitespace-only FILE segments
+// are skipped with the skip-empty attribute or WithSkipEmpty.
+func TestExecuteWithFiles_SkipEmpty(t *testing.T) {
+	data := map[string]any{"enabled": false}
+	tmpl := []byte(`#FILE:optional.yml skip-empty#
+{{ if .enabled }}enabled: true{{ end }}
+#FILE#
+#FILE:always.yml#
+{{ if .enabled }}enabled: true{{ end }}
+#FILE#
+#FILE:optional.yml skip-empty#
+{{ if not .enabled }}enabled: false{{ end }}
+#FILE#`)
+
+	var stdout bytes.Buffer
+	memWriter := &MemoryFileWriter{}
+	if err := ExecuteWithFiles(AnyProvider(data), tmpl, &stdout, memWriter); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the skipped segment must not collide with the later one
+	if got := string(memWriter.Files["optional.yml"]); got != "\nenabled: false\n" {
+		t.Errorf("unexpected optional.yml content %q", got)
+	}
+	if _, exists := memWriter.Files["always.yml"]; !exists {
+		t.Error("expected always.yml to be written without skip-empty")
+	}
+
+	memWriter = &MemoryFileWriter{}
+	if err := ExecuteWithFiles(AnyProvider(data), tmpl, &stdout, memWriter, WithSkipEmpty()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, exists := memWriter.Files["always.yml"]; exists {
+		t.Error("expected always.yml to be skipped with WithSkipEmpty")
+	}
+}
+
+// TestExecuteWithFiles_FileEach verifies that FILE-EACH segments produce one
+// file per list element with the element as dot.
+func TestExecuteWithFiles_FileEach(t *testing.T) {
+	data := YamlProvider([]byte(`
+services:
+  - name: api
+    port: 8080
+  - name: web
+    port: 80
+`))
+	tmpl := []byte(`#FILE-EACH:.services:deploy/{{.name}}.yaml#
+port: {{.port}}
+#FILE#
+done`)
+
+	var stdout bytes.Buffer
+	memWriter := &MemoryFileWriter{}
+	if err := ExecuteWithFiles(data, tmpl, &stdout, memWriter); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"deploy/api.yaml": "\nport: 8080\n",
+		"deploy/web.yaml": "\nport: 80\n",
+	}
+	if len(memWriter.Files) != len(expected) {
+		t.Fatalf("expected %d files, got %d", len(expected), len(memWriter.Files))
+	}
+	for name, content := range expected {
+		if got := string(memWriter.Files[name]); got != content {
+			t.Errorf("%s: expected %q, got %q", name, content, got)
+		}
+	}
+	if stdout.String() != "\ndone" {
+		t.Errorf("unexpected stdout %q", stdout.String())
+	}
+}
+
+func TestExecuteWithFiles_FileEachErrors(t *testing.T) {
+	cases := map[string]struct {
+		data    any
+		wantErr string
+	}{
+		"missing list":   {map[string]any{}, ""},
+		"not a list":     {map[string]any{"services": "api"}, "not a list"},
+		"duplicate path": {map[string]any{"services": []any{map[string]any{"name": "a"}, map[string]any{"name": "a"}}}, "written more than once"},
+	}
+	tmpl := []byte("#FILE-EACH:.services:{{.name}}.yaml#\nx\n#FILE#")
+	for name, tc := range cases {
+		memWriter := &MemoryFileWriter{}
+		err := ExecuteWithFiles(AnyProvider(tc.data), tmpl, io.Discard, memWriter)
+		if tc.wantErr == "" {
+			if err != nil || len(memWriter.Files) != 0 {
+				t.Errorf("%s: expected no files and no error, got %v (%d files)", name, err, len(memWriter.Files))
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", name, tc.wantErr, err)
+		}
+	}
+}
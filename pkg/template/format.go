@@ -0,0 +1,108 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formatter returns the canonically formatted version of the content of a
+// generated file, or an error if the content cannot be parsed.
+type Formatter func(content []byte) ([]byte, error)
+
+// Formatters maps lowercase file extensions, including the dot (e.g.
+// ".go"), to the Formatter of the files ending in them.
+type Formatters map[string]Formatter
+
+// DefaultFormatters returns the built-in formatters: gofmt for .go files
+// (via go/format), and two-space indentation for .json, .yaml and .yml
+// files. YAML comments are kept. Add entries to the returned map to format
+// other files, e.g. .tf files with a terraform fmt implementation.
+func DefaultFormatters() Formatters {
+	return Formatters{
+		".go":   format.Source,
+		".json": formatJSON,
+		".yaml": formatYAML,
+		".yml":  formatYAML,
+	}
+}
+
+// WithFormatters returns an Option that formats the generated files whose
+// extension has a formatter in formatters, so that generated code comes out
+// canonically formatted without external hooks. A file that cannot be
+// formatted, e.g. Go code with a syntax error, fails the run before
+// anything is written. Stdout content is not formatted.
+//
+// Formatting runs as a BeforeWrite hook; give this option before
+// WithEditorConfig and WithSigning.
+func WithFormatters(formatters Formatters) Option {
+	return WithHooks(Hooks{
+		BeforeWrite: func(_ context.Context, outputs []RenderedOutput) ([]RenderedOutput, error) {
+			for i, out := range outputs {
+				if out.Segment.Type != SegmentFile || out.Skipped != "" {
+					continue
+				}
+				formatter := formatters[strings.ToLower(filepath.Ext(out.Path))]
+				if formatter == nil {
+					continue
+				}
+				formatted, err := formatter(out.Content)
+				if err != nil {
+					return nil, fmt.Errorf("failed to format %s (line %d): %w", out.Path, out.Segment.Line, err)
+				}
+				outputs[i].Content = formatted
+			}
+			return outputs, nil
+		},
+	})
+}
+
+// formatJSON indents a JSON document with two spaces and ends it with a
+// newline.
+func formatJSON(content []byte) ([]byte, error) {
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 {
+		return content, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, content, "", "  "); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// formatYAML re-encodes every document of a YAML stream with two-space
+// indentation, keeping comments.
+func formatYAML(content []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return content, nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(&doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
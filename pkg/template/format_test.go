@@ -0,0 +1,64 @@
+package template
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDefaultFormatters(t *testing.T) {
+	cases := []struct {
+		ext     string
+		content string
+		want    string
+	}{
+		{".go", "package main\nfunc  main( ) {\nx:=1\n_ = x}", "package main\n\nfunc main() {\n\tx := 1\n\t_ = x\n}\n"},
+		{".json", `{"a":[1,2],"b":{}}`, "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": {}\n}\n"},
+		{".yaml", "a:\n    b: 1 # keep\n    c:\n    - x\n", "a:\n  b: 1 # keep\n  c:\n    - x\n"},
+		{".yml", "a: 1\n---\nb:   2\n", "a: 1\n---\nb: 2\n"},
+		{".json", "  \n", ""},
+	}
+	formatters := DefaultFormatters()
+	for _, tc := range cases {
+		got, err := formatters[tc.ext]([]byte(tc.content))
+		if err != nil {
+			t.Fatalf("%s %q: unexpected error: %v", tc.ext, tc.content, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.ext, tc.want, got)
+		}
+	}
+}
+
+func TestWithFormatters(t *testing.T) {
+	tmpl := []byte(`{"x":1}#FILE:main.go#package main
+var  x=1
+#FILE##FILE:data.JSON#{"a":1}#FILE##FILE:notes.txt#{"a":1}#FILE#`)
+	writer := &MemoryFileWriter{}
+	var stdout bytes.Buffer
+	if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &stdout, writer, WithFormatters(DefaultFormatters())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"main.go":   "package main\n\nvar x = 1\n",
+		"data.JSON": "{\n  \"a\": 1\n}\n",
+		"notes.txt": `{"a":1}`,
+	}
+	for name, content := range want {
+		if got := string(writer.Files[name]); got != content {
+			t.Errorf("%s: expected %q, got %q", name, content, got)
+		}
+	}
+	if stdout.String() != `{"x":1}` {
+		t.Errorf("expected stdout to be left alone, got %q", stdout.String())
+	}
+
+	writer = &MemoryFileWriter{}
+	err := ExecuteWithFiles(AnyProvider(map[string]any{}), []byte("#FILE:ok.json#{}#FILE#\n#FILE:bad.go#package main\nfunc {#FILE#"), &stdout, writer, WithFormatters(DefaultFormatters()))
+	if err == nil || !strings.Contains(err.Error(), "failed to format bad.go (line 2)") {
+		t.Errorf("expected a format error for bad.go, got %v", err)
+	}
+	if len(writer.Files) != 0 {
+		t.Errorf("expected nothing to be written, got %v", writer.Files)
+	}
+}
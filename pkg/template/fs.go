@@ -0,0 +1,92 @@
+package template
+
+import (
+	"io"
+	"os"
+)
+
+// FS is the filesystem DefaultFileWriter writes to. Implementations let
+// embedders target chroots, in-memory filesystems or remote backends while
+// keeping the writer's behavior: permissions, atomic replacement through a
+// temporary file and rename, and metadata preservation. Errors for missing
+// files should satisfy errors.Is(err, fs.ErrNotExist).
+type FS interface {
+	// OpenFile opens a file like os.OpenFile. The writer uses
+	// os.O_WRONLY|os.O_CREATE|os.O_TRUNC to create files, os.O_WRONLY|
+	// os.O_TRUNC to rewrite them in place, and os.O_RDONLY to read them.
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	// Rename replaces newpath with oldpath, atomically if possible.
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	Chmod(name string, mode os.FileMode) error
+	MkdirAll(path string, perm os.FileMode) error
+	Stat(name string) (os.FileInfo, error)
+	// Lstat is like Stat but does not follow a final symbolic link.
+	Lstat(name string) (os.FileInfo, error)
+}
+
+// File is an open file of an FS.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+}
+
+// LinkFS is an FS that supports hard links, which DefaultFileWriter uses
+// to deduplicate files (see DefaultFileWriter.Dedup). On other filesystems
+// duplicate files are written as copies.
+type LinkFS interface {
+	FS
+	Link(oldname, newname string) error
+}
+
+// metadataFS is implemented by filesystems that can give a replacement file
+// the owner and extended attributes of the file it replaces.
+type metadataFS interface {
+	preserveMetadata(info os.FileInfo, path, tmp string) error
+}
+
+// OSFS is the FS of the operating system, used by DefaultFileWriter unless
+// another one is set. It is the only FS on which the owner and extended
+// attributes of overwritten files are preserved.
+type OSFS struct{}
+
+func (OSFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (OSFS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (OSFS) Remove(name string) error                     { return os.Remove(name) }
+func (OSFS) Chmod(name string, mode os.FileMode) error    { return os.Chmod(name, mode) }
+func (OSFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+func (OSFS) Stat(name string) (os.FileInfo, error)        { return os.Stat(name) }
+func (OSFS) Lstat(name string) (os.FileInfo, error)       { return os.Lstat(name) }
+func (OSFS) Link(oldname, newname string) error           { return os.Link(oldname, newname) }
+
+func (OSFS) preserveMetadata(info os.FileInfo, path, tmp string) error {
+	return preserveMetadata(info, path, tmp)
+}
+
+// readFile reads the whole file name from fsys.
+func readFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// writeFile writes content to the file name on fsys, creating it with perm
+// (before the umask, on the OS filesystem) or truncating it.
+func writeFile(fsys FS, name string, content []byte, perm os.FileMode) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
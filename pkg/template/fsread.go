@@ -0,0 +1,112 @@
+package template
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultReadFileMaxSize = 1 << 20 // 1 MiB
+
+// FileReadConfig configures the opt-in readFile template function.
+type FileReadConfig struct {
+	// AllowedDirs lists the directories templates may read files from,
+	// including their subdirectories. A file outside all of them fails to
+	// read, also when it is reached through a symbolic link.
+	AllowedDirs []string
+	// MaxSize limits the size of files that can be read. Defaults to 1 MiB.
+	MaxSize int64
+}
+
+// WithFileFuncs returns an Option that registers the readFile template
+// function, which returns the content of a file as a string:
+//
+//	{{ readFile "certs/ca.pem" | nindent 4 }}
+//
+// Relative paths are resolved against the current working directory.
+func WithFileFuncs(cfg FileReadConfig) Option {
+	return optionFunc(func(o *options) {
+		r := newFileReader(cfg)
+		o.funcs["readFile"] = r.read
+	})
+}
+
+// fileReader reads files below a set of allowed directories.
+type fileReader struct {
+	cfg  FileReadConfig
+	name string // Function name prefixed to errors
+	// dirs holds the allowed directories as absolute paths with symbolic
+	// links resolved; directories that cannot be resolved are left out.
+	dirs []string
+}
+
+func newFileReader(cfg FileReadConfig) *fileReader {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = defaultReadFileMaxSize
+	}
+	r := &fileReader{cfg: cfg, name: "readFile"}
+	for _, dir := range cfg.AllowedDirs {
+		if resolved, err := resolvePath(dir); err == nil {
+			r.dirs = append(r.dirs, resolved)
+		}
+	}
+	return r
+}
+
+// read returns the content of path if it lies within an allowed directory.
+func (r *fileReader) read(path string) (string, error) {
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", r.name, err)
+	}
+	if !r.allowed(resolved) {
+		return "", fmt.Errorf("%s: %s is outside the allowed directories", r.name, path)
+	}
+
+	f, err := os.Open(resolved)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", r.name, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", r.name, err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s: %s is not a regular file", r.name, path)
+	}
+	content, err := io.ReadAll(io.LimitReader(f, r.cfg.MaxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to read %s: %w", r.name, path, err)
+	}
+	if int64(len(content)) > r.cfg.MaxSize {
+		return "", fmt.Errorf("%s: %s exceeds the maximum size of %d bytes", r.name, path, r.cfg.MaxSize)
+	}
+	return string(content), nil
+}
+
+// allowed reports whether the resolved path is one of the allowed
+// directories or lies below one of them.
+func (r *fileReader) allowed(path string) bool {
+	for _, dir := range r.dirs {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			continue
+		}
+		if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePath returns path as an absolute path with symbolic links resolved.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
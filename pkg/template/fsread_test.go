@@ -0,0 +1,63 @@
+package template
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileFuncs_ReadFile(t *testing.T) {
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "snippets")
+	if err := os.MkdirAll(filepath.Join(allowed, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(allowed, "sub", "header.txt"), []byte("line1\nline2"), 0644)
+	os.WriteFile(filepath.Join(allowed, "big.txt"), bytes.Repeat([]byte("x"), 13), 0644)
+	os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644)
+	if err := os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(allowed, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	cfg := FileReadConfig{AllowedDirs: []string{allowed}, MaxSize: 12}
+
+	var out bytes.Buffer
+	tmpl := []byte(`data:{{ readFile .path | nindent 2 }}`)
+	data := map[string]any{"path": filepath.Join(allowed, "sub", "header.txt")}
+	if err := Execute(AnyProvider(data), tmpl, &out, WithFileFuncs(cfg)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "data:\n  line1\n  line2"; out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+
+	cases := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "outside", path: filepath.Join(dir, "secret.txt"), want: "outside the allowed directories"},
+		{name: "traversal", path: filepath.Join(allowed, "..", "secret.txt"), want: "outside the allowed directories"},
+		{name: "symlink escape", path: filepath.Join(allowed, "link.txt"), want: "outside the allowed directories"},
+		{name: "directory", path: filepath.Join(allowed, "sub"), want: "not a regular file"},
+		{name: "too large", path: filepath.Join(allowed, "big.txt"), want: "exceeds the maximum size"},
+		{name: "missing", path: filepath.Join(allowed, "missing.txt"), want: "no such file"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := map[string]any{"path": tc.path}
+			err := Execute(AnyProvider(data), []byte(`{{ readFile .path }}`), &bytes.Buffer{}, WithFileFuncs(cfg))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestFileFuncs_DisabledByDefault(t *testing.T) {
+	err := Execute(AnyProvider(map[string]any{}), []byte(`{{ readFile "go.mod" }}`), &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), `function "readFile" not defined`) {
+		t.Errorf("expected undefined function error, got %v", err)
+	}
+}
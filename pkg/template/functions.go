@@ -1,45 +1,218 @@
 package template
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
 )
 
-// unique returns a new []any containing only the distinct elements from the provided slice.
-// It preserves the order of first occurrence.
+// BuiltinFuncs returns a copy of the functions available to every template,
+// e.g. to use them with text/template outside of this package. Changing the
+// returned map does not affect rendering; use WithFuncs to add or replace
+// functions.
+func BuiltinFuncs() template.FuncMap {
+	return builtinFuncs()
+}
+
+// builtinFuncs returns a fresh copy of the functions available to every
+// template. Opt-in functions are added on top of these through options.
+func builtinFuncs() template.FuncMap {
+	funcs := template.FuncMap{
+		"env":           os.Getenv,
+		"envOrDefault":  envOrDefault,
+		"unique":        unique,
+		"toStrings":     toStrings,
+		"toInts":        toInts,
+		"join":          join,
+		"dict":          dict,
+		"list":          list,
+		"merge":         merge,
+		"set":           set,
+		"hasKey":        hasKey,
+		"keys":          keys,
+		"values":        values,
+		"deepEqual":     deepEqual,
+		"dataDiff":      dataDiff,
+		"semver":        semver,
+		"semverCompare": semverCompare,
+		"toYaml":        toYaml,
+		"toJson":        toJson,
+		"toPrettyJson":  toPrettyJson,
+		"fromYaml":      fromYaml,
+		"fromJson":      fromJson,
+		"indent":        indent,
+		"nindent":       nindent,
+		"squote":        squote,
+		"shellQuote":    shellQuote,
+		"jsonEscape":    jsonEscape,
+		"yamlQuote":     yamlQuote,
+		"b64enc":        b64enc,
+		"b64dec":        b64dec,
+		"sha256sum":     sha256sum,
+		"sha1sum":       sha1sum,
+		"hashOf":        hashOf,
+		"uuidv4":        uuidv4,
+	}
+	for name, fn := range clockFuncs(systemClock{}) {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// unique returns a new slice containing only the distinct elements from the provided slice.
+// It preserves the order of first occurrence and the slice type, so that
+// e.g. a []string stays a []string for functions such as join.
 // Behavior:
-//   - If input is nil, returns (nil, nil).
+//   - If input is nil or a nil slice, returns (nil, nil).
+//   - If input is not a slice or array, returns an error.
 //   - If any element’s dynamic type is not comparable, returns an error.
 //
 // Parameters:
-//   - input: []any
+//   - input: a slice or array of any element type.
 //
 // Returns:
-//   - []any: a slice containing unique elements in original order.
-//   - error: non‐nil if any element is not comparable.
-func unique(input []any) ([]any, error) {
+//   - any: a slice of the same type containing unique elements in original order.
+//   - error: non‐nil if input is not a slice or any element is not comparable.
+func unique(input any) (any, error) {
 	if input == nil {
 		return nil, nil
 	}
-	seen := make(map[any]struct{}, len(input))
-	result := make([]any, 0, len(input))
+	v := reflect.ValueOf(input)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("unique: expected a list, got %T", input)
+	}
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		return nil, nil
+	}
+	seen := make(map[any]struct{}, v.Len())
+	result := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, v.Len())
 
-	for _, elem := range input {
-		if elem != nil {
-			t := reflect.TypeOf(elem)
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		key := elem.Interface()
+		if key != nil {
+			t := reflect.TypeOf(key)
 			if !t.Comparable() {
 				return nil, fmt.Errorf("unique: elements of type %s are not comparable", t.String())
 			}
 		}
-		if _, exists := seen[elem]; !exists {
-			seen[elem] = struct{}{}
-			result = append(result, elem)
+		if _, exists := seen[key]; !exists {
+			seen[key] = struct{}{}
+			result = reflect.Append(result, elem)
+		}
+	}
+	return result.Interface(), nil
+}
+
+// toStrings converts the elements of a list to strings, e.g. to pass a
+// list from the input data (always []any) to join. Numbers and booleans
+// are formatted as the template would print them.
+//
+// Parameters:
+//   - input: a slice or array of strings, numbers or booleans.
+//
+// Returns:
+//   - []string: the converted elements, nil if input is nil.
+//   - error: non-nil if input is not a list or an element is nil, a map or
+//     a list.
+func toStrings(input any) ([]string, error) {
+	return convertList(input, "toStrings", func(elem any) (string, bool) {
+		switch e := elem.(type) {
+		case string:
+			return e, true
+		case nil:
+			return "", false
+		}
+		switch reflect.TypeOf(elem).Kind() {
+		case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct, reflect.Pointer, reflect.Func, reflect.Chan:
+			return "", false
+		}
+		return fmt.Sprint(elem), true
+	})
+}
+
+// toInts converts the elements of a list to ints. Floats (as decoded from
+// JSON) must have no fractional part and strings must hold a decimal integer.
+//
+// Parameters:
+//   - input: a slice or array of numbers or numeric strings.
+//
+// Returns:
+//   - []int: the converted elements, nil if input is nil.
+//   - error: non-nil if input is not a list or an element cannot be
+//     converted exactly.
+func toInts(input any) ([]int, error) {
+	return convertList(input, "toInts", func(elem any) (int, bool) {
+		if s, ok := elem.(string); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			return n, err == nil
 		}
+		v := reflect.ValueOf(elem)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return int(v.Int()), true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int(v.Uint()), v.Uint() <= math.MaxInt
+		case reflect.Float32, reflect.Float64:
+			f := v.Float()
+			return int(f), f == math.Trunc(f) && math.Abs(f) <= 1<<53
+		}
+		return 0, false
+	})
+}
+
+// convertList applies convert to every element of the slice or array
+// input, reporting elements it rejects as errors of the function name.
+func convertList[T any](input any, name string, convert func(any) (T, bool)) ([]T, error) {
+	if input == nil {
+		return nil, nil
+	}
+	v := reflect.ValueOf(input)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%s: expected a list, got %T", name, input)
+	}
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		return nil, nil
+	}
+	result := make([]T, v.Len())
+	for i := range result {
+		elem := v.Index(i).Interface()
+		converted, ok := convert(elem)
+		if !ok {
+			return nil, fmt.Errorf("%s: cannot convert element %d (%v of type %T)", name, i, elem, elem)
+		}
+		result[i] = converted
 	}
 	return result, nil
 }
 
+// join concatenates the elements of a list of strings, placing sep between
+// them. Lists from the input data can be converted with toStrings first,
+// e.g. {{ .hosts | toStrings | join "," }}.
+//
+// Parameters:
+//   - sep: the separator.
+//   - elems: the strings to join.
+//
+// Returns:
+//   - string: the joined string.
+func join(sep string, elems []string) string {
+	return strings.Join(elems, sep)
+}
+
 // envOrDefault returns the value of the environment variable named by key.
 // If the variable is unset or its value is empty, defaultValue is returned.
 //
@@ -50,9 +223,245 @@ func unique(input []any) ([]any, error) {
 // Returns:
 //   - string: the environment variable’s value, or defaultValue if unset or empty.
 func envOrDefault(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+	return envOrDefaultFrom(os.Getenv)(key, defaultValue)
+}
+
+// envOrDefaultFrom returns an envOrDefault function that looks variables up
+// with getenv instead of in the process environment.
+func envOrDefaultFrom(getenv func(string) string) func(key, defaultValue string) string {
+	return func(key, defaultValue string) string {
+		value := getenv(key)
+		if value == "" {
+			return defaultValue
+		}
+		return value
+	}
+}
+
+// WithEnviron returns an Option that makes the env and envOrDefault template
+// functions read environ instead of the process environment, e.g. to render
+// for another deployment stage or to test templates without changing the
+// environment of the process. Variables missing from environ are unset.
+func WithEnviron(environ map[string]string) Option {
+	getenv := func(key string) string {
+		return environ[key]
+	}
+	return WithFuncs(template.FuncMap{
+		"env":          getenv,
+		"envOrDefault": envOrDefaultFrom(getenv),
+	})
+}
+
+// toYaml encodes value as YAML with two-space indentation, without the
+// trailing newline, so that it can be piped into indentation helpers.
+//
+// Parameters:
+//   - value: any value, typically a sub-structure of the input data.
+//
+// Returns:
+//   - string: the YAML document.
+//   - error: non-nil if value cannot be encoded.
+func toYaml(value any) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(value); err != nil {
+		return "", fmt.Errorf("toYaml: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("toYaml: %w", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// toJson encodes value as compact JSON. Characters such as < and & are not
+// escaped.
+//
+// Parameters:
+//   - value: any value, typically a sub-structure of the input data.
+//
+// Returns:
+//   - string: the JSON document on a single line.
+//   - error: non-nil if value cannot be encoded.
+func toJson(value any) (string, error) {
+	return encodeJSON("toJson", value, "")
+}
+
+// toPrettyJson encodes value as JSON indented with two spaces.
+//
+// Parameters:
+//   - value: any value, typically a sub-structure of the input data.
+//
+// Returns:
+//   - string: the indented JSON document.
+//   - error: non-nil if value cannot be encoded.
+func toPrettyJson(value any) (string, error) {
+	return encodeJSON("toPrettyJson", value, "  ")
+}
+
+// encodeJSON encodes value without HTML escaping and without the trailing
+// newline added by json.Encoder. Errors are prefixed with the name of the
+// calling function.
+func encodeJSON(name string, value any, indent string) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(value); err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// fromYaml parses a YAML document held in a string, such as a config blob
+// passed through an environment variable, into data the template can use.
+//
+// Parameters:
+//   - input: the YAML document.
+//
+// Returns:
+//   - any: the parsed value (map[string]any, []any or a scalar), nil for an
+//     empty document.
+//   - error: non-nil if input is not valid YAML.
+func fromYaml(input string) (any, error) {
+	var value any
+	if err := yaml.Unmarshal([]byte(input), &value); err != nil {
+		return nil, fmt.Errorf("fromYaml: %w", err)
+	}
+	return value, nil
+}
+
+// fromJson parses a JSON document held in a string into data the template
+// can use. Numbers are returned as float64.
+//
+// Parameters:
+//   - input: the JSON document.
+//
+// Returns:
+//   - any: the parsed value (map[string]any, []any or a scalar).
+//   - error: non-nil if input is not valid JSON.
+func fromJson(input string) (any, error) {
+	var value any
+	if err := json.Unmarshal([]byte(input), &value); err != nil {
+		return nil, fmt.Errorf("fromJson: %w", err)
+	}
+	return value, nil
+}
+
+// indent prefixes every line of s, including the first, with the given
+// number of spaces. It is typically used as {{ include "x" . | indent 4 }}.
+//
+// Parameters:
+//   - spaces: the number of spaces to add.
+//   - s: the text to indent.
+//
+// Returns:
+//   - string: the indented text.
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", max(spaces, 0))
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// nindent is like indent but starts with a newline, so that a block can be
+// placed after a key on the same template line, e.g.
+// "labels:{{ toYaml .labels | nindent 2 }}".
+//
+// Parameters:
+//   - spaces: the number of spaces to add.
+//   - s: the text to indent.
+//
+// Returns:
+//   - string: a newline followed by the indented text.
+func nindent(spaces int, s string) string {
+	return "\n" + indent(spaces, s)
+}
+
+// b64enc encodes s with standard, padded base64, as used for the data of
+// Kubernetes secrets.
+//
+// Parameters:
+//   - s: the text to encode.
+//
+// Returns:
+//   - string: the base64 encoding of s.
+func b64enc(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// b64dec decodes standard, padded base64.
+//
+// Parameters:
+//   - s: the base64 text to decode.
+//
+// Returns:
+//   - string: the decoded text.
+//   - error: non-nil if s is not valid base64.
+func b64dec(s string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("b64dec: %w", err)
+	}
+	return string(decoded), nil
+}
+
+// sha256sum returns the SHA-256 checksum of s, e.g. to add a checksum
+// annotation that changes whenever a rendered config changes.
+//
+// Parameters:
+//   - s: the text to hash.
+//
+// Returns:
+//   - string: the checksum as 64 lowercase hex digits.
+func sha256sum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// sha1sum returns the SHA-1 checksum of s. SHA-1 is not collision
+// resistant; use it for short cache-busting identifiers, not for security.
+//
+// Parameters:
+//   - s: the text to hash.
+//
+// Returns:
+//   - string: the checksum as 40 lowercase hex digits.
+func sha1sum(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashOf returns a SHA-256 checksum of a data value that does not depend on
+// the order of map keys, e.g. for a change-detection annotation:
+// {{ hashOf .config }}. The value is hashed in canonical JSON form (sorted
+// keys, no HTML escaping), so numbers hash by value and list order matters.
+//
+// Parameters:
+//   - value: the data to hash.
+//
+// Returns:
+//   - string: the checksum as 64 lowercase hex digits.
+//   - error: non-nil if value cannot be encoded as JSON.
+func hashOf(value any) (string, error) {
+	canonical, err := encodeJSON("hashOf", value, "")
+	if err != nil {
+		return "", err
+	}
+	return sha256sum(canonical), nil
+}
+
+// uuidv4 returns a new random (version 4) UUID. Each call returns a
+// different value, so output using it changes on every run.
+//
+// Returns:
+//   - string: the UUID in its canonical form, e.g.
+//     "f47ac10b-58cc-4372-a567-0e02b2c3d479".
+//   - error: non-nil if the system random number generator fails.
+func uuidv4() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", fmt.Errorf("uuidv4: %w", err)
 	}
-	return value
+	u[6] = u[6]&0x0f | 0x40 // version 4
+	u[8] = u[8]&0x3f | 0x80 // RFC 9562 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
 }
@@ -1,8 +1,11 @@
 package template
 
 import (
+	"bytes"
 	"os"
 	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -87,3 +90,189 @@ func TestGetEnvOrDefault_WithEnv(t *testing.T) {
 		t.Errorf("expected setVal, got %q", got)
 	}
 }
+
+func TestToYamlToJson(t *testing.T) {
+	data, err := YamlProvider([]byte("values:\n  name: api\n  ports: [80, 443]\n  url: http://x?a=1&b=<2>\n"))()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := data.(map[string]any)["values"]
+
+	cases := []struct {
+		name string
+		fn   func(any) (string, error)
+		want string
+	}{
+		{name: "toYaml", fn: toYaml, want: "name: api\nports:\n  - 80\n  - 443\nurl: http://x?a=1&b=<2>"},
+		{name: "toJson", fn: toJson, want: `{"name":"api","ports":[80,443],"url":"http://x?a=1&b=<2>"}`},
+		{name: "toPrettyJson", fn: toPrettyJson, want: "{\n  \"name\": \"api\",\n  \"ports\": [\n    80,\n    443\n  ],\n  \"url\": \"http://x?a=1&b=<2>\"\n}"},
+	}
+	for _, tc := range cases {
+		got, err := tc.fn(values)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+
+	if _, err := toJson(map[string]any{"f": func() {}}); err == nil {
+		t.Error("expected error for a value that cannot be encoded")
+	}
+}
+
+func TestFromYamlFromJson(t *testing.T) {
+	tmpl := []byte(`{{ range (fromYaml .blob).hosts }}{{ . }};{{ end }}{{ (fromJson .json).port }}`)
+	data := AnyProvider(map[string]any{
+		"blob": "hosts:\n  - a\n  - b\n",
+		"json": `{"port": 8080}`,
+	})
+	var out bytes.Buffer
+	if err := Execute(data, tmpl, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "a;b;8080" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	if _, err := fromYaml("a: ["); err == nil {
+		t.Error("expected error for invalid YAML")
+	}
+	if _, err := fromJson("{"); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+	if v, err := fromYaml(""); err != nil || v != nil {
+		t.Errorf("expected nil for an empty document, got %v, %v", v, err)
+	}
+}
+
+func TestEncodingFuncs(t *testing.T) {
+	tmpl := []byte(`{{ b64enc "admin" }} {{ b64dec "YWRtaW4=" }} {{ sha256sum "abc" }} {{ sha1sum "abc" }}`)
+	var out bytes.Buffer
+	if err := Execute(AnyProvider(map[string]any{}), tmpl, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "YWRtaW4= admin " +
+		"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad " +
+		"a9993e364706816aba3e25717850c26c9cd0d89d"
+	if out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+
+	if _, err := b64dec("not base64!"); err == nil {
+		t.Error("expected error for invalid base64")
+	}
+}
+
+func TestUUIDv4(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first, err := uuidv4()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, _ := uuidv4()
+	if !pattern.MatchString(first) {
+		t.Errorf("%q is not a version 4 UUID", first)
+	}
+	if first == second {
+		t.Errorf("expected different UUIDs, got %q twice", first)
+	}
+}
+
+func TestUnique_PreservesSliceType(t *testing.T) {
+	out, err := unique([]string{"b", "a", "b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(out, []string{"b", "a"}) {
+		t.Errorf("expected []string{b a}, got %#v", out)
+	}
+	if _, err := unique("abc"); err == nil {
+		t.Error("expected error for a value that is not a list")
+	}
+}
+
+func TestToStringsToInts(t *testing.T) {
+	strs, err := toStrings([]any{"a", 1, 2.5, true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(strs, []string{"a", "1", "2.5", "true"}) {
+		t.Errorf("unexpected strings %#v", strs)
+	}
+	ints, err := toInts([]any{1, float64(2), " 3", uint8(4)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(ints, []int{1, 2, 3, 4}) {
+		t.Errorf("unexpected ints %#v", ints)
+	}
+
+	for _, input := range []any{[]any{"a", nil}, []any{map[string]any{}}, "abc"} {
+		if _, err := toStrings(input); err == nil {
+			t.Errorf("toStrings(%#v): expected error", input)
+		}
+	}
+	for _, input := range []any{[]any{1.5}, []any{"x"}, []any{true}} {
+		if _, err := toInts(input); err == nil {
+			t.Errorf("toInts(%#v): expected error", input)
+		}
+	}
+}
+
+func TestJoin_Chain(t *testing.T) {
+	tmpl := []byte(`{{ .hosts | unique | toStrings | join "," }}`)
+	data := AnyProvider(map[string]any{"hosts": []any{"a", "b", "a", 8080}})
+	var out bytes.Buffer
+	if err := Execute(data, tmpl, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "a,b,8080" {
+		t.Errorf("expected %q, got %q", "a,b,8080", out.String())
+	}
+}
+
+func TestHashOf(t *testing.T) {
+	a, err := YamlProvider([]byte("config:\n  b: [1, 2]\n  a: x\n"))()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := fromJson(`{"config": {"a": "x", "b": [1.0, 2]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashA, err := hashOf(a.(map[string]any)["config"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hashB, _ := hashOf(b.(map[string]any)["config"])
+	if hashA != hashB {
+		t.Errorf("expected equal hashes regardless of key order and number type, got %s and %s", hashA, hashB)
+	}
+	if want := sha256sum(`{"a":"x","b":[1,2]}`); hashA != want {
+		t.Errorf("expected %s, got %s", want, hashA)
+	}
+
+	reordered, _ := hashOf(map[string]any{"a": "x", "b": []any{2, 1}})
+	if reordered == hashA {
+		t.Error("expected list order to change the hash")
+	}
+	if _, err := hashOf(map[string]any{"f": func() {}}); err == nil || !strings.HasPrefix(err.Error(), "hashOf: ") {
+		t.Errorf("expected hashOf error, got %v", err)
+	}
+}
+
+func TestWithEnviron(t *testing.T) {
+	t.Setenv("SIMPLATE_TEST_STAGE", "prod")
+	t.Setenv("SIMPLATE_TEST_REGION", "us")
+	tmpl := []byte(`{{ env "SIMPLATE_TEST_STAGE" }} {{ envOrDefault "SIMPLATE_TEST_REGION" "eu" }}`)
+	var out bytes.Buffer
+	environ := map[string]string{"SIMPLATE_TEST_STAGE": "dev"}
+	if err := Execute(AnyProvider(map[string]any{}), tmpl, &out, WithEnviron(environ)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "dev eu" {
+		t.Errorf("expected %q, got %q", "dev eu", out.String())
+	}
+}
@@ -0,0 +1,170 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// UpdateGitignore appends the paths of generated files to the .gitignore
+// file at file, so that they are not committed. paths are absolute or relative
+// to the current directory, and must be below the directory of file; they
+// are written as patterns anchored to it, e.g. /gen/api.go. Paths already
+// listed are skipped, so that repeated runs leave the file unchanged. The
+// file is created if needed; nil fsys means the OS filesystem.
+//
+// It returns the patterns that were added.
+func UpdateGitignore(fsys FS, file string, paths []string) ([]string, error) {
+	return updateGitFile(fsys, file, paths,
+		func(pattern string) string { return escapeGitPattern(pattern, true) },
+		func(line, pattern string) bool {
+			line = strings.TrimSpace(line)
+			return line == escapeGitPattern(pattern, true) || line == strings.TrimPrefix(pattern, "/")
+		})
+}
+
+// UpdateGitattributes marks the paths of generated files as
+// linguist-generated=true in the .gitattributes file at file, so that code
+// hosts collapse them in diffs and leave them out of language statistics.
+// Paths are handled like in UpdateGitignore; paths already marked
+// linguist-generated are skipped.
+//
+// It returns the patterns that were added.
+func UpdateGitattributes(fsys FS, file string, paths []string) ([]string, error) {
+	return updateGitFile(fsys, file, paths,
+		func(pattern string) string { return quoteGitAttributesPattern(pattern) + " linguist-generated=true" },
+		func(line, pattern string) bool {
+			first, attrs := splitGitAttributesLine(line)
+			if first != quoteGitAttributesPattern(pattern) && first != strings.TrimPrefix(pattern, "/") {
+				return false
+			}
+			for _, attr := range attrs {
+				if attr == "linguist-generated" || attr == "linguist-generated=true" {
+					return true
+				}
+			}
+			return false
+		})
+}
+
+// splitGitAttributesLine returns the pattern of a .gitattributes line, in
+// double quotes if it is quoted, and its attributes.
+func splitGitAttributesLine(line string) (string, []string) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, `"`) {
+		for i := 1; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '"':
+				return line[:i+1], strings.Fields(line[i+1:])
+			}
+		}
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
+
+// updateGitFile appends entry(pattern) to file for the patterns of paths
+// for which no line of the file is listed according to listed.
+func updateGitFile(fsys FS, file string, paths []string, entry func(pattern string) string, listed func(line, pattern string) bool) ([]string, error) {
+	if fsys == nil {
+		fsys = OSFS{}
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", file, err)
+	}
+	content, err := readFile(fsys, abs)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	lines := strings.Split(string(content), "\n")
+
+	var added []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		pattern, err := gitPattern(filepath.Dir(abs), path)
+		if err != nil {
+			return nil, err
+		}
+		if seen[pattern] {
+			continue
+		}
+		seen[pattern] = true
+		exists := false
+		for _, line := range lines {
+			if exists = listed(line, pattern); exists {
+				break
+			}
+		}
+		if !exists {
+			added = append(added, pattern)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	buf.Write(content)
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	for _, pattern := range added {
+		buf.WriteString(entry(pattern))
+		buf.WriteByte('\n')
+	}
+	w := &DefaultFileWriter{FS: fsys}
+	if err := w.WriteFile(abs, buf.Bytes(), 0); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return added, nil
+}
+
+// gitPattern returns the slash-separated path of path relative to dir,
+// anchored with a leading slash.
+func gitPattern(dir, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not below %s", path, dir)
+	}
+	return "/" + filepath.ToSlash(rel), nil
+}
+
+// escapeGitPattern escapes the wildcard characters of pattern, and its
+// trailing spaces for .gitignore files, so that it matches the literal path.
+func escapeGitPattern(pattern string, gitignore bool) string {
+	var b strings.Builder
+	for _, r := range pattern {
+		if strings.ContainsRune(`\*?[`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	escaped := b.String()
+	if gitignore && strings.HasSuffix(escaped, " ") {
+		escaped = escaped[:len(escaped)-1] + `\ `
+	}
+	return escaped
+}
+
+// quoteGitAttributesPattern returns pattern escaped for .gitattributes, in
+// double quotes if it contains whitespace or quotes.
+func quoteGitAttributesPattern(pattern string) string {
+	escaped := escapeGitPattern(pattern, false)
+	if !strings.ContainsAny(escaped, " \t\"") {
+		return escaped
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(escaped) + `"`
+}
@@ -0,0 +1,67 @@
+package template
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpdateGitignore(t *testing.T) {
+	fsys := &MemFS{}
+	if err := fsys.MkdirAll("/repo", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(fsys, "/repo/.gitignore", []byte("/bin\n/gen/old.go"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{"/repo/gen/api.go", "/repo/gen/old.go", "/repo/gen/a*b.txt", "/repo/gen/api.go"}
+	added, err := UpdateGitignore(fsys, "/repo/.gitignore", paths)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"/gen/api.go", "/gen/a*b.txt"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("expected added patterns %v, got %v", want, added)
+	}
+	assertMemFile(t, fsys, "/repo/.gitignore", "/bin\n/gen/old.go\n/gen/api.go\n/gen/a\\*b.txt\n", 0644)
+
+	// A second run changes nothing
+	if added, err := UpdateGitignore(fsys, "/repo/.gitignore", paths); err != nil || len(added) != 0 {
+		t.Errorf("expected no change on the second run, got %v, %v", added, err)
+	}
+	assertMemFile(t, fsys, "/repo/.gitignore", "/bin\n/gen/old.go\n/gen/api.go\n/gen/a\\*b.txt\n", 0644)
+
+	if _, err := UpdateGitignore(fsys, "/repo/sub/.gitignore", []string{"/repo/x.go"}); err == nil {
+		t.Error("expected an error for a path outside the directory of the .gitignore file")
+	}
+}
+
+func TestUpdateGitattributes(t *testing.T) {
+	fsys := &MemFS{}
+	if err := fsys.MkdirAll("/repo", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(fsys, "/repo/.gitattributes", []byte("*.sh text eol=lf\n/gen/old.go linguist-generated\n/gen/api.go -diff\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{"/repo/gen/api.go", "/repo/gen/old.go", "/repo/gen/my file.go"}
+	added, err := UpdateGitattributes(fsys, "/repo/.gitattributes", paths)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"/gen/api.go", "/gen/my file.go"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("expected added patterns %v, got %v", want, added)
+	}
+	want := "*.sh text eol=lf\n/gen/old.go linguist-generated\n/gen/api.go -diff\n/gen/api.go linguist-generated=true\n\"/gen/my file.go\" linguist-generated=true\n"
+	assertMemFile(t, fsys, "/repo/.gitattributes", want, 0644)
+
+	if added, err := UpdateGitattributes(fsys, "/repo/.gitattributes", paths); err != nil || len(added) != 0 {
+		t.Errorf("expected no change on the second run, got %v, %v", added, err)
+	}
+
+	// The file is created if needed
+	if _, err := UpdateGitattributes(fsys, "/repo/gen/.gitattributes", []string{"/repo/gen/api.go"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertMemFile(t, fsys, "/repo/gen/.gitattributes", "/api.go linguist-generated=true\n", 0644)
+}
@@ -0,0 +1,75 @@
+package template
+
+import (
+	"sort"
+)
+
+// IncludeCycles returns the cycles of the include graph given by edges (see
+// TemplateMetrics.Includes): each cycle lists the names of the templates
+// that include each other, directly or through others, sorted, and a
+// template including itself is a cycle of its own. Cycles are valid as long
+// as the recursion ends, but they are easily introduced by mistake.
+func IncludeCycles(edges []IncludeEdge) [][]string {
+	next := map[string][]string{}
+	self := map[string]bool{}
+	var names []string
+	for _, e := range edges {
+		for _, name := range []string{e.From, e.To} {
+			if _, ok := next[name]; !ok {
+				next[name] = nil
+				names = append(names, name)
+			}
+		}
+		next[e.From] = append(next[e.From], e.To)
+		if e.From == e.To {
+			self[e.From] = true
+		}
+	}
+	sort.Strings(names)
+
+	// Tarjan's strongly connected components
+	index := map[string]int{}
+	low := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var cycles [][]string
+	var visit func(name string)
+	visit = func(name string) {
+		index[name] = len(index)
+		low[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, to := range next[name] {
+			if _, seen := index[to]; !seen {
+				visit(to)
+				low[name] = min(low[name], low[to])
+			} else if onStack[to] {
+				low[name] = min(low[name], index[to])
+			}
+		}
+		if low[name] != index[name] {
+			return
+		}
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == name {
+				break
+			}
+		}
+		if len(component) > 1 || self[name] {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+	for _, name := range names {
+		if _, seen := index[name]; !seen {
+			visit(name)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
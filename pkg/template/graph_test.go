@@ -0,0 +1,32 @@
+package template
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIncludeCycles(t *testing.T) {
+	tests := []struct {
+		name  string
+		edges []IncludeEdge
+		want  [][]string
+	}{
+		{name: "none", edges: []IncludeEdge{{From: "stdout:1", To: "a"}, {From: "a", To: "b"}}},
+		{name: "self", edges: []IncludeEdge{{From: "tree", To: "tree"}}, want: [][]string{{"tree"}}},
+		{
+			name: "mutual and separate",
+			edges: []IncludeEdge{
+				{From: "FILE x", To: "b"}, {From: "b", To: "c"}, {From: "c", To: "a"}, {From: "a", To: "b"},
+				{From: "y", To: "z"}, {From: "z", To: "y"},
+			},
+			want: [][]string{{"a", "b", "c"}, {"y", "z"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IncludeCycles(tt.edges); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Manifest lists the files produced by a run.
+type Manifest struct {
+	ID   string    `json:"id,omitempty" yaml:"id,omitempty"`
+	Time time.Time `json:"time" yaml:"time"`
+	// Dir is the output directory the file paths are relative to, if any.
+	Dir   string         `json:"dir,omitempty" yaml:"dir,omitempty"`
+	Files []ManifestFile `json:"files" yaml:"files"`
+}
+
+// ManifestFile describes a single generated file.
+type ManifestFile struct {
+	Path   string          `json:"path" yaml:"path"`
+	Size   int             `json:"size" yaml:"size"`
+	Mode   os.FileMode     `json:"mode,omitempty" yaml:"mode,omitempty"`
+	SHA256 string          `json:"sha256" yaml:"sha256"`
+	Source *ManifestSource `json:"source,omitempty" yaml:"source,omitempty"`
+	// LinkedTo is the path of the file this file is a hard link to, see
+	// DefaultFileWriter.Dedup. Editing either of them changes both.
+	LinkedTo string `json:"linkedTo,omitempty" yaml:"linkedTo,omitempty"`
+}
+
+// ManifestSource is the template segment a file was generated from.
+type ManifestSource struct {
+	Template string `json:"template,omitempty" yaml:"template,omitempty"`
+	Line     int    `json:"line" yaml:"line"`
+	Each     string `json:"each,omitempty" yaml:"each,omitempty"`
+}
+
+// History keeps the manifest and content of every recorded run in a
+// directory, usually .simplate inside the output directory, so that the
+// outputs of a previous run can be restored:
+//
+//	<Dir>/history/<run-id>.json   manifest of each run
+//	<Dir>/objects/...             file contents (see StoreFileWriter)
+type History struct {
+	Dir string
+}
+
+// Recorder returns a FileWriter that writes through w and records every
+// written file. Call Save on it once the run is complete.
+func (h *History) Recorder(w FileWriter) *HistoryRecorder {
+	r := &HistoryRecorder{history: h}
+	r.recordingWriter = recordingWriter{FileWriter: w, record: r.record}
+	return r
+}
+
+// HistoryRecorder is a FileWriter that records the files written through it
+// for a History.
+type HistoryRecorder struct {
+	recordingWriter
+
+	history *History
+
+	mu    sync.Mutex // guards files
+	files []ManifestFile
+}
+
+// record writes the file and keeps a copy of its content in the history.
+func (r *HistoryRecorder) record(filename string, content []byte, info SegmentInfo, write func() (WriteStatus, error)) (WriteStatus, error) {
+	status, err := write()
+	if err != nil {
+		return "", err
+	}
+	store := &StoreFileWriter{Store: r.history.Dir}
+	if _, err := store.storeObject(content, info.Mode); err != nil {
+		return "", fmt.Errorf("failed to record %s in history: %w", filename, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files = append(r.files, manifestFile(filename, content, info))
+	return status, nil
+}
+
+// manifestFile describes a file written with the given content from the
+// segment described by info.
+func manifestFile(filename string, content []byte, info SegmentInfo) ManifestFile {
+	sum := sha256.Sum256(content)
+	file := ManifestFile{
+		Path:   filename,
+		Size:   len(content),
+		Mode:   info.Mode,
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+	if info.Line > 0 {
+		file.Source = &ManifestSource{Template: info.Template, Line: info.Line, Each: info.Each}
+	}
+	return file
+}
+
+// ManifestRecorder is a FileWriter that writes through the wrapped
+// FileWriter and records every written file, e.g. to describe the outputs
+// of a run in an attestation.
+type ManifestRecorder struct {
+	recordingWriter
+
+	mu    sync.Mutex // guards files
+	files []ManifestFile
+}
+
+// NewManifestRecorder returns a ManifestRecorder writing through w.
+func NewManifestRecorder(w FileWriter) *ManifestRecorder {
+	r := &ManifestRecorder{}
+	r.recordingWriter = recordingWriter{FileWriter: w, record: r.record}
+	return r
+}
+
+// record writes the file and records it, with the file it was linked to if
+// the wrapped writer is a LinkReporter. Unchanged files are recorded too.
+func (r *ManifestRecorder) record(filename string, content []byte, info SegmentInfo, write func() (WriteStatus, error)) (WriteStatus, error) {
+	status, err := write()
+	if err != nil {
+		return "", err
+	}
+	file := manifestFile(filename, content, info)
+	file.LinkedTo = linkedTo(r.FileWriter, filename)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files = append(r.files, file)
+	return status, nil
+}
+
+// Files returns the recorded files sorted by path.
+func (r *ManifestRecorder) Files() []ManifestFile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	files := append([]ManifestFile(nil), r.files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// Manifest returns a manifest of the recorded files, made at t.
+func (r *ManifestRecorder) Manifest(t time.Time) *Manifest {
+	return &Manifest{Time: t.UTC(), Files: r.Files()}
+}
+
+// Save writes the manifest of the recorded run to the history and returns
+// it. Runs that wrote no files are not recorded and Save returns nil.
+func (r *HistoryRecorder) Save() (*Manifest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.files) == 0 {
+		return nil, nil
+	}
+	dir := filepath.Join(r.history.Dir, "history")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	manifest := &Manifest{Time: time.Now().UTC(), Files: r.files}
+	base := manifest.Time.Format("20060102T150405Z")
+	manifest.ID = base
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(dir, manifest.ID+".json")); os.IsNotExist(err) {
+			break
+		}
+		manifest.ID = base + "-" + strconv.Itoa(n)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifest.ID+".json"), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// Runs returns the manifests of all recorded runs, oldest first.
+func (h *History) Runs() ([]*Manifest, error) {
+	entries, err := os.ReadDir(filepath.Join(h.Dir, "history"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	var runs []*Manifest
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		manifest, err := h.Run(id)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, manifest)
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Time.Before(runs[j].Time)
+	})
+	return runs, nil
+}
+
+// Run returns the manifest of the run with the given ID.
+func (h *History) Run(id string) (*Manifest, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid run ID %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(h.Dir, "history", id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("run %s not found in history", id)
+		}
+		return nil, fmt.Errorf("failed to read run %s: %w", id, err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode run %s: %w", id, err)
+	}
+	return &manifest, nil
+}
+
+// Rollback rewrites the files of the run with the given ID through w with
+// the content they had after that run. Files generated only by later runs
+// are left untouched.
+func (h *History) Rollback(id string, w FileWriter) (*Manifest, error) {
+	manifest, err := h.Run(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read every object first so that a damaged history fails the rollback
+	// before anything is written
+	contents := make([][]byte, len(manifest.Files))
+	for i, f := range manifest.Files {
+		if len(f.SHA256) != sha256.Size*2 {
+			return nil, fmt.Errorf("run %s: invalid checksum for %s", id, f.Path)
+		}
+		content, err := os.ReadFile(objectPath(h.Dir, f.SHA256, f.Mode))
+		if err != nil {
+			return nil, fmt.Errorf("run %s: failed to read recorded content of %s: %w", id, f.Path, err)
+		}
+		if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != f.SHA256 {
+			return nil, fmt.Errorf("run %s: recorded content of %s does not match its checksum", id, f.Path)
+		}
+		contents[i] = content
+	}
+
+	for i, f := range manifest.Files {
+		if err := w.WriteFile(f.Path, contents[i], f.Mode); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", f.Path, err)
+		}
+	}
+	return manifest, nil
+}
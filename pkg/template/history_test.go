@@ -0,0 +1,94 @@
+package template
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHistory_RecordAndRollback(t *testing.T) {
+	history := &History{Dir: t.TempDir()}
+	memWriter := &MemoryFileWriter{}
+	tmpl := []byte("#FILE:app.conf#\nversion={{.version}}\n#FILE#\n#FILE:extra-{{.version}}.conf#\nx\n#FILE#")
+
+	var ids []string
+	for _, version := range []string{"1", "2"} {
+		recorder := history.Recorder(memWriter)
+		if err := ExecuteWithFiles(AnyProvider(map[string]any{"version": version}), tmpl, io.Discard, recorder); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		manifest, err := recorder.Save()
+		if err != nil {
+			t.Fatalf("failed to save run: %v", err)
+		}
+		if len(manifest.Files) != 2 || manifest.Files[0].Path != "app.conf" || manifest.Files[0].Size != 11 {
+			t.Errorf("unexpected manifest files: %+v", manifest.Files)
+		}
+		ids = append(ids, manifest.ID)
+	}
+	if ids[0] == ids[1] {
+		t.Fatalf("expected distinct run IDs, got %v", ids)
+	}
+
+	runs, err := history.Runs()
+	if err != nil || len(runs) != 2 || runs[0].ID != ids[0] || runs[1].ID != ids[1] {
+		t.Fatalf("unexpected runs %+v (%v)", runs, err)
+	}
+
+	if _, err := history.Rollback(ids[0], memWriter); err != nil {
+		t.Fatalf("unexpected rollback error: %v", err)
+	}
+	if got := string(memWriter.Files["app.conf"]); got != "\nversion=1\n" {
+		t.Errorf("expected app.conf to be restored, got %q", got)
+	}
+	if _, exists := memWriter.Files["extra-2.conf"]; !exists {
+		t.Error("expected files of later runs to be left untouched")
+	}
+}
+
+func TestHistory_Errors(t *testing.T) {
+	history := &History{Dir: t.TempDir()}
+
+	if manifest, err := history.Recorder(&MemoryFileWriter{}).Save(); manifest != nil || err != nil {
+		t.Errorf("expected empty runs not to be recorded, got %+v (%v)", manifest, err)
+	}
+	if runs, err := history.Runs(); len(runs) != 0 || err != nil {
+		t.Errorf("expected no runs, got %+v (%v)", runs, err)
+	}
+	for _, id := range []string{"missing", "../escape", ""} {
+		if _, err := history.Rollback(id, &MemoryFileWriter{}); err == nil {
+			t.Errorf("expected error rolling back to %q", id)
+		} else if id == "missing" && !strings.Contains(err.Error(), "not found") {
+			t.Errorf("unexpected error for missing run: %v", err)
+		}
+	}
+}
+
+func TestHistory_RollbackModifiedObject(t *testing.T) {
+	history := &History{Dir: t.TempDir()}
+	recorder := history.Recorder(&MemoryFileWriter{})
+	if err := recorder.WriteFile("app.conf", []byte("version=1\n"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	manifest, err := recorder.Save()
+	if err != nil {
+		t.Fatalf("failed to save run: %v", err)
+	}
+
+	object := objectPath(history.Dir, manifest.Files[0].SHA256, manifest.Files[0].Mode)
+	if err := os.Chmod(object, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(object, []byte("tampered\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	memWriter := &MemoryFileWriter{}
+	if _, err := history.Rollback(manifest.ID, memWriter); err == nil || !strings.Contains(err.Error(), "does not match its checksum") {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+	if len(memWriter.Files) != 0 {
+		t.Errorf("expected nothing to be restored, got %v", mapKeys(memWriter.Files))
+	}
+}
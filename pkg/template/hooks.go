@@ -0,0 +1,107 @@
+package template
+
+import (
+	"context"
+	"fmt"
+)
+
+// Hooks lets applications that embed the engine add their own steps between
+// the stages of a run: load and validate the input, parse the template,
+// render the segments, then write the outputs. Nil hooks are skipped.
+//
+// Execute and ExecuteContext render the template as a whole and only call
+// AfterLoad, and RenderSegments only calls BeforeWrite; ExecuteWithFiles
+// and Engine call every hook.
+type Hooks struct {
+	// AfterLoad receives the validated input data and returns the data to
+	// render, e.g. enriched with values from another system.
+	AfterLoad func(ctx context.Context, data any) (any, error)
+	// AfterParse receives the parsed segments and returns the segments to
+	// render.
+	AfterParse func(ctx context.Context, segments []Segment) ([]Segment, error)
+	// BeforeWrite receives all rendered outputs in template order, before
+	// anything is written, and returns the outputs to write. It may change
+	// their content (e.g. to sign it), drop outputs or add files. Path
+	// collisions are checked on the returned outputs.
+	BeforeWrite func(ctx context.Context, outputs []RenderedOutput) ([]RenderedOutput, error)
+}
+
+// RenderedOutput is a rendered segment as passed to Hooks.BeforeWrite.
+type RenderedOutput struct {
+	Segment Segment    // Segment that produced the output; Type tells stdout from file output
+	Path    string     // Rendered filename, empty for stdout segments
+	Content []byte     // Rendered content
+	Skipped SkipReason // Set if the output is known not to be written
+	// SidecarOf is the path of the file output this output accompanies,
+	// e.g. its signature. A sidecar is written right after its file and
+	// skipped whenever the file is skipped; if-missing and WithNoClobber
+	// are not checked for the sidecar itself.
+	SidecarOf string
+}
+
+// WithHooks returns an Option that adds stage hooks. Hooks of several
+// WithHooks options run in the order the options are given, each receiving
+// the result of the previous one.
+func WithHooks(hooks Hooks) Option {
+	return optionFunc(func(o *options) {
+		o.hooks = append(o.hooks, hooks)
+	})
+}
+
+// afterLoad runs the AfterLoad hooks on data.
+func (o *options) afterLoad(data any) (any, error) {
+	for _, h := range o.hooks {
+		if h.AfterLoad == nil {
+			continue
+		}
+		var err error
+		if data, err = h.AfterLoad(o.ctx, data); err != nil {
+			return nil, fmt.Errorf("after load hook failed: %w", err)
+		}
+	}
+	return data, nil
+}
+
+// afterParse runs the AfterParse hooks on segments.
+func (o *options) afterParse(segments []Segment) ([]Segment, error) {
+	for _, h := range o.hooks {
+		if h.AfterParse == nil {
+			continue
+		}
+		var err error
+		if segments, err = h.AfterParse(o.ctx, segments); err != nil {
+			return nil, fmt.Errorf("after parse hook failed: %w", err)
+		}
+	}
+	return segments, nil
+}
+
+// beforeWrite runs the BeforeWrite hooks on the rendered segments.
+func (o *options) beforeWrite(rendered []renderedSegment) ([]renderedSegment, error) {
+	hasHook := false
+	for _, h := range o.hooks {
+		hasHook = hasHook || h.BeforeWrite != nil
+	}
+	if !hasHook {
+		return rendered, nil
+	}
+
+	outputs := make([]RenderedOutput, len(rendered))
+	for i, r := range rendered {
+		outputs[i] = RenderedOutput{Segment: r.segment, Path: r.filename, Content: r.content, Skipped: r.skipped, SidecarOf: r.sidecarOf}
+	}
+	for _, h := range o.hooks {
+		if h.BeforeWrite == nil {
+			continue
+		}
+		var err error
+		if outputs, err = h.BeforeWrite(o.ctx, outputs); err != nil {
+			return nil, fmt.Errorf("before write hook failed: %w", err)
+		}
+	}
+	rendered = make([]renderedSegment, len(outputs))
+	for i, out := range outputs {
+		rendered[i] = renderedSegment{segment: out.Segment, filename: out.Path, content: out.Content, skipped: out.Skipped, sidecarOf: out.SidecarOf}
+	}
+	return rendered, nil
+}
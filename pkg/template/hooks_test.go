@@ -0,0 +1,97 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWithHooks(t *testing.T) {
+	var calls []string
+	enrich := Hooks{
+		AfterLoad: func(ctx context.Context, data any) (any, error) {
+			calls = append(calls, "load")
+			m := data.(map[string]any)
+			return map[string]any{"name": m["name"], "region": "eu-west-1"}, nil
+		},
+	}
+	sign := Hooks{
+		AfterParse: func(ctx context.Context, segments []Segment) ([]Segment, error) {
+			calls = append(calls, fmt.Sprintf("parse %d", len(segments)))
+			return segments, nil
+		},
+		BeforeWrite: func(ctx context.Context, outputs []RenderedOutput) ([]RenderedOutput, error) {
+			calls = append(calls, "write")
+			var signed []RenderedOutput
+			for _, out := range outputs {
+				signed = append(signed, out)
+				if out.Segment.Type == SegmentFile {
+					sig := RenderedOutput{Segment: Segment{Type: SegmentFile, Line: out.Segment.Line}, Path: out.Path + ".sig", Content: []byte(sha256sum(string(out.Content)))}
+					signed = append(signed, sig)
+				}
+			}
+			return signed, nil
+		},
+	}
+
+	var out bytes.Buffer
+	memWriter := &MemoryFileWriter{}
+	tmpl := []byte("#FILE:app.conf#{{ .name }} in {{ .region }}#FILE#")
+	err := ExecuteWithFiles(AnyProvider(map[string]any{"name": "api"}), tmpl, &out, memWriter, WithHooks(enrich), WithHooks(sign))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(calls, ","); got != "load,parse 1,write" {
+		t.Errorf("unexpected hook calls %q", got)
+	}
+	if got := string(memWriter.Files["app.conf"]); got != "api in eu-west-1" {
+		t.Errorf("unexpected content %q", got)
+	}
+	if got := string(memWriter.Files["app.conf.sig"]); got != sha256sum("api in eu-west-1") {
+		t.Errorf("unexpected signature %q", got)
+	}
+}
+
+func TestWithHooks_Errors(t *testing.T) {
+	hookErr := errors.New("boom")
+	cases := []struct {
+		name  string
+		hooks Hooks
+		want  string
+	}{
+		{name: "after load", hooks: Hooks{AfterLoad: func(context.Context, any) (any, error) { return nil, hookErr }}, want: "after load hook failed"},
+		{name: "after parse", hooks: Hooks{AfterParse: func(context.Context, []Segment) ([]Segment, error) { return nil, hookErr }}, want: "after parse hook failed"},
+		{name: "before write", hooks: Hooks{BeforeWrite: func(context.Context, []RenderedOutput) ([]RenderedOutput, error) { return nil, hookErr }}, want: "before write hook failed"},
+		{name: "collision", hooks: Hooks{BeforeWrite: func(_ context.Context, outputs []RenderedOutput) ([]RenderedOutput, error) {
+			return append(outputs, outputs...), nil
+		}}, want: "output path collision"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			memWriter := &MemoryFileWriter{}
+			err := ExecuteWithFiles(AnyProvider(map[string]any{}), []byte("#FILE:a.txt#a#FILE#"), &bytes.Buffer{}, memWriter, WithHooks(tc.hooks))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+			if len(memWriter.Files) != 0 {
+				t.Errorf("expected nothing to be written, got %v", memWriter.Files)
+			}
+		})
+	}
+}
+
+func TestWithHooks_Execute(t *testing.T) {
+	hooks := Hooks{AfterLoad: func(ctx context.Context, data any) (any, error) {
+		return map[string]any{"greeting": "hello"}, nil
+	}}
+	var out bytes.Buffer
+	if err := Execute(AnyProvider(map[string]any{}), []byte("{{ .greeting }}"), &out, WithHooks(hooks)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "hello" {
+		t.Errorf("expected %q, got %q", "hello", out.String())
+	}
+}
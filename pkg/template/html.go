@@ -0,0 +1,84 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+)
+
+// WithHTMLEscaping returns an Option that renders template content with
+// html/template instead of text/template, so that values are escaped
+// according to their context (HTML text, attributes, URLs, JavaScript, CSS)
+// when generating HTML pages or emails. Without it, a value such as
+// <script>...</script> in the input data is copied verbatim into the page.
+//
+// Filenames of FILE directives are not escaped. include returns already
+// escaped HTML. Trusted values can bypass escaping with the safeHTML,
+// safeHTMLAttr, safeJS, safeCSS and safeURL functions, which this option
+// registers. Templates that html/template cannot escape unambiguously, e.g.
+// an action inside an unquoted attribute name, fail to render.
+func WithHTMLEscaping() Option {
+	return optionFunc(func(o *options) {
+		o.html = true
+		o.funcs["safeHTML"] = func(s string) htmltemplate.HTML { return htmltemplate.HTML(s) }
+		o.funcs["safeHTMLAttr"] = func(s string) htmltemplate.HTMLAttr { return htmltemplate.HTMLAttr(s) }
+		o.funcs["safeJS"] = func(s string) htmltemplate.JS { return htmltemplate.JS(s) }
+		o.funcs["safeCSS"] = func(s string) htmltemplate.CSS { return htmltemplate.CSS(s) }
+		o.funcs["safeURL"] = func(s string) htmltemplate.URL { return htmltemplate.URL(s) }
+	})
+}
+
+// templateExecutor is the part of text/template and html/template templates
+// used to render a parsed template.
+type templateExecutor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// parseHTML parses src as an html/template named name, with the configured
+// functions (including include), strict mode and the shared definitions
+// (see collectDefines).
+func (o *options) parseHTML(name, src string) (*htmltemplate.Template, error) {
+	tmpl := bindHTMLInclude(o.ctx, htmltemplate.New(name).Funcs(htmltemplate.FuncMap(o.funcs)))
+	if o.strict {
+		tmpl.Option("missingkey=error")
+	}
+	if _, err := tmpl.Parse(src); err != nil {
+		return nil, err
+	}
+	for name, tree := range o.defines {
+		if tmpl.Lookup(name) != nil {
+			continue
+		}
+		// Escaping rewrites the tree, which other segments share
+		if _, err := tmpl.AddParseTree(name, tree.Copy()); err != nil {
+			return nil, err
+		}
+	}
+	return tmpl, nil
+}
+
+// bindHTMLInclude adds the include function to an html/template, see
+// bindInclude. The result is escaped HTML, which is not escaped again.
+func bindHTMLInclude(ctx context.Context, tmpl *htmltemplate.Template) *htmltemplate.Template {
+	depth := 0
+	return tmpl.Funcs(htmltemplate.FuncMap{
+		"include": func(name string, data any) (htmltemplate.HTML, error) {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			if depth >= maxIncludeDepth {
+				return "", fmt.Errorf("include %q: nested too deeply (more than %d levels)", name, maxIncludeDepth)
+			}
+			depth++
+			defer func() { depth-- }()
+
+			var buf bytes.Buffer
+			if err := tmpl.ExecuteTemplate(contextWriter{ctx: ctx, w: &buf}, name, data); err != nil {
+				return "", err
+			}
+			return htmltemplate.HTML(buf.String()), nil
+		},
+	})
+}
@@ -0,0 +1,71 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWithHTMLEscaping(t *testing.T) {
+	data := map[string]any{
+		"name":  "<script>alert(1)</script>",
+		"url":   "javascript:alert(1)",
+		"title": "Tom & Jerry",
+		"page":  "a&b",
+	}
+	tmpl := []byte(`{{define "greeting"}}<b>{{.}}</b>{{end}}<p>{{.name}}</p>
+#FILE:{{.page}}.html#<a href="{{.url}}" title="{{.title}}">{{include "greeting" .title}}</a>{{safeHTML "<hr>"}}
+#FILE#`)
+	var stdout bytes.Buffer
+	writer := &MemoryFileWriter{}
+	if err := ExecuteWithFiles(AnyProvider(data), tmpl, &stdout, writer, WithHTMLEscaping()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"; stdout.String() != want {
+		t.Errorf("expected stdout %q, got %q", want, stdout.String())
+	}
+	// Filenames are not escaped
+	got, ok := writer.Files["a&b.html"]
+	if !ok {
+		t.Fatalf("expected a&b.html to be written, got %v", writer.Files)
+	}
+	if want := `<a href="#ZgotmplZ" title="Tom &amp; Jerry"><b>Tom &amp; Jerry</b></a><hr>` + "\n"; string(got) != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// Without the option, values are copied verbatim
+	stdout.Reset()
+	if err := Execute(AnyProvider(data), []byte("{{.name}}"), &stdout); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout.String() != data["name"] {
+		t.Errorf("expected verbatim output, got %q", stdout.String())
+	}
+	stdout.Reset()
+	if err := Execute(AnyProvider(data), []byte("{{.name}}"), &stdout, WithHTMLEscaping()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout.String() != "&lt;script&gt;alert(1)&lt;/script&gt;" {
+		t.Errorf("expected escaped output, got %q", stdout.String())
+	}
+}
+
+func TestWithHTMLEscaping_Errors(t *testing.T) {
+	err := ExecuteWithFiles(AnyProvider(map[string]any{"a": "x"}), []byte("ok\n<p {{if .a}}title=\"{{end}}>{{.a}}</p>"), &bytes.Buffer{}, &MemoryFileWriter{},
+		WithHTMLEscaping(), WithTemplateName("page.tmpl"))
+	var terr *TemplateError
+	if !errors.As(err, &terr) || terr.Line != 2 || !strings.Contains(err.Error(), "page.tmpl:2") {
+		t.Errorf("expected an escaping error located at page.tmpl:2, got %v", err)
+	}
+}
+
+func TestRenderSegmentPreview_HTML(t *testing.T) {
+	preview, err := RenderSegmentPreview([]byte("#FILE:{{.n}}.html#<i>{{.n}}</i>#FILE#"), 0, map[string]any{"n": "<x>"}, WithHTMLEscaping())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if preview.Filename != "<x>.html" || string(preview.Content) != "<i>&lt;x&gt;</i>" {
+		t.Errorf("unexpected preview %q %q", preview.Filename, preview.Content)
+	}
+}
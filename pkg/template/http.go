@@ -0,0 +1,193 @@
+package template
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHTTPTimeout     = 10 * time.Second
+	defaultHTTPMaxBodySize = 1 << 20 // 1 MiB
+)
+
+// HTTPConfig configures the opt-in httpGet and httpGetJSON template functions.
+type HTTPConfig struct {
+	// AllowedHosts lists the hostnames templates may fetch from. Entries of
+	// the form "*.example.com" match any subdomain of example.com. A request
+	// to a host not in the list fails.
+	AllowedHosts []string
+	// Timeout bounds each request. Defaults to 10 seconds.
+	Timeout time.Duration
+	// MaxBodySize limits the number of response bytes read. Defaults to 1 MiB.
+	MaxBodySize int64
+	// Client is used to perform requests. Defaults to a client using the
+	// default transport, which honors HTTPS_PROXY and NO_PROXY.
+	Client *http.Client
+}
+
+// WithHTTPFuncs returns an Option that registers the httpGet and httpGetJSON
+// template functions:
+//
+//	{{ httpGet "https://example.com/allowlist.txt" }}
+//	{{ range (httpGetJSON "https://example.com/keys.json").keys }}...{{ end }}
+//
+// Responses are cached for the duration of a single execution, so a URL
+// fetched inside a range loop is requested only once.
+func WithHTTPFuncs(cfg HTTPConfig) Option {
+	return optionFunc(func(o *options) {
+		f := newHTTPFetcher(cfg)
+		o.registerBlocking(map[string]any{
+			"httpGet":     f.get,
+			"httpGetJSON": f.getJSON,
+		})
+	})
+}
+
+// httpFetcher performs allowlisted GET requests and caches response bodies.
+type httpFetcher struct {
+	cfg    HTTPConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string][]byte
+}
+
+func newHTTPFetcher(cfg HTTPConfig) *httpFetcher {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultHTTPTimeout
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = defaultHTTPMaxBodySize
+	}
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &httpFetcher{cfg: cfg, client: client, cache: make(map[string][]byte)}
+}
+
+// get returns the response body of a GET request to rawURL as a string.
+func (f *httpFetcher) get(ctx context.Context, rawURL string) (string, error) {
+	body, err := f.fetch(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// getJSON fetches rawURL and decodes the response body as JSON.
+func (f *httpFetcher) getJSON(ctx context.Context, rawURL string) (any, error) {
+	body, err := f.fetch(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	var data any
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("httpGetJSON: failed to decode response from %s: %w", rawURL, err)
+	}
+	return data, nil
+}
+
+// fetch returns the (possibly cached) body of a GET request to rawURL.
+func (f *httpFetcher) fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	f.mu.Lock()
+	body, ok := f.cache[rawURL]
+	f.mu.Unlock()
+	if ok {
+		return body, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("httpGet: invalid URL %q: %w", rawURL, err)
+	}
+	if err := f.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("httpGet: invalid URL %q: %w", rawURL, err)
+	}
+	client := *f.client
+	client.Timeout = f.cfg.Timeout
+	client.CheckRedirect = f.checkRedirect
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("httpGet: request to %s failed: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("httpGet: request to %s returned status %s", rawURL, resp.Status)
+	}
+
+	body, err = io.ReadAll(io.LimitReader(resp.Body, f.cfg.MaxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("httpGet: failed to read response from %s: %w", rawURL, err)
+	}
+	if int64(len(body)) > f.cfg.MaxBodySize {
+		return nil, fmt.Errorf("httpGet: response from %s exceeds %d bytes", rawURL, f.cfg.MaxBodySize)
+	}
+
+	f.mu.Lock()
+	f.cache[rawURL] = body
+	f.mu.Unlock()
+	return body, nil
+}
+
+// checkURL returns an error unless u is an http or https URL of an allowed
+// host.
+func (f *httpFetcher) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("httpGet: unsupported URL scheme %q", u.Scheme)
+	}
+	if !hostAllowed(u.Hostname(), f.cfg.AllowedHosts) {
+		return fmt.Errorf("httpGet: host %q is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+// checkRedirect applies the allowlist to every redirect, so that an allowed
+// host cannot send requests on to hosts that are not. It then defers to the
+// CheckRedirect of the configured client, or stops after 10 redirects like
+// the default policy.
+func (f *httpFetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if err := f.checkURL(req.URL); err != nil {
+		return fmt.Errorf("redirect refused: %w", err)
+	}
+	if f.client.CheckRedirect != nil {
+		return f.client.CheckRedirect(req, via)
+	}
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
+
+// hostAllowed reports whether host matches one of the allowlist entries.
+// Entries starting with "*." match any subdomain of the remaining suffix.
+func hostAllowed(host string, allowed []string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if suffix, ok := strings.CutPrefix(entry, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == entry {
+			return true
+		}
+	}
+	return false
+}
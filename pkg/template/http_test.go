@@ -0,0 +1,161 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPFuncs_GetAndCache(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, "10.0.0.1")
+	}))
+	defer srv.Close()
+
+	tmpl := []byte(fmt.Sprintf(`{{range .items}}{{httpGet %q}};{{end}}`, srv.URL))
+	data := map[string]any{"items": []any{1, 2, 3}}
+	var out bytes.Buffer
+	err := Execute(AnyProvider(data), tmpl, &out, WithHTTPFuncs(HTTPConfig{AllowedHosts: []string{"127.0.0.1"}}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "10.0.0.1;10.0.0.1;10.0.0.1;"; out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+	if requests != 1 {
+		t.Errorf("expected 1 request with caching, got %d", requests)
+	}
+}
+
+func TestHTTPFuncs_GetJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"keys":["a","b"]}`)
+	}))
+	defer srv.Close()
+
+	tmpl := []byte(fmt.Sprintf(`{{range (httpGetJSON %q).keys}}{{.}}{{end}}`, srv.URL))
+	var out bytes.Buffer
+	err := Execute(AnyProvider(map[string]any{}), tmpl, &out, WithHTTPFuncs(HTTPConfig{AllowedHosts: []string{"127.0.0.1"}}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "ab" {
+		t.Errorf("expected %q, got %q", "ab", out.String())
+	}
+}
+
+func TestHTTPFuncs_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, strings.Repeat("x", 64))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		name    string
+		url     string
+		cfg     HTTPConfig
+		wantErr string
+	}{
+		{"host not allowed", srv.URL, HTTPConfig{AllowedHosts: []string{"example.com"}}, "not allowed"},
+		{"bad scheme", "file:///etc/passwd", HTTPConfig{AllowedHosts: []string{"127.0.0.1"}}, "unsupported URL scheme"},
+		{"bad status", srv.URL + "/missing", HTTPConfig{AllowedHosts: []string{"127.0.0.1"}}, "404"},
+		{"body too large", srv.URL, HTTPConfig{AllowedHosts: []string{"127.0.0.1"}, MaxBodySize: 8}, "exceeds"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl := []byte(fmt.Sprintf(`{{httpGet %q}}`, tc.url))
+			var out bytes.Buffer
+			err := Execute(AnyProvider(map[string]any{}), tmpl, &out, WithHTTPFuncs(tc.cfg))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestHTTPFuncs_RedirectToDisallowedHost(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "secret")
+	}))
+	defer target.Close()
+	redirectURL := strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/local" {
+			http.Redirect(w, r, target.URL, http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, redirectURL, http.StatusFound)
+	}))
+	defer srv.Close()
+
+	cfg := HTTPConfig{AllowedHosts: []string{"127.0.0.1"}}
+	var out bytes.Buffer
+	err := Execute(AnyProvider(map[string]any{}), []byte(fmt.Sprintf(`{{httpGet %q}}`, srv.URL)), &out, WithHTTPFuncs(cfg))
+	if err == nil || !strings.Contains(err.Error(), `host "localhost" is not allowed`) {
+		t.Fatalf("expected the redirect to localhost to be refused, got %v (output %q)", err, out.String())
+	}
+
+	out.Reset()
+	err = Execute(AnyProvider(map[string]any{}), []byte(fmt.Sprintf(`{{httpGet %q}}`, srv.URL+"/local")), &out, WithHTTPFuncs(cfg))
+	if err != nil {
+		t.Fatalf("expected a redirect to an allowed host to be followed, got %v", err)
+	}
+	if out.String() != "secret" {
+		t.Errorf("expected %q, got %q", "secret", out.String())
+	}
+}
+
+func TestHTTPFuncs_NotRegisteredByDefault(t *testing.T) {
+	var out bytes.Buffer
+	if err := Execute(AnyProvider(map[string]any{}), []byte(`{{httpGet "http://127.0.0.1"}}`), &out); err == nil {
+		t.Fatal("expected httpGet to be undefined without WithHTTPFuncs, got nil")
+	}
+}
+
+func TestHostAllowed(t *testing.T) {
+	allowed := []string{"example.com", "*.internal.net"}
+	cases := map[string]bool{
+		"example.com":      true,
+		"EXAMPLE.com":      true,
+		"api.example.com":  false,
+		"a.internal.net":   true,
+		"a.b.internal.net": true,
+		"internal.net":     false,
+		"evilinternal.net": false,
+		"example.com.evil": false,
+	}
+	for host, want := range cases {
+		if got := hostAllowed(host, allowed); got != want {
+			t.Errorf("hostAllowed(%q) = %v; want %v", host, got, want)
+		}
+	}
+}
+
+func TestHTTPFuncs_ContextCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	tmpl := []byte(fmt.Sprintf(`{{ httpGet %q }}`, srv.URL))
+	err := ExecuteContext(ctx, ContextProvider(AnyProvider(map[string]any{})), tmpl, &bytes.Buffer{},
+		WithHTTPFuncs(HTTPConfig{AllowedHosts: []string{"127.0.0.1"}}))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// maxIncludeDepth bounds nested include calls so that a template including
+// itself fails instead of exhausting the stack.
+const maxIncludeDepth = 100
+
+// bindInclude adds the include function to tmpl. include renders the named
+// template (defined with {{define}} or {{block}}) with data and returns the
+// result as a string, so that it can be piped into functions such as
+// nindent, unlike the {{template}} action. include stops once ctx is done,
+// so that templates that only include without writing can be aborted too.
+func bindInclude(ctx context.Context, tmpl *template.Template) *template.Template {
+	depth := 0
+	return tmpl.Funcs(template.FuncMap{
+		"include": func(name string, data any) (string, error) {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			if depth >= maxIncludeDepth {
+				return "", fmt.Errorf("include %q: nested too deeply (more than %d levels)", name, maxIncludeDepth)
+			}
+			depth++
+			defer func() { depth-- }()
+
+			var buf bytes.Buffer
+			if err := tmpl.ExecuteTemplate(contextWriter{ctx: ctx, w: &buf}, name, data); err != nil {
+				return "", err
+			}
+			return buf.String(), nil
+		},
+	})
+}
+
+// sharedTemplateName returns the name under which definitions collected by
+// collectDefines are parsed. Errors inside them carry this name and
+// absolute positions.
+func (o *options) sharedTemplateName() string {
+	return o.templateName + " (defines)"
+}
+
+// collectDefines parses every segment that defines named templates and
+// returns the definitions, so that a template defined anywhere in the file
+// can be used by include or {{template}} in any segment. The first
+// definition of a name wins; segments that fail to parse are skipped, as
+// rendering reports their errors.
+func (o *options) collectDefines(segments []Segment) map[string]*parse.Tree {
+	var defines map[string]*parse.Tree
+	for _, segment := range segments {
+		if !bytes.Contains(segment.Content, []byte("define")) && !bytes.Contains(segment.Content, []byte("block")) {
+			continue
+		}
+		// Pad the content so that positions in the parsed trees refer to
+		// the whole template file
+		start := segment.contentPos()
+		padded := strings.Repeat("\n", start.line-1) + strings.Repeat(" ", start.column-1) + string(segment.Content)
+		tmpl, err := o.newTemplate(o.sharedTemplateName()).Parse(padded)
+		if err != nil {
+			continue
+		}
+		for _, t := range tmpl.Templates() {
+			if t.Name() == tmpl.Name() || t.Tree == nil {
+				continue
+			}
+			if defines == nil {
+				defines = make(map[string]*parse.Tree)
+			}
+			if _, ok := defines[t.Name()]; !ok {
+				defines[t.Name()] = t.Tree
+			}
+		}
+	}
+	return defines
+}
+
+// addDefines makes the shared definitions available to tmpl, without
+// replacing templates tmpl defines itself.
+func (o *options) addDefines(tmpl *template.Template) error {
+	for name, tree := range o.defines {
+		if tmpl.Lookup(name) != nil {
+			continue
+		}
+		if _, err := tmpl.AddParseTree(name, tree); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestIndent(t *testing.T) {
+	cases := []struct {
+		fn     func(int, string) string
+		spaces int
+		in     string
+		want   string
+	}{
+		{fn: indent, spaces: 2, in: "a: 1\nb: 2", want: "  a: 1\n  b: 2"},
+		{fn: indent, spaces: 0, in: "a", want: "a"},
+		{fn: nindent, spaces: 4, in: "a\nb", want: "\n    a\n    b"},
+	}
+	for _, tc := range cases {
+		if got := tc.fn(tc.spaces, tc.in); got != tc.want {
+			t.Errorf("expected %q, got %q", tc.want, got)
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	tmpl := []byte(`{{- define "labels" }}app: {{ .name }}
+team: {{ .team }}{{ end -}}
+metadata:
+  labels:{{ include "labels" . | nindent 4 }}
+`)
+	var out bytes.Buffer
+	data := AnyProvider(map[string]any{"name": "api", "team": "core"})
+	if err := Execute(data, tmpl, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "metadata:\n  labels:\n    app: api\n    team: core\n"
+	if out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestInclude_Recursion(t *testing.T) {
+	tmpl := []byte(`{{ define "loop" }}{{ include "loop" . }}{{ end }}{{ include "loop" . }}`)
+	err := Execute(AnyProvider(map[string]any{}), tmpl, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+		t.Errorf("expected recursion error, got %v", err)
+	}
+}
+
+func TestExecuteWithFiles_SharedDefines(t *testing.T) {
+	tmpl := []byte(`{{- define "header" }}# generated for {{ .name }}{{ end -}}
+#FILE:a.txt#{{ include "header" . }}
+a#FILE#
+#FILE:b.txt#{{ template "header" . }}
+b#FILE#
+#FILE:c.txt#{{ define "header" }}local{{ end }}{{ template "header" . }}#FILE#`)
+	memWriter := &MemoryFileWriter{}
+	data := AnyProvider(map[string]any{"name": "api"})
+	if err := ExecuteWithFiles(data, tmpl, io.Discard, memWriter); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"a.txt": "# generated for api\na",
+		"b.txt": "# generated for api\nb",
+		"c.txt": "local",
+	}
+	for name, content := range want {
+		if got := string(memWriter.Files[name]); got != content {
+			t.Errorf("%s: expected %q, got %q", name, content, got)
+		}
+	}
+}
+
+func TestExecuteWithFiles_SharedDefineErrorLocation(t *testing.T) {
+	tmpl := []byte("intro\n  {{ define \"x\" }}{{ .a.b }}{{ end }}\n#FILE:a.txt#{{ template \"x\" . }}#FILE#")
+	err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, io.Discard, &MemoryFileWriter{}, WithStrictMode(), WithTemplateName("site.tmpl"))
+	var terr *TemplateError
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected a TemplateError, got %v", err)
+	}
+	if terr.Name != "site.tmpl" || terr.Line != 2 || terr.Column != 24 {
+		t.Errorf("expected site.tmpl:2:24, got %s:%d:%d (%v)", terr.Name, terr.Line, terr.Column, err)
+	}
+}
+
+func TestRenderSegmentPreview_Include(t *testing.T) {
+	tmpl := []byte(`{{ define "x" }}[{{ . }}]{{ end }}{{ include "x" .name | indent 2 }}`)
+	preview, err := RenderSegmentPreview(tmpl, 0, map[string]any{"name": "api"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(preview.Content) != "  [api]" {
+		t.Errorf("unexpected preview %q", preview.Content)
+	}
+}
@@ -0,0 +1,94 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// WithLintSchema returns an Option that validates the input data against an
+// additional JSON Schema whose violations are reported as warnings (see
+// WithWarnings) instead of failing the run. It lets a stricter contract be
+// introduced gradually: rules start in the lint schema and move to the
+// validation schema once existing data complies.
+func WithLintSchema(schema []byte) Option {
+	return optionFunc(func(o *options) {
+		o.lintSchemas = append(o.lintSchemas, schema)
+	})
+}
+
+// LintJsonSchema validates input against schema and returns one message per
+// violation, in the form "path: message" (see SchemaViolation). Unlike
+// WithJsonSchemaValidation, violations are not an error; the returned error
+// is only set when the schema itself cannot be compiled.
+func LintJsonSchema(input any, schema []byte) ([]string, error) {
+	violations, err := lintViolations(input, schema)
+	if err != nil {
+		return nil, err
+	}
+	var messages []string
+	for _, v := range violations {
+		messages = append(messages, v.String())
+	}
+	return messages, nil
+}
+
+// lintViolations validates input against schema and returns the violations.
+func lintViolations(input any, schema []byte) ([]SchemaViolation, error) {
+	compiled, err := jsonschema.CompileString("lint-schema.json", string(schema))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile lint JSONSchema: %w", err)
+	}
+	err = compiled.Validate(input)
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return nil, err
+	}
+	return schemaViolations(verr), nil
+}
+
+// validationKey is the key under which the lint results are added to the
+// input data.
+const validationKey = "Validation"
+
+// lint reports the violations of the lint schemas as warnings and, when
+// lint schemas are set, returns data with the violations added under
+// .Validation, so that templates can list known issues:
+//
+//	{{ range .Validation }}- {{ .Path }}: {{ .Message }}{{ end }}
+//
+// The input data is not modified. If it is not a map or already has a
+// Validation key, it is returned unchanged with a warning.
+func (o *options) lint(data any) (any, error) {
+	if len(o.lintSchemas) == 0 {
+		return data, nil
+	}
+	violations := []SchemaViolation{}
+	for _, schema := range o.lintSchemas {
+		found, err := lintViolations(data, schema)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range found {
+			o.warnf("lint: %s", v)
+		}
+		violations = append(violations, found...)
+	}
+
+	m, ok := data.(map[string]any)
+	if !ok {
+		o.warnf("lint results are not available as .%s: the input data is not a map", validationKey)
+		return data, nil
+	}
+	if _, exists := m[validationKey]; exists {
+		o.warnf("lint results are not available as .%s: the input data already has this key", validationKey)
+		return data, nil
+	}
+	withResults := make(map[string]any, len(m)+1)
+	for k, v := range m {
+		withResults[k] = v
+	}
+	withResults[validationKey] = violations
+	return withResults, nil
+}
@@ -0,0 +1,106 @@
+package template
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const lintTestSchema = `{
+	"type":"object",
+	"properties":{
+		"owner":{"type":"string","minLength":1},
+		"port":{"type":"integer","maximum":1024}
+	},
+	"required":["owner"]
+}`
+
+func TestLintJsonSchema(t *testing.T) {
+	cases := []struct {
+		name string
+		data map[string]any
+		want []string
+	}{
+		{name: "compliant", data: map[string]any{"owner": "ops", "port": 80}},
+		{name: "missing property", data: map[string]any{"port": 80}, want: []string{".: missing properties: 'owner'"}},
+		{name: "several violations", data: map[string]any{"owner": "", "port": 8080}, want: []string{".owner", ".port"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := LintJsonSchema(tc.data, []byte(lintTestSchema))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %d messages, got %v", len(tc.want), got)
+			}
+			joined := strings.Join(got, "\n")
+			for _, want := range tc.want {
+				if !strings.Contains(joined, want) {
+					t.Errorf("expected messages to contain %q, got %v", want, got)
+				}
+			}
+		})
+	}
+
+	if _, err := LintJsonSchema(map[string]any{}, []byte("{")); err == nil {
+		t.Error("expected error for invalid lint schema")
+	}
+}
+
+func TestExecute_LintSchemaWarns(t *testing.T) {
+	var out, warnings bytes.Buffer
+	data := AnyProvider(map[string]any{"port": 8080})
+	err := Execute(data, []byte("port={{.port}}"), &out, WithLintSchema([]byte(lintTestSchema)), WithWarnings(&warnings))
+	if err != nil {
+		t.Fatalf("lint violations must not fail rendering: %v", err)
+	}
+	if out.String() != "port=8080" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	for _, want := range []string{"warning: lint: .: missing properties: 'owner'", "warning: lint: .port"} {
+		if !strings.Contains(warnings.String(), want) {
+			t.Errorf("expected warnings to contain %q, got %q", want, warnings.String())
+		}
+	}
+}
+
+func TestExecute_LintResultsInData(t *testing.T) {
+	tmpl := []byte(`{{ range .Validation }}- {{ .Path }}: {{ .Message }}
+{{ else }}no issues
+{{ end }}`)
+	input := map[string]any{"owner": "ops", "port": 8080}
+	var out bytes.Buffer
+	if err := Execute(AnyProvider(input), tmpl, &out, WithLintSchema([]byte(lintTestSchema))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "- .port: ") || strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	if _, ok := input["Validation"]; ok {
+		t.Error("the input data must not be modified")
+	}
+
+	out.Reset()
+	if err := Execute(AnyProvider(map[string]any{"owner": "ops"}), tmpl, &out, WithLintSchema([]byte(lintTestSchema))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "no issues\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestExecute_LintResultsKeyTaken(t *testing.T) {
+	var out, warnings bytes.Buffer
+	data := AnyProvider(map[string]any{"owner": "ops", "Validation": "mine"})
+	err := Execute(data, []byte(`{{ .Validation }}`), &out, WithLintSchema([]byte(lintTestSchema)), WithWarnings(&warnings))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "mine" {
+		t.Errorf("expected the input value to be kept, got %q", out.String())
+	}
+	if !strings.Contains(warnings.String(), "already has this key") {
+		t.Errorf("expected a warning, got %q", warnings.String())
+	}
+}
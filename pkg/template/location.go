@@ -0,0 +1,114 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultTemplateName is the name used in error locations unless
+// WithTemplateName is set.
+const defaultTemplateName = "template"
+
+// WithTemplateName returns an Option that sets the name (typically the
+// template file path) used in TemplateError locations.
+func WithTemplateName(name string) Option {
+	return optionFunc(func(o *options) {
+		o.templateName = name
+	})
+}
+
+// TemplateError is a text/template parse or execution error located in the
+// original template file. For templates with FILE directives, positions are
+// mapped back from the segment to the whole file.
+type TemplateError struct {
+	Name   string // Template name, see WithTemplateName
+	Line   int    // 1-based line in the template file
+	Column int    // 1-based column, 0 when text/template reports none (parse errors)
+	Msg    string // Error message without its location
+	Err    error  // Original text/template error
+}
+
+func (e *TemplateError) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", e.Name, e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.Name, e.Line, e.Msg)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// position is a 1-based line and column in the template file.
+type position struct {
+	line, column int
+}
+
+// contentPos returns where the segment content starts in the template file.
+// Segments built by hand without ContentLine are assumed to start at the
+// beginning of Line.
+func (s Segment) contentPos() position {
+	if s.ContentLine == 0 {
+		return position{line: max(s.Line, 1), column: 1}
+	}
+	return position{line: s.ContentLine, column: max(s.ContentColumn, 1)}
+}
+
+// filenamePos returns where the filename template of a FILE segment starts.
+func (s Segment) filenamePos() position {
+	return position{line: max(s.Line, 1), column: max(s.FilenameColumn, 1)}
+}
+
+// errorLocation matches the location text/template and html/template put
+// after the template name in parse errors ("line: ") and execution errors
+// ("line:col: ").
+var errorLocation = regexp.MustCompile(`^(\d+)(?::(\d+))?: `)
+
+// locateError converts an error from a template named name, whose text starts
+// at start in the template file, into a TemplateError. Errors without a
+// recognizable location are returned unchanged.
+func locateError(err error, name string, start position) error {
+	msg := err.Error()
+	var rest string
+	switch {
+	case strings.HasPrefix(msg, "template: "+name+":"):
+		rest = msg[len("template: "+name+":"):]
+	case strings.HasPrefix(msg, "html/template:"+name+":"):
+		// Escaping errors of WithHTMLEscaping
+		rest = msg[len("html/template:"+name+":"):]
+	default:
+		return err
+	}
+	m := errorLocation.FindStringSubmatch(rest)
+	if m == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(m[1])
+	located := &TemplateError{Name: name, Line: start.line + line - 1, Msg: rest[len(m[0]):], Err: err}
+	if m[2] != "" {
+		// text/template columns are 0-based byte offsets within the line
+		col, _ := strconv.Atoi(m[2])
+		located.Column = col + 1
+		if line == 1 {
+			located.Column += start.column - 1
+		}
+	}
+	return located
+}
+
+// locateError is like the locateError function for errors of a segment
+// starting at start, and also locates errors inside definitions shared
+// between segments (see collectDefines), whose positions are absolute.
+func (o *options) locateError(err error, start position) error {
+	located := locateError(err, o.templateName, start)
+	if located != err {
+		return located
+	}
+	located = locateError(err, o.sharedTemplateName(), position{line: 1, column: 1})
+	if terr, ok := located.(*TemplateError); ok {
+		terr.Name = o.templateName
+	}
+	return located
+}
@@ -0,0 +1,49 @@
+package template
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestExecuteWithFiles_ErrorLocation(t *testing.T) {
+	data := AnyProvider(map[string]any{"name": "api"})
+	cases := []struct {
+		name   string
+		tmpl   string
+		line   int
+		column int
+	}{
+		{name: "stdout segment", tmpl: "header\n  {{.missing.field}}\n", line: 2, column: 13},
+		{name: "file content on directive line", tmpl: "intro\n#FILE:a.txt#{{.missing.field}}\n#FILE#", line: 2, column: 23},
+		{name: "file content after directive", tmpl: "intro\n#FILE:a.txt#\nok\n x {{.missing.field}}\n#FILE#", line: 4, column: 14},
+		{name: "filename", tmpl: "\n#FILE:out/{{.missing.field}}.txt#\nx\n#FILE#", line: 2, column: 21},
+		{name: "each filename", tmpl: "#FILE-EACH:.items:{{.missing.field}}#x#FILE#", line: 1, column: 29},
+		{name: "after file block", tmpl: "#FILE:a.txt#\nx\n#FILE# {{.missing.field}}", line: 3, column: 18},
+		{name: "parse error", tmpl: "#FILE:a.txt#\nx\n{{if .name}}\n#FILE#", line: 4},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := data
+			if strings.Contains(tc.tmpl, "FILE-EACH") {
+				input = AnyProvider(map[string]any{"items": []any{map[string]any{}}})
+			}
+			err := ExecuteWithFiles(input, []byte(tc.tmpl), io.Discard, &MemoryFileWriter{}, WithTemplateName("site.tmpl"), WithStrictMode())
+			var terr *TemplateError
+			if !errors.As(err, &terr) {
+				t.Fatalf("expected a TemplateError, got %v", err)
+			}
+			if terr.Name != "site.tmpl" || terr.Line != tc.line || terr.Column != tc.column {
+				t.Errorf("expected site.tmpl:%d:%d, got %s:%d:%d (%v)", tc.line, tc.column, terr.Name, terr.Line, terr.Column, err)
+			}
+		})
+	}
+}
+
+func TestExecute_ErrorLocation(t *testing.T) {
+	err := Execute(AnyProvider(map[string]any{}), []byte("a\nb {{.x.y}}"), io.Discard, WithStrictMode())
+	if err == nil || !strings.Contains(err.Error(), "template:2:7: ") {
+		t.Errorf("expected error located at template:2:7, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package template
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifestRecorder_Sources(t *testing.T) {
+	recorder := NewManifestRecorder(&MemoryFileWriter{})
+	tmpl := []byte("header\n#FILE:b.txt#b#FILE#\n#FILE-EACH:.items:{{.}}.txt#{{.}}#FILE#")
+	data := map[string]any{"items": []any{"a"}}
+	if err := ExecuteWithFiles(AnyProvider(data), tmpl, &bytes.Buffer{}, recorder, WithTemplateName("app.tmpl")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	manifest := recorder.Manifest(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	if len(manifest.Files) != 2 {
+		t.Fatalf("expected 2 files, got %+v", manifest.Files)
+	}
+	want := []ManifestSource{
+		{Template: "app.tmpl", Line: 3, Each: ".items"},
+		{Template: "app.tmpl", Line: 2},
+	}
+	for i, f := range manifest.Files {
+		if f.Source == nil || *f.Source != want[i] {
+			t.Errorf("%s: expected source %+v, got %+v", f.Path, want[i], f.Source)
+		}
+	}
+}
+
+func TestMarshalManifest(t *testing.T) {
+	manifest := &Manifest{
+		Time: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		Dir:  "out",
+		Files: []ManifestFile{
+			{Path: "a.txt", Size: 1, Mode: 0755, SHA256: "abc", Source: &ManifestSource{Template: "app.tmpl", Line: 4}},
+			{Path: "b.txt", Size: 2, SHA256: "def"},
+		},
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"simplate.lock", "manifest.json", "manifest.yaml", "manifest.YML"} {
+		data, err := MarshalManifest(manifest, name)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		isJSON := bytes.HasPrefix(data, []byte("{"))
+		if wantJSON := !strings.HasSuffix(strings.ToLower(name), ".yaml") && !strings.HasSuffix(strings.ToLower(name), ".yml"); isJSON != wantJSON {
+			t.Errorf("%s: expected JSON %v, got %s", name, wantJSON, data)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadManifest(path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if !got.Time.Equal(manifest.Time) {
+			t.Errorf("%s: expected time %v, got %v", name, manifest.Time, got.Time)
+		}
+		got.Time = manifest.Time
+		if !reflect.DeepEqual(got, manifest) {
+			t.Errorf("%s: expected %+v, got %+v", name, manifest, got)
+		}
+	}
+
+	if _, err := ReadManifest(filepath.Join(dir, "missing.lock")); err == nil {
+		t.Error("expected an error for a missing manifest")
+	}
+}
@@ -0,0 +1,288 @@
+package template
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is an in-memory FS with directories, permissions, hard links and
+// atomic renames, for embedders that want to inspect the result of a render
+// with the full behavior of DefaultFileWriter, e.g.
+//
+//	fsys := &MemFS{}
+//	writer := &DefaultFileWriter{FS: fsys}
+//
+// Unlike MemoryFileWriter, it sees the files written by earlier renders and
+// the temporary files and directories the writer creates. There is no umask
+// and no owner. The zero value is an empty filesystem; it is safe for
+// concurrent use.
+type MemFS struct {
+	mu    sync.Mutex // guards nodes and the nodes' content
+	nodes map[string]*memNode
+}
+
+// memNode is a file or directory of a MemFS. Hard links share a node.
+type memNode struct {
+	dir     bool
+	mode    os.FileMode // Permission bits
+	data    []byte
+	modTime time.Time
+}
+
+// memFile is an open file of a MemFS.
+type memFile struct {
+	fs     *MemFS
+	node   *memNode
+	name   string
+	flag   int
+	offset int
+}
+
+// memFileInfo describes a node of a MemFS.
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.size }
+func (fi memFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi memFileInfo) Sys() any           { return nil }
+
+// node returns the node at the cleaned path name, or nil. The root of
+// absolute and relative paths always exists. The caller holds the lock.
+func (m *MemFS) node(name string) *memNode {
+	if name == "." || name == string(filepath.Separator) {
+		return &memNode{dir: true, mode: 0755}
+	}
+	return m.nodes[name]
+}
+
+// checkParent returns an error unless the parent directory of the cleaned
+// path name exists. The caller holds the lock.
+func (m *MemFS) checkParent(op, name string) error {
+	parent := m.node(filepath.Dir(name))
+	if parent == nil {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.dir {
+		return &fs.PathError{Op: op, Path: name, Err: errors.New("not a directory")}
+	}
+	return nil
+}
+
+// OpenFile opens the file name, creating it with perm if flag contains
+// os.O_CREATE.
+func (m *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.node(name)
+	switch {
+	case n == nil && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case n == nil:
+		if err := m.checkParent("open", name); err != nil {
+			return nil, err
+		}
+		if m.nodes == nil {
+			m.nodes = make(map[string]*memNode)
+		}
+		n = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		m.nodes[name] = n
+	case flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case n.dir && flag&(os.O_WRONLY|os.O_RDWR) != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	case flag&os.O_TRUNC != 0:
+		n.data = nil
+		n.modTime = time.Now()
+	}
+	return &memFile{fs: m, node: n, name: name, flag: flag}, nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	if f.flag&os.O_WRONLY != 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrPermission}
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.offset >= len(f.node.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += n
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = len(f.node.data)
+	}
+	if end := f.offset + len(p); end > len(f.node.data) {
+		f.node.data = append(f.node.data, make([]byte, end-len(f.node.data))...)
+	}
+	copy(f.node.data[f.offset:], p)
+	f.offset += len(p)
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Close() error { return nil }
+
+// Rename moves oldpath, and its contents if it is a directory, to newpath,
+// replacing a file at newpath.
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.nodes[oldpath]
+	if n == nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	if err := m.checkParent("rename", newpath); err != nil {
+		return err
+	}
+	if target := m.node(newpath); target != nil && target.dir {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errors.New("file exists")}
+	}
+	delete(m.nodes, oldpath)
+	m.nodes[newpath] = n
+	if n.dir {
+		prefix := oldpath + string(filepath.Separator)
+		for name, child := range m.nodes {
+			if rest, ok := strings.CutPrefix(name, prefix); ok {
+				delete(m.nodes, name)
+				m.nodes[filepath.Join(newpath, rest)] = child
+			}
+		}
+	}
+	return nil
+}
+
+// Remove removes the file or empty directory name.
+func (m *MemFS) Remove(name string) error {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.nodes[name]
+	if n == nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if n.dir {
+		prefix := name + string(filepath.Separator)
+		for other := range m.nodes {
+			if strings.HasPrefix(other, prefix) {
+				return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+			}
+		}
+	}
+	delete(m.nodes, name)
+	return nil
+}
+
+// Chmod sets the permission bits of name.
+func (m *MemFS) Chmod(name string, mode os.FileMode) error {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.nodes[name]
+	if n == nil {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrNotExist}
+	}
+	n.mode = mode.Perm()
+	return nil
+}
+
+// MkdirAll creates the directory path and any missing parents with perm.
+func (m *MemFS) MkdirAll(path string, perm os.FileMode) error {
+	path = filepath.Clean(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdirAll(path, perm)
+}
+
+// mkdirAll implements MkdirAll. The caller holds the lock.
+func (m *MemFS) mkdirAll(path string, perm os.FileMode) error {
+	if n := m.node(path); n != nil {
+		if !n.dir {
+			return &fs.PathError{Op: "mkdir", Path: path, Err: errors.New("not a directory")}
+		}
+		return nil
+	}
+	if err := m.mkdirAll(filepath.Dir(path), perm); err != nil {
+		return err
+	}
+	if m.nodes == nil {
+		m.nodes = make(map[string]*memNode)
+	}
+	m.nodes[path] = &memNode{dir: true, mode: perm.Perm(), modTime: time.Now()}
+	return nil
+}
+
+// Stat describes the file or directory name.
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.node(name)
+	if n == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	mode := n.mode
+	if n.dir {
+		mode |= os.ModeDir
+	}
+	return memFileInfo{name: filepath.Base(name), size: int64(len(n.data)), mode: mode, modTime: n.modTime}, nil
+}
+
+// Lstat is the same as Stat, since a MemFS has no symbolic links.
+func (m *MemFS) Lstat(name string) (os.FileInfo, error) {
+	return m.Stat(name)
+}
+
+// Link makes newname a hard link to the file oldname: both share content
+// and permissions.
+func (m *MemFS) Link(oldname, newname string) error {
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.nodes[oldname]
+	if n == nil || n.dir {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if m.node(newname) != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	if err := m.checkParent("link", newname); err != nil {
+		return err
+	}
+	m.nodes[newname] = n
+	return nil
+}
+
+// ReadFile returns the content of the file name.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	return readFile(m, name)
+}
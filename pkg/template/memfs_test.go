@@ -0,0 +1,116 @@
+package template
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+func TestDefaultFileWriter_MemFS(t *testing.T) {
+	fsys := &MemFS{}
+	writer := &DefaultFileWriter{FS: fsys, Dedup: true}
+	if err := writer.SetBaseDir("/out"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := writer.WriteFile("conf/app.yaml", []byte("a: 1"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.WriteFile("bin/run.sh", []byte("#!/bin/sh"), 0750); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertMemFile(t, fsys, "/out/conf/app.yaml", "a: 1", 0644)
+	assertMemFile(t, fsys, "/out/bin/run.sh", "#!/bin/sh", 0750)
+	if _, err := fsys.Stat("/out/conf/app.yaml.tmp"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the temporary file to be renamed, got %v", err)
+	}
+
+	// Overwriting keeps the mode of the existing file
+	if err := fsys.Chmod("/out/conf/app.yaml", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteFile("conf/app.yaml", []byte("a: 2"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertMemFile(t, fsys, "/out/conf/app.yaml", "a: 2", 0600)
+
+	// Identical files are hard linked
+	if err := writer.WriteFile("copy.sh", []byte("#!/bin/sh"), 0750); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fsys.Chmod("/out/bin/run.sh", 0700); err != nil {
+		t.Fatal(err)
+	}
+	assertMemFile(t, fsys, "/out/copy.sh", "#!/bin/sh", 0700)
+
+	if exists, err := writer.Exists("copy.sh"); err != nil || !exists {
+		t.Errorf("expected copy.sh to exist, got %v, %v", exists, err)
+	}
+	if exists, err := writer.Exists("missing.txt"); err != nil || exists {
+		t.Errorf("expected missing.txt not to exist, got %v, %v", exists, err)
+	}
+	if err := writer.WriteFile("../escape.txt", []byte("x"), 0); err == nil {
+		t.Error("expected path traversal to be rejected")
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	fsys := &MemFS{}
+	if err := writeFile(fsys, "missing/file.txt", []byte("x"), 0644); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a missing parent error, got %v", err)
+	}
+	if err := fsys.MkdirAll("a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(fsys, "a/b/file.txt", []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.MkdirAll("a/b/file.txt/c", 0755); err == nil {
+		t.Error("expected an error creating a directory below a file")
+	}
+	if err := fsys.Remove("a/b"); err == nil {
+		t.Error("expected an error removing a non-empty directory")
+	}
+	if err := fsys.Rename("a", "z"); err != nil {
+		t.Fatal(err)
+	}
+	assertMemFile(t, fsys, "z/b/file.txt", "x", 0644)
+	if _, err := fsys.Stat("a/b"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a/b to be moved, got %v", err)
+	}
+	if err := fsys.Link("z/b/file.txt", "z/link.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Link("z/b/file.txt", "z/link.txt"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected an exists error, got %v", err)
+	}
+	if err := writeFile(fsys, "z/link.txt", []byte("changed"), 0); err != nil {
+		t.Fatal(err)
+	}
+	assertMemFile(t, fsys, "z/b/file.txt", "changed", 0644)
+	if f, err := fsys.OpenFile("z/b/file.txt", os.O_RDONLY, 0); err != nil {
+		t.Fatal(err)
+	} else if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("expected an error writing a read-only file")
+	}
+}
+
+// assertMemFile checks the content and permissions of a file in fsys.
+func assertMemFile(t *testing.T, fsys *MemFS, name, content string, perm os.FileMode) {
+	t.Helper()
+	got, err := fsys.ReadFile(name)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	if string(got) != content {
+		t.Errorf("%s: expected content %q, got %q", name, content, got)
+	}
+	info, err := fsys.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != perm {
+		t.Errorf("%s: expected mode %04o, got %04o", name, perm, info.Mode().Perm())
+	}
+}
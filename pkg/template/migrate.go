@@ -0,0 +1,224 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MigrationsKeyword is the JSON Schema keyword under which a schema declares
+// how to upgrade data written for the previous schema version. Its value is
+// a list of moves applied in order, each renaming or moving the value at the
+// dotted path "from" to the dotted path "to":
+//
+//	"x-simplate-migrations": [
+//	  {"from": "db.host", "to": "database.host"},
+//	  {"from": "name", "to": "appName"}
+//	]
+const MigrationsKeyword = "x-simplate-migrations"
+
+// migration is a single declared move.
+type migration struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// MigrateYAML upgrades YAML data written for the fromSchema JSON Schema to
+// the toSchema JSON Schema and returns the migrated YAML. The data is first
+// validated against fromSchema (skipped if fromSchema is nil), then the
+// moves declared in toSchema under MigrationsKeyword are applied, missing
+// properties with a "default" in toSchema are added, and the result is
+// validated against toSchema. Comments and key order are preserved.
+//
+// Moves whose source path does not exist are skipped; a move onto an
+// existing value fails.
+func MigrateYAML(input, fromSchema, toSchema []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(input, &doc); err != nil {
+		return nil, withKind(ErrInput, fmt.Errorf("failed to unmarshal YAML input: %w", err))
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("data must be a mapping to be migrated")
+	}
+
+	if fromSchema != nil {
+		if err := validateNode(&doc, fromSchema); err != nil {
+			return nil, fmt.Errorf("invalid source data: %w", err)
+		}
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(toSchema, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse target schema: %w", err)
+	}
+	var migrations []migration
+	if raw, ok := schema[MigrationsKeyword]; ok {
+		encoded, _ := json.Marshal(raw)
+		if err := json.Unmarshal(encoded, &migrations); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", MigrationsKeyword, err)
+		}
+	}
+
+	for _, m := range migrations {
+		if err := moveNode(root, m.From, m.To); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyDefaults(root, schema); err != nil {
+		return nil, err
+	}
+
+	if err := validateNode(&doc, toSchema); err != nil {
+		return nil, fmt.Errorf("invalid migrated data: %w", err)
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to encode migrated data: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode migrated data: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// validateNode validates the data held by doc against schema.
+func validateNode(doc *yaml.Node, schema []byte) error {
+	var data any
+	if err := doc.Decode(&data); err != nil {
+		return fmt.Errorf("failed to decode data: %w", err)
+	}
+	return WithJsonSchemaValidation(schema)(data)
+}
+
+// moveNode moves the value at the dotted path from to the dotted path to,
+// creating intermediate mappings as needed. to must not be from or lie
+// below it: such a move would not be idempotent, and the value would be
+// removed along with its old place.
+func moveNode(root *yaml.Node, from, to string) error {
+	fromPath, toPath := strings.Split(from, "."), strings.Split(to, ".")
+	if from == "" || to == "" {
+		return fmt.Errorf("invalid migration %q -> %q: both paths are required", from, to)
+	}
+	if to == from || strings.HasPrefix(to, from+".") {
+		return fmt.Errorf("invalid migration %q -> %q: cannot move a value into itself", from, to)
+	}
+
+	parent := lookupMapping(root, fromPath[:len(fromPath)-1], false)
+	if parent == nil {
+		return nil
+	}
+	idx := mappingIndex(parent, fromPath[len(fromPath)-1])
+	if idx == -1 {
+		return nil
+	}
+	key, value := parent.Content[idx], parent.Content[idx+1]
+
+	target := lookupMapping(root, toPath[:len(toPath)-1], true)
+	if target == nil {
+		return fmt.Errorf("cannot move %s to %s: %s is not a mapping", from, to, strings.Join(toPath[:len(toPath)-1], "."))
+	}
+	if mappingIndex(target, toPath[len(toPath)-1]) != -1 {
+		return fmt.Errorf("cannot move %s to %s: target already exists", from, to)
+	}
+
+	parent.Content = append(parent.Content[:idx], parent.Content[idx+2:]...)
+	key.Value = toPath[len(toPath)-1]
+	target.Content = append(target.Content, key, value)
+
+	// Drop mappings left empty by the move, e.g. db after db.host -> database.host
+	for i := len(fromPath) - 1; i > 0; i-- {
+		m := lookupMapping(root, fromPath[:i], false)
+		if m == nil || len(m.Content) > 0 {
+			break
+		}
+		grandparent := lookupMapping(root, fromPath[:i-1], false)
+		idx := mappingIndex(grandparent, fromPath[i-1])
+		grandparent.Content = append(grandparent.Content[:idx], grandparent.Content[idx+2:]...)
+	}
+	return nil
+}
+
+// lookupMapping returns the mapping node at path below root. Missing
+// mappings are created if create is set; otherwise nil is returned, as it
+// is when a path element is not a mapping.
+func lookupMapping(root *yaml.Node, path []string, create bool) *yaml.Node {
+	node := root
+	for _, key := range path {
+		idx := mappingIndex(node, key)
+		if idx == -1 {
+			if !create {
+				return nil
+			}
+			child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+			node = child
+			continue
+		}
+		node = node.Content[idx+1]
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+	}
+	return node
+}
+
+// mappingIndex returns the index of key's key node in the mapping node m,
+// or -1 if it is not present.
+func mappingIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyDefaults adds the properties of schema that are missing from the
+// mapping node m and have a default value, recursing into nested objects
+// present in m.
+func applyDefaults(m *yaml.Node, schema map[string]any) error {
+	properties, _ := schema["properties"].(map[string]any)
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := properties[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		idx := mappingIndex(m, name)
+		if idx != -1 {
+			if value := m.Content[idx+1]; value.Kind == yaml.MappingNode {
+				if err := applyDefaults(value, property); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		def, ok := property["default"]
+		if !ok {
+			continue
+		}
+		var value yaml.Node
+		if err := value.Encode(def); err != nil {
+			return fmt.Errorf("invalid default for %s: %w", name, err)
+		}
+		m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, &value)
+	}
+	return nil
+}
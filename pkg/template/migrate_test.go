@@ -0,0 +1,116 @@
+package template
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const migrateV1Schema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string"},
+		"db": {"type": "object", "properties": {"host": {"type": "string"}}}
+	},
+	"required": ["name"]
+}`
+
+const migrateV2Schema = `{
+	"type": "object",
+	"x-simplate-migrations": [
+		{"from": "name", "to": "appName"},
+		{"from": "db.host", "to": "database.host"}
+	],
+	"properties": {
+		"appName": {"type": "string"},
+		"replicas": {"type": "integer", "default": 2},
+		"database": {
+			"type": "object",
+			"properties": {
+				"host": {"type": "string"},
+				"port": {"type": "integer", "default": 5432}
+			},
+			"additionalProperties": false
+		}
+	},
+	"required": ["appName", "database"],
+	"additionalProperties": false
+}`
+
+func TestMigrateYAML(t *testing.T) {
+	input := []byte(`# application settings
+name: api # the service name
+db:
+  host: db.internal
+`)
+	out, err := MigrateYAML(input, []byte(migrateV1Schema), []byte(migrateV2Schema))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `# application settings
+appName: api # the service name
+database:
+  host: db.internal
+  port: 5432
+replicas: 2
+`
+	if string(out) != expected {
+		t.Errorf("unexpected migrated data:\n%s\nwant:\n%s", out, expected)
+	}
+
+	// Migrating already migrated data is a no-op apart from validation
+	again, err := MigrateYAML(out, nil, []byte(migrateV2Schema))
+	if err != nil || string(again) != expected {
+		t.Errorf("expected migration to be idempotent, got %q (%v)", again, err)
+	}
+}
+
+func TestMoveNode_IntoItself(t *testing.T) {
+	for _, to := range []string{"db", "db.primary"} {
+		var root yaml.Node
+		if err := yaml.Unmarshal([]byte("db:\n  host: db.internal\n"), &root); err != nil {
+			t.Fatal(err)
+		}
+		err := moveNode(root.Content[0], "db", to)
+		if err == nil || !strings.Contains(err.Error(), "cannot move a value into itself") {
+			t.Errorf("db -> %s: expected an error, got %v", to, err)
+		}
+		out, _ := yaml.Marshal(&root)
+		if string(out) != "db:\n    host: db.internal\n" {
+			t.Errorf("db -> %s: expected the data to be unchanged, got %q", to, out)
+		}
+	}
+
+	// A sibling sharing the prefix is not below from
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte("db: x\n"), &root); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveNode(root.Content[0], "db", "dbs.primary"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMigrateYAML_Errors(t *testing.T) {
+	cases := map[string]struct {
+		input   string
+		from    string
+		wantErr string
+	}{
+		"invalid source data": {"db: {}\n", migrateV1Schema, ".: missing properties: 'name'"},
+		"target exists":       {"name: api\nappName: other\ndb: {host: x}\n", "", "target already exists"},
+		"invalid result":      {"name: api\n", "", "invalid migrated data"},
+		"not a mapping":       {"- a\n", "", "must be a mapping"},
+	}
+	for name, tc := range cases {
+		var from []byte
+		if tc.from != "" {
+			from = []byte(tc.from)
+		}
+		_, err := MigrateYAML([]byte(tc.input), from, []byte(migrateV2Schema))
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", name, tc.wantErr, err)
+		}
+	}
+}
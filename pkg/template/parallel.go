@@ -0,0 +1,89 @@
+package template
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// WithParallelism returns an Option that renders segments and writes files
+// using up to n goroutines. Stdout segments are still written in template
+// order. n <= 0 uses one goroutine per CPU; the default is 1 (sequential).
+//
+// Template functions and the FileWriter are then called concurrently; the
+// built-in functions and writers of this package are safe for that.
+func WithParallelism(n int) Option {
+	return optionFunc(func(o *options) {
+		if n <= 0 {
+			n = runtime.NumCPU()
+		}
+		o.parallel = n
+	})
+}
+
+// forEach calls fn for every index in [0, n), using up to o.parallel
+// goroutines, and returns the error of the lowest failing index. Once a
+// call has failed, calls that have not started yet are skipped.
+func (o *options) forEach(n int, fn func(i int) error) error {
+	for _, err := range o.run(n, fn, true) {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachAll is like forEach but, with WithKeepGoing, calls fn for every
+// index even after failures and returns all errors as RenderErrors.
+func (o *options) forEachAll(n int, fn func(i int) error) error {
+	if !o.keepGoing {
+		return o.forEach(n, fn)
+	}
+	var failed RenderErrors
+	for _, err := range o.run(n, fn, false) {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed.err()
+}
+
+// run calls fn for every index in [0, n) using up to o.parallel goroutines
+// and returns the errors by index. With stopOnError, calls that have not
+// started yet are skipped once a call has failed.
+func (o *options) run(n int, fn func(i int) error, stopOnError bool) []error {
+	errs := make([]error, n)
+	if o.parallel <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			if errs[i] = fn(i); errs[i] != nil && stopOnError {
+				break
+			}
+		}
+		return errs
+	}
+
+	var failed atomic.Bool
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(o.parallel, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if stopOnError && failed.Load() {
+					continue
+				}
+				if err := fn(i); err != nil {
+					errs[i] = err
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,72 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithParallelism(t *testing.T) {
+	services := make([]any, 200)
+	for i := range services {
+		services[i] = map[string]any{"name": fmt.Sprintf("svc%03d", i)}
+	}
+	data := map[string]any{"services": services}
+	tmpl := []byte(`first
+#FILE-EACH:.services:{{.name}}.yaml#
+name: {{.name}}
+#FILE#
+{{ range .services }}{{ .name }} {{ end }}
+#FILE:index.txt#
+{{ len .services }}
+#FILE#
+last`)
+
+	render := func(opts ...Option) (string, *MemoryFileWriter, *RenderReport) {
+		segments, err := ParseSegments(tmpl)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var stdout bytes.Buffer
+		memWriter := &MemoryFileWriter{}
+		report, err := RenderSegments(segments, data, memWriter, &stdout, opts...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return stdout.String(), memWriter, report
+	}
+
+	seqStdout, seqFiles, seqReport := render()
+	parStdout, parFiles, parReport := render(WithParallelism(8))
+
+	if parStdout != seqStdout {
+		t.Errorf("stdout differs:\nsequential %q\nparallel   %q", seqStdout, parStdout)
+	}
+	if len(parFiles.Files) != 201 || !reflect.DeepEqual(parFiles.Files, seqFiles.Files) {
+		t.Errorf("files differ: %d parallel, %d sequential", len(parFiles.Files), len(seqFiles.Files))
+	}
+	if !reflect.DeepEqual(parReport, seqReport) {
+		t.Error("expected the report to keep template order")
+	}
+}
+
+func TestWithParallelism_Error(t *testing.T) {
+	o := newOptions(context.Background(), []Option{WithParallelism(4)})
+	var calls atomic.Int32
+	err := o.forEach(1000, func(i int) error {
+		calls.Add(1)
+		if i == 10 {
+			return fmt.Errorf("failed %d", i)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "failed 10" {
+		t.Errorf("expected the failing call's error, got %v", err)
+	}
+	if calls.Load() >= 1000 {
+		t.Error("expected calls after the failure to be skipped")
+	}
+}
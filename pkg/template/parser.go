@@ -3,7 +3,7 @@ package template
 import (
 	"bytes"
 	"fmt"
-	"strings"
+	"os"
 )
 
 // SegmentType represents the type of template segment.
@@ -14,146 +14,378 @@ const (
 	SegmentStdout SegmentType = iota
 	// SegmentFile indicates content that should be written to a file.
 	SegmentFile
+	// SegmentDir indicates a directory that must exist in the output. It
+	// has a Filename and Mode but no Content.
+	SegmentDir
 )
 
 // Segment represents a portion of a template that is either directed to stdout
-// or to a specific file.
+// or to a specific file, or a directory to create.
 type Segment struct {
 	Type     SegmentType
-	Content  []byte // Raw template content to be rendered
-	Filename []byte // Template expression for filename (FILE segments only)
+	Content  []byte      // Raw template content to be rendered
+	Filename []byte      // Template expression for filename (FILE and DIR segments only)
+	Mode     os.FileMode // Requested permissions, 0 for the writer default (FILE and DIR segments only)
+	Line     int         // 1-based line in the template where the segment (or its directive) starts
+	Each     []byte      // Data path of the list to iterate, e.g. ".services" (FILE-EACH segments only)
+
+	// Positions used to report template errors relative to the whole file
+	ContentLine    int // 1-based line where Content starts
+	ContentColumn  int // 1-based column where Content starts
+	FilenameColumn int // 1-based column in Line where Filename starts (FILE and DIR segments only)
+
+	IfMissing bool // Leave the file untouched if it already exists (FILE segments only)
+	SkipEmpty bool // Do not create the file if it renders to whitespace only (FILE segments only)
+
+	// Whitespace clean-up of the rendered content (FILE segments only)
+	EnsureTrailingNewline   bool // End non-empty content with a newline
+	StripTrailingWhitespace bool // Remove spaces and tabs at the end of every line
+	StripBOM                bool // Remove a leading UTF-8 byte order mark
 }
 
 const (
 	fileOpenPrefix = "#FILE:"
+	fileEachPrefix = "#FILE-EACH:"
 	fileOpenSuffix = "#"
 	fileClose      = "#FILE#"
+	dirPrefix      = "#DIR:"
+)
+
+// Attributes that may follow the filename in a FILE directive, separated by
+// whitespace, e.g. #FILE:config.yml if-missing#.
+const (
+	attrIfMissing               = "if-missing"
+	attrSkipEmpty               = "skip-empty"
+	attrEnsureTrailingNewline   = "ensure-trailing-newline"
+	attrStripTrailingWhitespace = "strip-trailing-whitespace"
+	attrStripBOM                = "strip-bom"
+)
+
+// fileAttribute is the flag of a FILE directive attribute.
+type fileAttribute uint8
+
+const (
+	fileIfMissing fileAttribute = 1 << iota
+	fileSkipEmpty
+	fileEnsureTrailingNewline
+	fileStripTrailingWhitespace
+	fileStripBOM
 )
 
+// fileAttributes maps the recognized FILE directive attributes to their flag.
+var fileAttributes = map[string]fileAttribute{
+	attrIfMissing:               fileIfMissing,
+	attrSkipEmpty:               fileSkipEmpty,
+	attrEnsureTrailingNewline:   fileEnsureTrailingNewline,
+	attrStripTrailingWhitespace: fileStripTrailingWhitespace,
+	attrStripBOM:                fileStripBOM,
+}
+
 // ParseSegments parses a template into segments based on FILE directive markers.
 // It identifies #FILE:filename# ... #FILE# blocks and separates them from
-// content that should go to stdout.
+// content that should go to stdout. A filename may end with an octal mode,
+// as in #FILE:bin/run.sh:0755#, to request permissions for the file, and
+// may be followed by whitespace-separated attributes:
+//   - if-missing: do not overwrite the file if it already exists
+//   - skip-empty: do not create the file if it renders to whitespace only
+//   - ensure-trailing-newline: end the rendered content with a newline
+//   - strip-trailing-whitespace: remove spaces and tabs at the end of lines
+//   - strip-bom: remove a leading UTF-8 byte order mark
+//
+// A #FILE-EACH:.list:filename# ... #FILE# block is a FILE segment rendered
+// once per element of the list found at the given data path, with the
+// element as dot, e.g. #FILE-EACH:.services:deploy/{{.name}}.yaml#.
+//
+// A #DIR:path# directive, which has no body and may appear anywhere outside
+// FILE blocks, is a DIR segment declaring a directory that must exist in the
+// output, e.g. #DIR:var/log/{{.name}}# or #DIR:plugins:0750#. Its path is
+// rendered like a filename, and a line ending right after the directive is
+// dropped.
+//
+// The template is scanned once. The Content, Filename and Each fields of the
+// returned segments are sub-slices of templateBytes, capped so that appending
+// to them copies, and must not be modified in place.
 //
-// Returns a slice of Segment objects representing the parsed template, or an
-// error if the template contains malformed FILE directives.
+// Returns a slice of Segment objects representing the parsed template, or a
+// *TemplateError locating the malformed FILE directive.
 //
 // Error conditions:
 //   - Unclosed FILE directive (missing closing #FILE#)
 //   - Nested FILE directives (FILE directive inside another FILE directive)
-//   - Empty filename in FILE directive
+//   - DIR directive inside a FILE block
+//   - Empty filename in FILE directive or empty path in DIR directive
 func ParseSegments(templateBytes []byte) ([]Segment, error) {
 	if len(templateBytes) == 0 {
-		return []Segment{{Type: SegmentStdout, Content: []byte{}}}, nil
+		return []Segment{{Type: SegmentStdout, Content: []byte{}, Line: 1, ContentLine: 1, ContentColumn: 1}}, nil
 	}
 
+	s := &scanner{src: templateBytes, line: 1}
 	var segments []Segment
-	template := string(templateBytes)
-	pos := 0
 	inFileBlock := false
-	fileBlockStart := 0
+	var fileBlockStart position
 
-	for pos < len(template) {
-		// Look for FILE directive markers
-		openIdx := strings.Index(template[pos:], fileOpenPrefix)
-		closeIdx := strings.Index(template[pos:], fileClose)
+	// Start of the content not yet assigned to a segment
+	textStart, textPos := 0, s.position()
 
-		// No more directives found
-		if openIdx == -1 && closeIdx == -1 {
-			if inFileBlock {
-				return nil, fmt.Errorf("unclosed FILE directive starting at position %d", fileBlockStart)
-			}
-			// Add remaining content as stdout segment
-			if pos < len(template) {
-				segments = append(segments, Segment{
-					Type:    SegmentStdout,
-					Content: []byte(template[pos:]),
-				})
-			}
+	for {
+		// Directives start with #, so jump from one # to the next
+		idx := bytes.IndexByte(templateBytes[s.pos:], '#')
+		if idx == -1 {
 			break
 		}
+		s.advance(s.pos + idx)
+		rest := templateBytes[s.pos:]
 
-		if !inFileBlock {
-			// We're looking for an opening directive
-			if closeIdx != -1 && (openIdx == -1 || closeIdx < openIdx) {
-				return nil, fmt.Errorf("unexpected FILE closing marker at position %d", pos+closeIdx)
+		switch {
+		case hasPrefix(rest, fileClose):
+			if !inFileBlock {
+				return nil, s.errorf(s.position(), "unexpected FILE closing marker")
 			}
+			segments[len(segments)-1].Content = templateBytes[textStart:s.pos:s.pos]
+			inFileBlock = false
+			s.advance(s.pos + len(fileClose))
+			textStart, textPos = s.pos, s.position()
 
-			if openIdx != -1 {
-				// Found opening directive
-				// Add any content before this as stdout segment
-				if openIdx > 0 {
-					segments = append(segments, Segment{
-						Type:    SegmentStdout,
-						Content: []byte(template[pos : pos+openIdx]),
-					})
-				}
-
-				// Find the end of the opening marker (the second #)
-				openStart := pos + openIdx
-				filenameStart := openStart + len(fileOpenPrefix)
-				filenameEnd := strings.Index(template[filenameStart:], fileOpenSuffix)
-
-				if filenameEnd == -1 {
-					return nil, fmt.Errorf("malformed FILE directive at position %d: missing closing # in filename", openStart)
-				}
-
-				filename := template[filenameStart : filenameStart+filenameEnd]
-				if strings.TrimSpace(filename) == "" {
-					return nil, fmt.Errorf("empty filename in FILE directive at position %d", openStart)
-				}
-
-				// Check for nested FILE directive in filename
-				if strings.Contains(filename, fileOpenPrefix) {
-					return nil, fmt.Errorf("nested FILE directive not allowed at position %d", openStart)
-				}
-
-				fileBlockStart = openStart
-				inFileBlock = true
-				pos = filenameStart + filenameEnd + len(fileOpenSuffix)
-
-				// Store filename for later when we find the closing marker
-				segments = append(segments, Segment{
-					Type:     SegmentFile,
-					Filename: []byte(filename),
-					Content:  nil, // Will be filled when we find the closing marker
-				})
+		case hasPrefix(rest, fileOpenPrefix) || hasPrefix(rest, fileEachPrefix):
+			if inFileBlock {
+				return nil, s.errorf(s.position(), "nested FILE directive not allowed")
 			}
-		} else {
-			// We're inside a FILE block, looking for closing directive
-			if openIdx != -1 && (closeIdx == -1 || openIdx < closeIdx) {
-				return nil, fmt.Errorf("nested FILE directive not allowed at position %d", pos+openIdx)
+			// Add any content before this as stdout segment
+			if s.pos > textStart {
+				segments = append(segments, stdoutSegment(templateBytes[textStart:s.pos:s.pos], textPos))
 			}
+			fileBlockStart = s.position()
+			segment, err := s.directive()
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, segment)
+			inFileBlock = true
+			textStart, textPos = s.pos, s.position()
 
-			if closeIdx != -1 {
-				// Found closing directive
-				// Extract content between opening and closing
-				content := template[pos : pos+closeIdx]
-				segments[len(segments)-1].Content = []byte(content)
-
-				inFileBlock = false
-				pos = pos + closeIdx + len(fileClose)
-			} else {
-				return nil, fmt.Errorf("unclosed FILE directive starting at position %d", fileBlockStart)
+		case hasPrefix(rest, dirPrefix):
+			if inFileBlock {
+				return nil, s.errorf(s.position(), "DIR directive not allowed inside a FILE block")
+			}
+			if s.pos > textStart {
+				segments = append(segments, stdoutSegment(templateBytes[textStart:s.pos:s.pos], textPos))
+			}
+			segment, err := s.dirDirective()
+			if err != nil {
+				return nil, err
 			}
+			segments = append(segments, segment)
+			textStart, textPos = s.pos, s.position()
+
+		default:
+			s.advance(s.pos + 1)
 		}
 	}
 
 	if inFileBlock {
-		return nil, fmt.Errorf("unclosed FILE directive starting at position %d", fileBlockStart)
+		return nil, s.errorf(fileBlockStart, "unclosed FILE directive")
 	}
-
-	// If no segments were created, return a single stdout segment with all content
-	if len(segments) == 0 {
-		return []Segment{{Type: SegmentStdout, Content: templateBytes}}, nil
+	// Add remaining content as stdout segment
+	if textStart < len(templateBytes) {
+		segments = append(segments, stdoutSegment(templateBytes[textStart:len(templateBytes):len(templateBytes)], textPos))
 	}
 
 	// Filter out empty stdout segments at the beginning and end
 	return filterEmptyEdgeSegments(segments), nil
 }
 
+// scanner reads a template in a single pass, tracking the line and column
+// of its current offset.
+type scanner struct {
+	src       []byte
+	pos       int // Current byte offset in src
+	line      int // 1-based line of pos
+	lineStart int // Offset of the first byte of line
+}
+
+// position returns the line and column of the current offset.
+func (s *scanner) position() position {
+	return position{line: s.line, column: s.pos - s.lineStart + 1}
+}
+
+// advance moves the scanner forward to offset, counting the lines it passes.
+func (s *scanner) advance(offset int) {
+	skipped := s.src[s.pos:offset]
+	if n := bytes.Count(skipped, newline); n > 0 {
+		s.line += n
+		s.lineStart = s.pos + bytes.LastIndexByte(skipped, '\n') + 1
+	}
+	s.pos = offset
+}
+
+// errorf returns a TemplateError for a malformed directive at pos.
+func (s *scanner) errorf(pos position, format string, args ...any) error {
+	return &TemplateError{Name: defaultTemplateName, Line: pos.line, Column: pos.column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// directive parses the FILE or FILE-EACH opening marker at the current
+// offset, moves past it and returns the FILE segment it starts, without
+// Content.
+func (s *scanner) directive() (Segment, error) {
+	start := s.position()
+	prefix := fileOpenPrefix
+	if hasPrefix(s.src[s.pos:], fileEachPrefix) {
+		prefix = fileEachPrefix
+	}
+
+	// Find the end of the opening marker (the second #)
+	specStart := s.pos + len(prefix)
+	specLen := bytes.IndexByte(s.src[specStart:], fileOpenSuffix[0])
+	if specLen == -1 {
+		return Segment{}, s.errorf(start, "malformed FILE directive: missing closing # in filename")
+	}
+	markerEnd := specStart + specLen + len(fileOpenSuffix)
+	spec := s.src[specStart : specStart+specLen]
+
+	var each []byte
+	if prefix == fileEachPrefix {
+		idx := bytes.IndexByte(spec, ':')
+		if idx != -1 {
+			each = bytes.TrimSpace(spec[:idx])
+		}
+		if len(each) == 0 {
+			return Segment{}, s.errorf(start, "malformed FILE-EACH directive: expected #FILE-EACH:.list:filename#")
+		}
+		spec = spec[idx+1:]
+		specStart += idx + 1
+	}
+
+	filename, attrs := splitFileAttributes(spec)
+	filename, mode := splitFileMode(filename)
+	if len(bytes.TrimSpace(filename)) == 0 {
+		return Segment{}, s.errorf(start, "empty filename in FILE directive")
+	}
+
+	s.advance(specStart)
+	filenameColumn := s.position().column
+	s.advance(markerEnd)
+	content := s.position()
+	return Segment{
+		Type:     SegmentFile,
+		Filename: filename[:len(filename):len(filename)],
+		Mode:     mode,
+		Line:     start.line,
+		Each:     each[:len(each):len(each)],
+
+		ContentLine:    content.line,
+		ContentColumn:  content.column,
+		FilenameColumn: filenameColumn,
+
+		IfMissing: attrs&fileIfMissing != 0,
+		SkipEmpty: attrs&fileSkipEmpty != 0,
+
+		EnsureTrailingNewline:   attrs&fileEnsureTrailingNewline != 0,
+		StripTrailingWhitespace: attrs&fileStripTrailingWhitespace != 0,
+		StripBOM:                attrs&fileStripBOM != 0,
+	}, nil
+}
+
+// dirDirective parses the DIR directive at the current offset, moves past
+// it and the line ending following it, and returns its DIR segment.
+func (s *scanner) dirDirective() (Segment, error) {
+	start := s.position()
+	specStart := s.pos + len(dirPrefix)
+	specLen := bytes.IndexByte(s.src[specStart:], fileOpenSuffix[0])
+	if specLen == -1 {
+		return Segment{}, s.errorf(start, "malformed DIR directive: missing closing # in path")
+	}
+	path, mode := splitFileMode(s.src[specStart : specStart+specLen])
+	if len(bytes.TrimSpace(path)) == 0 {
+		return Segment{}, s.errorf(start, "empty path in DIR directive")
+	}
+
+	s.advance(specStart)
+	pathColumn := s.position().column
+	markerEnd := specStart + specLen + len(fileOpenSuffix)
+	s.advance(markerEnd)
+	end := s.position()
+
+	// A DIR directive on its own line leaves no blank line in stdout
+	if rest := s.src[markerEnd:]; hasPrefix(rest, "\n") {
+		s.advance(markerEnd + 1)
+	} else if hasPrefix(rest, "\r\n") {
+		s.advance(markerEnd + 2)
+	}
+	return Segment{
+		Type:     SegmentDir,
+		Filename: path[:len(path):len(path)],
+		Mode:     mode,
+		Line:     start.line,
+
+		ContentLine:    end.line,
+		ContentColumn:  end.column,
+		FilenameColumn: pathColumn,
+	}, nil
+}
+
+// newline is the line separator counted by scanner.advance.
+var newline = []byte{'\n'}
+
+// hasPrefix reports whether b begins with prefix, without allocating.
+func hasPrefix(b []byte, prefix string) bool {
+	return len(b) >= len(prefix) && string(b[:len(prefix)]) == prefix
+}
+
+// stdoutSegment returns a stdout segment with content starting at pos.
+func stdoutSegment(content []byte, pos position) Segment {
+	return Segment{
+		Type:    SegmentStdout,
+		Content: content,
+		Line:    pos.line,
+
+		ContentLine:   pos.line,
+		ContentColumn: pos.column,
+	}
+}
+
+// splitFileMode removes an octal permission suffix such as ":0755" from
+// the end of a FILE directive's filename and returns the remaining filename
+// together with the mode, or 0 if there is no suffix.
+func splitFileMode(filename []byte) ([]byte, os.FileMode) {
+	idx := bytes.LastIndexByte(filename, ':')
+	digits := filename[idx+1:]
+	if idx == -1 || len(digits) < 3 || len(digits) > 4 {
+		return filename, 0
+	}
+	var mode os.FileMode
+	for _, d := range digits {
+		if d < '0' || d > '7' {
+			return filename, 0
+		}
+		mode = mode<<3 | os.FileMode(d-'0')
+	}
+	return filename[:idx], mode
+}
+
+// splitFileAttributes removes recognized attributes from the end of a FILE
+// directive's filename specification and returns the remaining filename
+// together with the flags of the attributes found. Trailing words that are
+// not attributes are kept as part of the filename.
+func splitFileAttributes(spec []byte) ([]byte, fileAttribute) {
+	var attrs fileAttribute
+	for {
+		trimmed := bytes.TrimRight(spec, " \t")
+		idx := bytes.LastIndexAny(trimmed, " \t")
+		if idx == -1 {
+			return spec, attrs
+		}
+		attr, ok := fileAttributes[string(trimmed[idx+1:])]
+		if !ok {
+			return spec, attrs
+		}
+		attrs |= attr
+		spec = bytes.TrimRight(trimmed[:idx], " \t")
+	}
+}
+
 // filterEmptyEdgeSegments removes empty stdout segments from the beginning
 // and end of the segments slice, but preserves empty segments in the middle
-// and all FILE segments (even if empty).
+// and all FILE and DIR segments (even if empty).
 func filterEmptyEdgeSegments(segments []Segment) []Segment {
 	if len(segments) == 0 {
 		return segments
@@ -162,19 +394,19 @@ func filterEmptyEdgeSegments(segments []Segment) []Segment {
 	start := 0
 	end := len(segments)
 
-	// Find first non-empty segment or first FILE segment
+	// Find first non-empty segment or first FILE or DIR segment
 	for start < len(segments) {
 		seg := segments[start]
-		if seg.Type == SegmentFile || len(bytes.TrimSpace(seg.Content)) > 0 {
+		if seg.Type != SegmentStdout || len(bytes.TrimSpace(seg.Content)) > 0 {
 			break
 		}
 		start++
 	}
 
-	// Find last non-empty segment or last FILE segment
+	// Find last non-empty segment or last FILE or DIR segment
 	for end > start {
 		seg := segments[end-1]
-		if seg.Type == SegmentFile || len(bytes.TrimSpace(seg.Content)) > 0 {
+		if seg.Type != SegmentStdout || len(bytes.TrimSpace(seg.Content)) > 0 {
 			break
 		}
 		end--
@@ -182,7 +414,7 @@ func filterEmptyEdgeSegments(segments []Segment) []Segment {
 
 	if start >= end {
 		// All segments were empty stdout segments
-		return []Segment{{Type: SegmentStdout, Content: []byte{}}}
+		return []Segment{{Type: SegmentStdout, Content: []byte{}, Line: 1, ContentLine: 1, ContentColumn: 1}}
 	}
 
 	return segments[start:end]
@@ -1,7 +1,13 @@
 package template
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -293,3 +299,281 @@ func containsAny(s, substr string) bool {
 	}
 	return false
 }
+
+func TestParseSegments_FileMode(t *testing.T) {
+	cases := []struct {
+		directive string
+		filename  string
+		mode      os.FileMode
+	}{
+		{"#FILE:bin/run.sh:0755#", "bin/run.sh", 0755},
+		{"#FILE:secret.key:600#", "secret.key", 0600},
+		{"#FILE:{{.name}}.sh:0700#", "{{.name}}.sh", 0700},
+		{"#FILE:plain.txt#", "plain.txt", 0},
+		{"#FILE:c:\\dir\\file.txt#", "c:\\dir\\file.txt", 0},
+		{"#FILE:port:8080#", "port:8080", 0}, // 8 is not an octal digit
+	}
+	for _, tc := range cases {
+		segments, err := ParseSegments([]byte(tc.directive + "\ncontent\n#FILE#"))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.directive, err)
+		}
+		if string(segments[0].Filename) != tc.filename {
+			t.Errorf("%s: expected filename %q, got %q", tc.directive, tc.filename, segments[0].Filename)
+		}
+		if segments[0].Mode != tc.mode {
+			t.Errorf("%s: expected mode %04o, got %04o", tc.directive, tc.mode, segments[0].Mode)
+		}
+	}
+}
+
+func TestParseSegments_Dir(t *testing.T) {
+	segments, err := ParseSegments([]byte("Header\n#DIR:logs#\n#DIR:{{.name}}/plugins:0750#\n#FILE:a.txt#\nx\n#FILE#"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(segments) != 4 {
+		t.Fatalf("expected 4 segments, got %d", len(segments))
+	}
+	cases := []struct {
+		filename string
+		mode     os.FileMode
+		line     int
+	}{
+		{"logs", 0, 2},
+		{"{{.name}}/plugins", 0750, 3},
+	}
+	for i, tc := range cases {
+		segment := segments[i+1]
+		if segment.Type != SegmentDir || string(segment.Filename) != tc.filename || segment.Mode != tc.mode || segment.Line != tc.line {
+			t.Errorf("segment %d: expected DIR %q mode %04o at line %d, got %+v", i+1, tc.filename, tc.mode, tc.line, segment)
+		}
+		if segment.Content != nil {
+			t.Errorf("segment %d: expected no content, got %q", i+1, segment.Content)
+		}
+	}
+}
+
+func TestParseSegments_FileModeWithoutFilename(t *testing.T) {
+	if _, err := ParseSegments([]byte("#FILE::0755#\ncontent\n#FILE#")); err == nil {
+		t.Fatal("expected error for mode without filename, got nil")
+	}
+}
+
+func TestParseSegments_Lines(t *testing.T) {
+	template := []byte("line 1\nline 2\n#FILE:a.txt#\nA\n#FILE#\nline 6\n#FILE:b.txt#\nB\n#FILE#")
+	segments, err := ParseSegments(template)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []int{1, 3, 5, 7}
+	if len(segments) != len(want) {
+		t.Fatalf("expected %d segments, got %d", len(want), len(segments))
+	}
+	for i, line := range want {
+		if segments[i].Line != line {
+			t.Errorf("segment %d: expected line %d, got %d", i, line, segments[i].Line)
+		}
+	}
+}
+
+func TestParseSegments_Attributes(t *testing.T) {
+	cases := []struct {
+		directive string
+		filename  string
+		mode      os.FileMode
+		ifMissing bool
+		skipEmpty bool
+	}{
+		{"#FILE:config.yml if-missing#", "config.yml", 0, true, false},
+		{"#FILE:bin/run.sh:0755 if-missing#", "bin/run.sh", 0755, true, false},
+		{"#FILE:{{ .name }}.yml  if-missing #", "{{ .name }}.yml", 0, true, false},
+		{"#FILE:{{ .name }}.yml#", "{{ .name }}.yml", 0, false, false},
+		{"#FILE:my notes.txt#", "my notes.txt", 0, false, false},
+		{"#FILE:optional.yml skip-empty#", "optional.yml", 0, false, true},
+		{"#FILE:a.yml skip-empty if-missing#", "a.yml", 0, true, true},
+	}
+	for _, tc := range cases {
+		segments, err := ParseSegments([]byte(tc.directive + "\ncontent\n#FILE#"))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.directive, err)
+		}
+		seg := segments[0]
+		if string(seg.Filename) != tc.filename || seg.Mode != tc.mode || seg.IfMissing != tc.ifMissing || seg.SkipEmpty != tc.skipEmpty {
+			t.Errorf("%s: got filename %q mode %04o if-missing %v skip-empty %v", tc.directive, seg.Filename, seg.Mode, seg.IfMissing, seg.SkipEmpty)
+		}
+	}
+}
+
+func TestParseSegments_FileEach(t *testing.T) {
+	tmpl := "header\n#FILE-EACH:.services:deploy/{{.name}}.yaml:0600 skip-empty#\nname: {{.name}}\n#FILE#\n#FILE:plain.txt#\nx\n#FILE#"
+	segments, err := ParseSegments([]byte(tmpl))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(segments) != 4 {
+		t.Fatalf("expected 4 segments, got %d", len(segments))
+	}
+	seg := segments[1]
+	if seg.Type != SegmentFile || string(seg.Each) != ".services" || string(seg.Filename) != "deploy/{{.name}}.yaml" {
+		t.Errorf("unexpected FILE-EACH segment: each %q filename %q", seg.Each, seg.Filename)
+	}
+	if seg.Mode != 0600 || !seg.SkipEmpty || seg.Line != 2 {
+		t.Errorf("unexpected FILE-EACH mode %04o skip-empty %v line %d", seg.Mode, seg.SkipEmpty, seg.Line)
+	}
+	if segments[3].Each != nil {
+		t.Errorf("expected no list path on plain FILE segment, got %q", segments[3].Each)
+	}
+}
+
+func TestParseSegments_FileEachErrors(t *testing.T) {
+	cases := []string{
+		"#FILE-EACH:deploy.yaml#\nx\n#FILE#",
+		"#FILE-EACH::deploy.yaml#\nx\n#FILE#",
+		"#FILE-EACH:.services:#\nx\n#FILE#",
+		"#FILE-EACH:.services:a.yaml#\n#FILE:b.yaml#\n#FILE#",
+	}
+	for _, tmpl := range cases {
+		if _, err := ParseSegments([]byte(tmpl)); err == nil {
+			t.Errorf("expected error for %q", tmpl)
+		}
+	}
+}
+
+func TestParseSegments_ErrorPositions(t *testing.T) {
+	cases := []struct {
+		template string
+		line     int
+		column   int
+		msg      string
+	}{
+		{"a\n  #FILE:x.txt#\nbody", 2, 3, "unclosed FILE directive"},
+		{"a\nb #FILE#", 2, 3, "unexpected FILE closing marker"},
+		{"#FILE:a.txt#\n\t#FILE:b.txt#\n#FILE#", 2, 2, "nested FILE directive not allowed"},
+		{"x\n#FILE: :0644#\n#FILE#", 2, 1, "empty filename in FILE directive"},
+		{"#FILE-EACH:a.txt#\n#FILE#", 1, 1, "malformed FILE-EACH directive"},
+		{"x #FILE:a.txt", 1, 3, "malformed FILE directive"},
+		{"#FILE:a.txt#\n#DIR:logs#\n#FILE#", 2, 1, "DIR directive not allowed inside a FILE block"},
+		{"x\n #DIR:logs", 2, 2, "malformed DIR directive"},
+		{"#DIR::0755#", 1, 1, "empty path in DIR directive"},
+	}
+	for _, tc := range cases {
+		_, err := ParseSegments([]byte(tc.template))
+		var terr *TemplateError
+		if !errors.As(err, &terr) {
+			t.Fatalf("%q: expected a TemplateError, got %v", tc.template, err)
+		}
+		if terr.Line != tc.line || terr.Column != tc.column || !strings.HasPrefix(terr.Msg, tc.msg) {
+			t.Errorf("%q: expected %d:%d: %s, got %v", tc.template, tc.line, tc.column, tc.msg, err)
+		}
+	}
+
+	err := ExecuteWithFiles(AnyProvider(map[string]any{}), []byte("x\n#FILE:a.txt#"), io.Discard, &MemoryFileWriter{}, WithTemplateName("site.tmpl"))
+	if err == nil || !strings.Contains(err.Error(), "site.tmpl:2:1: unclosed FILE directive") {
+		t.Errorf("expected the error to be located in site.tmpl, got %v", err)
+	}
+}
+
+func TestParseSegments_SubSlices(t *testing.T) {
+	template := []byte("head\n#FILE-EACH: .items :{{ .name }}.txt#\nbody\n#FILE#")
+	segments, err := ParseSegments(template)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, seg := range segments {
+		for _, field := range [][]byte{seg.Content, seg.Filename, seg.Each} {
+			if len(field) == 0 {
+				continue
+			}
+			start := bytes.Index(template, field)
+			if &field[0] != &template[start] {
+				t.Errorf("expected %q to share the template's memory", field)
+			}
+			if cap(field) != len(field) {
+				t.Errorf("expected %q to be capped at its length, got capacity %d", field, cap(field))
+			}
+		}
+	}
+	if got := append(segments[1].Filename, 'x'); &got[0] == &segments[1].Filename[0] {
+		t.Error("expected appending to a filename to copy it")
+	}
+	if string(segments[1].Each) != ".items" || segments[1].FilenameColumn != 21 {
+		t.Errorf("unexpected each %q filename column %d", segments[1].Each, segments[1].FilenameColumn)
+	}
+}
+
+// benchmarkTemplate returns a template with n FILE blocks separated by
+// stdout content.
+func benchmarkTemplate(n int) []byte {
+	var b bytes.Buffer
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "# section %d\n{{ .header }}\n", i)
+		fmt.Fprintf(&b, "#FILE:out/{{ .name }}-%d.yaml:0644 if-missing#\n", i)
+		b.WriteString("name: {{ .name }}\nitems:\n{{- range .items }}\n  - {{ . }} # comment\n{{- end }}\n#FILE#\n")
+	}
+	return b.Bytes()
+}
+
+func BenchmarkParseSegments(b *testing.B) {
+	for _, n := range []int{1, 100, 10000} {
+		template := benchmarkTemplate(n)
+		b.Run(fmt.Sprintf("files=%d", n), func(b *testing.B) {
+			b.SetBytes(int64(len(template)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := ParseSegments(template); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func FuzzParseSegments(f *testing.F) {
+	seeds := []string{
+		"",
+		"plain text\n",
+		"#FILE:a.txt#\nA\n#FILE#",
+		"x\n#FILE:bin/run.sh:0755 if-missing skip-empty#\nB\n#FILE#\ny",
+		"#FILE-EACH:.items:{{ .name }}.txt#\n{{ . }}\n#FILE#",
+		"#FILE:a\n#FILE#",
+		"##FILE#FILE:#",
+		string(benchmarkTemplate(3)),
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, template []byte) {
+		segments, err := ParseSegments(template)
+		if err != nil {
+			var terr *TemplateError
+			if !errors.As(err, &terr) || terr.Line < 1 || terr.Column < 1 {
+				t.Fatalf("expected a located TemplateError, got %v", err)
+			}
+			return
+		}
+		if len(segments) == 0 {
+			t.Fatal("expected at least one segment")
+		}
+		lines := bytes.SplitAfter(template, []byte("\n"))
+		for i, seg := range segments {
+			if seg.Type == SegmentFile && len(bytes.TrimSpace(seg.Filename)) == 0 {
+				t.Errorf("segment %d: empty filename", i)
+			}
+			if len(seg.Content) == 0 {
+				continue
+			}
+			// The content is found at its reported position
+			if seg.ContentLine < 1 || seg.ContentLine > len(lines) {
+				t.Fatalf("segment %d: content line %d out of range", i, seg.ContentLine)
+			}
+			offset := seg.ContentColumn - 1
+			for _, line := range lines[:seg.ContentLine-1] {
+				offset += len(line)
+			}
+			if !bytes.HasPrefix(template[offset:], seg.Content) {
+				t.Errorf("segment %d: content %q not found at %d:%d", i, seg.Content, seg.ContentLine, seg.ContentColumn)
+			}
+		}
+	})
+}
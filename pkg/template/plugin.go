@@ -0,0 +1,202 @@
+package template
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// funcName matches the names text/template accepts for functions.
+var funcName = regexp.MustCompile(`^[\p{L}_][\p{L}\p{N}_]*$`)
+
+// Plugin is an external executable that provides template functions. It
+// speaks a line-based JSON protocol on its standard input and output: for
+// every request line the plugin writes exactly one response line.
+//
+//	-> {"method":"functions"}
+//	<- {"functions":["slugify","owner"]}
+//	-> {"method":"call","function":"slugify","args":["Hello World"]}
+//	<- {"result":"hello-world"}
+//	<- {"error":"unknown team"}              (on failure)
+//
+// The plugin should exit when its standard input is closed. Its standard
+// error is passed through to the standard error of this process. A plugin
+// that does not answer a call before the call's context is done is killed,
+// as its responses can no longer be matched to requests.
+type Plugin struct {
+	Path      string   // Executable the plugin was started from
+	Functions []string // Functions the plugin provides
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+
+	mu      sync.Mutex // serializes requests
+	pending atomic.Int32
+	closed  atomic.Bool
+}
+
+// pluginCloseTimeout is how long Close waits for a plugin to exit after
+// closing its standard input before killing it.
+const pluginCloseTimeout = 5 * time.Second
+
+// pluginRequest is a request line sent to a plugin.
+type pluginRequest struct {
+	Method   string `json:"method"`
+	Function string `json:"function,omitempty"`
+	Args     []any  `json:"args,omitempty"`
+}
+
+// pluginResponse is a response line received from a plugin.
+type pluginResponse struct {
+	Functions []string `json:"functions,omitempty"`
+	Result    any      `json:"result,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// LoadPlugin starts the plugin executable at path with args and asks it
+// for its functions. The plugin is killed when ctx is done; call Close to
+// stop it once rendering is complete.
+func LoadPlugin(ctx context.Context, path string, args ...string) (*Plugin, error) {
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", path, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", path, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", path, err)
+	}
+
+	p := &Plugin{Path: path, cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}
+	resp, err := p.request(ctx, pluginRequest{Method: "functions"})
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("plugin %s: failed to list functions: %w", path, err)
+	}
+	for _, name := range resp.Functions {
+		if !funcName.MatchString(name) {
+			p.Close()
+			return nil, fmt.Errorf("plugin %s: invalid function name %q", path, name)
+		}
+	}
+	p.Functions = resp.Functions
+	return p, nil
+}
+
+// request sends req to the plugin and reads its response. The plugin is
+// killed if ctx is done before it answers.
+func (p *Plugin) request(ctx context.Context, req pluginRequest) (*pluginResponse, error) {
+	line, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count the request before checking closed, so that Close either
+	// refuses it or sees it pending
+	p.pending.Add(1)
+	defer p.pending.Add(-1)
+	if p.closed.Load() {
+		return nil, errors.New("plugin is closed")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { p.cmd.Process.Kill() })
+	defer stop()
+
+	if _, err := p.stdin.Write(append(line, '\n')); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	respLine, err := p.stdout.ReadBytes('\n')
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if p.closed.Load() {
+			return nil, errors.New("plugin is closed")
+		}
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("plugin exited unexpectedly")
+		}
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	var resp pluginResponse
+	if err := json.Unmarshal(respLine, &resp); err != nil {
+		return nil, fmt.Errorf("invalid response %q: %w", respLine, err)
+	}
+	return &resp, nil
+}
+
+// call invokes a plugin function with args.
+func (p *Plugin) call(ctx context.Context, name string, args []any) (any, error) {
+	resp, err := p.request(ctx, pluginRequest{Method: "call", Function: name, Args: args})
+	if err != nil {
+		return nil, fmt.Errorf("%s: plugin %s: %w", name, p.Path, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s: %s", name, resp.Error)
+	}
+	return resp.Result, nil
+}
+
+// Close closes the plugin's standard input and waits for it to exit. A
+// plugin that is still handling a request, or that has not exited after
+// five seconds, is killed.
+func (p *Plugin) Close() error {
+	if p.closed.Swap(true) {
+		return nil
+	}
+	p.stdin.Close()
+	if p.pending.Load() > 0 {
+		p.cmd.Process.Kill()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- p.cmd.Wait() }()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(pluginCloseTimeout):
+		p.cmd.Process.Kill()
+		err = <-done
+	}
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", p.Path, err)
+	}
+	return nil
+}
+
+// WithPlugin returns an Option that registers the functions of a loaded
+// plugin. Arguments and results are exchanged as JSON, so numbers arrive
+// as float64. Plugin functions count as blocking functions (see
+// WithFunctionPolicy), since they call out of the process.
+func WithPlugin(p *Plugin) Option {
+	return optionFunc(func(o *options) {
+		funcs := make(map[string]any, len(p.Functions))
+		for _, name := range p.Functions {
+			funcs[name] = func(ctx context.Context, args ...any) (any, error) {
+				return p.call(ctx, name, args)
+			}
+		}
+		o.registerBlocking(funcs)
+	})
+}
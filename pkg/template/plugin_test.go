@@ -0,0 +1,153 @@
+package template
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPluginHelperProcess is not a real test: it is started by the plugin
+// tests as a plugin executable.
+func TestPluginHelperProcess(t *testing.T) {
+	mode := os.Getenv("SIMPLATE_TEST_PLUGIN")
+	if mode == "" {
+		return
+	}
+	defer os.Exit(0)
+
+	in := bufio.NewScanner(os.Stdin)
+	out := json.NewEncoder(os.Stdout)
+	for in.Scan() {
+		var req pluginRequest
+		if err := json.Unmarshal(in.Bytes(), &req); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		switch {
+		case mode == "invalid":
+			out.Encode(map[string]any{"functions": []string{"not-valid"}})
+		case mode == "crash":
+			os.Exit(3)
+		case req.Method == "functions":
+			out.Encode(map[string]any{"functions": []string{"slugify", "add", "hang"}})
+		case req.Function == "hang":
+			time.Sleep(time.Hour)
+		case req.Function == "slugify":
+			out.Encode(map[string]any{"result": strings.ReplaceAll(strings.ToLower(req.Args[0].(string)), " ", "-")})
+		case req.Function == "add":
+			if len(req.Args) != 2 {
+				out.Encode(map[string]any{"error": "expected two numbers"})
+				continue
+			}
+			out.Encode(map[string]any{"result": req.Args[0].(float64) + req.Args[1].(float64)})
+		}
+	}
+}
+
+// loadTestPlugin starts this test binary as a plugin in the given mode.
+func loadTestPlugin(t *testing.T, mode string) (*Plugin, error) {
+	t.Setenv("SIMPLATE_TEST_PLUGIN", mode)
+	return LoadPlugin(context.Background(), os.Args[0], "-test.run=^TestPluginHelperProcess$")
+}
+
+func TestWithPlugin(t *testing.T) {
+	plugin, err := loadTestPlugin(t, "ok")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer plugin.Close()
+	if strings.Join(plugin.Functions, ",") != "slugify,add,hang" {
+		t.Errorf("unexpected functions %v", plugin.Functions)
+	}
+
+	tmpl := []byte(`{{ slugify .title }} {{ add 1 2 }}`)
+	var out bytes.Buffer
+	if err := Execute(AnyProvider(map[string]any{"title": "Hello World"}), tmpl, &out, WithPlugin(plugin), WithParallelism(4)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "hello-world 3" {
+		t.Errorf("expected %q, got %q", "hello-world 3", out.String())
+	}
+
+	err = Execute(AnyProvider(map[string]any{}), []byte(`{{ add 1 }}`), &out, WithPlugin(plugin))
+	if err == nil || !strings.Contains(err.Error(), "add: expected two numbers") {
+		t.Errorf("expected the plugin error, got %v", err)
+	}
+
+	if err := plugin.Close(); err != nil {
+		t.Errorf("unexpected error on close: %v", err)
+	}
+	if _, err := plugin.call(context.Background(), "add", []any{1, 2}); err == nil {
+		t.Error("expected error after close")
+	}
+}
+
+func TestPlugin_HungCall(t *testing.T) {
+	plugin, err := loadTestPlugin(t, "ok")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer plugin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := plugin.call(ctx, "hang", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the call to stop at its deadline, got %v", err)
+	}
+
+	// Close must not wait for a call that never returns
+	plugin, err = loadTestPlugin(t, "ok")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	called := make(chan error, 1)
+	go func() {
+		_, err := plugin.call(context.Background(), "hang", nil)
+		called <- err
+	}()
+	for plugin.pending.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	closed := make(chan struct{})
+	go func() {
+		plugin.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(pluginCloseTimeout / 2):
+		t.Fatal("Close blocked on the hung call")
+	}
+	if err := <-called; err == nil {
+		t.Error("expected the hung call to fail once the plugin is closed")
+	}
+}
+
+func TestLoadPlugin_Errors(t *testing.T) {
+	cases := []struct {
+		mode string
+		want string
+	}{
+		{mode: "invalid", want: `invalid function name "not-valid"`},
+		{mode: "crash", want: "plugin exited unexpectedly"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.mode, func(t *testing.T) {
+			_, err := loadTestPlugin(t, tc.mode)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+
+	if _, err := LoadPlugin(context.Background(), "./does-not-exist"); err == nil {
+		t.Error("expected error for a missing executable")
+	}
+}
@@ -0,0 +1,176 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"time"
+)
+
+// FunctionErrorPolicy selects what happens when a blocking template function
+// (httpGet, DNS lookups, cloud metadata, ...) fails or times out.
+type FunctionErrorPolicy string
+
+const (
+	// FunctionErrorFail aborts template execution with the error.
+	FunctionErrorFail FunctionErrorPolicy = "fail"
+	// FunctionErrorEmpty makes the function return the zero value of its
+	// result type (empty string, nil list, ...).
+	FunctionErrorEmpty FunctionErrorPolicy = "empty"
+	// FunctionErrorDefault makes the function return the value configured
+	// for it in FunctionPolicy.Defaults, or the zero value if none is set.
+	FunctionErrorDefault FunctionErrorPolicy = "default"
+)
+
+// FunctionPolicy configures timeouts and error handling for blocking
+// template functions.
+type FunctionPolicy struct {
+	// OnError selects the error policy. Defaults to FunctionErrorFail.
+	OnError FunctionErrorPolicy
+	// Timeouts maps function names to the maximum time a single call may
+	// take. Functions without an entry are not given an extra deadline.
+	Timeouts map[string]time.Duration
+	// Defaults maps function names to the value returned under the
+	// FunctionErrorDefault policy. The value must be assignable to the
+	// function's result type (or to its element type for list results).
+	Defaults map[string]any
+}
+
+// WithFunctionPolicy returns an Option that applies the given timeout and
+// error policy to every blocking template function enabled by other options,
+// regardless of the order in which the options are passed.
+func WithFunctionPolicy(p FunctionPolicy) Option {
+	return optionFunc(func(o *options) {
+		o.policy = &p
+	})
+}
+
+// registerBlocking adds functions that may block on external systems to the
+// function map and records their names so a FunctionPolicy can wrap them.
+// Their first parameter is a context.Context, which is bound by
+// applyFunctionPolicy and not visible to templates.
+func (o *options) registerBlocking(funcs map[string]any) {
+	for name, fn := range funcs {
+		o.funcs[name] = fn
+		o.blocking = append(o.blocking, name)
+	}
+}
+
+// applyFunctionPolicy binds the execution context to all registered
+// blocking functions and wraps them according to the configured policy.
+func (o *options) applyFunctionPolicy() {
+	o.unbound = make(map[string]any, len(o.blocking))
+	for _, name := range o.blocking {
+		if fn, ok := o.funcs[name]; ok {
+			o.unbound[name] = fn
+		}
+	}
+	o.bindBlocking()
+}
+
+// bindBlocking replaces the blocking functions in the function map with
+// wrappers bound to o.ctx.
+func (o *options) bindBlocking() {
+	policy := FunctionPolicy{}
+	if o.policy != nil {
+		policy = *o.policy
+	}
+	onError := policy.OnError
+	if onError == "" {
+		onError = FunctionErrorFail
+	}
+	for name, fn := range o.unbound {
+		o.funcs[name] = wrapBlocking(o.ctx, name, fn, policy.Timeouts[name], onError, policy.Defaults[name])
+	}
+}
+
+// withContext returns a copy of o bound to ctx, whose blocking functions
+// are canceled together with ctx.
+func (o *options) withContext(ctx context.Context) *options {
+	bound := *o
+	bound.ctx = ctx
+	if len(o.unbound) > 0 {
+		bound.funcs = maps.Clone(o.funcs)
+		bound.bindBlocking()
+	}
+	return &bound
+}
+
+// wrapBlocking returns a function with the signature of fn without its
+// leading context.Context parameter. Every call passes fn a context derived
+// from ctx that expires after timeout (if positive), and converts errors
+// according to onError. fn must return exactly two values, the second being
+// an error; other values are returned unchanged.
+func wrapBlocking(ctx context.Context, name string, fn any, timeout time.Duration, onError FunctionErrorPolicy, def any) any {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
+	errType := reflect.TypeOf((*error)(nil)).Elem()
+	if t.Kind() != reflect.Func || t.NumIn() == 0 || t.In(0) != contextType || t.NumOut() != 2 || t.Out(1) != errType {
+		return fn
+	}
+	resultType := t.Out(0)
+
+	in := make([]reflect.Type, t.NumIn()-1)
+	for i := range in {
+		in[i] = t.In(i + 1)
+	}
+	wrapped := reflect.FuncOf(in, []reflect.Type{resultType, errType}, t.IsVariadic())
+
+	return reflect.MakeFunc(wrapped, func(args []reflect.Value) []reflect.Value {
+		call := v.Call
+		if t.IsVariadic() {
+			call = v.CallSlice
+		}
+
+		callCtx := ctx
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			callCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		results := call(append([]reflect.Value{reflect.ValueOf(callCtx)}, args...))
+		var err error
+		if errVal := results[1].Interface(); errVal != nil {
+			err = errVal.(error)
+		}
+		if err == nil {
+			return results
+		}
+		if timeout > 0 && errors.Is(callCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			err = fmt.Errorf("%s: timed out after %s", name, timeout)
+		}
+
+		switch onError {
+		case FunctionErrorEmpty:
+			return []reflect.Value{reflect.Zero(resultType), reflect.Zero(errType)}
+		case FunctionErrorDefault:
+			return []reflect.Value{defaultValue(resultType, def), reflect.Zero(errType)}
+		default:
+			return []reflect.Value{reflect.Zero(resultType), reflect.ValueOf(&err).Elem()}
+		}
+	}).Interface()
+}
+
+// defaultValue returns def as a value of typ, or the zero value of typ if def
+// is nil or not assignable. A single default is wrapped in a one-element
+// slice for slice result types.
+func defaultValue(typ reflect.Type, def any) reflect.Value {
+	if def == nil {
+		return reflect.Zero(typ)
+	}
+	dv := reflect.ValueOf(def)
+	switch {
+	case dv.Type().AssignableTo(typ):
+		out := reflect.New(typ).Elem()
+		out.Set(dv)
+		return out
+	case typ.Kind() == reflect.Slice && dv.Type().AssignableTo(typ.Elem()):
+		out := reflect.MakeSlice(typ, 1, 1)
+		out.Index(0).Set(dv)
+		return out
+	}
+	return reflect.Zero(typ)
+}
@@ -0,0 +1,122 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withTestBlockingFuncs registers blocking functions used to exercise
+// FunctionPolicy without touching the network.
+func withTestBlockingFuncs() Option {
+	return optionFunc(func(o *options) {
+		o.registerBlocking(map[string]any{
+			"failing": func(ctx context.Context, name string) (string, error) { return "", errors.New("backend unavailable") },
+			"failingList": func(ctx context.Context) ([]string, error) {
+				return nil, errors.New("backend unavailable")
+			},
+			"slow": func(ctx context.Context) (string, error) {
+				select {
+				case <-ctx.Done():
+					return "", ctx.Err()
+				case <-time.After(time.Second):
+					return "late", nil
+				}
+			},
+			"ok": func(ctx context.Context) (string, error) { return "fine", nil },
+		})
+	})
+}
+
+func TestFunctionPolicy(t *testing.T) {
+	cases := []struct {
+		name    string
+		tmpl    string
+		policy  *FunctionPolicy
+		want    string
+		wantErr string
+	}{
+		{name: "no policy fails", tmpl: `{{failing "x"}}`, wantErr: "backend unavailable"},
+		{name: "fail policy", tmpl: `{{failing "x"}}`, policy: &FunctionPolicy{OnError: FunctionErrorFail}, wantErr: "backend unavailable"},
+		{name: "empty policy", tmpl: `[{{failing "x"}}]`, policy: &FunctionPolicy{OnError: FunctionErrorEmpty}, want: "[]"},
+		{
+			name:   "default policy",
+			tmpl:   `{{failing "x"}}`,
+			policy: &FunctionPolicy{OnError: FunctionErrorDefault, Defaults: map[string]any{"failing": "fallback"}},
+			want:   "fallback",
+		},
+		{
+			name:   "default policy wraps list results",
+			tmpl:   `{{range failingList}}{{.}}{{end}}`,
+			policy: &FunctionPolicy{OnError: FunctionErrorDefault, Defaults: map[string]any{"failingList": "fallback"}},
+			want:   "fallback",
+		},
+		{name: "default policy without default", tmpl: `[{{failing "x"}}]`, policy: &FunctionPolicy{OnError: FunctionErrorDefault}, want: "[]"},
+		{
+			name:    "timeout",
+			tmpl:    `{{slow}}`,
+			policy:  &FunctionPolicy{Timeouts: map[string]time.Duration{"slow": 10 * time.Millisecond}},
+			wantErr: "timed out",
+		},
+		{
+			name:   "timeout with empty policy",
+			tmpl:   `[{{slow}}]`,
+			policy: &FunctionPolicy{OnError: FunctionErrorEmpty, Timeouts: map[string]time.Duration{"slow": 10 * time.Millisecond}},
+			want:   "[]",
+		},
+		{name: "success passes through", tmpl: `{{ok}}`, policy: &FunctionPolicy{OnError: FunctionErrorEmpty}, want: "fine"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := []Option{withTestBlockingFuncs()}
+			if tc.policy != nil {
+				// pass the policy first to verify option order does not matter
+				opts = append([]Option{WithFunctionPolicy(*tc.policy)}, opts...)
+			}
+			var out bytes.Buffer
+			err := Execute(AnyProvider(map[string]any{}), []byte(tc.tmpl), &out, opts...)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, out.String())
+			}
+		})
+	}
+}
+
+func TestFunctionPolicy_TimeoutCancelsCall(t *testing.T) {
+	var callCtx context.Context
+	opt := optionFunc(func(o *options) {
+		o.registerBlocking(map[string]any{
+			"wait": func(ctx context.Context) (string, error) {
+				callCtx = ctx
+				<-ctx.Done()
+				return "", ctx.Err()
+			},
+		})
+	})
+	policy := WithFunctionPolicy(FunctionPolicy{Timeouts: map[string]time.Duration{"wait": 10 * time.Millisecond}})
+
+	start := time.Now()
+	err := Execute(AnyProvider(map[string]any{}), []byte(`{{wait}}`), &bytes.Buffer{}, opt, policy)
+	if err == nil || !strings.Contains(err.Error(), "wait: timed out after 10ms") {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	// The call runs in the template goroutine and has returned by now
+	if callCtx == nil || callCtx.Err() == nil {
+		t.Error("expected the function to be called with a canceled context")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the call to stop at its deadline, took %s", elapsed)
+	}
+}
@@ -0,0 +1,83 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxPortablePathLength is the longest path usable with the classic Windows
+// API: MAX_PATH (260) minus the terminating NUL.
+const maxPortablePathLength = 259
+
+// portabilityInvalidChars are characters that are not allowed in Windows
+// file names (in addition to control characters).
+const portabilityInvalidChars = `<>:"\|?*`
+
+// windowsReservedNames are device names that cannot be used as Windows file
+// names, with or without an extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// WithPortabilityCheck returns an Option that makes ExecuteWithFiles fail,
+// before writing anything, if a generated path would not be usable on
+// Windows: paths longer than MAX_PATH, components containing characters
+// such as ':' or '?', components ending in a dot or space, and reserved
+// device names such as CON or NUL.
+func WithPortabilityCheck() Option {
+	return optionFunc(func(o *options) {
+		o.portability = true
+	})
+}
+
+// checkPortability returns an error listing every portability problem of
+// the rendered FILE and DIR segments' paths.
+func checkPortability(rendered []renderedSegment) error {
+	var errs []error
+	for _, r := range rendered {
+		if r.segment.Type == SegmentStdout || r.skipped != "" {
+			continue
+		}
+		for _, problem := range portabilityProblems(r.filename) {
+			errs = append(errs, fmt.Errorf("non-portable output path %s (line %d): %s", r.filename, r.segment.Line, problem))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// portabilityProblems describes why path cannot be used on Windows, or
+// returns nil if it can.
+func portabilityProblems(path string) []string {
+	var problems []string
+
+	clean := filepath.ToSlash(filepath.Clean(path))
+	if n := len(utf16.Encode([]rune(clean))); n > maxPortablePathLength {
+		problems = append(problems, fmt.Sprintf("length %d exceeds the Windows limit of %d characters", n, maxPortablePathLength))
+	}
+
+	for _, component := range strings.Split(clean, "/") {
+		if component == "" || component == "." {
+			continue
+		}
+		if idx := strings.IndexFunc(component, func(r rune) bool {
+			return r < 0x20 || strings.ContainsRune(portabilityInvalidChars, r)
+		}); idx != -1 {
+			problems = append(problems, fmt.Sprintf("%q contains the invalid character %q", component, component[idx]))
+		}
+		if strings.HasSuffix(component, ".") || strings.HasSuffix(component, " ") {
+			problems = append(problems, fmt.Sprintf("%q ends with a dot or space", component))
+		}
+		base, _, _ := strings.Cut(component, ".")
+		if windowsReservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+			problems = append(problems, fmt.Sprintf("%q is a reserved device name", component))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,55 @@
+package template
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPortabilityProblems(t *testing.T) {
+	cases := map[string]int{
+		"deploy/api.yaml":           0,
+		"./configs/app.conf":        0,
+		"notes/meeting: monday.txt": 1,
+		"what?.txt":                 1,
+		"dir./file.txt":             1,
+		"file.txt ":                 1,
+		"logs/con.txt":              1,
+		"NUL":                       1,
+		"console.txt":               0,
+		"a\tb.txt":                  1,
+		strings.Repeat("d/", 131):   1,
+		"bad:name./" + "aux.log":    3,
+		strings.Repeat("x", 259):    0,
+		strings.Repeat("é", 260):    1,
+	}
+	for path, want := range cases {
+		if got := portabilityProblems(path); len(got) != want {
+			t.Errorf("%q: expected %d problems, got %d: %v", path, want, len(got), got)
+		}
+	}
+}
+
+func TestExecuteWithFiles_PortabilityCheck(t *testing.T) {
+	tmpl := []byte("#FILE:{{.name}}.txt#\nx\n#FILE#")
+	data := AnyProvider(map[string]any{"name": "report: 2024?"})
+
+	memWriter := &MemoryFileWriter{}
+	if err := ExecuteWithFiles(data, tmpl, io.Discard, memWriter); err != nil {
+		t.Fatalf("unexpected error without portability check: %v", err)
+	}
+
+	memWriter = &MemoryFileWriter{}
+	err := ExecuteWithFiles(data, tmpl, io.Discard, memWriter, WithPortabilityCheck())
+	if err == nil {
+		t.Fatal("expected portability error")
+	}
+	for _, want := range []string{"line 1", `':'`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %s, got %v", want, err)
+		}
+	}
+	if len(memWriter.Files) != 0 {
+		t.Errorf("expected no files to be written, got %d", len(memWriter.Files))
+	}
+}
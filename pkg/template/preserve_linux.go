@@ -0,0 +1,65 @@
+//go:build linux
+
+package template
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// preserveMetadata gives tmp the owner and extended attributes of the
+// existing file at path, described by info. It returns errOwnerNotPreserved
+// if the process is not allowed to give tmp the original owner.
+func preserveMetadata(info os.FileInfo, path, tmp string) error {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		if err := os.Lchown(tmp, int(st.Uid), int(st.Gid)); err != nil {
+			if errors.Is(err, syscall.EPERM) {
+				return errOwnerNotPreserved
+			}
+			return fmt.Errorf("failed to set owner: %w", err)
+		}
+	}
+	// Copy attributes after chown, which clears security.capability
+	return copyXattrs(path, tmp)
+}
+
+// copyXattrs copies the extended attributes of src to dst. Filesystems
+// without xattr support and attributes the process may not set (such as
+// trusted.* for unprivileged users) are skipped.
+func copyXattrs(src, dst string) error {
+	size, err := syscall.Listxattr(src, nil)
+	if err != nil {
+		if errors.Is(err, syscall.ENOTSUP) {
+			return nil
+		}
+		return fmt.Errorf("failed to list extended attributes: %w", err)
+	}
+	if size == 0 {
+		return nil
+	}
+	buf := make([]byte, size)
+	if size, err = syscall.Listxattr(src, buf); err != nil {
+		return fmt.Errorf("failed to list extended attributes: %w", err)
+	}
+
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		valueSize, err := syscall.Getxattr(src, name, nil)
+		if err != nil {
+			return fmt.Errorf("failed to read extended attribute %s: %w", name, err)
+		}
+		value := make([]byte, valueSize)
+		if valueSize, err = syscall.Getxattr(src, name, value); err != nil {
+			return fmt.Errorf("failed to read extended attribute %s: %w", name, err)
+		}
+		if err := syscall.Setxattr(dst, name, value[:valueSize], 0); err != nil {
+			if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ENOTSUP) {
+				continue
+			}
+			return fmt.Errorf("failed to set extended attribute %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+//go:build linux
+
+package template
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestDefaultFileWriter_PreservesXattrs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	if err := syscall.Setxattr(path, "user.simplate.test", []byte("kept"), 0); err != nil {
+		if errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EPERM) {
+			t.Skipf("user extended attributes not supported: %v", err)
+		}
+		t.Fatalf("failed to set xattr: %v", err)
+	}
+
+	writer := &DefaultFileWriter{}
+	if err := writer.SetBaseDir(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.WriteFile("config.yml", []byte("new"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	value := make([]byte, 16)
+	n, err := syscall.Getxattr(path, "user.simplate.test", value)
+	if err != nil || string(value[:n]) != "kept" {
+		t.Errorf("expected xattr to be preserved, got %q (%v)", value[:n], err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "new" {
+		t.Errorf("expected new content, got %q", content)
+	}
+}
+
+func TestDefaultFileWriter_PreservesOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing file ownership requires root")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	if err := os.Chown(path, 1234, 5678); err != nil {
+		t.Fatalf("failed to chown file: %v", err)
+	}
+
+	writer := &DefaultFileWriter{}
+	if err := writer.SetBaseDir(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.WriteFile("config.yml", []byte("new"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat file: %v", err)
+	}
+	st := info.Sys().(*syscall.Stat_t)
+	if st.Uid != 1234 || st.Gid != 5678 {
+		t.Errorf("expected owner 1234:5678, got %d:%d", st.Uid, st.Gid)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package template
+
+import "os"
+
+// preserveMetadata is a no-op outside Linux: only the permission bits of
+// existing files are preserved there.
+func preserveMetadata(info os.FileInfo, path, tmp string) error {
+	return nil
+}
@@ -0,0 +1,198 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"text/template"
+)
+
+// previewCacheSize bounds the number of parsed templates kept by
+// RenderSegmentPreview.
+const previewCacheSize = 32
+
+// SegmentPreview is the result of rendering a single template segment.
+type SegmentPreview struct {
+	Type     SegmentType
+	Filename string      // Rendered filename (FILE and DIR segments)
+	Mode     os.FileMode // Requested permissions (FILE and DIR segments)
+	Content  []byte      // Rendered content (FILE and stdout segments)
+}
+
+// RenderSegmentPreview renders only the segment at segmentIndex of templ (as
+// returned by ParseSegments) with the given data, without validating input or
+// writing any files. It is meant for live previews in editors: the segment
+// list and each segment's parsed templates are cached, so repeated calls for
+// the same template source only pay for execution.
+//
+// Options are applied as in Execute; validation functions are ignored.
+// FILE-EACH segments are previewed with the first element of their list as
+// dot; an empty list yields a preview without filename and content.
+func RenderSegmentPreview(templ []byte, segmentIndex int, data any, opts ...Option) (*SegmentPreview, error) {
+	o := newOptions(context.Background(), opts)
+
+	parsed, err := previews.get(templ, o.funcs)
+	if err != nil {
+		return nil, err
+	}
+	if segmentIndex < 0 || segmentIndex >= len(parsed.segments) {
+		return nil, fmt.Errorf("segment index %d out of range (template has %d segments)", segmentIndex, len(parsed.segments))
+	}
+
+	segment := parsed.segments[segmentIndex]
+	preview := &SegmentPreview{Type: segment.Type}
+	if segment.Type != SegmentStdout {
+		preview.Mode = o.segmentMode(segment)
+	}
+
+	if segment.Each != nil {
+		items, err := o.eachItems(segment.Each, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve FILE-EACH list for segment %d: %w", segmentIndex, err)
+		}
+		if len(items) == 0 {
+			return preview, nil
+		}
+		data = items[0]
+	}
+
+	if segment.Type != SegmentStdout {
+		filenameTmpl, err := parsed.template(segmentIndex, true, o)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse filename template for segment %d: %w", segmentIndex, err)
+		}
+		var filenameBuf bytes.Buffer
+		if err := filenameTmpl.Execute(&filenameBuf, data); err != nil {
+			return nil, fmt.Errorf("failed to render filename template for segment %d: %w", segmentIndex, err)
+		}
+		preview.Filename = filenameBuf.String()
+	}
+	if segment.Type == SegmentDir {
+		return preview, nil
+	}
+
+	var contentBuf bytes.Buffer
+	if o.html {
+		// The cache holds text/templates; HTML previews are parsed on every
+		// call
+		if err := o.renderSegment(segment.Content, segment.contentPos(), data, &contentBuf); err != nil {
+			return nil, fmt.Errorf("failed to render segment %d: %w", segmentIndex, err)
+		}
+	} else {
+		contentTmpl, err := parsed.template(segmentIndex, false, o)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse segment %d: %w", segmentIndex, err)
+		}
+		if err := contentTmpl.Execute(&contentBuf, data); err != nil {
+			return nil, fmt.Errorf("failed to render segment %d: %w", segmentIndex, err)
+		}
+	}
+	preview.Content = contentBuf.Bytes()
+	if segment.Type == SegmentFile {
+		preview.Content = o.cleanWhitespace(segment, preview.Content)
+	}
+
+	return preview, nil
+}
+
+// previews is the process-wide cache used by RenderSegmentPreview.
+var previews = &previewCache{entries: make(map[[sha256.Size]byte]*parsedTemplate)}
+
+// previewCache is a bounded FIFO cache of parsed templates keyed by the
+// template source and the names of the available functions (parsing fails
+// on unknown functions, so the function set is part of the key).
+type previewCache struct {
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*parsedTemplate
+	order   [][sha256.Size]byte
+}
+
+// parsedTemplate holds the segments of a template and lazily parsed
+// text/templates for their filenames and contents.
+type parsedTemplate struct {
+	segments []Segment
+
+	mu        sync.Mutex
+	filenames map[int]*template.Template
+	contents  map[int]*template.Template
+}
+
+func (c *previewCache) get(templ []byte, funcs template.FuncMap) (*parsedTemplate, error) {
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	h.Write(templ)
+	for _, name := range names {
+		h.Write([]byte{0})
+		h.Write([]byte(name))
+	}
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if parsed, ok := c.entries[key]; ok {
+		return parsed, nil
+	}
+
+	segments, err := ParseSegments(templ)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template segments: %w", err)
+	}
+	parsed := &parsedTemplate{
+		segments:  segments,
+		filenames: make(map[int]*template.Template),
+		contents:  make(map[int]*template.Template),
+	}
+
+	if len(c.order) >= previewCacheSize {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.entries[key] = parsed
+	c.order = append(c.order, key)
+	return parsed, nil
+}
+
+// template returns an executable clone of the parsed filename or content
+// template of segment i, bound to the functions and strict mode of o.
+// Parsing happens once per segment.
+func (p *parsedTemplate) template(i int, filename bool, o *options) (*template.Template, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cache, source := p.contents, p.segments[i].Content
+	if filename {
+		cache, source = p.filenames, p.segments[i].Filename
+	}
+
+	tmpl, ok := cache[i]
+	if !ok {
+		var err error
+		tmpl, err = bindInclude(o.ctx, template.New("segment").Funcs(o.funcs)).Parse(string(source))
+		if err != nil {
+			return nil, err
+		}
+		cache[i] = tmpl
+	}
+
+	// Clone so the caller's functions (which may carry per-call state such
+	// as caches) are bound without mutating the shared template.
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	bindInclude(o.ctx, clone.Funcs(o.funcs))
+	if o.strict {
+		clone.Option("missingkey=error")
+	}
+	return clone, nil
+}
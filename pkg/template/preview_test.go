@@ -0,0 +1,100 @@
+package template
+
+import (
+	"strings"
+	"testing"
+)
+
+const previewTestTemplate = "Header {{.app}}\n#FILE:{{.app}}.conf:0600#\nname={{.app}}\n#FILE#\nFooter"
+
+func TestRenderSegmentPreview(t *testing.T) {
+	data := map[string]any{"app": "api"}
+
+	file, err := RenderSegmentPreview([]byte(previewTestTemplate), 1, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if file.Type != SegmentFile || file.Filename != "api.conf" || file.Mode != 0600 {
+		t.Errorf("unexpected file preview metadata: %+v", file)
+	}
+	if string(file.Content) != "\nname=api\n" {
+		t.Errorf("unexpected file content: %q", file.Content)
+	}
+
+	stdout, err := RenderSegmentPreview([]byte(previewTestTemplate), 0, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout.Type != SegmentStdout || string(stdout.Content) != "Header api\n" {
+		t.Errorf("unexpected stdout preview: %+v", stdout)
+	}
+}
+
+func TestRenderSegmentPreview_ReusesCache(t *testing.T) {
+	templ := []byte("#FILE:a.txt#\n{{.v}}\n#FILE#")
+
+	first, err := RenderSegmentPreview(templ, 0, map[string]any{"v": 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parsed, err := previews.get(templ, builtinFuncs())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(parsed.contents) != 1 || len(parsed.filenames) != 1 {
+		t.Fatalf("expected parsed segment templates to be cached, got %d/%d", len(parsed.contents), len(parsed.filenames))
+	}
+
+	// Different data must still be rendered with the cached parse
+	second, err := RenderSegmentPreview(templ, 0, map[string]any{"v": 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(first.Content) != "\n1\n" || string(second.Content) != "\n2\n" {
+		t.Errorf("unexpected contents %q and %q", first.Content, second.Content)
+	}
+}
+
+func TestRenderSegmentPreview_Errors(t *testing.T) {
+	cases := []struct {
+		name    string
+		templ   string
+		index   int
+		wantErr string
+	}{
+		{"index out of range", previewTestTemplate, 5, "out of range"},
+		{"negative index", previewTestTemplate, -1, "out of range"},
+		{"malformed directive", "#FILE:a.txt#\nno close", 0, "unclosed"},
+		{"bad segment template", "#FILE:a.txt#\n{{.v\n#FILE#", 0, "failed to parse segment"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := RenderSegmentPreview([]byte(tc.templ), tc.index, map[string]any{})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRenderSegmentPreview_FileEach(t *testing.T) {
+	templ := []byte("#FILE-EACH:.services:{{.name}}.yaml#\nname: {{.name}}\n#FILE#")
+
+	preview, err := RenderSegmentPreview(templ, 0, map[string]any{
+		"services": []any{map[string]any{"name": "api"}, map[string]any{"name": "web"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if preview.Filename != "api.yaml" || string(preview.Content) != "\nname: api\n" {
+		t.Errorf("expected preview of the first element, got %+v", preview)
+	}
+
+	empty, err := RenderSegmentPreview(templ, 0, map[string]any{"services": []any{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if empty.Filename != "" || len(empty.Content) != 0 {
+		t.Errorf("expected empty preview for an empty list, got %+v", empty)
+	}
+}
@@ -0,0 +1,98 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+)
+
+// PruneResult lists the stale files found by Prune.
+type PruneResult struct {
+	Removed  []string // Stale files that were deleted
+	Modified []string // Stale files kept because they changed since they were generated
+}
+
+// Prune deletes the files listed in previous, the manifest of an earlier
+// run, that are no longer generated, i.e. are missing from generated, so
+// that renamed or removed FILE segments do not leave orphans behind.
+// generated lists every path of the current render, including the files it
+// skipped (see RenderReport.Files): an if-missing file left in place is
+// still generated. Paths are relative to dir, the output directory of both
+// runs; nil fsys means the OS filesystem.
+//
+// Only files whose content still matches the digest in previous are
+// deleted, so hand-edited files and files that are not regular files are
+// kept and reported as modified. Directories left empty are removed, up to
+// dir. Paths are validated like in DefaultFileWriter, and files below
+// symbolic links to directories are never deleted.
+func Prune(fsys FS, dir string, previous *Manifest, generated []string) (*PruneResult, error) {
+	if fsys == nil {
+		fsys = OSFS{}
+	}
+	w := &DefaultFileWriter{FS: fsys, Symlinks: SymlinkReplace}
+	if dir != "" {
+		w.baseDir = filepath.Clean(dir)
+	}
+	keep := make(map[string]bool, len(generated))
+	for _, path := range generated {
+		keep[filepath.Clean(path)] = true
+	}
+
+	result := &PruneResult{}
+	var dirs []string
+	for _, f := range previous.Files {
+		if keep[filepath.Clean(f.Path)] {
+			continue
+		}
+		path, err := w.resolve(f.Path)
+		if err != nil {
+			return result, fmt.Errorf("invalid manifest entry: %w", err)
+		}
+		if _, err := w.checkSymlinks(fsys, path); err != nil {
+			return result, err
+		}
+		info, err := fsys.Lstat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		if !info.Mode().IsRegular() {
+			result.Modified = append(result.Modified, f.Path)
+			continue
+		}
+		content, err := readFile(fsys, path)
+		if err != nil {
+			return result, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != f.SHA256 {
+			result.Modified = append(result.Modified, f.Path)
+			continue
+		}
+		if err := fsys.Remove(path); err != nil {
+			return result, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		result.Removed = append(result.Removed, f.Path)
+		dirs = append(dirs, filepath.Dir(path))
+	}
+
+	// Remove emptied directories, deepest first; removing a directory that
+	// still has entries fails and ends the walk up from it
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, d := range dirs {
+		for d != w.baseDir && d != "." && d != string(filepath.Separator) {
+			if fsys.Remove(d) != nil {
+				break
+			}
+			d = filepath.Dir(d)
+		}
+	}
+	sort.Strings(result.Removed)
+	sort.Strings(result.Modified)
+	return result, nil
+}
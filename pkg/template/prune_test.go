@@ -0,0 +1,65 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	fsys := &MemFS{}
+	writer := &DefaultFileWriter{FS: fsys}
+	if err := writer.SetBaseDir("out"); err != nil {
+		t.Fatal(err)
+	}
+	entry := func(path, content string) ManifestFile {
+		if err := writer.WriteFile(path, []byte(content), 0); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		return ManifestFile{Path: path, Size: len(content), SHA256: hex.EncodeToString(sum[:])}
+	}
+	previous := &Manifest{Files: []ManifestFile{
+		entry("keep.conf", "keep"),
+		entry("old/nested/stale.conf", "stale"),
+		entry("edited.conf", "generated"),
+		{Path: "gone.conf", SHA256: "abc"},
+	}}
+	if err := writer.WriteFile("edited.conf", []byte("edited by hand"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteFile("unrelated.txt", []byte("x"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Prune(fsys, "out", previous, []string{"keep.conf"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &PruneResult{Removed: []string{"old/nested/stale.conf"}, Modified: []string{"edited.conf"}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("expected %+v, got %+v", want, result)
+	}
+	for path, exists := range map[string]bool{
+		"out/keep.conf":     true,
+		"out/edited.conf":   true,
+		"out/unrelated.txt": true,
+		"out/old":           false,
+		"out":               true,
+	} {
+		_, err := fsys.Stat(path)
+		if got := !errors.Is(err, fs.ErrNotExist); got != exists {
+			t.Errorf("%s: expected exists %v, got %v", path, exists, got)
+		}
+	}
+}
+
+func TestPrune_InvalidPath(t *testing.T) {
+	previous := &Manifest{Files: []ManifestFile{{Path: "../escape.conf", SHA256: "abc"}}}
+	if _, err := Prune(&MemFS{}, "out", previous, nil); err == nil {
+		t.Error("expected a path outside the output directory to be rejected")
+	}
+}
@@ -0,0 +1,199 @@
+package template
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FileChange describes how a run changed a file.
+type FileChange struct {
+	Path string `json:"path"`
+	// Action is "create" for new files and "update" for modified ones, as
+	// in the GitLab commits API.
+	Action string `json:"action"`
+	// Mode is the git file mode of the file, "100644" or "100755", as in
+	// the GitHub trees API.
+	Mode string `json:"mode"`
+	// Content is the new content of the file, base64 encoded if Encoding
+	// is "base64" because it is not valid UTF-8 text.
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+	// Diff is the unified diff from the previous content.
+	Diff      string `json:"diff"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+// ChangeRecorder is a FileWriter that writes through the wrapped
+// FileWriter and records how every written file changed, e.g. to open a
+// pull request with the changes of a run. The previous content of files is
+// read from FS (the OS filesystem if nil) in Dir, the base directory of the
+// wrapped writer.
+type ChangeRecorder struct {
+	recordingWriter
+	FS  FS
+	Dir string
+
+	mu      sync.Mutex // guards changes
+	changes []FileChange
+}
+
+// NewChangeRecorder returns a ChangeRecorder writing through w, whose base
+// directory is dir in fsys.
+func NewChangeRecorder(w FileWriter, fsys FS, dir string) *ChangeRecorder {
+	r := &ChangeRecorder{FS: fsys, Dir: dir}
+	r.recordingWriter = recordingWriter{FileWriter: w, record: r.record}
+	return r
+}
+
+// record writes the file and records its change. Files written with their
+// previous content are not recorded.
+func (r *ChangeRecorder) record(filename string, content []byte, info SegmentInfo, write func() (WriteStatus, error)) (WriteStatus, error) {
+	fsys := r.FS
+	if fsys == nil {
+		fsys = OSFS{}
+	}
+	path := filename
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.Dir, path)
+	}
+	old, err := readFile(fsys, path)
+	if errors.Is(err, fs.ErrNotExist) {
+		old = nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to read previous content of %s: %w", filename, err)
+	} else if old == nil {
+		old = []byte{}
+	}
+
+	status, err := write()
+	if err != nil {
+		return "", err
+	}
+	if status == WriteUnchanged || old != nil && bytes.Equal(old, content) {
+		return status, nil
+	}
+
+	change := FileChange{
+		Path:     filepath.ToSlash(filename),
+		Action:   "update",
+		Mode:     "100644",
+		Content:  string(content),
+		Encoding: "text",
+	}
+	if old == nil {
+		change.Action = "create"
+	}
+	if info.Mode&0111 != 0 {
+		change.Mode = "100755"
+	}
+	if !utf8.Valid(content) {
+		change.Content = base64.StdEncoding.EncodeToString(content)
+		change.Encoding = "base64"
+	}
+	change.Diff = unifiedDiff(change.Path, old, content)
+	for _, line := range strings.Split(change.Diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "):
+		case strings.HasPrefix(line, "+"):
+			change.Additions++
+		case strings.HasPrefix(line, "-"):
+			change.Deletions++
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.changes = append(r.changes, change)
+	return status, nil
+}
+
+// Changes returns the recorded changes sorted by path.
+func (r *ChangeRecorder) Changes() []FileChange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changes := append([]FileChange(nil), r.changes...)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// PullRequestPayload summarizes the changes of a run for opening a pull
+// (or merge) request through the GitHub or GitLab API: Title and Body are
+// the request's, and Files hold what a commit needs.
+type PullRequestPayload struct {
+	Title  string          `json:"title"`
+	Body   string          `json:"body"`
+	Files  []FileChange    `json:"files"`
+	Report PullRequestStat `json:"report"`
+}
+
+// PullRequestStat is the run report of a PullRequestPayload.
+type PullRequestStat struct {
+	Template string `json:"template,omitempty"`
+	Dir      string `json:"dir,omitempty"`
+	// Generated is the number of files the run wrote, changed or not.
+	Generated int `json:"generated"`
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Additions int `json:"additions"`
+	Deletions int `json:"deletions"`
+}
+
+// NewPullRequestPayload returns the payload of a pull request titled title
+// for changes, made by a run of template that wrote generated files in dir.
+// The body lists the changed files; it is empty without changes, when there
+// is nothing to propose.
+func NewPullRequestPayload(title, template, dir string, generated int, changes []FileChange) *PullRequestPayload {
+	payload := &PullRequestPayload{
+		Title: title,
+		Files: changes,
+		Report: PullRequestStat{
+			Template:  template,
+			Dir:       dir,
+			Generated: generated,
+			Unchanged: max(generated-len(changes), 0),
+		},
+	}
+	if payload.Files == nil {
+		payload.Files = []FileChange{}
+	}
+	for _, change := range changes {
+		if change.Action == "create" {
+			payload.Report.Created++
+		} else {
+			payload.Report.Updated++
+		}
+		payload.Report.Additions += change.Additions
+		payload.Report.Deletions += change.Deletions
+	}
+	if len(changes) == 0 {
+		return payload
+	}
+
+	var b strings.Builder
+	source := "the templates"
+	if template != "" {
+		source = "`" + template + "`"
+	}
+	fmt.Fprintf(&b, "Regenerated from %s: %d file(s) created, %d updated, %d unchanged.\n\n",
+		source, payload.Report.Created, payload.Report.Updated, payload.Report.Unchanged)
+	b.WriteString("| File | Change | Lines |\n|---|---|---|\n")
+	for _, change := range changes {
+		action := "updated"
+		if change.Action == "create" {
+			action = "created"
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | +%d −%d |\n", change.Path, action, change.Additions, change.Deletions)
+	}
+	payload.Body = b.String()
+	return payload
+}
@@ -0,0 +1,67 @@
+package template
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestChangeRecorder(t *testing.T) {
+	fsys := &MemFS{}
+	writer := &DefaultFileWriter{FS: fsys}
+	if err := writer.SetBaseDir("out"); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"same.txt": "same\n", "old.txt": "a\nb\n"} {
+		if err := writer.WriteFile(name, []byte(content), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recorder := NewChangeRecorder(writer, fsys, "out")
+	tmpl := []byte("#FILE:same.txt#same\n#FILE##FILE:old.txt#a\nc\n#FILE##FILE:bin/run:0755#\x00#FILE##FILE:new.txt#new\n#FILE#")
+	if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &bytes.Buffer{}, recorder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	changes := recorder.Changes()
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %+v", changes)
+	}
+	want := []FileChange{
+		{Path: "bin/run", Action: "create", Mode: "100755", Content: "\x00", Encoding: "text", Diff: "Binary files /dev/null and b/bin/run differ\n"},
+		{Path: "new.txt", Action: "create", Mode: "100644", Content: "new\n", Encoding: "text", Diff: "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+new\n", Additions: 1},
+		{Path: "old.txt", Action: "update", Mode: "100644", Content: "a\nc\n", Encoding: "text", Diff: "--- a/old.txt\n+++ b/old.txt\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n", Additions: 1, Deletions: 1},
+	}
+	for i, change := range changes {
+		if change != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], change)
+		}
+	}
+
+	payload := NewPullRequestPayload("Regenerate", "app.tmpl", "out", 4, changes)
+	if payload.Report != (PullRequestStat{Template: "app.tmpl", Dir: "out", Generated: 4, Created: 2, Updated: 1, Unchanged: 1, Additions: 2, Deletions: 1}) {
+		t.Errorf("unexpected report %+v", payload.Report)
+	}
+	if !strings.HasPrefix(payload.Body, "Regenerated from `app.tmpl`: 2 file(s) created, 1 updated, 1 unchanged.") ||
+		!strings.Contains(payload.Body, "| `old.txt` | updated | +1 −1 |") {
+		t.Errorf("unexpected body:\n%s", payload.Body)
+	}
+}
+
+func TestChangeRecorder_Base64(t *testing.T) {
+	recorder := NewChangeRecorder(&MemoryFileWriter{}, &MemFS{}, "")
+	if err := recorder.WriteFile("logo.bin", []byte{0xff, 0xfe}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if changes := recorder.Changes(); len(changes) != 1 || changes[0].Encoding != "base64" || changes[0].Content != "//4=" {
+		t.Errorf("expected base64 content, got %+v", changes)
+	}
+}
+
+func TestNewPullRequestPayload_NoChanges(t *testing.T) {
+	payload := NewPullRequestPayload("Regenerate", "", "", 2, nil)
+	if payload.Body != "" || payload.Files == nil || payload.Report.Unchanged != 2 {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+}
@@ -0,0 +1,117 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// squote wraps a value in single quotes, doubling the single quotes it
+// contains, which is how YAML and SQL escape them:
+//
+//	name: {{ squote .name }}   # name: 'it''s' for it's
+//
+// Parameters:
+//   - value: the value to quote; nil is quoted as an empty string and other
+//     non-strings are formatted with fmt.Sprint.
+//
+// Returns:
+//   - string: the quoted value.
+func squote(value any) string {
+	return "'" + strings.ReplaceAll(quoteString(value), "'", "''") + "'"
+}
+
+// shellQuote quotes a value as a single POSIX shell word, so that it is
+// passed to a command unchanged whatever characters it contains, e.g.
+// "cp {{ shellQuote .src }} /srv". A list yields one quoted word per
+// element, separated by spaces, e.g. "exec app {{ shellQuote .args }}".
+//
+// Parameters:
+//   - value: the value or list of values to quote; non-strings are
+//     formatted like in squote.
+//
+// Returns:
+//   - string: the shell words.
+func shellQuote(value any) string {
+	if v := reflect.ValueOf(value); value != nil && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8 {
+		words := make([]string, v.Len())
+		for i := range words {
+			words[i] = shellQuote(v.Index(i).Interface())
+		}
+		return strings.Join(words, " ")
+	}
+	return "'" + strings.ReplaceAll(quoteString(value), "'", `'\''`) + "'"
+}
+
+// jsonEscape escapes a value for use inside a JSON string literal of the
+// template, without adding the quotes, e.g. "\"msg\": \"{{ jsonEscape .msg }}\"".
+// Use toJson to produce a complete JSON value instead.
+//
+// Parameters:
+//   - value: the value to escape; non-strings are formatted like in squote.
+//
+// Returns:
+//   - string: the escaped value.
+func jsonEscape(value any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	// Encoding a string cannot fail
+	_ = enc.Encode(quoteString(value))
+	out := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	return string(out[1 : len(out)-1])
+}
+
+// yamlQuote returns a value as a double-quoted YAML scalar, which is
+// always read back as the same string: values such as "yes", "0755",
+// "null" or "a: b" are not reinterpreted, and control characters are
+// escaped, e.g. "password: {{ yamlQuote .password }}".
+//
+// Parameters:
+//   - value: the value to quote; non-strings are formatted like in squote.
+//
+// Returns:
+//   - string: the double-quoted scalar.
+func yamlQuote(value any) string {
+	s := quoteString(value)
+	var b strings.Builder
+	b.WriteByte('"')
+	// Invalid UTF-8 bytes are replaced with U+FFFD by the range loop
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7F || r >= 0x80 && r <= 0x9F || r == 0xFEFF || r == 0xFFFE || r == 0xFFFF:
+			// Not printable in YAML
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// quoteString returns the string the quoting functions quote: value itself
+// for strings, the text of byte slices, an empty string for nil and the
+// fmt.Sprint formatting otherwise.
+func quoteString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(value)
+}
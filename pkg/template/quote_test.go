@@ -0,0 +1,73 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestQuoteFuncs(t *testing.T) {
+	tmpl := []byte(`{{ squote .s }} {{ shellQuote .s }} {{ jsonEscape .s }} {{ yamlQuote .s }} {{ shellQuote .args }} {{ squote .n }} {{ yamlQuote .missing }}`)
+	data := map[string]any{"s": `it's "a" <b>`, "args": []any{"-v", "a b"}, "n": 8080}
+	var out bytes.Buffer
+	if err := Execute(AnyProvider(data), tmpl, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `'it''s "a" <b>' 'it'\''s "a" <b>' it's \"a\" <b> "it's \"a\" <b>" '-v' 'a b' '8080' ""`
+	if out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+}
+
+// quoteSamples are values that break naive quoting.
+var quoteSamples = []string{
+	"", "plain", "it's", `"quoted"`, `back\slash`, "yes", "0755", "null", "a: b", "- item", "#comment",
+	"line\nbreak", "tab\there", "cr\r\n", "bell\a", "del\x7f", "nel\u0085", "bom\ufeff", "snow ☃", "$HOME `id` $(id)", "*",
+}
+
+func TestYamlQuote_RoundTrip(t *testing.T) {
+	for _, s := range quoteSamples {
+		var got string
+		if err := yaml.Unmarshal([]byte("v: "+yamlQuote(s)), &struct{ V *string }{&got}); err != nil {
+			t.Errorf("%q: invalid YAML %s: %v", s, yamlQuote(s), err)
+			continue
+		}
+		if got != s {
+			t.Errorf("%q: read back as %q from %s", s, got, yamlQuote(s))
+		}
+
+		// Single-quoted scalars cannot escape line breaks and control characters
+		if strings.ContainsAny(s, "\r\n\a\x7f\u0085\ufeff") {
+			continue
+		}
+		var single string
+		if err := yaml.Unmarshal([]byte("v: "+squote(s)), &struct{ V *string }{&single}); err != nil || single != s {
+			t.Errorf("%q: squote read back as %q, %v", s, single, err)
+		}
+	}
+}
+
+func TestJsonEscape_RoundTrip(t *testing.T) {
+	for _, s := range quoteSamples {
+		var got string
+		if err := json.Unmarshal([]byte(`"`+jsonEscape(s)+`"`), &got); err != nil || got != s {
+			t.Errorf("%q: read back as %q, %v", s, got, err)
+		}
+	}
+}
+
+func TestShellQuote_RoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not installed")
+	}
+	for _, s := range quoteSamples {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(s)).Output()
+		if err != nil || string(out) != s {
+			t.Errorf("%q: sh printed %q, %v", s, out, err)
+		}
+	}
+}
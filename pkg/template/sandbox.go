@@ -0,0 +1,33 @@
+package template
+
+// osFuncs are the functions, apart from blocking functions, that give
+// templates access to the environment or filesystem of the process.
+var osFuncs = []string{"env", "envOrDefault", "readFile", "datasource", "ds"}
+
+// WithSandbox returns an Option for rendering untrusted templates, e.g. in
+// multi-tenant services or CI: it removes the env, envOrDefault, readFile,
+// datasource and ds functions and every blocking function (HTTP, DNS, cloud
+// metadata and plugin functions) from the function map, regardless of the
+// order in which the options are passed. Templates using them fail to
+// parse. Generated files are still confined to the output directory by the
+// file writer.
+func WithSandbox() Option {
+	return optionFunc(func(o *options) {
+		o.sandbox = true
+	})
+}
+
+// applySandbox removes the functions with access to the operating system
+// when the sandbox is enabled.
+func (o *options) applySandbox() {
+	if !o.sandbox {
+		return
+	}
+	for _, name := range osFuncs {
+		delete(o.funcs, name)
+	}
+	for _, name := range o.blocking {
+		delete(o.funcs, name)
+	}
+	o.blocking = nil
+}
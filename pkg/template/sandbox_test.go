@@ -0,0 +1,35 @@
+package template
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWithSandbox(t *testing.T) {
+	t.Setenv("SIMPLATE_TEST_SECRET", "s3cr3t")
+	sandboxed := []Option{
+		WithSandbox(),
+		WithFileFuncs(FileReadConfig{AllowedDirs: []string{t.TempDir()}}),
+		WithHTTPFuncs(HTTPConfig{AllowedHosts: []string{"example.com"}}),
+		WithFunctionPolicy(FunctionPolicy{OnError: FunctionErrorEmpty}),
+		WithGomplateFuncs(GomplateConfig{Datasources: map[string]string{"SIMPLATE_TEST_SECRET": "/etc/hostname"}}),
+	}
+	for _, name := range []string{"env", "envOrDefault", "readFile", "httpGet", "httpGetJSON", "datasource", "ds"} {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Execute(AnyProvider(map[string]any{}), []byte(`{{ `+name+` "SIMPLATE_TEST_SECRET" }}`), &out, sandboxed...)
+			if err == nil || !strings.Contains(err.Error(), `function "`+name+`" not defined`) {
+				t.Errorf("expected %s to be undefined, got %v (output %q)", name, err, out.String())
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	if err := Execute(AnyProvider(map[string]any{"name": "api"}), []byte(`{{ .name | b64enc }}`), &out, sandboxed...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "YXBp" {
+		t.Errorf("expected %q, got %q", "YXBp", out.String())
+	}
+}
@@ -0,0 +1,160 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaViolation is a single JSON Schema violation of the input data.
+type SchemaViolation struct {
+	Path    string `json:"path"`           // Data path, e.g. .servers[2].port
+	Pointer string `json:"pointer"`        // JSON pointer, e.g. /servers/2/port
+	Message string `json:"message"`        // Violation, e.g. expected integer, but got string
+	Line    int    `json:"line,omitempty"` // 1-based YAML line, 0 if unknown (see SetLines)
+}
+
+func (v SchemaViolation) String() string {
+	if v.Line > 0 {
+		return fmt.Sprintf("%s: %s (line %d)", v.Path, v.Message, v.Line)
+	}
+	return fmt.Sprintf("%s: %s", v.Path, v.Message)
+}
+
+// SchemaError is returned by WithJsonSchemaValidation when the input data
+// does not match the schema. It lists every violation as "path: message".
+type SchemaError struct {
+	Violations []SchemaViolation
+	Err        error // Underlying *jsonschema.ValidationError
+}
+
+func (e *SchemaError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("data does not match the schema:")
+	for _, v := range e.Violations {
+		sb.WriteString("\n  ")
+		sb.WriteString(v.String())
+	}
+	return sb.String()
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+// SetLines sets the Line of every violation from the YAML document the data
+// was read from. Violations whose location cannot be found keep line 0.
+func (e *SchemaError) SetLines(yamlInput []byte) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(yamlInput, &doc); err != nil || len(doc.Content) == 0 {
+		return
+	}
+	for i := range e.Violations {
+		if node := lookupPointer(doc.Content[0], e.Violations[i].Pointer); node != nil {
+			e.Violations[i].Line = node.Line
+		}
+	}
+}
+
+// newSchemaError converts a jsonschema validation error into a SchemaError.
+// Other errors are returned unchanged.
+func newSchemaError(err error) error {
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return err
+	}
+	return &SchemaError{Violations: schemaViolations(verr), Err: err}
+}
+
+// schemaViolations flattens the leaf causes of a validation error.
+func schemaViolations(verr *jsonschema.ValidationError) []SchemaViolation {
+	var violations []SchemaViolation
+	var collect func(*jsonschema.ValidationError)
+	collect = func(ve *jsonschema.ValidationError) {
+		if len(ve.Causes) == 0 {
+			violations = append(violations, SchemaViolation{
+				Path:    pointerPath(ve.InstanceLocation),
+				Pointer: ve.InstanceLocation,
+				Message: ve.Message,
+			})
+			return
+		}
+		for _, cause := range ve.Causes {
+			collect(cause)
+		}
+	}
+	collect(verr)
+	return violations
+}
+
+// identifier matches mapping keys that can be written as .key in a path.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// pointerPath converts a JSON pointer such as /servers/2/port into a data
+// path such as .servers[2].port. Numeric tokens are shown as list indexes.
+func pointerPath(pointer string) string {
+	tokens := pointerTokens(pointer)
+	if len(tokens) == 0 {
+		return "."
+	}
+	var sb strings.Builder
+	for _, token := range tokens {
+		switch {
+		case isIndex(token):
+			fmt.Fprintf(&sb, "[%s]", token)
+		case identifier.MatchString(token):
+			sb.WriteString("." + token)
+		default:
+			fmt.Fprintf(&sb, "[%q]", token)
+		}
+	}
+	return sb.String()
+}
+
+// pointerTokens splits and unescapes a JSON pointer.
+func pointerTokens(pointer string) []string {
+	if pointer == "" || pointer == "/" {
+		return nil
+	}
+	tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens
+}
+
+func isIndex(token string) bool {
+	_, err := strconv.ParseUint(token, 10, 0)
+	return err == nil
+}
+
+// lookupPointer returns the YAML node at the JSON pointer, or nil.
+func lookupPointer(node *yaml.Node, pointer string) *yaml.Node {
+	for _, token := range pointerTokens(pointer) {
+		for node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		switch node.Kind {
+		case yaml.MappingNode:
+			i := mappingIndex(node, token)
+			if i < 0 {
+				return nil
+			}
+			node = node.Content[i+1]
+		case yaml.SequenceNode:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(node.Content) {
+				return nil
+			}
+			node = node.Content[idx]
+		default:
+			return nil
+		}
+	}
+	return node
+}
@@ -0,0 +1,66 @@
+package template
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPointerPath(t *testing.T) {
+	cases := map[string]string{
+		"":                                ".",
+		"/servers/2/port":                 ".servers[2].port",
+		"/labels/app.kubernetes.io~1name": `.labels["app.kubernetes.io/name"]`,
+		"/a~0b":                           `["a~b"]`,
+	}
+	for pointer, want := range cases {
+		if got := pointerPath(pointer); got != want {
+			t.Errorf("pointerPath(%q) = %q, want %q", pointer, got, want)
+		}
+	}
+}
+
+func TestWithJsonSchemaValidation_SchemaError(t *testing.T) {
+	schema := []byte(`{
+		"type":"object",
+		"properties":{
+			"servers":{"type":"array","items":{
+				"type":"object",
+				"properties":{"port":{"type":"integer"}},
+				"required":["port"]
+			}}
+		}
+	}`)
+	input := []byte("servers:\n  - port: 80\n  - port: 443\n  - name: web\n    port: http\n  - name: db\n")
+	data, err := YamlProvider(input)()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = WithJsonSchemaValidation(schema)(data)
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("expected a SchemaError, got %v", err)
+	}
+	schemaErr.SetLines(input)
+
+	want := []SchemaViolation{
+		{Path: ".servers[2].port", Pointer: "/servers/2/port", Message: "expected integer, but got string", Line: 5},
+		{Path: ".servers[3]", Pointer: "/servers/3", Message: "missing properties: 'port'", Line: 6},
+	}
+	if len(schemaErr.Violations) != len(want) {
+		t.Fatalf("expected %d violations, got %v", len(want), schemaErr.Violations)
+	}
+	for _, w := range want {
+		found := false
+		for _, v := range schemaErr.Violations {
+			found = found || v == w
+		}
+		if !found {
+			t.Errorf("missing violation %+v in %+v", w, schemaErr.Violations)
+		}
+	}
+	if !strings.Contains(err.Error(), ".servers[2].port: expected integer, but got string (line 5)") {
+		t.Errorf("unexpected error message %q", err.Error())
+	}
+}
@@ -0,0 +1,300 @@
+package template
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KeyProvider returns the key named id, used to decrypt the inline
+// encrypted values of data files. id is the vault ID of Ansible Vault 1.2
+// values or the key field of ENC values, and empty for the default key.
+// Keys are passwords or random bytes of any length.
+type KeyProvider func(id string) ([]byte, error)
+
+// ErrDecryption is matched by errors from values that cannot be decrypted
+// because the key is wrong or the value was altered.
+var ErrDecryption = errors.New("wrong key or altered value")
+
+const (
+	// vaultHeader starts the values encrypted with ansible-vault.
+	vaultHeader = "$ANSIBLE_VAULT;"
+	// vaultIterations is the PBKDF2 iteration count of Ansible Vault.
+	vaultIterations = 10000
+
+	// encAlgorithm is the algorithm of ENC values, see EncryptValue.
+	encAlgorithm = "AES256_GCM"
+	// encIterations is the PBKDF2 iteration count of ENC values.
+	encIterations = 100000
+	encSaltSize   = 16
+)
+
+// encKeyID matches the key IDs allowed in ENC values.
+var encKeyID = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// DecryptingYamlProvider returns an InputProvider that unmarshals the
+// provided YAML bytes like YamlProvider, decrypting the inline encrypted
+// values with the keys of keys:
+//
+//   - scalars tagged !vault, as produced by ansible-vault encrypt_string,
+//     and strings starting with the $ANSIBLE_VAULT; header. Vault 1.1 and
+//     1.2 (with a vault ID) values are supported.
+//   - strings of the form ENC[AES256_GCM,...], as produced by EncryptValue.
+//
+// Decrypted values are strings. The rest of the file stays readable and
+// diffable, while the secrets stay encrypted at rest. Errors name the
+// location of the value that failed to decrypt. Decryption is opt-in: with
+// nil keys the provider is YamlProvider and such values stay plain strings.
+//
+// Example:
+//
+//	provider := DecryptingYamlProvider([]byte("user: app\npassword: ENC[AES256_GCM,data:...,salt:...]\n"), keys)
+//	data, err := provider()
+//	// data == map[string]any{"user":"app","password":"s3cret"}, err == nil
+func DecryptingYamlProvider(input []byte, keys KeyProvider) InputProvider {
+	if keys == nil {
+		return YamlProvider(input)
+	}
+	return func() (any, error) {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(input, &doc); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal YAML input: %w", err)
+		}
+		if doc.Kind == 0 {
+			return nil, nil
+		}
+		if err := decryptNode(&doc, "", keys); err != nil {
+			return nil, err
+		}
+		var data any
+		if err := doc.Decode(&data); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal YAML input: %w", err)
+		}
+		return data, nil
+	}
+}
+
+// decryptNode replaces the encrypted scalars below node, at path, with their
+// plaintext. Mapping keys and aliases are left alone: the anchored node is
+// decrypted where it is defined.
+func decryptNode(node *yaml.Node, path string, keys KeyProvider) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := decryptNode(child, path, keys); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := decryptNode(node.Content[i+1], path+"."+node.Content[i].Value, keys); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			if err := decryptNode(child, path+"["+strconv.Itoa(i)+"]", keys); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		var plaintext []byte
+		var err error
+		switch {
+		case node.Tag == "!vault" || node.ShortTag() == "!!str" && strings.HasPrefix(node.Value, vaultHeader):
+			plaintext, err = decryptVault(node.Value, keys)
+		case node.ShortTag() == "!!str" && strings.HasPrefix(node.Value, "ENC[") && strings.HasSuffix(node.Value, "]"):
+			plaintext, err = decryptENC(node.Value, keys)
+		default:
+			return nil
+		}
+		if err != nil {
+			if path == "" {
+				path = "."
+			}
+			return fmt.Errorf("failed to decrypt the value of %s (line %d): %w", path, node.Line, err)
+		}
+		node.Tag, node.Style, node.Value = "!!str", 0, string(plaintext)
+	}
+	return nil
+}
+
+// decryptVault decrypts an Ansible Vault value: a header line such as
+// $ANSIBLE_VAULT;1.2;AES256;prod followed by the hex encoding of the hex
+// encoded salt, HMAC and ciphertext, one per line. The key and the CTR
+// counter are derived from the password with PBKDF2-SHA256.
+func decryptVault(value string, keys KeyProvider) ([]byte, error) {
+	lines := strings.Fields(value)
+	if len(lines) == 0 {
+		return nil, errors.New("empty vault value")
+	}
+	header := strings.Split(lines[0], ";")
+	if len(header) < 3 || header[0] != strings.TrimSuffix(vaultHeader, ";") {
+		return nil, fmt.Errorf("invalid vault header %q", lines[0])
+	}
+	var id string
+	switch header[1] {
+	case "1.1":
+	case "1.2":
+		if len(header) > 3 {
+			id = header[3]
+		}
+	default:
+		return nil, fmt.Errorf("unsupported vault format version %s", header[1])
+	}
+	if header[2] != "AES256" {
+		return nil, fmt.Errorf("unsupported vault cipher %s", header[2])
+	}
+
+	body, err := hex.DecodeString(strings.Join(lines[1:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault value: %w", err)
+	}
+	parts := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid vault value: expected a salt, an HMAC and a ciphertext")
+	}
+	var fields [3][]byte
+	for i, part := range parts {
+		if fields[i], err = hex.DecodeString(part); err != nil {
+			return nil, fmt.Errorf("invalid vault value: %w", err)
+		}
+	}
+	salt, mac, ciphertext := fields[0], fields[1], fields[2]
+
+	password, err := keys(id)
+	if err != nil {
+		return nil, err
+	}
+	derived, err := pbkdf2.Key(sha256.New, string(password), salt, vaultIterations, 2*32+aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha256.New, derived[32:64])
+	h.Write(ciphertext)
+	if !hmac.Equal(h.Sum(nil), mac) {
+		return nil, ErrDecryption
+	}
+	block, err := aes.NewCipher(derived[:32])
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, derived[64:]).XORKeyStream(plaintext, ciphertext)
+
+	// Remove the PKCS#7 padding
+	n := 0
+	if len(plaintext) > 0 {
+		n = int(plaintext[len(plaintext)-1])
+	}
+	if n == 0 || n > aes.BlockSize || n > len(plaintext) ||
+		!bytes.Equal(plaintext[len(plaintext)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, errors.New("invalid vault value: bad padding")
+	}
+	return plaintext[:len(plaintext)-n], nil
+}
+
+// EncryptValue encrypts plaintext with key into an ENC value that
+// DecryptingYamlProvider decrypts with the key named id, or the default key
+// if id is empty:
+//
+//	ENC[AES256_GCM,data:<base64>,salt:<base64>,key:<id>]
+//
+// data holds the nonce, ciphertext and tag of AES-256-GCM, keyed with
+// PBKDF2-SHA256 of key and the random salt. Encrypting the same plaintext
+// twice gives different values.
+func EncryptValue(plaintext, key []byte, id string) (string, error) {
+	if id != "" && !encKeyID.MatchString(id) {
+		return "", fmt.Errorf("invalid key ID %q: only letters, digits, '_', '.' and '-' are allowed", id)
+	}
+	salt := make([]byte, encSaltSize)
+	rand.Read(salt)
+	aead, err := encAEAD(key, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+
+	value := "ENC[" + encAlgorithm +
+		",data:" + base64.StdEncoding.EncodeToString(sealed) +
+		",salt:" + base64.StdEncoding.EncodeToString(salt)
+	if id != "" {
+		value += ",key:" + id
+	}
+	return value + "]", nil
+}
+
+// decryptENC decrypts an ENC value of EncryptValue.
+func decryptENC(value string, keys KeyProvider) ([]byte, error) {
+	fields := strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, "ENC["), "]"), ",")
+	if fields[0] != encAlgorithm {
+		return nil, fmt.Errorf("unsupported ENC algorithm %q", fields[0])
+	}
+	var sealed, salt []byte
+	var id string
+	for _, field := range fields[1:] {
+		name, content, _ := strings.Cut(field, ":")
+		var err error
+		switch name {
+		case "data":
+			sealed, err = base64.StdEncoding.DecodeString(content)
+		case "salt":
+			salt, err = base64.StdEncoding.DecodeString(content)
+		case "key":
+			id = content
+		default:
+			return nil, fmt.Errorf("invalid ENC value: unknown field %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid ENC value: field %s: %w", name, err)
+		}
+	}
+	if sealed == nil || salt == nil {
+		return nil, errors.New("invalid ENC value: expected data and salt fields")
+	}
+
+	key, err := keys(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := encAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("invalid ENC value: data too short")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plaintext, nil
+}
+
+// encAEAD returns the AES-256-GCM cipher of ENC values with key and salt.
+func encAEAD(key, salt []byte) (cipher.AEAD, error) {
+	derived, err := pbkdf2.Key(sha256.New, string(key), salt, encIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,139 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testVault is "s3cret value" encrypted with the password hunter2 in the
+// Ansible Vault 1.1 format, without its header line.
+const testVault = `32316364646536313835363437373866633836653034626239666139353264323230326234386338
+3632643837323538306235313934363262366436633333350a313234323338393737626433326636
+33656437326231366334636263663335396639303831626439363235373439333562386636663861
+6332383331653030630a393837343131623337306634383862633862643438616533383836316238
+3362`
+
+func testKeys(keys map[string]string) KeyProvider {
+	return func(id string) ([]byte, error) {
+		key, ok := keys[id]
+		if !ok {
+			return nil, fmt.Errorf("no key %q", id)
+		}
+		return []byte(key), nil
+	}
+}
+
+func TestDecryptingYamlProvider(t *testing.T) {
+	enc, err := EncryptValue([]byte("db pass"), []byte("hunter2"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encProd, err := EncryptValue([]byte("12"), []byte("prod key"), "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "user: app\n" +
+		"vault: !vault |\n  $ANSIBLE_VAULT;1.1;AES256\n" + indent(2, testVault) + "\n" +
+		"list:\n  - \"$ANSIBLE_VAULT;1.2;AES256;old\\n" + strings.ReplaceAll(testVault, "\n", "") + "\"\n" +
+		"db:\n  password: &pw " + enc + "\n  again: *pw\n" +
+		"port: " + encProd + "\n" +
+		"plain: ENC[not closed\n"
+
+	keys := testKeys(map[string]string{"": "hunter2", "old": "hunter2", "prod": "prod key"})
+	data, err := DecryptingYamlProvider([]byte(input), keys)()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]any{
+		"user":  "app",
+		"vault": "s3cret value",
+		"list":  []any{"s3cret value"},
+		"db":    map[string]any{"password": "db pass", "again": "db pass"},
+		"port":  "12",
+		"plain": "ENC[not closed",
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("data = %#v, want %#v", data, want)
+	}
+}
+
+func TestDecryptingYamlProvider_NoKeys(t *testing.T) {
+	input := "tag: ENC[v1]\nbanner: \"$ANSIBLE_VAULT;1.1;AES256\"\nvault: !vault |\n  $ANSIBLE_VAULT;1.1;AES256\n" + indent(2, testVault) + "\n"
+	data, err := DecryptingYamlProvider([]byte(input), nil)()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := data.(map[string]any)
+	if m["tag"] != "ENC[v1]" || m["banner"] != "$ANSIBLE_VAULT;1.1;AES256" {
+		t.Errorf("expected plain strings without keys, got %#v", m)
+	}
+	if vault, _ := m["vault"].(string); !strings.HasPrefix(vault, "$ANSIBLE_VAULT;1.1;AES256\n") {
+		t.Errorf("expected the vault value to stay encrypted, got %q", m["vault"])
+	}
+}
+
+func TestDecryptingYamlProvider_Errors(t *testing.T) {
+	// 12 bytes of nonce, 2 of ciphertext and 16 of tag need no base64 padding
+	enc, err := EncryptValue([]byte("xy"), []byte("hunter2"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	altered := strings.Replace(enc, ",salt:", "AAAA,salt:", 1)
+
+	tests := []struct {
+		name    string
+		input   string
+		keys    map[string]string
+		wantErr string
+		wantIs  error
+	}{
+		{name: "wrong key", input: "a:\n  b: " + enc + "\n", keys: map[string]string{"": "wrong"}, wantErr: "failed to decrypt the value of .a.b (line 2)", wantIs: ErrDecryption},
+		{name: "wrong vault password", input: "a: !vault |\n  $ANSIBLE_VAULT;1.1;AES256\n" + indent(2, testVault) + "\n", keys: map[string]string{"": "wrong"}, wantIs: ErrDecryption},
+		{name: "altered value", input: "- " + altered + "\n", wantErr: "failed to decrypt the value of [0] (line 1)", wantIs: ErrDecryption},
+		{name: "missing key", input: "a: ENC[AES256_GCM,data:AAAA,salt:AAAA,key:other]\n", wantErr: `no key "other"`},
+		{name: "unknown field", input: "a: ENC[AES256_GCM,data:AAAA,salt:AAAA,iv:AAAA]\n", wantErr: `unknown field "iv"`},
+		{name: "missing salt", input: "a: ENC[AES256_GCM,data:AAAA]\n", wantErr: "expected data and salt fields"},
+		{name: "unsupported algorithm", input: "a: ENC[PKCS7,AAAA]\n", wantErr: `unsupported ENC algorithm "PKCS7"`},
+		{name: "vault version", input: "a: !vault |\n  $ANSIBLE_VAULT;2.0;AES256\n  00\n", wantErr: "unsupported vault format version 2.0"},
+		{name: "vault body", input: "a: !vault |\n  $ANSIBLE_VAULT;1.1;AES256\n  zz\n", wantErr: "invalid vault value"},
+		{name: "vault not a vault", input: "a: !vault secret\n", wantErr: `invalid vault header "secret"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := tt.keys
+			if keys == nil {
+				keys = map[string]string{"": "hunter2"}
+			}
+			_, err := DecryptingYamlProvider([]byte(tt.input), testKeys(keys))()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("expected error matching %v, got %v", tt.wantIs, err)
+			}
+		})
+	}
+}
+
+func TestEncryptValue(t *testing.T) {
+	a, err := EncryptValue([]byte("same"), []byte("key"), "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := EncryptValue([]byte("same"), []byte("key"), "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("expected different values for the same plaintext")
+	}
+	if !strings.HasPrefix(a, "ENC[AES256_GCM,data:") || !strings.HasSuffix(a, ",key:prod]") {
+		t.Errorf("unexpected value %s", a)
+	}
+	if _, err := EncryptValue([]byte("x"), []byte("key"), "a,b"); err == nil {
+		t.Error("expected an error for an invalid key ID")
+	}
+}
@@ -0,0 +1,226 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// semverPattern matches a semantic version. Minor and patch may be omitted
+// and default to 0, and a leading "v" is allowed.
+var semverPattern = regexp.MustCompile(`^v?(0|[1-9]\d*)(?:\.(0|[1-9]\d*))?(?:\.(0|[1-9]\d*))?` +
+	`(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?$`)
+
+// semVersion is a parsed semantic version as returned by the semver
+// template function.
+type semVersion struct {
+	Major      int64
+	Minor      int64
+	Patch      int64
+	Prerelease string // e.g. "rc.1", empty for releases
+	Metadata   string // Build metadata, ignored in comparisons
+
+	// parts is the number of version numbers given (1 to 3), used to
+	// derive the range of ~ and ^ constraints.
+	parts int
+}
+
+// String returns the version in its full form, e.g. "1.2.0-rc.1".
+func (v *semVersion) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Metadata != "" {
+		s += "+" + v.Metadata
+	}
+	return s
+}
+
+// semver parses a semantic version such as "1.2.3", "v2.0.0-rc.1" or "1.4",
+// so that templates can use its parts: {{ (semver .version).Major }}.
+//
+// Parameters:
+//   - version: the version string.
+//
+// Returns:
+//   - *semVersion: the version with the fields Major, Minor, Patch,
+//     Prerelease and Metadata.
+//   - error: non-nil if version is not a semantic version.
+func semver(version string) (*semVersion, error) {
+	v, err := parseSemver(version)
+	if err != nil {
+		return nil, fmt.Errorf("semver: %w", err)
+	}
+	return v, nil
+}
+
+// parseSemver parses a semantic version, see semverPattern.
+func parseSemver(version string) (*semVersion, error) {
+	m := semverPattern.FindStringSubmatch(strings.TrimSpace(version))
+	if m == nil {
+		return nil, fmt.Errorf("invalid semantic version %q", version)
+	}
+	v := &semVersion{Prerelease: m[4], Metadata: m[5], parts: 1}
+	numbers := []*int64{&v.Major, &v.Minor, &v.Patch}
+	for i, field := range m[1:4] {
+		if field == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid semantic version %q: %w", version, err)
+		}
+		*numbers[i] = n
+		v.parts = i + 1
+	}
+	return v, nil
+}
+
+// compareSemver returns -1, 0 or 1 if a is lower than, equal to or higher
+// than b, following the precedence rules of semantic versioning.
+func compareSemver(a, b *semVersion) int {
+	for _, pair := range [][2]int64{{a.Major, b.Major}, {a.Minor, b.Minor}, {a.Patch, b.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return comparePrerelease(a.Prerelease, b.Prerelease)
+}
+
+// comparePrerelease compares prerelease identifiers; a release (empty
+// prerelease) is higher than any prerelease of the same version.
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < min(len(as), len(bs)); i++ {
+		an, aErr := strconv.ParseUint(as[i], 10, 64)
+		bn, bErr := strconv.ParseUint(bs[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1 // Numeric identifiers are lower than alphanumeric ones
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// semverCompare reports whether version satisfies constraint, e.g.
+// {{ if semverCompare ">=1.25.0" .kubeVersion }}.
+//
+// A constraint is a list of comparisons that must all hold, separated by
+// commas or spaces, and alternatives are separated by "||". Comparisons
+// use the operators =, !=, >, >=, < and <=, ~ (same minor version: ~1.2.3
+// is >=1.2.3 <1.3.0) and ^ (compatible: ^1.2.3 is >=1.2.3 <2.0.0, and
+// ^0.2.3 is >=0.2.3 <0.3.0). A version without operator must be equal.
+//
+// Parameters:
+//   - constraint: the version constraint.
+//   - version: the version to check.
+//
+// Returns:
+//   - bool: true if version satisfies the constraint.
+//   - error: non-nil if the constraint or version is invalid.
+func semverCompare(constraint, version string) (bool, error) {
+	v, err := parseSemver(version)
+	if err != nil {
+		return false, fmt.Errorf("semverCompare: %w", err)
+	}
+	alternatives := strings.Split(constraint, "||")
+	matched := false
+	for _, alternative := range alternatives {
+		comparisons := strings.Fields(strings.ReplaceAll(alternative, ",", " "))
+		if len(comparisons) == 0 {
+			return false, fmt.Errorf("semverCompare: invalid constraint %q", constraint)
+		}
+		all := true
+		for i := 0; i < len(comparisons); i++ {
+			comparison := comparisons[i]
+			// Allow a space between operator and version, e.g. ">= 1.2"
+			if strings.TrimLeft(comparison, "=!<>~^") == "" && i+1 < len(comparisons) {
+				i++
+				comparison += comparisons[i]
+			}
+			ok, err := matchComparison(comparison, v)
+			if err != nil {
+				return false, fmt.Errorf("semverCompare: invalid constraint %q: %w", constraint, err)
+			}
+			all = all && ok
+		}
+		matched = matched || all
+	}
+	return matched, nil
+}
+
+// matchComparison reports whether v satisfies a single comparison such as
+// ">=1.2.0".
+func matchComparison(comparison string, v *semVersion) (bool, error) {
+	rest := strings.TrimLeft(comparison, "=!<>~^")
+	op := comparison[:len(comparison)-len(rest)]
+	bound, err := parseSemver(rest)
+	if err != nil {
+		return false, err
+	}
+	c := compareSemver(v, bound)
+	switch op {
+	case "", "=", "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case "~":
+		upper := &semVersion{Major: bound.Major, Minor: bound.Minor + 1}
+		if bound.parts == 1 {
+			upper = &semVersion{Major: bound.Major + 1}
+		}
+		return c >= 0 && compareSemver(v, upper) < 0, nil
+	case "^":
+		var upper *semVersion
+		switch {
+		case bound.Major > 0 || bound.parts == 1:
+			upper = &semVersion{Major: bound.Major + 1}
+		case bound.Minor > 0 || bound.parts == 2:
+			upper = &semVersion{Minor: bound.Minor + 1}
+		default:
+			upper = &semVersion{Patch: bound.Patch + 1}
+		}
+		return c >= 0 && compareSemver(v, upper) < 0, nil
+	}
+	return false, fmt.Errorf("unknown operator %q", op)
+}
@@ -0,0 +1,78 @@
+package template
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSemver(t *testing.T) {
+	v, err := semver("v1.24.3-rc.1+build.5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.Major != 1 || v.Minor != 24 || v.Patch != 3 || v.Prerelease != "rc.1" || v.Metadata != "build.5" {
+		t.Errorf("unexpected version %+v", v)
+	}
+	if v.String() != "1.24.3-rc.1+build.5" {
+		t.Errorf("unexpected string %q", v.String())
+	}
+	for _, invalid := range []string{"", "1.x", "01.2.3", "1.2.3.4", "1.2.3-"} {
+		if _, err := semver(invalid); err == nil {
+			t.Errorf("%q: expected error", invalid)
+		}
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	cases := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{constraint: ">=1.25.0", version: "1.25.0", want: true},
+		{constraint: ">=1.25.0", version: "1.24.9", want: false},
+		{constraint: ">= 1.2, < 2", version: "1.9.0", want: true},
+		{constraint: ">=1.2 <2", version: "2.0.0", want: false},
+		{constraint: "1.2.3", version: "v1.2.3+meta", want: true},
+		{constraint: "!=1.2.3", version: "1.2.3", want: false},
+		{constraint: "<1.0.0", version: "1.0.0-rc.1", want: true},
+		{constraint: ">1.0.0-alpha.1", version: "1.0.0-alpha.beta", want: true},
+		{constraint: ">1.0.0-alpha", version: "1.0.0-alpha.1", want: true},
+		{constraint: ">1.0.0-rc.2", version: "1.0.0-rc.10", want: true},
+		{constraint: "~1.2.3", version: "1.2.9", want: true},
+		{constraint: "~1.2.3", version: "1.3.0", want: false},
+		{constraint: "~1", version: "1.9.0", want: true},
+		{constraint: "^1.2.3", version: "1.9.0", want: true},
+		{constraint: "^1.2.3", version: "2.0.0", want: false},
+		{constraint: "^0.2.3", version: "0.3.0", want: false},
+		{constraint: "^0.0.3", version: "0.0.4", want: false},
+		{constraint: "<1.0 || >=3.0", version: "3.1.0", want: true},
+		{constraint: "<1.0 || >=3.0", version: "2.0.0", want: false},
+	}
+	for _, tc := range cases {
+		got, err := semverCompare(tc.constraint, tc.version)
+		if err != nil {
+			t.Fatalf("%s %s: unexpected error: %v", tc.constraint, tc.version, err)
+		}
+		if got != tc.want {
+			t.Errorf("semverCompare(%q, %q): expected %v, got %v", tc.constraint, tc.version, tc.want, got)
+		}
+	}
+
+	for _, tc := range [][2]string{{">=x", "1.0.0"}, {"=>1.0", "1.0.0"}, {"", "1.0.0"}, {">=1.0", "latest"}} {
+		if _, err := semverCompare(tc[0], tc[1]); err == nil {
+			t.Errorf("semverCompare(%q, %q): expected error", tc[0], tc[1])
+		}
+	}
+}
+
+func TestSemver_Template(t *testing.T) {
+	tmpl := []byte(`{{ $v := semver .version }}{{ $v.Major }}.{{ $v.Minor }}{{ if semverCompare ">=1.25" .version }} new{{ end }}`)
+	var out bytes.Buffer
+	if err := Execute(AnyProvider(map[string]any{"version": "1.27.2"}), tmpl, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "1.27 new" {
+		t.Errorf("expected %q, got %q", "1.27 new", out.String())
+	}
+}
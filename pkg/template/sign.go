@@ -0,0 +1,125 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// SignatureExtension is appended to the path of a generated file to name its
+// detached signature file.
+const SignatureExtension = ".sig"
+
+// ErrBadSignature is returned by VerifySignature when a signature does not
+// match the path and content.
+var ErrBadSignature = errors.New("signature does not match")
+
+// WithSigning returns an Option that writes a detached Ed25519 signature
+// next to every generated file, as <path>.sig, so that consumers can prove
+// the file was not changed or moved since it was generated (see
+// VerifySignature). Signature files are written and skipped together with
+// the files they sign.
+//
+// Signing runs as a BeforeWrite hook and must be the last one: give this
+// option after every option that changes the outputs, such as
+// WithFormatters, WithEditorConfig and WithHooks, or the signatures will
+// not match the written files.
+func WithSigning(key ed25519.PrivateKey) Option {
+	return WithHooks(Hooks{
+		BeforeWrite: func(_ context.Context, outputs []RenderedOutput) ([]RenderedOutput, error) {
+			signed := make([]RenderedOutput, 0, len(outputs))
+			for _, out := range outputs {
+				signed = append(signed, out)
+				if out.Segment.Type != SegmentFile || out.Skipped != "" {
+					continue
+				}
+				sig := out
+				sig.Path = out.Path + SignatureExtension
+				sig.Content = Sign(key, out.Path, out.Content)
+				sig.Segment.Mode = 0
+				sig.SidecarOf = out.Path
+				signed = append(signed, sig)
+			}
+			return signed, nil
+		},
+	})
+}
+
+// Sign returns the content of a detached signature file for the file at
+// path (relative to the output directory) with the given content: the
+// base64-encoded Ed25519 signature followed by a newline. The signature
+// covers the path too, so that a signed file cannot be passed off as
+// another one.
+func Sign(key ed25519.PrivateKey, path string, content []byte) []byte {
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, signedMessage(path, content)))
+	return []byte(sig + "\n")
+}
+
+// VerifySignature checks a detached signature file created by Sign against
+// the path and content of a file. It returns ErrBadSignature if the path,
+// content or signature was changed or the signature was made with another
+// key.
+func VerifySignature(key ed25519.PublicKey, path string, content, signature []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature)))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if !ed25519.Verify(key, signedMessage(path, content), sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// signedMessage returns the message signed for a file: the length of its
+// cleaned, slash-separated path as a big-endian uint64, the path and the
+// content.
+func signedMessage(path string, content []byte) []byte {
+	path = filepath.ToSlash(filepath.Clean(path))
+	msg := make([]byte, 0, 8+len(path)+len(content))
+	msg = binary.BigEndian.AppendUint64(msg, uint64(len(path)))
+	msg = append(msg, path...)
+	return append(msg, content...)
+}
+
+// ParsePrivateKey parses a PEM-encoded PKCS #8 Ed25519 private key, as
+// created by "openssl genpkey -algorithm ed25519".
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T: only Ed25519 keys are supported", key)
+	}
+	return edKey, nil
+}
+
+// ParsePublicKey parses a PEM-encoded PKIX Ed25519 public key, as created
+// by "openssl pkey -pubout".
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T: only Ed25519 keys are supported", key)
+	}
+	return edKey, nil
+}
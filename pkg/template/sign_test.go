@@ -0,0 +1,117 @@
+package template
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestWithSigning(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memWriter := &MemoryFileWriter{}
+	tmpl := []byte("header\n#FILE:run.sh:0755#echo hi#FILE#\n#FILE:empty.txt skip-empty# #FILE#")
+	if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &bytes.Buffer{}, memWriter, WithSigning(priv)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sig, ok := memWriter.Files["run.sh"+SignatureExtension]
+	if !ok {
+		t.Fatalf("expected a signature file, got %v", memWriter.Files)
+	}
+	if mode := memWriter.Modes["run.sh"+SignatureExtension]; mode != 0 {
+		t.Errorf("expected the default mode for the signature, got %v", mode)
+	}
+	if err := VerifySignature(pub, "run.sh", memWriter.Files["run.sh"], sig); err != nil {
+		t.Errorf("expected a valid signature: %v", err)
+	}
+	if err := VerifySignature(pub, "./run.sh", memWriter.Files["run.sh"], sig); err != nil {
+		t.Errorf("expected a valid signature for an unclean path: %v", err)
+	}
+	if err := VerifySignature(pub, "run.sh", []byte("echo pwned"), sig); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("expected ErrBadSignature for changed content, got %v", err)
+	}
+	if err := VerifySignature(pub, "other.sh", memWriter.Files["run.sh"], sig); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("expected ErrBadSignature for another path, got %v", err)
+	}
+	if len(memWriter.Files) != 2 {
+		t.Errorf("expected only run.sh and its signature, got %v", memWriter.Files)
+	}
+	if err := VerifySignature(pub, "run.sh", nil, []byte("not base64!")); err == nil || errors.Is(err, ErrBadSignature) {
+		t.Errorf("expected an invalid signature error, got %v", err)
+	}
+}
+
+// TestWithSigning_SkippedFiles verifies that signatures are skipped and
+// written together with their files under if-missing and WithNoClobber.
+func TestWithSigning_SkippedFiles(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		tmpl string
+		opts []Option
+	}{
+		{name: "if-missing", tmpl: "#FILE:kept.conf if-missing#new#FILE#\n#FILE:new.conf if-missing#new#FILE#"},
+		{name: "no clobber", tmpl: "#FILE:kept.conf#new#FILE#\n#FILE:new.conf#new#FILE#", opts: []Option{WithNoClobber()}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// kept.conf was edited by hand and is not signed; new.conf is
+			// missing but has a stale signature
+			memWriter := &MemoryFileWriter{Files: map[string][]byte{
+				"kept.conf":                     []byte("edited"),
+				"new.conf" + SignatureExtension: []byte("stale\n"),
+			}}
+			opts := append(tc.opts, WithSigning(priv))
+			if err := ExecuteWithFiles(AnyProvider(map[string]any{}), []byte(tc.tmpl), &bytes.Buffer{}, memWriter, opts...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := string(memWriter.Files["kept.conf"]); got != "edited" {
+				t.Errorf("expected kept.conf to be kept, got %q", got)
+			}
+			if sig, ok := memWriter.Files["kept.conf"+SignatureExtension]; ok {
+				t.Errorf("expected no signature for the kept file, got %q", sig)
+			}
+			if err := VerifySignature(pub, "new.conf", memWriter.Files["new.conf"], memWriter.Files["new.conf"+SignatureExtension]); err != nil {
+				t.Errorf("expected the signature of new.conf to be replaced: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDER, _ := x509.MarshalPKCS8PrivateKey(priv)
+	pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+
+	parsedPriv, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parsedPub, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := VerifySignature(parsedPub, "x", []byte("x"), Sign(parsedPriv, "x", []byte("x"))); err != nil {
+		t.Errorf("expected parsed keys to match: %v", err)
+	}
+
+	if _, err := ParsePrivateKey([]byte("garbage")); err == nil {
+		t.Error("expected error for non-PEM data")
+	}
+	if _, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER})); err == nil {
+		t.Error("expected error for a private key passed as public key")
+	}
+}
@@ -0,0 +1,172 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// StoreFileWriter is a FileWriter that keeps every generated file in a
+// content-addressed store and materializes the output tree as hard links to
+// the stored objects. Objects are not removed, so the content of any
+// previous generation stays available, and unchanged files of two runs
+// share the same object.
+//
+// Objects, and thus the generated files linked to them, are read-only, as
+// editing a file in place would modify the object of every generation that
+// shares it. An object is checked against its sha256 before it is reused
+// and stored again if it was modified anyway.
+//
+// Objects are stored as <Store>/objects/<aa>/<rest of sha256>-<mode>, where
+// mode is the octal permission requested for the file; the object itself
+// has that permission without its write bits. Store must be on the same
+// filesystem as the output directory.
+type StoreFileWriter struct {
+	// Store is the store directory.
+	Store string
+	// FileMode is the permission of files written without a requested
+	// mode, 0644 if 0.
+	FileMode os.FileMode
+	// DirMode is the permission of the directories created in the output
+	// directory, see DefaultFileWriter.DirMode.
+	DirMode os.FileMode
+
+	target DefaultFileWriter
+}
+
+// SetBaseDir sets the output directory in which the tree is materialized.
+func (w *StoreFileWriter) SetBaseDir(dir string) error {
+	w.target.DirMode = w.DirMode
+	return w.target.SetBaseDir(dir)
+}
+
+// Exists reports whether filename exists in the output tree.
+func (w *StoreFileWriter) Exists(filename string) (bool, error) {
+	return w.target.Exists(filename)
+}
+
+// WriteFile stores content (if not already stored with the same mode) and
+// atomically replaces filename with a hard link to the stored object.
+func (w *StoreFileWriter) WriteFile(filename string, content []byte, mode os.FileMode) error {
+	return w.WriteSegment(filename, content, SegmentInfo{Mode: mode})
+}
+
+// WriteSegment is WriteFile with the mode and the permission of created
+// directories taken from info.
+func (w *StoreFileWriter) WriteSegment(filename string, content []byte, info SegmentInfo) error {
+	mode := info.Mode
+	if mode == 0 {
+		mode = w.FileMode.Perm()
+	}
+	if w.Store == "" {
+		return fmt.Errorf("store directory is not set")
+	}
+	cleanFilename, err := w.target.resolve(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := w.target.checkSymlinks(OSFS{}, cleanFilename); err != nil {
+		return err
+	}
+
+	object, err := w.storeObject(content, mode)
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(cleanFilename); dir != "" && dir != "." {
+		dirMode := info.DirMode.Perm()
+		if dirMode == 0 {
+			dirMode = w.DirMode.Perm()
+		}
+		if dirMode == 0 {
+			dirMode = defaultDirMode
+		}
+		if err := os.MkdirAll(dir, dirMode); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+	if err := linkFile(OSFS{}, object, cleanFilename); err != nil {
+		return fmt.Errorf("failed to link %s to stored object: %w", cleanFilename, err)
+	}
+	return nil
+}
+
+// WriteDir creates the directory dirname in the output directory, see
+// DefaultFileWriter.WriteDir. Directories are not kept in the store.
+func (w *StoreFileWriter) WriteDir(dirname string, mode os.FileMode) error {
+	if mode == 0 {
+		mode = w.DirMode
+	}
+	return w.target.WriteDir(dirname, mode)
+}
+
+// ObjectPath returns the path under which content with the given mode is
+// kept in the store.
+func (w *StoreFileWriter) ObjectPath(content []byte, mode os.FileMode) string {
+	sum := sha256.Sum256(content)
+	return objectPath(w.Store, hex.EncodeToString(sum[:]), mode)
+}
+
+// objectPath returns the path of the object with the given hex-encoded
+// sha256 and mode in store.
+func objectPath(store, sum string, mode os.FileMode) string {
+	if mode == 0 {
+		mode = defaultFileMode
+	}
+	return filepath.Join(store, "objects", sum[:2], fmt.Sprintf("%s-%04o", sum[2:], mode.Perm()))
+}
+
+// storeObject writes content to the store unless an intact object with the
+// same content and mode already exists, and returns the object path.
+func (w *StoreFileWriter) storeObject(content []byte, mode os.FileMode) (string, error) {
+	object := w.ObjectPath(content, mode)
+	if objectIntact(object, content) {
+		return object, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(object), 0755); err != nil {
+		return "", fmt.Errorf("failed to create store directory: %w", err)
+	}
+	perm := defaultFileMode
+	if mode != 0 {
+		perm = mode.Perm()
+	}
+	perm &^= 0222
+	// Use a unique temporary file, as the same object may be stored
+	// concurrently
+	f, err := os.CreateTemp(filepath.Dir(object), filepath.Base(object)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to write store object: %w", err)
+	}
+	tmpFile := f.Name()
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return "", fmt.Errorf("failed to write store object: %w", err)
+	}
+	if err := os.Chmod(tmpFile, perm); err != nil {
+		os.Remove(tmpFile)
+		return "", fmt.Errorf("failed to set mode %04o on store object: %w", perm, err)
+	}
+	if err := os.Rename(tmpFile, object); err != nil {
+		os.Remove(tmpFile)
+		return "", fmt.Errorf("failed to write store object: %w", err)
+	}
+	return object, nil
+}
+
+// objectIntact reports whether the object at path holds content, i.e. it
+// exists and was not modified since it was stored.
+func objectIntact(path string, content []byte) bool {
+	stored, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return sha256.Sum256(stored) == sha256.Sum256(content)
+}
@@ -0,0 +1,98 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreFileWriter(t *testing.T) {
+	root := t.TempDir()
+	writer := &StoreFileWriter{Store: filepath.Join(root, "store")}
+	if err := writer.SetBaseDir(filepath.Join(root, "out")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := writer.WriteFile("a/config.yml", []byte("v1"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.WriteFile("b/config.yml", []byte("v1"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.WriteFile("run.sh", []byte("v1"), 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stat := func(path string) os.FileInfo {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("failed to stat %s: %v", path, err)
+		}
+		return info
+	}
+	object := writer.ObjectPath([]byte("v1"), 0)
+	if !os.SameFile(stat(object), stat(filepath.Join(root, "out/a/config.yml"))) ||
+		!os.SameFile(stat(object), stat(filepath.Join(root, "out/b/config.yml"))) {
+		t.Error("expected outputs to be links to the stored object")
+	}
+	if info := stat(object); info.Mode().Perm() != 0444 {
+		t.Errorf("expected a read-only object, got %v", info.Mode().Perm())
+	}
+	if info := stat(filepath.Join(root, "out/run.sh")); info.Mode().Perm() != 0555 || os.SameFile(info, stat(object)) {
+		t.Errorf("expected run.sh to use a separate 0555 object, got %v", info.Mode().Perm())
+	}
+
+	// A new generation replaces the link but keeps the old object
+	if err := writer.WriteFile("a/config.yml", []byte("v2"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(root, "out/a/config.yml")); string(content) != "v2" {
+		t.Errorf("expected new content, got %q", content)
+	}
+	if content, _ := os.ReadFile(object); string(content) != "v1" {
+		t.Errorf("expected previous object to be kept, got %q", content)
+	}
+
+	exists, err := writer.Exists("a/config.yml")
+	if err != nil || !exists {
+		t.Errorf("expected a/config.yml to exist, got %v (%v)", exists, err)
+	}
+}
+
+func TestStoreFileWriter_ModifiedObject(t *testing.T) {
+	root := t.TempDir()
+	writer := &StoreFileWriter{Store: filepath.Join(root, "store")}
+	if err := writer.SetBaseDir(filepath.Join(root, "out")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.WriteFile("a.conf", []byte("v1"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Edit the output in place despite its read-only mode, which also
+	// modifies the shared object
+	out := filepath.Join(root, "out/a.conf")
+	if err := os.Chmod(out, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(out, []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.WriteFile("b.conf", []byte("v1"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(root, "out/b.conf")); string(content) != "v1" {
+		t.Errorf("expected the modified object to be stored again, got %q", content)
+	}
+	if content, _ := os.ReadFile(writer.ObjectPath([]byte("v1"), 0)); string(content) != "v1" {
+		t.Errorf("expected an intact object, got %q", content)
+	}
+}
+
+func TestStoreFileWriter_PathTraversal(t *testing.T) {
+	writer := &StoreFileWriter{Store: t.TempDir()}
+	if err := writer.WriteFile("../escape.txt", []byte("x"), 0); err == nil {
+		t.Error("expected path traversal error")
+	}
+}
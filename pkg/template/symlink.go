@@ -0,0 +1,106 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy decides how DefaultFileWriter treats symbolic links that
+// already exist where it writes. A link planted in a generated tree, e.g.
+// out/app.conf -> /etc/passwd or out/conf -> /etc, would otherwise let a
+// writer that follows it modify files outside the output directory.
+type SymlinkPolicy string
+
+const (
+	// SymlinkRefuse fails the write if the file or one of its parent
+	// directories below the output directory is a symbolic link. It is the
+	// default.
+	SymlinkRefuse SymlinkPolicy = "refuse"
+	// SymlinkReplace replaces a symbolic link at the file path with a
+	// regular file, leaving the link target untouched. Symbolic links to
+	// parent directories are still refused.
+	SymlinkReplace SymlinkPolicy = "replace"
+	// SymlinkFollow writes through symbolic links: a linked file is
+	// rewritten in place, which is not atomic, and linked directories are
+	// used as they are. Only use it for trees whose links are trusted.
+	SymlinkFollow SymlinkPolicy = "follow"
+)
+
+// ParseSymlinkPolicy returns the SymlinkPolicy named s.
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch p := SymlinkPolicy(s); p {
+	case SymlinkRefuse, SymlinkReplace, SymlinkFollow:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid symlink policy %q: must be refuse, replace or follow", s)
+}
+
+// checkSymlinks applies the writer's symlink policy to path, a resolved
+// filename, and the directories leading to it below the base directory, or
+// below the current directory for relative paths without one; the
+// directories of absolute paths without a base directory are trusted. It
+// reports whether path is a symbolic link to be written through.
+func (w *DefaultFileWriter) checkSymlinks(fsys FS, path string) (bool, error) {
+	policy := w.Symlinks
+	if policy == "" {
+		policy = SymlinkRefuse
+	}
+	if _, err := ParseSymlinkPolicy(string(policy)); err != nil {
+		return false, err
+	}
+
+	current, rel := w.baseDir, path
+	switch {
+	case w.baseDir != "":
+		var err error
+		if rel, err = filepath.Rel(w.baseDir, path); err != nil {
+			return false, fmt.Errorf("resolved path %s is outside output directory", path)
+		}
+	case filepath.IsAbs(path):
+		current, rel = filepath.Split(path)
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts {
+		current = filepath.Join(current, part)
+		info, err := fsys.Lstat(current)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to stat %s: %w", current, err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		last := i == len(parts)-1
+		switch {
+		case policy == SymlinkFollow:
+			if last {
+				return true, nil
+			}
+		case policy == SymlinkReplace && last:
+			return false, nil
+		default:
+			return false, fmt.Errorf("refusing to write %s through symbolic link %s", path, current)
+		}
+	}
+	return false, nil
+}
+
+// removeStaleSymlink removes a symbolic link at the temporary file path, so
+// that writing the temporary file cannot be redirected outside the output
+// directory.
+func removeStaleSymlink(fsys FS, tmpFile string) error {
+	info, err := fsys.Lstat(tmpFile)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	if err := fsys.Remove(tmpFile); err != nil {
+		return fmt.Errorf("failed to remove symbolic link %s: %w", tmpFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// symlinkTree returns an output directory containing app.conf and conf
+// linking to a file and a directory outside of it.
+func symlinkTree(t *testing.T) (outDir, outsideFile, outsideDir string) {
+	t.Helper()
+	dir := t.TempDir()
+	outDir = filepath.Join(dir, "out")
+	outsideDir = filepath.Join(dir, "outside")
+	outsideFile = filepath.Join(outsideDir, "secret")
+	for _, d := range []string{outDir, outsideDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(outsideFile, []byte("original"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outsideFile, filepath.Join(outDir, "app.conf")); err != nil {
+		t.Skipf("symbolic links not supported: %v", err)
+	}
+	if err := os.Symlink(outsideDir, filepath.Join(outDir, "conf")); err != nil {
+		t.Fatal(err)
+	}
+	return outDir, outsideFile, outsideDir
+}
+
+func TestDefaultFileWriter_Symlinks(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      SymlinkPolicy
+		filename    string
+		wantErr     bool
+		wantOutside string // Expected content of the file outside the output directory
+		wantLink    bool   // Whether filename is still a symbolic link
+	}{
+		{name: "default refuses file link", filename: "app.conf", wantErr: true, wantOutside: "original", wantLink: true},
+		{name: "default refuses directory link", filename: "conf/secret", wantErr: true, wantOutside: "original"},
+		{name: "refuse", policy: SymlinkRefuse, filename: "app.conf", wantErr: true, wantOutside: "original", wantLink: true},
+		{name: "replace file link", policy: SymlinkReplace, filename: "app.conf", wantOutside: "original"},
+		{name: "replace refuses directory link", policy: SymlinkReplace, filename: "conf/secret", wantErr: true, wantOutside: "original"},
+		{name: "follow file link", policy: SymlinkFollow, filename: "app.conf", wantOutside: "generated", wantLink: true},
+		{name: "follow directory link", policy: SymlinkFollow, filename: "conf/secret", wantOutside: "generated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outDir, outsideFile, _ := symlinkTree(t)
+			writer := &DefaultFileWriter{Symlinks: tt.policy}
+			if err := writer.SetBaseDir(outDir); err != nil {
+				t.Fatal(err)
+			}
+			err := writer.WriteFile(tt.filename, []byte("generated"), 0)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "symbolic link") {
+					t.Errorf("expected a symbolic link error, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got, _ := os.ReadFile(outsideFile); string(got) != tt.wantOutside {
+				t.Errorf("expected outside file %q, got %q", tt.wantOutside, got)
+			}
+			if tt.filename == "app.conf" {
+				info, err := os.Lstat(filepath.Join(outDir, tt.filename))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if isLink := info.Mode()&os.ModeSymlink != 0; isLink != tt.wantLink {
+					t.Errorf("expected link %v, got %v", tt.wantLink, isLink)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultFileWriter_StaleTempSymlink(t *testing.T) {
+	outDir, outsideFile, _ := symlinkTree(t)
+	if err := os.Symlink(outsideFile, filepath.Join(outDir, "new.conf.tmp")); err != nil {
+		t.Fatal(err)
+	}
+	writer := &DefaultFileWriter{}
+	if err := writer.SetBaseDir(outDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteFile("new.conf", []byte("generated"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(outsideFile); string(got) != "original" {
+		t.Errorf("expected the outside file to be untouched, got %q", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(outDir, "new.conf")); string(got) != "generated" {
+		t.Errorf("expected new.conf to be written, got %q", got)
+	}
+}
+
+func TestStoreFileWriter_RefusesSymlinks(t *testing.T) {
+	outDir, outsideFile, _ := symlinkTree(t)
+	writer := &StoreFileWriter{Store: t.TempDir()}
+	if err := writer.SetBaseDir(outDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteFile("conf/secret", []byte("generated"), 0); err == nil {
+		t.Error("expected writing through a linked directory to fail")
+	}
+	if got, _ := os.ReadFile(outsideFile); string(got) != "original" {
+		t.Errorf("expected the outside file to be untouched, got %q", got)
+	}
+}
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	for _, s := range []string{"refuse", "replace", "follow"} {
+		if p, err := ParseSymlinkPolicy(s); err != nil || string(p) != s {
+			t.Errorf("%s: got %q, %v", s, p, err)
+		}
+	}
+	if _, err := ParseSymlinkPolicy("ignore"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,56 @@
+// Command wasmplugin is a WebAssembly plugin used by the tests. Build it
+// with:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o plugin.wasm
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"unsafe"
+)
+
+// buffers keeps allocated memory alive until the next call.
+var buffers [][]byte
+
+//go:wasmexport alloc
+func alloc(size int32) int32 {
+	buf := make([]byte, size)
+	buffers = append(buffers, buf)
+	return int32(uintptr(unsafe.Pointer(unsafe.SliceData(buf))))
+}
+
+//go:wasmexport upper
+func upper(ptr, size int32) int64 {
+	var args []any
+	if err := json.Unmarshal(input(ptr, size), &args); err != nil {
+		return respond(map[string]any{"error": err.Error()})
+	}
+	if len(args) != 1 {
+		return respond(map[string]any{"error": "expected one argument"})
+	}
+	s, _ := args[0].(string)
+	return respond(map[string]any{"result": strings.ToUpper(s)})
+}
+
+// spins is incremented by spin so that its loop is not optimized away.
+var spins int64
+
+//go:wasmexport spin
+func spin(ptr, size int32) int64 {
+	for {
+		spins++
+	}
+}
+
+func input(ptr, size int32) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(uintptr(ptr))), size)
+}
+
+func respond(v any) int64 {
+	out, _ := json.Marshal(v)
+	buffers = [][]byte{out}
+	return int64(uintptr(unsafe.Pointer(unsafe.SliceData(out))))<<32 | int64(len(out))
+}
+
+func main() {}
@@ -0,0 +1,78 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// WithSegmentTimeout returns an Option that aborts the rendering of a
+// segment (its filename and content) after timeout, so that one pathological
+// segment, such as a runaway loop of include calls, fails with its filename
+// instead of stalling the whole run. With WithKeepGoing, the other segments
+// still complete and every timeout is reported. Timeout errors satisfy
+// errors.Is(err, context.DeadlineExceeded).
+//
+// Templates are aborted at their next write or include call, and calls of
+// blocking functions (HTTP, DNS, cloud metadata and plugin functions) in
+// flight are canceled; an abandoned execution keeps running in the
+// background until then.
+func WithSegmentTimeout(timeout time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.segmentTimeout = timeout
+	})
+}
+
+// segmentTimeoutError reports that a segment exceeded the segment timeout.
+type segmentTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *segmentTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.timeout)
+}
+
+func (e *segmentTimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// renderJobWithTimeout renders job like renderJob, but gives up once the
+// segment timeout has passed.
+func (o *options) renderJobWithTimeout(job renderJob) (renderedSegment, error) {
+	ctx, cancel := context.WithTimeout(o.ctx, o.segmentTimeout)
+	defer cancel()
+	bound := o.withContext(ctx)
+
+	type result struct {
+		rendered renderedSegment
+		err      error
+	}
+	var filename atomic.Pointer[string]
+	done := make(chan result, 1)
+	go func() {
+		r, err := bound.renderJob(job, &filename)
+		done <- result{r, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err == nil || !errors.Is(res.err, context.DeadlineExceeded) || o.ctx.Err() != nil {
+			return res.rendered, res.err
+		}
+	case <-ctx.Done():
+		if err := o.ctx.Err(); err != nil {
+			return renderedSegment{}, err
+		}
+	}
+	timeoutErr := &segmentTimeoutError{timeout: o.segmentTimeout}
+	switch name := filename.Load(); {
+	case job.segment.Type == SegmentStdout:
+		return renderedSegment{}, fmt.Errorf("failed to render stdout segment %d: %w", job.index, timeoutErr)
+	case name == nil:
+		return renderedSegment{}, fmt.Errorf("failed to render filename template for segment %d: %w", job.index, timeoutErr)
+	default:
+		return renderedSegment{}, fmt.Errorf("failed to render file content for %s: %w", *name, timeoutErr)
+	}
+}
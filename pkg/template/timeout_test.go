@@ -0,0 +1,84 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithSegmentTimeout(t *testing.T) {
+	// 100^6 include calls that produce no output
+	loop := strings.Repeat("{{ range $.items }}", 6) + `{{ include "nop" $ }}` + strings.Repeat("{{ end }}", 6)
+	tmpl := []byte(`{{ define "nop" }}{{ end }}start
+#FILE:slow.txt#` + loop + `#FILE#
+#FILE:{{ .name }}.txt#{{ .name }}#FILE#
+#FILE:other.txt#{{ .name }}#FILE#
+#FILE:slow2.txt#` + loop + `#FILE#`)
+
+	start := time.Now()
+	var out bytes.Buffer
+	writer := &MemoryFileWriter{}
+	err := ExecuteWithFiles(AnyProvider(map[string]any{"name": "fast", "items": make([]any, 100)}), tmpl, &out, writer,
+		WithSegmentTimeout(50*time.Millisecond), WithKeepGoing())
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("render took %s", elapsed)
+	}
+
+	var renderErrs RenderErrors
+	if !errors.As(err, &renderErrs) || len(renderErrs) != 2 {
+		t.Fatalf("expected both slow segments to fail, got %v", err)
+	}
+	for _, name := range []string{"slow.txt", "slow2.txt"} {
+		if !strings.Contains(err.Error(), "failed to render file content for "+name+": timed out after 50ms") {
+			t.Errorf("expected the timeout to name %s, got %v", name, err)
+		}
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+	if len(writer.Files) != 0 {
+		t.Errorf("expected nothing to be written, got %v", writer.Files)
+	}
+}
+
+func TestWithSegmentTimeout_Completes(t *testing.T) {
+	var out bytes.Buffer
+	writer := &MemoryFileWriter{}
+	tmpl := []byte("a{{ .name }}#FILE:{{ .name }}.txt#{{ .name }}#FILE#")
+	if err := ExecuteWithFiles(AnyProvider(map[string]any{"name": "x"}), tmpl, &out, writer, WithSegmentTimeout(time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "ax" || string(writer.Files["x.txt"]) != "x" {
+		t.Errorf("unexpected output %q, files %v", out.String(), writer.Files)
+	}
+}
+
+func TestWithSegmentTimeout_CancelsBlockingCalls(t *testing.T) {
+	canceled := make(chan error, 1)
+	slow := optionFunc(func(o *options) {
+		o.registerBlocking(map[string]any{
+			"slow": func(ctx context.Context) (string, error) {
+				<-ctx.Done()
+				canceled <- ctx.Err()
+				return "", ctx.Err()
+			},
+		})
+	})
+
+	err := ExecuteWithFiles(AnyProvider(map[string]any{}), []byte("#FILE:a.txt#{{ slow }}#FILE#"), &bytes.Buffer{}, &MemoryFileWriter{},
+		slow, WithSegmentTimeout(50*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a segment timeout, got %v", err)
+	}
+	select {
+	case err := <-canceled:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the call to see the segment deadline, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the blocking call to be canceled with its segment")
+	}
+}
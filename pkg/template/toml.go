@@ -0,0 +1,602 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// checkTOML parses a TOML 1.0 document without building its values, and
+// returns an error locating the first syntax error, duplicate key or table
+// defined twice.
+func checkTOML(content []byte) error {
+	if !utf8.Valid(content) {
+		return errors.New("toml: invalid UTF-8")
+	}
+	p := &tomlParser{src: string(content), line: 1, defined: map[string]tomlKind{}, arrays: map[string]int{}}
+	return p.document()
+}
+
+// tomlKind is what a key path of a TOML document was defined as.
+type tomlKind int
+
+const (
+	tomlValue    tomlKind = iota // A value, including arrays and inline tables, which cannot be extended
+	tomlTable                    // A table defined by a [table] header
+	tomlImplicit                 // A table created by a header of a sub-table
+	tomlDotted                   // A table created by a dotted key
+	tomlArray                    // An array of tables defined by [[table]] headers
+)
+
+// tomlParser checks a TOML document.
+type tomlParser struct {
+	src  string
+	pos  int
+	line int
+
+	// defined holds the kinds of the key paths defined so far, as
+	// canonical paths (see resolve)
+	defined map[string]tomlKind
+	// arrays holds the index of the last element of arrays of tables
+	arrays map[string]int
+	// table is the canonical path of the current table
+	table string
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("toml: line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) eof() bool { return p.pos >= len(p.src) }
+
+// peek returns the next byte, or 0 at the end of the document.
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *tomlParser) skipSpace() {
+	for !p.eof() && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// newline consumes a line ending, if any.
+func (p *tomlParser) newline() bool {
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "\n"):
+		p.pos++
+	case strings.HasPrefix(p.src[p.pos:], "\r\n"):
+		p.pos += 2
+	default:
+		return false
+	}
+	p.line++
+	return true
+}
+
+// comment consumes a comment, if any, up to the end of the line.
+func (p *tomlParser) comment() error {
+	if p.peek() != '#' {
+		return nil
+	}
+	for !p.eof() && p.src[p.pos] != '\n' && !strings.HasPrefix(p.src[p.pos:], "\r\n") {
+		if isTOMLControl(p.src[p.pos]) {
+			return p.errorf("control character in comment")
+		}
+		p.pos++
+	}
+	return nil
+}
+
+// endOfLine consumes the rest of a line after a header or key/value pair,
+// which may only hold whitespace and a comment.
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace()
+	if err := p.comment(); err != nil {
+		return err
+	}
+	if !p.eof() && !p.newline() {
+		return p.errorf("expected the end of the line, found %q", p.src[p.pos])
+	}
+	return nil
+}
+
+// skipBlank consumes whitespace, comments and line endings, as allowed
+// between the values of an array.
+func (p *tomlParser) skipBlank() error {
+	for {
+		p.skipSpace()
+		if err := p.comment(); err != nil {
+			return err
+		}
+		if !p.newline() {
+			return nil
+		}
+	}
+}
+
+func (p *tomlParser) document() error {
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil
+		}
+		var err error
+		switch c := p.src[p.pos]; {
+		case c == '#':
+			err = p.endOfLine()
+		case p.newline():
+		case c == '[':
+			err = p.header()
+		default:
+			err = p.keyValue()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// header checks a [table] or [[array]] header line.
+func (p *tomlParser) header() error {
+	array := strings.HasPrefix(p.src[p.pos:], "[[")
+	if array {
+		p.pos += 2
+	} else {
+		p.pos++
+	}
+	p.skipSpace()
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(p.src[p.pos:], closing) {
+		return p.errorf("expected %s after table name", closing)
+	}
+	p.pos += len(closing)
+
+	name := strings.Join(keys, ".")
+	parent := p.resolve("", keys[:len(keys)-1], tomlImplicit)
+	if parent == "" && len(keys) > 1 {
+		return p.errorf("cannot define table [%s]: a parent key is not a table", name)
+	}
+	path := tomlJoin(parent, keys[len(keys)-1])
+	kind, exists := p.defined[path]
+	switch {
+	case array && exists && kind != tomlArray:
+		return p.errorf("cannot define array of tables [[%s]]: key already defined", name)
+	case array:
+		p.defined[path] = tomlArray
+		p.arrays[path]++
+		p.table = fmt.Sprintf("%s[%d]", path, p.arrays[path])
+	case exists && kind != tomlImplicit:
+		return p.errorf("table [%s] already defined", name)
+	default:
+		p.defined[path] = tomlTable
+		p.table = path
+	}
+	return p.endOfLine()
+}
+
+// keyValue checks a key = value line of the current table.
+func (p *tomlParser) keyValue() error {
+	if err := p.pair(p.defined, p.table); err != nil {
+		return err
+	}
+	return p.endOfLine()
+}
+
+// pair checks a key = value pair in the table at path table, recording
+// its keys in defined.
+func (p *tomlParser) pair(defined map[string]tomlKind, table string) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.peek() != '=' {
+		return p.errorf("expected = after key %s", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipSpace()
+
+	path := table
+	for _, key := range keys[:len(keys)-1] {
+		path = tomlJoin(path, key)
+		switch kind, exists := defined[path]; {
+		case !exists:
+			defined[path] = tomlDotted
+		case kind != tomlDotted:
+			return p.errorf("cannot add keys to %s with dotted key %s", key, strings.Join(keys, "."))
+		}
+	}
+	path = tomlJoin(path, keys[len(keys)-1])
+	if _, exists := defined[path]; exists {
+		return p.errorf("key %s already defined", strings.Join(keys, "."))
+	}
+	defined[path] = tomlValue
+	return p.value()
+}
+
+// resolve returns the canonical path of keys below base, in which arrays of
+// tables are followed by the index of their last element, e.g. "a[2].b".
+// Missing tables are recorded as kind. It returns "" if a key on the way
+// is a value.
+func (p *tomlParser) resolve(base string, keys []string, kind tomlKind) string {
+	path := base
+	for _, key := range keys {
+		path = tomlJoin(path, key)
+		existing, exists := p.defined[path]
+		switch {
+		case !exists:
+			p.defined[path] = kind
+		case existing == tomlValue:
+			return ""
+		case existing == tomlArray:
+			path = fmt.Sprintf("%s[%d]", path, p.arrays[path])
+		}
+	}
+	return path
+}
+
+// tomlJoin appends key to the canonical path.
+func tomlJoin(path, key string) string {
+	// Quoted keys may contain dots, so parts are separated by NUL
+	if path == "" {
+		return "\x00" + key
+	}
+	return path + "\x00" + key
+}
+
+// key checks a possibly dotted key and returns its parts.
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		key, err := p.simpleKey()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		p.skipSpace()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+		p.skipSpace()
+	}
+}
+
+// simpleKey checks a bare or quoted key and returns it.
+func (p *tomlParser) simpleKey() (string, error) {
+	switch p.peek() {
+	case '"':
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			return "", p.errorf("multi-line strings cannot be keys")
+		}
+		return p.basicString()
+	case '\'':
+		if strings.HasPrefix(p.src[p.pos:], "'''") {
+			return "", p.errorf("multi-line strings cannot be keys")
+		}
+		return p.literalString()
+	}
+	start := p.pos
+	for !p.eof() && isTOMLBareKey(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		if p.eof() || p.src[p.pos] == '\n' || p.src[p.pos] == '\r' {
+			return "", p.errorf("expected a key")
+		}
+		return "", p.errorf("invalid character %q in key", p.src[p.pos])
+	}
+	return p.src[start:p.pos], nil
+}
+
+func isTOMLBareKey(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// isTOMLControl reports whether c is a control character other than tab,
+// which may not appear in strings and comments.
+func isTOMLControl(c byte) bool {
+	return c < 0x20 && c != '\t' || c == 0x7f
+}
+
+// value checks a value.
+func (p *tomlParser) value() error {
+	switch p.peek() {
+	case '"':
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			return p.multilineString(`"`)
+		}
+		_, err := p.basicString()
+		return err
+	case '\'':
+		if strings.HasPrefix(p.src[p.pos:], "'''") {
+			return p.multilineString("'")
+		}
+		_, err := p.literalString()
+		return err
+	case '[':
+		return p.array()
+	case '{':
+		return p.inlineTable()
+	case 0, '\n', '\r', '#':
+		return p.errorf("expected a value")
+	}
+	return p.scalar()
+}
+
+// basicString checks a "string" and returns its unescaped content.
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.eof() || p.src[p.pos] == '\n' || p.src[p.pos] == '\r' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\\':
+			r, err := p.escape()
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+		case isTOMLControl(c):
+			return "", p.errorf("control character in string")
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// escape checks the escape sequence at the current position and returns
+// the character it stands for.
+func (p *tomlParser) escape() (rune, error) {
+	p.pos++
+	if p.eof() {
+		return 0, p.errorf("unterminated string")
+	}
+	c := p.src[p.pos]
+	p.pos++
+	switch c {
+	case 'b':
+		return '\b', nil
+	case 't':
+		return '\t', nil
+	case 'n':
+		return '\n', nil
+	case 'f':
+		return '\f', nil
+	case 'r':
+		return '\r', nil
+	case '"':
+		return '"', nil
+	case '\\':
+		return '\\', nil
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.src) {
+			return 0, p.errorf("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return 0, p.errorf("invalid unicode escape \\%c%s", c, p.src[p.pos:p.pos+n])
+		}
+		p.pos += n
+		return rune(code), nil
+	}
+	return 0, p.errorf("invalid escape sequence \\%c", c)
+}
+
+// literalString checks a 'string' and returns its content.
+func (p *tomlParser) literalString() (string, error) {
+	p.pos++
+	start := p.pos
+	for {
+		if p.eof() || p.src[p.pos] == '\n' || p.src[p.pos] == '\r' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		if c == '\'' {
+			p.pos++
+			return p.src[start : p.pos-1], nil
+		}
+		if isTOMLControl(c) {
+			return "", p.errorf("control character in string")
+		}
+		p.pos++
+	}
+}
+
+// multilineString checks a multi-line basic (quote is a double quote) or
+// literal (quote is a single quote) string, delimited by three quotes, which
+// may end with up to two quotes before its closing delimiter.
+func (p *tomlParser) multilineString(quote string) error {
+	delimiter := strings.Repeat(quote, 3)
+	p.pos += 3
+	for {
+		switch {
+		case p.eof():
+			return p.errorf("unterminated multi-line string")
+		case strings.HasPrefix(p.src[p.pos:], delimiter):
+			p.pos += 3
+			for i := 0; i < 2 && strings.HasPrefix(p.src[p.pos:], quote); i++ {
+				p.pos++
+			}
+			return nil
+		case p.newline():
+		case quote == `"` && p.src[p.pos] == '\\':
+			// A backslash at the end of a line trims the following whitespace
+			rest := strings.TrimLeft(p.src[p.pos+1:], " \t")
+			if strings.HasPrefix(rest, "\n") || strings.HasPrefix(rest, "\r\n") {
+				p.pos = len(p.src) - len(rest)
+				if err := p.skipBlankLines(); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := p.escape(); err != nil {
+				return err
+			}
+		case isTOMLControl(p.src[p.pos]):
+			return p.errorf("control character in string")
+		default:
+			p.pos++
+		}
+	}
+}
+
+// skipBlankLines consumes whitespace and line endings.
+func (p *tomlParser) skipBlankLines() error {
+	for {
+		p.skipSpace()
+		if !p.newline() {
+			return nil
+		}
+	}
+}
+
+// array checks an array, whose values may span lines.
+func (p *tomlParser) array() error {
+	p.pos++
+	for {
+		if err := p.skipBlank(); err != nil {
+			return err
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return nil
+		}
+		if err := p.value(); err != nil {
+			return err
+		}
+		if err := p.skipBlank(); err != nil {
+			return err
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return nil
+		default:
+			return p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+// inlineTable checks an inline { key = value, ... } table, which must fit
+// on one line and has keys of its own.
+func (p *tomlParser) inlineTable() error {
+	p.pos++
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.pos++
+		return nil
+	}
+	defined := map[string]tomlKind{}
+	for {
+		p.skipSpace()
+		if err := p.pair(defined, ""); err != nil {
+			return err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+			p.skipSpace()
+			if p.peek() == '}' {
+				return p.errorf("trailing comma in inline table")
+			}
+		case '}':
+			p.pos++
+			return nil
+		default:
+			return p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+var (
+	tomlInteger = regexp.MustCompile(`^(?:[+-]?(?:0|[1-9](?:_?[0-9])*)|0x[0-9A-Fa-f](?:_?[0-9A-Fa-f])*|0o[0-7](?:_?[0-7])*|0b[01](?:_?[01])*)$`)
+	tomlFloat   = regexp.MustCompile(`^[+-]?(?:(?:0|[1-9](?:_?[0-9])*)(?:\.[0-9](?:_?[0-9])*)?(?:[eE][+-]?[0-9](?:_?[0-9])*)?|inf|nan)$`)
+	tomlDate    = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	tomlTime    = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(?:\.\d+)?$`)
+	// A date and time, the time optionally followed by an offset
+	tomlDateTime = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})[Tt ](\d{2}:\d{2}:\d{2}(?:\.\d+)?)([Zz]|[+-]\d{2}:\d{2})?$`)
+)
+
+// scalar checks a boolean, number or date/time.
+func (p *tomlParser) scalar() error {
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	token := p.src[start:p.pos]
+	// A date may be separated from its time by a space
+	if tomlDate.MatchString(token) && len(p.src) >= p.pos+3 && p.src[p.pos] == ' ' && isDigit(p.src[p.pos+1]) && isDigit(p.src[p.pos+2]) {
+		p.pos++
+		for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.src[p.pos])) {
+			p.pos++
+		}
+		token = p.src[start:p.pos]
+	}
+
+	switch {
+	case token == "true" || token == "false":
+		return nil
+	case tomlInteger.MatchString(token):
+		return nil
+	case tomlFloat.MatchString(token) && (strings.ContainsAny(token, ".eE") || strings.HasSuffix(token, "inf") || strings.HasSuffix(token, "nan")):
+		return nil
+	case tomlDate.MatchString(token):
+		if _, err := time.Parse("2006-01-02", token); err != nil {
+			return p.errorf("invalid date %s", token)
+		}
+		return nil
+	case tomlTime.MatchString(token):
+		if _, err := time.Parse("15:04:05", token[:8]); err != nil {
+			return p.errorf("invalid time %s", token)
+		}
+		return nil
+	case tomlDateTime.MatchString(token):
+		m := tomlDateTime.FindStringSubmatch(token)
+		if _, err := time.Parse("2006-01-02T15:04:05", m[1]+"T"+m[2][:8]); err != nil {
+			return p.errorf("invalid date-time %s", token)
+		}
+		if len(m[3]) == 6 {
+			if _, err := time.Parse("-07:00", m[3]); err != nil {
+				return p.errorf("invalid date-time %s", token)
+			}
+		}
+		return nil
+	}
+	if token == "" {
+		return p.errorf("expected a value")
+	}
+	return p.errorf("invalid value %s", token)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
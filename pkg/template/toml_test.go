@@ -0,0 +1,123 @@
+package template
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckTOML_Valid(t *testing.T) {
+	doc := `# Example from the TOML specification
+title = "TOML \"Example\" \u00e9"
+'literal key' = 'C:\Users\nodejs'
+"quoted.key" = true
+site."google.com" = true
+empty = ""
+
+[owner]
+name = "Tom Preston-Werner"
+dob = 1979-05-27T07:32:00-08:00
+local = 1979-05-27 07:32:00.999
+day = 1979-05-27
+lunch = 12:30:00
+
+[database]
+enabled = true
+ports = [ 8000, 8001, 8002 ]
+data = [ ["delta", "phi"], [3.14] ]
+temp_targets = { cpu = 79.5, case = 72.0, nested.deep = -inf }
+mixed = [
+  1, # comment
+  'two',
+  { three = 3 },
+]
+
+[servers.alpha]
+ip = "10.0.0.1"
+
+[servers.beta]
+ip = "10.0.0.2"
+
+[fruit]
+apple.color = "red"
+apple.taste.sweet = true
+
+[fruit.apple.texture]
+smooth = true
+
+[[products]]
+name = "Hammer"
+sku = 738594937
+
+[[products]]
+
+[[products]]
+name = "Nail"
+sku = 0xDEAD_BEEF
+color = "gray"
+[products.details]
+weight = 1_000
+ratio = 6.626e-34
+flags = [0o755, 0b1101, +inf, nan, -0.0]
+
+[multi]
+basic = """
+Roses are red \
+    Violets are blue ""quoted""""
+literal = '''
+The first newline is
+trimmed in raw strings. '' '''
+`
+	if err := checkTOML([]byte(doc)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckTOML_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{name: "missing equals", doc: "a 1\n", want: "line 1: expected = after key a"},
+		{name: "missing value", doc: "a =\n", want: "line 1: expected a value"},
+		{name: "unterminated string", doc: "\na = \"x\n", want: "line 2: unterminated string"},
+		{name: "bad escape", doc: `a = "\q"`, want: `invalid escape sequence \q`},
+		{name: "leading zero", doc: "a = 012", want: "invalid value 012"},
+		{name: "bad date", doc: "a = 2024-02-30", want: "invalid date 2024-02-30"},
+		{name: "bare word", doc: "a = yes", want: "invalid value yes"},
+		{name: "duplicate key", doc: "a = 1\nb = 2\na = 3\n", want: "line 3: key a already defined"},
+		{name: "duplicate dotted key", doc: "a.b = 1\na.b = 2\n", want: "key a.b already defined"},
+		{name: "value extended", doc: "a = 1\na.b = 2\n", want: "cannot add keys to a"},
+		{name: "table twice", doc: "[a]\nx = 1\n[b]\n[a]\n", want: "line 4: table [a] already defined"},
+		{name: "table over value", doc: "a = 1\n[a]\n", want: "table [a] already defined"},
+		{name: "table below value", doc: "a = 1\n[a.b]\n", want: "a parent key is not a table"},
+		{name: "array over table", doc: "[a]\n[[a]]\n", want: "cannot define array of tables [[a]]"},
+		{name: "dotted table reopened", doc: "[fruit]\napple.color = 1\n[fruit.apple]\n", want: "table [fruit.apple] already defined"},
+		{name: "trailing garbage", doc: "a = 1 2\n", want: "expected the end of the line"},
+		{name: "unclosed array", doc: "a = [1, 2\n", want: "expected , or ] in array"},
+		{name: "inline trailing comma", doc: "a = { b = 1, }", want: "trailing comma in inline table"},
+		{name: "inline duplicate", doc: "a = { b = 1, b = 2 }", want: "key b already defined"},
+		{name: "unclosed header", doc: "[a\n", want: "expected ] after table name"},
+		{name: "control character", doc: "a = \"\x01\"", want: "control character in string"},
+		{name: "invalid UTF-8", doc: "a = \"\xff\"", want: "invalid UTF-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTOML([]byte(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestCheckTOML_ArraysOfTables(t *testing.T) {
+	// Each element of an array of tables has keys and sub-tables of its own
+	doc := "[[a]]\nx = 1\n[a.sub]\ny = 1\n[[a]]\nx = 2\n[a.sub]\ny = 2\n"
+	if err := checkTOML([]byte(doc)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := checkTOML([]byte("[[a]]\n[a.sub]\n[a.sub]\n")); err == nil {
+		t.Error("expected an error for a sub-table defined twice in one element")
+	}
+}
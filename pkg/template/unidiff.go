@@ -0,0 +1,217 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines around changes in
+	// unified diffs.
+	diffContext = 3
+	// maxDiffEdits bounds the work of the line diff; files that differ by
+	// more edits are shown as entirely replaced.
+	maxDiffEdits = 2000
+)
+
+// diffOp is a line of an edit script: unchanged (' '), deleted ('-') or
+// inserted ('+').
+type diffOp struct {
+	kind byte
+	line string // Including its line ending, if any
+}
+
+// unifiedDiff returns the unified diff (as produced by diff -u and git)
+// turning old into new for the file path. A nil old stands for a new file.
+// It returns an empty string if the contents are equal, and a one-line
+// note for binary content.
+func unifiedDiff(path string, old, new []byte) string {
+	if bytes.Equal(old, new) && old != nil {
+		return ""
+	}
+	from := "a/" + path
+	if old == nil {
+		from = "/dev/null"
+	}
+	if bytes.IndexByte(old, 0) != -1 || bytes.IndexByte(new, 0) != -1 {
+		return fmt.Sprintf("Binary files %s and b/%s differ\n", from, path)
+	}
+
+	ops := diffLines(splitLines(old), splitLines(new))
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ b/%s\n", from, path)
+	for start := 0; start < len(ops); {
+		// Find the next change and the end of its hunk, merging changes
+		// separated by at most twice the context
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		end := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i + 1
+			} else if i-end >= 2*diffContext {
+				break
+			}
+		}
+		hunkStart := max(first-diffContext, start)
+		hunkEnd := min(end+diffContext, len(ops))
+		writeHunk(&b, ops, hunkStart, hunkEnd)
+		start = hunkEnd
+	}
+	return b.String()
+}
+
+// writeHunk writes the hunk of ops[start:end] with its @@ header.
+func writeHunk(b *strings.Builder, ops []diffOp, start, end int) {
+	oldLine, newLine := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			oldLine++
+		}
+		if op.kind != '-' {
+			newLine++
+		}
+	}
+	oldCount, newCount := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+	// Empty ranges start at the line before them, as in diff -u
+	if oldCount == 0 {
+		oldLine--
+	}
+	if newCount == 0 {
+		newLine--
+	}
+	fmt.Fprintf(b, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+	for _, op := range ops[start:end] {
+		b.WriteByte(op.kind)
+		b.WriteString(op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			b.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats the line range of a hunk header.
+func hunkRange(line, count int) string {
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// splitLines splits content after every newline.
+func splitLines(content []byte) []string {
+	var lines []string
+	for len(content) > 0 {
+		i := bytes.IndexByte(content, '\n') + 1
+		if i == 0 {
+			i = len(content)
+		}
+		lines = append(lines, string(content[:i]))
+		content = content[i:]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script turning a into b, computed
+// with Myers' algorithm. Beyond maxDiffEdits edits, every line of a is
+// deleted and every line of b inserted.
+//
+// The trace keeps, for every step d, only the diagonals -d-1 to d+1 that
+// the backtrack reads, so that it grows with the square of the number of
+// edits rather than with the edits times the size of the files.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		if d > maxDiffEdits {
+			return replaceAll(a, b)
+		}
+		trace = append(trace, slices.Clone(v[offset-d-1:offset+d+2]))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	return replaceAll(a, b)
+}
+
+// backtrack walks the trace of diffLines back from the end of a and b and
+// returns the edit script in order. trace[d] holds the diagonals -d-1 to
+// d+1 of step d, so diagonal k is at index k+d+1.
+func backtrack(a, b []string, trace [][]int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || k != d && v[k-1+d+1] < v[k+1+d+1] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+d+1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+			x--
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// replaceAll returns the edit script deleting a and inserting b.
+func replaceAll(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a {
+		ops = append(ops, diffOp{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, diffOp{'+', line})
+	}
+	return ops
+}
@@ -0,0 +1,121 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new []byte
+		want     string
+	}{
+		{name: "equal", old: []byte("a\n"), new: []byte("a\n"), want: ""},
+		{
+			name: "new file",
+			new:  []byte("a\nb\n"),
+			want: "--- /dev/null\n+++ b/f.txt\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "emptied",
+			old:  []byte("a\n"),
+			new:  []byte{},
+			want: "--- a/f.txt\n+++ b/f.txt\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name: "changed line with context",
+			old:  []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n"),
+			new:  []byte("1\n2\n3\n4\nfive\n6\n7\n8\n9\n"),
+			want: "--- a/f.txt\n+++ b/f.txt\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "separate hunks",
+			old:  []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"),
+			new:  []byte("one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n"),
+			want: "--- a/f.txt\n+++ b/f.txt\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			name: "missing final newline",
+			old:  []byte("a\nb"),
+			new:  []byte("a\nb\n"),
+			want: "--- a/f.txt\n+++ b/f.txt\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name: "binary",
+			old:  []byte("a\x00"),
+			new:  []byte("b\x00"),
+			want: "Binary files a/f.txt and b/f.txt differ\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("f.txt", tt.old, tt.new); got != tt.want {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff_GitApply(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	var long []string
+	for i := range 50 {
+		long = append(long, fmt.Sprint(i))
+	}
+	pairs := [][2]string{
+		{"a\nb\nc\n", "a\nc\nd\n"},
+		{"x\n", "y"},
+		{strings.Join(long, "\n") + "\n", strings.Join(long[5:], "\n") + "\nend\n"},
+		{"same\nsame\nsame\n", "same\nother\nsame\nsame\n"},
+	}
+	for i, pair := range pairs {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "f.txt"), []byte(pair[0]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command("git", "apply", "--unsafe-paths", "--directory=.", "-")
+		cmd.Dir = dir
+		cmd.Stdin = strings.NewReader(unifiedDiff("f.txt", []byte(pair[0]), []byte(pair[1])))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("%d: git apply failed: %v: %s", i, err, out)
+			continue
+		}
+		if got, _ := os.ReadFile(filepath.Join(dir, "f.txt")); string(got) != pair[1] {
+			t.Errorf("%d: expected %q after applying, got %q", i, pair[1], got)
+		}
+	}
+}
+
+func TestDiffLines_ManyEditsInLargeFile(t *testing.T) {
+	// 500 changed lines in 50000: the trace must not hold a copy of every
+	// diagonal per edit, which would take hundreds of megabytes
+	a := make([]string, 50000)
+	b := make([]string, len(a))
+	for i := range a {
+		a[i] = fmt.Sprintf("line %d\n", i)
+		b[i] = a[i]
+		if i%100 == 0 {
+			b[i] = fmt.Sprintf("changed %d\n", i)
+		}
+	}
+	ops := diffLines(a, b)
+	var removed, added int
+	for _, op := range ops {
+		switch op.kind {
+		case '-':
+			removed++
+		case '+':
+			added++
+		}
+	}
+	if removed != 500 || added != 500 || len(ops) != len(a)+500 {
+		t.Errorf("expected 500 lines replaced, got %d removed and %d added in %d ops", removed, added, len(ops))
+	}
+}
@@ -0,0 +1,216 @@
+package template
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"gopkg.in/yaml.v3"
+)
+
+// WasmManifest declares a WebAssembly plugin and the template functions it
+// exports.
+type WasmManifest struct {
+	// Module is the path of the .wasm file, relative to the manifest.
+	Module string `yaml:"module" json:"module"`
+	// Functions lists the exported functions to register.
+	Functions []string `yaml:"functions" json:"functions"`
+}
+
+// WasmPlugin is a WebAssembly module that provides template functions. The
+// module runs in a sandbox: it has no access to files, the network or the
+// environment, only to the WASI clock and random number generator.
+//
+// A module exports its linear memory as "memory", a function
+// "alloc(size i32) i32" that reserves size bytes and returns their address,
+// and, for every declared function, "name(ptr i32, len i32) i64". Such a
+// function receives the JSON array of the template arguments at ptr and
+// returns the address (high 32 bits) and length (low 32 bits) of a JSON
+// response, {"result": ...} or {"error": "..."}, as in the exec plugin
+// protocol (see Plugin). WASI reactors are initialized through their
+// _initialize export.
+type WasmPlugin struct {
+	Path      string   // Manifest the plugin was loaded from
+	Functions []string // Functions the plugin provides
+
+	runtime wazero.Runtime
+	module  api.Module
+
+	mu     sync.Mutex // serializes calls into the module
+	closed atomic.Bool
+}
+
+// wasmMemoryLimitPages caps the linear memory of a module at 64 MiB, in
+// pages of 64 KiB.
+const wasmMemoryLimitPages = 1024
+
+// LoadWasmPlugin reads the manifest at path (YAML or JSON), then compiles
+// and instantiates its module, whose memory is limited to 64 MiB. Loading
+// is aborted when ctx is done; call Close to release the module once
+// rendering is complete.
+func LoadWasmPlugin(ctx context.Context, path string) (*WasmPlugin, error) {
+	manifestBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin manifest: %w", err)
+	}
+	var manifest WasmManifest
+	if err := yaml.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid plugin manifest %s: %w", path, err)
+	}
+	if manifest.Module == "" {
+		return nil, fmt.Errorf("invalid plugin manifest %s: no module", path)
+	}
+	modulePath := manifest.Module
+	if !filepath.IsAbs(modulePath) {
+		modulePath = filepath.Join(filepath.Dir(path), modulePath)
+	}
+	wasm, err := os.ReadFile(modulePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin module: %w", err)
+	}
+
+	runtimeConfig := wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(wasmMemoryLimitPages)
+	runtime := wazero.NewRuntimeWithConfig(ctx, runtimeConfig)
+	p := &WasmPlugin{Path: path, runtime: runtime}
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("plugin %s: %w", path, err)
+	}
+	config := wazero.NewModuleConfig().
+		WithStartFunctions("_initialize").
+		WithStderr(os.Stderr).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+	if p.module, err = runtime.InstantiateWithConfig(ctx, wasm, config); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("plugin %s: failed to instantiate module: %w", path, err)
+	}
+
+	if err := p.checkExport("alloc", []api.ValueType{api.ValueTypeI32}, []api.ValueType{api.ValueTypeI32}); err != nil {
+		p.Close()
+		return nil, err
+	}
+	for _, name := range manifest.Functions {
+		if !funcName.MatchString(name) {
+			p.Close()
+			return nil, fmt.Errorf("plugin %s: invalid function name %q", path, name)
+		}
+		if err := p.checkExport(name, []api.ValueType{api.ValueTypeI32, api.ValueTypeI32}, []api.ValueType{api.ValueTypeI64}); err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	if p.module.Memory() == nil {
+		p.Close()
+		return nil, fmt.Errorf("plugin %s: module does not export its memory", path)
+	}
+	p.Functions = manifest.Functions
+	return p, nil
+}
+
+// checkExport verifies that the module exports the function name with the
+// given signature.
+func (p *WasmPlugin) checkExport(name string, params, results []api.ValueType) error {
+	fn := p.module.ExportedFunction(name)
+	if fn == nil {
+		return fmt.Errorf("plugin %s: module does not export %s", p.Path, name)
+	}
+	def := fn.Definition()
+	if !equalTypes(def.ParamTypes(), params) || !equalTypes(def.ResultTypes(), results) {
+		return fmt.Errorf("plugin %s: %s has the wrong signature", p.Path, name)
+	}
+	return nil
+}
+
+// equalTypes reports whether two WebAssembly signatures are the same.
+func equalTypes(a, b []api.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// call invokes the exported function name with args. The call is aborted,
+// and the module closed, when ctx is done.
+func (p *WasmPlugin) call(ctx context.Context, name string, args []any) (any, error) {
+	if args == nil {
+		args = []any{}
+	}
+	in, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to encode arguments: %w", name, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed.Load() {
+		return nil, fmt.Errorf("%s: plugin %s is closed", name, p.Path)
+	}
+	res, err := p.module.ExportedFunction("alloc").Call(ctx, uint64(len(in)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: plugin %s: alloc failed: %w", name, p.Path, err)
+	}
+	ptr := uint32(res[0])
+	if !p.module.Memory().Write(ptr, in) {
+		return nil, fmt.Errorf("%s: plugin %s: alloc returned an invalid address", name, p.Path)
+	}
+	res, err = p.module.ExportedFunction(name).Call(ctx, uint64(ptr), uint64(len(in)))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%s: plugin %s: %w", name, p.Path, ctx.Err())
+		}
+		return nil, fmt.Errorf("%s: plugin %s: %w", name, p.Path, err)
+	}
+	out, ok := p.module.Memory().Read(uint32(res[0]>>32), uint32(res[0]))
+	if !ok {
+		return nil, fmt.Errorf("%s: plugin %s: response is out of memory bounds", name, p.Path)
+	}
+	var resp pluginResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("%s: plugin %s: invalid response %q: %w", name, p.Path, out, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s: %s", name, resp.Error)
+	}
+	return resp.Result, nil
+}
+
+// Close releases the module and its runtime. A call still running is
+// aborted.
+func (p *WasmPlugin) Close() error {
+	if p.closed.Swap(true) {
+		return nil
+	}
+	return p.runtime.Close(context.Background())
+}
+
+// WithWasmPlugin returns an Option that registers the functions of a loaded
+// WebAssembly plugin. As with WithPlugin, arguments and results are
+// exchanged as JSON and the functions count as blocking functions.
+func WithWasmPlugin(p *WasmPlugin) Option {
+	return optionFunc(func(o *options) {
+		funcs := make(map[string]any, len(p.Functions))
+		for _, name := range p.Functions {
+			funcs[name] = func(ctx context.Context, args ...any) (any, error) {
+				return p.call(ctx, name, args)
+			}
+		}
+		o.registerBlocking(funcs)
+	})
+}
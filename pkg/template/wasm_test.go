@@ -0,0 +1,145 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildWasmPlugin compiles testdata/wasmplugin to WebAssembly and writes a
+// manifest for it declaring functions. It returns the manifest path.
+func buildWasmPlugin(t *testing.T, functions ...string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping WebAssembly build in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not available")
+	}
+	dir := t.TempDir()
+	cmd := exec.Command(goTool, "build", "-buildmode=c-shared", "-o", filepath.Join(dir, "plugin.wasm"), ".")
+	cmd.Dir = filepath.Join("testdata", "wasmplugin")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build plugin: %v\n%s", err, out)
+	}
+	manifest := "module: plugin.wasm\nfunctions: [" + strings.Join(functions, ", ") + "]\n"
+	path := filepath.Join(dir, "plugin.yaml")
+	if err := os.WriteFile(path, []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWithWasmPlugin(t *testing.T) {
+	path := buildWasmPlugin(t, "upper")
+	plugin, err := LoadWasmPlugin(context.Background(), path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer plugin.Close()
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  string
+	}{
+		{name: "call", template: `{{ upper .name }}`, want: "HELLO WORLD"},
+		{name: "repeated calls", template: `{{ upper "a" }}{{ upper "b" }}`, want: "AB"},
+		{name: "plugin error", template: `{{ upper "a" "b" }}`, wantErr: "upper: expected one argument"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Execute(AnyProvider(map[string]any{"name": "hello world"}), []byte(tt.template), &buf, WithWasmPlugin(plugin), WithParallelism(4))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+
+	if err := plugin.Close(); err != nil {
+		t.Errorf("unexpected error on close: %v", err)
+	}
+	if _, err := plugin.call(context.Background(), "upper", []any{"a"}); err == nil {
+		t.Error("expected error after close")
+	}
+}
+
+func TestWasmPlugin_HungCall(t *testing.T) {
+	path := buildWasmPlugin(t, "spin")
+	plugin, err := LoadWasmPlugin(context.Background(), path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer plugin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := plugin.call(ctx, "spin", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the call to stop at its deadline, got %v", err)
+	}
+
+	// Close must not wait for a call that never returns
+	plugin, err = LoadWasmPlugin(context.Background(), path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	called := make(chan error, 1)
+	go func() {
+		_, err := plugin.call(context.Background(), "spin", nil)
+		called <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	closed := make(chan struct{})
+	go func() {
+		plugin.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked on the running call")
+	}
+	select {
+	case err := <-called:
+		if err == nil {
+			t.Error("expected the running call to fail once the plugin is closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the running call was not aborted by Close")
+	}
+}
+
+func TestLoadWasmPlugin_Errors(t *testing.T) {
+	path := buildWasmPlugin(t, "missing")
+	if _, err := LoadWasmPlugin(context.Background(), path); err == nil || !strings.Contains(err.Error(), "does not export missing") {
+		t.Errorf("expected missing export error, got %v", err)
+	}
+
+	dir := t.TempDir()
+	noModule := filepath.Join(dir, "plugin.yaml")
+	if err := os.WriteFile(noModule, []byte("functions: [upper]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadWasmPlugin(context.Background(), noModule); err == nil || !strings.Contains(err.Error(), "no module") {
+		t.Errorf("expected no module error, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package template
+
+import "bytes"
+
+// utf8BOM is the UTF-8 encoded byte order mark.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// WithEnsureTrailingNewline returns an Option that ends the content of every
+// generated file with a newline, as if every FILE directive had the
+// ensure-trailing-newline attribute. Empty files stay empty.
+func WithEnsureTrailingNewline() Option {
+	return optionFunc(func(o *options) {
+		o.ensureTrailingNewline = true
+	})
+}
+
+// WithStripTrailingWhitespace returns an Option that removes spaces and tabs
+// at the end of every line of generated files, as if every FILE directive
+// had the strip-trailing-whitespace attribute. Line endings, including
+// CRLF, are kept.
+func WithStripTrailingWhitespace() Option {
+	return optionFunc(func(o *options) {
+		o.stripTrailingWhitespace = true
+	})
+}
+
+// WithStripBOM returns an Option that removes a UTF-8 byte order mark at the
+// start of generated files, as if every FILE directive had the strip-bom
+// attribute.
+func WithStripBOM() Option {
+	return optionFunc(func(o *options) {
+		o.stripBOM = true
+	})
+}
+
+// cleanWhitespace applies the whitespace clean-up requested by the
+// attributes of segment or by the options to the rendered content of a FILE
+// segment, so that generated files satisfy linters such as editorconfig or
+// yamllint without managing whitespace in the template. content may be
+// modified in place.
+func (o *options) cleanWhitespace(segment Segment, content []byte) []byte {
+	if segment.StripBOM || o.stripBOM {
+		content = bytes.TrimPrefix(content, utf8BOM)
+	}
+	if segment.StripTrailingWhitespace || o.stripTrailingWhitespace {
+		content = stripTrailingWhitespace(content)
+	}
+	if (segment.EnsureTrailingNewline || o.ensureTrailingNewline) && len(content) > 0 && content[len(content)-1] != '\n' {
+		content = append(content, '\n')
+	}
+	return content
+}
+
+// stripTrailingWhitespace removes spaces and tabs before every line ending
+// and at the end of content, reusing the memory of content.
+func stripTrailingWhitespace(content []byte) []byte {
+	out := content[:0]
+	for len(content) > 0 {
+		line, rest, found := bytes.Cut(content, []byte{'\n'})
+		cr := bytes.HasSuffix(line, []byte{'\r'})
+		if cr {
+			line = line[:len(line)-1]
+		}
+		out = append(out, bytes.TrimRight(line, " \t")...)
+		if cr {
+			out = append(out, '\r')
+		}
+		if found {
+			out = append(out, '\n')
+		}
+		content = rest
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package template
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCleanWhitespace(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		opts []Option
+		want string
+	}{
+		{name: "untouched", tmpl: "#FILE:a.txt#\ufeffkey: 1  \nx#FILE#", want: "\ufeffkey: 1  \nx"},
+		{name: "ensure newline", tmpl: "#FILE:a.txt ensure-trailing-newline#key: 1#FILE#", want: "key: 1\n"},
+		{name: "newline kept", tmpl: "#FILE:a.txt ensure-trailing-newline#key: 1\n#FILE#", want: "key: 1\n"},
+		{name: "empty stays empty", tmpl: "#FILE:a.txt ensure-trailing-newline##FILE#", want: ""},
+		{name: "strip trailing whitespace", tmpl: "#FILE:a.txt strip-trailing-whitespace#a: 1 \t\n\n  b: 2  \r\nc \t#FILE#", want: "a: 1\n\n  b: 2\r\nc"},
+		{name: "strip BOM", tmpl: "#FILE:a.txt strip-bom#\ufeffkey: 1#FILE#", want: "key: 1"},
+		{name: "combined", tmpl: "#FILE:a.txt strip-bom strip-trailing-whitespace ensure-trailing-newline#\ufeffa  \nb  #FILE#", want: "a\nb\n"},
+		{
+			name: "options",
+			tmpl: "#FILE:a.txt#\ufeffa  \nb  #FILE#",
+			opts: []Option{WithStripBOM(), WithStripTrailingWhitespace(), WithEnsureTrailingNewline()},
+			want: "a\nb\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &MemoryFileWriter{}
+			var stdout bytes.Buffer
+			if err := ExecuteWithFiles(AnyProvider(map[string]any{}), []byte(tt.tmpl+"out  "), &stdout, writer, tt.opts...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := string(writer.Files["a.txt"]); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			if stdout.String() != "out  " {
+				t.Errorf("expected stdout to be untouched, got %q", stdout.String())
+			}
+		})
+	}
+}
+
+func TestCleanWhitespace_SkipEmpty(t *testing.T) {
+	writer := &MemoryFileWriter{}
+	tmpl := []byte("#FILE:a.txt skip-empty ensure-trailing-newline#  #FILE#")
+	if err := ExecuteWithFiles(AnyProvider(map[string]any{}), tmpl, &bytes.Buffer{}, writer, WithStripTrailingWhitespace()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := writer.Files["a.txt"]; ok {
+		t.Errorf("expected a.txt to be skipped, got %q", writer.Files["a.txt"])
+	}
+}
@@ -1,23 +1,270 @@
 package template
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
+// defaultFileMode is the permission used for files written with mode 0.
+const defaultFileMode os.FileMode = 0644
+
+// defaultDirMode is the permission used for directories created by writers
+// whose DirMode is 0.
+const defaultDirMode os.FileMode = 0755
+
 // FileWriter provides an abstraction for writing files to enable testing
 // without actual filesystem I/O.
+//
+// The mode passed to WriteFile holds the permission bits requested by the
+// template (e.g. #FILE:run.sh:0755#); 0 means the writer's default.
 type FileWriter interface {
-	WriteFile(filename string, content []byte) error
+	WriteFile(filename string, content []byte, mode os.FileMode) error
 	SetBaseDir(dir string) error
 }
 
+// ExistsChecker is a FileWriter that can tell whether a file has already
+// been written (or exists on its target), so that if-missing segments and
+// WithNoClobber leave it untouched. Files of writers that do not implement
+// ExistsChecker are looked up with Lstat like DefaultFileWriter does,
+// relative to the current directory.
+type ExistsChecker interface {
+	FileWriter
+	Exists(filename string) (bool, error)
+}
+
+// LinkReporter is a FileWriter that can write a file as a hard link to
+// another file it wrote, such as DefaultFileWriter with Dedup, and tells
+// which. ManifestRecorder records the link of every file in the manifest.
+type LinkReporter interface {
+	FileWriter
+	// LinkedTo returns the filename of the file that filename was last
+	// written as a hard link to, or "" if it was written as a file of its
+	// own.
+	LinkedTo(filename string) string
+}
+
+// linkedTo returns the file that filename was written as a hard link to by
+// w, see LinkReporter.
+func linkedTo(w FileWriter, filename string) string {
+	if lr, ok := w.(LinkReporter); ok {
+		return lr.LinkedTo(filename)
+	}
+	return ""
+}
+
+// fileExists reports whether filename exists for w, see ExistsChecker.
+func fileExists(w FileWriter, filename string) (bool, error) {
+	if ec, ok := w.(ExistsChecker); ok {
+		return ec.Exists(filename)
+	}
+	return (&DefaultFileWriter{}).Exists(filename)
+}
+
+// SegmentInfo describes the FILE segment a file was generated from.
+type SegmentInfo struct {
+	Template  string      // Name of the template, see WithTemplateName
+	Line      int         // 1-based line of the FILE directive in the template
+	Mode      os.FileMode // Requested permissions, 0 for the writer default
+	DirMode   os.FileMode // Requested permissions of created directories, 0 for the writer default
+	IfMissing bool        // The directive has the if-missing attribute
+	SkipEmpty bool        // The directive has the skip-empty attribute
+	Each      string      // Data path iterated by a FILE-EACH directive, empty otherwise
+}
+
+// SegmentWriter is a FileWriter that also receives the metadata of the
+// segment each file was generated from, so that writers such as archives or
+// manifests can record more than the filename and content. When the writer
+// of a render implements SegmentWriter, files are written with WriteSegment
+// instead of WriteFile.
+type SegmentWriter interface {
+	FileWriter
+	WriteSegment(filename string, content []byte, info SegmentInfo) error
+}
+
+// WriteStatus tells what writing a file changed.
+type WriteStatus string
+
+const (
+	// WriteCreated means the file did not exist before.
+	WriteCreated WriteStatus = "created"
+	// WriteUpdated means an existing file was replaced.
+	WriteUpdated WriteStatus = "updated"
+	// WriteUnchanged means the file already had the content and mode and
+	// was left untouched, see DefaultFileWriter.SkipUnchanged.
+	WriteUnchanged WriteStatus = "unchanged"
+)
+
+// StatusWriter is a SegmentWriter that also reports whether each file was
+// created, updated or left unchanged. When the writer of a render
+// implements StatusWriter, files are written with WriteFileStatus and the
+// status is recorded in the FileResult of the RenderReport.
+type StatusWriter interface {
+	SegmentWriter
+	WriteFileStatus(filename string, content []byte, info SegmentInfo) (WriteStatus, error)
+}
+
+// writeSegment writes a file through w, passing info along if w is a
+// SegmentWriter. The status is empty unless w is a StatusWriter.
+func writeSegment(w FileWriter, filename string, content []byte, info SegmentInfo) (WriteStatus, error) {
+	switch sw := w.(type) {
+	case StatusWriter:
+		return sw.WriteFileStatus(filename, content, info)
+	case SegmentWriter:
+		return "", sw.WriteSegment(filename, content, info)
+	}
+	return "", w.WriteFile(filename, content, info.Mode)
+}
+
+// DirWriter is a FileWriter that also creates directories, as declared by
+// DIR directives (see ParseSegments).
+type DirWriter interface {
+	FileWriter
+	// WriteDir creates the directory dirname and its parents unless they
+	// exist. mode is the requested permission, 0 for the writer default.
+	WriteDir(dirname string, mode os.FileMode) error
+}
+
+// writeDir creates dirname with w, which must be a DirWriter.
+func writeDir(w FileWriter, dirname string, mode os.FileMode) error {
+	dw, ok := w.(DirWriter)
+	if !ok {
+		return fmt.Errorf("the file writer (%T) does not support DIR directives", w)
+	}
+	return dw.WriteDir(dirname, mode)
+}
+
+// recordingWriter is embedded by the FileWriters that write through a
+// wrapped FileWriter and record what they write (HistoryRecorder,
+// ManifestRecorder and ChangeRecorder). Every file is written by record,
+// which calls write to write it through the wrapped writer.
+type recordingWriter struct {
+	FileWriter
+
+	record func(filename string, content []byte, info SegmentInfo, write func() (WriteStatus, error)) (WriteStatus, error)
+}
+
+// WriteFile writes the file through the wrapped FileWriter and records it.
+func (w *recordingWriter) WriteFile(filename string, content []byte, mode os.FileMode) error {
+	return w.WriteSegment(filename, content, SegmentInfo{Mode: mode})
+}
+
+// WriteSegment is like WriteFile and passes info on to the wrapped writer
+// if it is a SegmentWriter.
+func (w *recordingWriter) WriteSegment(filename string, content []byte, info SegmentInfo) error {
+	_, err := w.WriteFileStatus(filename, content, info)
+	return err
+}
+
+// WriteFileStatus is like WriteSegment and returns the status reported by
+// the wrapped writer if it is a StatusWriter.
+func (w *recordingWriter) WriteFileStatus(filename string, content []byte, info SegmentInfo) (WriteStatus, error) {
+	return w.record(filename, content, info, func() (WriteStatus, error) {
+		return writeSegment(w.FileWriter, filename, content, info)
+	})
+}
+
+// WriteDir creates the directory through the wrapped FileWriter, which must
+// be a DirWriter. Directories are not recorded.
+func (w *recordingWriter) WriteDir(dirname string, mode os.FileMode) error {
+	return writeDir(w.FileWriter, dirname, mode)
+}
+
+// Exists reports whether filename exists for the wrapped writer.
+func (w *recordingWriter) Exists(filename string) (bool, error) {
+	return fileExists(w.FileWriter, filename)
+}
+
+// LinkedTo returns the file that filename was written as a hard link to by
+// the wrapped writer, see LinkReporter.
+func (w *recordingWriter) LinkedTo(filename string) string {
+	return linkedTo(w.FileWriter, filename)
+}
+
+// errOwnerNotPreserved is returned by preserveMetadata when the process may
+// not give a replacement file the owner of the file it replaces.
+var errOwnerNotPreserved = errors.New("not permitted to preserve owner")
+
 // DefaultFileWriter is the production implementation of FileWriter that writes
 // files to the actual filesystem.
 type DefaultFileWriter struct {
+	// NoPreserveMetadata disables keeping the mode, owner and extended
+	// attributes of files that are overwritten; replaced files then get the
+	// requested mode or 0644 and belong to the current user.
+	NoPreserveMetadata bool
+	// Dedup makes the writer hard link files whose content and mode are
+	// identical to a file it has already written, instead of storing the
+	// same bytes again. Linked files share permissions and owner, and
+	// editing one of them changes all of them.
+	Dedup bool
+	// FS is the filesystem files are written to; nil means the filesystem
+	// of the operating system (OSFS).
+	FS FS
+	// Symlinks decides how existing symbolic links at or above the written
+	// files are treated; the zero value refuses them (see SymlinkPolicy).
+	Symlinks SymlinkPolicy
+	// SkipUnchanged leaves files that already have the rendered content
+	// and requested mode untouched, keeping their modification time, so
+	// that make or watch pipelines do not rebuild what did not change.
+	SkipUnchanged bool
+	// Backup keeps a copy of the previous version of every overwritten
+	// file, named by appending Backup to its name, e.g. "~" for "app.conf~".
+	// BackupTimestamp appends the time instead. Empty disables backups.
+	Backup string
+	// FileMode is the permission of files written without a requested
+	// mode. Like a requested mode it is applied exactly, regardless of the
+	// umask, also to files that are overwritten. If 0, new files get 0644
+	// (the umask applies) and overwritten files keep their permissions.
+	FileMode os.FileMode
+	// DirMode is the permission of the directories the writer creates,
+	// including the base directory, or 0755 if 0. As with mkdir, the umask
+	// of the process is applied on the OS filesystem, and the permissions
+	// of existing directories are left alone.
+	DirMode os.FileMode
+
 	baseDir string
+
+	mu      sync.Mutex // guards written and links
+	written map[dedupKey]dedupSource
+	links   map[string]string // filename -> filename it is a hard link to
+}
+
+// dedupSource is a file written by a DefaultFileWriter with Dedup.
+type dedupSource struct {
+	filename string // as passed to WriteFile
+	path     string // resolved path
+}
+
+// dedupKey identifies file content for deduplication.
+type dedupKey struct {
+	sum  [sha256.Size]byte
+	mode os.FileMode
+}
+
+// fs returns the filesystem the writer writes to.
+func (w *DefaultFileWriter) fs() FS {
+	if w.FS == nil {
+		return OSFS{}
+	}
+	return w.FS
+}
+
+// dirMode returns the permission of the directories the writer creates:
+// requested, if not 0, or DirMode.
+func (w *DefaultFileWriter) dirMode(requested os.FileMode) os.FileMode {
+	if requested != 0 {
+		return requested.Perm()
+	}
+	if w.DirMode == 0 {
+		return defaultDirMode
+	}
+	return w.DirMode.Perm()
 }
 
 // SetBaseDir sets the base directory for file writes. All file paths will be
@@ -33,12 +280,12 @@ func (w *DefaultFileWriter) SetBaseDir(dir string) error {
 	cleanDir := filepath.Clean(dir)
 
 	// Create directory if it doesn't exist
-	if err := os.MkdirAll(cleanDir, 0755); err != nil {
+	if err := w.fs().MkdirAll(cleanDir, w.dirMode(0)); err != nil {
 		return fmt.Errorf("failed to create output directory %s: %w", cleanDir, err)
 	}
 
 	// Verify it's a directory
-	info, err := os.Stat(cleanDir)
+	info, err := w.fs().Stat(cleanDir)
 	if err != nil {
 		return fmt.Errorf("failed to stat output directory %s: %w", cleanDir, err)
 	}
@@ -60,34 +307,78 @@ func (w *DefaultFileWriter) SetBaseDir(dir string) error {
 // Security considerations:
 //   - Filenames are sanitized using filepath.Clean()
 //   - Path traversal attempts (containing "..") are rejected
-//   - Parent directories are created with 0755 permissions
-//   - Files are created with 0644 permissions
+//   - Parent directories are created with DirMode, 0755 by default
+//   - Files are created with the given mode, or FileMode or 0644 if mode is 0
 //   - Final path is verified to be within base directory (if set)
-func (w *DefaultFileWriter) WriteFile(filename string, content []byte) error {
-	if filename == "" {
-		return fmt.Errorf("filename cannot be empty")
-	}
+//   - Symbolic links at the path or its parent directories are refused,
+//     unless Symlinks allows them
+//
+// When an existing regular file is overwritten, its permissions (unless mode
+// is set) and, on Linux, its owner and extended attributes are kept. If the
+// process may not assign the original owner to a new file, the existing file
+// is rewritten in place instead, which is not atomic. Set NoPreserveMetadata
+// to always replace files with new ones. Owners and extended attributes are
+// only preserved on the OS filesystem (see FS).
+func (w *DefaultFileWriter) WriteFile(filename string, content []byte, mode os.FileMode) error {
+	_, err := w.write(filename, content, SegmentInfo{Mode: mode})
+	return err
+}
 
-	// Check for path traversal attempts before joining with base dir
-	// This catches patterns like "../" or "..\\"
-	if strings.Contains(filename, "..") {
-		return fmt.Errorf("path traversal not allowed in filename: %s", filename)
-	}
+// WriteSegment is WriteFile with the mode and the permission of created
+// directories taken from info.
+func (w *DefaultFileWriter) WriteSegment(filename string, content []byte, info SegmentInfo) error {
+	_, err := w.write(filename, content, info)
+	return err
+}
 
-	// Join with base directory if set
-	fullPath := filename
-	if w.baseDir != "" {
-		fullPath = filepath.Join(w.baseDir, filename)
+// WriteFileStatus is like WriteSegment and reports whether the file was
+// created, updated or, with SkipUnchanged, left unchanged.
+func (w *DefaultFileWriter) WriteFileStatus(filename string, content []byte, info SegmentInfo) (WriteStatus, error) {
+	return w.write(filename, content, info)
+}
+
+// write implements WriteSegment and reports the resulting status.
+func (w *DefaultFileWriter) write(filename string, content []byte, info SegmentInfo) (WriteStatus, error) {
+	mode, dirMode := info.Mode, w.dirMode(info.DirMode)
+	if mode == 0 {
+		mode = w.FileMode.Perm()
+	}
+	cleanFilename, err := w.resolve(filename)
+	if err != nil {
+		return "", err
 	}
+	fsys := w.fs()
 
-	// Sanitize the full path
-	cleanFilename := filepath.Clean(fullPath)
+	follow, err := w.checkSymlinks(fsys, cleanFilename)
+	if err != nil {
+		return "", err
+	}
+	if follow {
+		if info, err := fsys.Stat(cleanFilename); err == nil && info.Mode().IsRegular() {
+			if w.SkipUnchanged && unchanged(fsys, cleanFilename, info, content, mode) {
+				return WriteUnchanged, nil
+			}
+			if err := w.backup(fsys, cleanFilename, info); err != nil {
+				return "", err
+			}
+		}
+		return WriteUpdated, writeInPlace(fsys, cleanFilename, content, mode)
+	}
 
-	// Verify the resolved path is still within baseDir (defense in depth)
-	if w.baseDir != "" {
-		relPath, err := filepath.Rel(w.baseDir, cleanFilename)
-		if err != nil || strings.HasPrefix(relPath, "..") {
-			return fmt.Errorf("resolved path %s is outside output directory", cleanFilename)
+	status := WriteCreated
+	var existing os.FileInfo
+	if info, err := fsys.Lstat(cleanFilename); err == nil {
+		status = WriteUpdated
+		if info.Mode().IsRegular() {
+			if w.SkipUnchanged && unchanged(fsys, cleanFilename, info, content, mode) {
+				return WriteUnchanged, nil
+			}
+			if err := w.backup(fsys, cleanFilename, info); err != nil {
+				return "", err
+			}
+			if !w.NoPreserveMetadata {
+				existing = info
+			}
 		}
 	}
 
@@ -96,32 +387,240 @@ func (w *DefaultFileWriter) WriteFile(filename string, content []byte) error {
 
 	// Create parent directories if needed
 	if dir != "" && dir != "." {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		if err := fsys.MkdirAll(dir, dirMode); err != nil {
+			return "", fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+
+	var key dedupKey
+	linker, canLink := fsys.(LinkFS)
+	if w.Dedup && canLink {
+		key = dedupKey{sum: sha256.Sum256(content), mode: mode}
+		w.mu.Lock()
+		source, ok := w.written[key]
+		w.mu.Unlock()
+		if ok && source.path != cleanFilename {
+			// The source may have been overwritten since; fall back to a
+			// regular write if it changed or linking is not possible
+			current, err := readFile(fsys, source.path)
+			if err == nil && bytes.Equal(current, content) && linkFile(linker, source.path, cleanFilename) == nil {
+				w.setLink(filename, source.filename)
+				return status, nil
+			}
 		}
 	}
 
 	// Write to temporary file first for atomic write
 	tmpFile := cleanFilename + ".tmp"
-	if err := os.WriteFile(tmpFile, content, 0644); err != nil {
-		return fmt.Errorf("failed to write file %s: %w", cleanFilename, err)
+	if err := removeStaleSymlink(fsys, tmpFile); err != nil {
+		return "", err
+	}
+	perm := defaultFileMode
+	if mode != 0 {
+		perm = mode.Perm()
+	} else if existing != nil {
+		perm = existing.Mode().Perm()
+	}
+	if err := writeFile(fsys, tmpFile, content, perm); err != nil {
+		return "", fmt.Errorf("failed to write file %s: %w", cleanFilename, err)
+	}
+
+	// Apply an explicitly requested or preserved mode exactly, regardless of
+	// the umask
+	if mode != 0 || existing != nil {
+		if err := fsys.Chmod(tmpFile, perm); err != nil {
+			fsys.Remove(tmpFile)
+			return "", fmt.Errorf("failed to set mode %04o on %s: %w", perm, cleanFilename, err)
+		}
+	}
+
+	if mfs, ok := fsys.(metadataFS); ok && existing != nil {
+		if err := mfs.preserveMetadata(existing, cleanFilename, tmpFile); err != nil {
+			fsys.Remove(tmpFile)
+			if errors.Is(err, errOwnerNotPreserved) {
+				return status, writeInPlace(fsys, cleanFilename, content, mode)
+			}
+			return "", fmt.Errorf("failed to preserve metadata of %s: %w", cleanFilename, err)
+		}
 	}
 
 	// Rename temporary file to final filename (atomic on most filesystems)
-	if err := os.Rename(tmpFile, cleanFilename); err != nil {
-		os.Remove(tmpFile) // Clean up temp file on error
-		return fmt.Errorf("failed to rename temp file to %s: %w", cleanFilename, err)
+	if err := fsys.Rename(tmpFile, cleanFilename); err != nil {
+		fsys.Remove(tmpFile) // Clean up temp file on error
+		return "", fmt.Errorf("failed to rename temp file to %s: %w", cleanFilename, err)
+	}
+
+	if w.Dedup && canLink {
+		w.mu.Lock()
+		if w.written == nil {
+			w.written = make(map[dedupKey]dedupSource)
+		}
+		w.written[key] = dedupSource{filename: filename, path: cleanFilename}
+		w.mu.Unlock()
+		w.setLink(filename, "")
+	}
+	return status, nil
+}
+
+// setLink records that filename was written as a hard link to source, or
+// as a file of its own if source is empty.
+func (w *DefaultFileWriter) setLink(filename, source string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if source == "" {
+		delete(w.links, filename)
+		return
+	}
+	if w.links == nil {
+		w.links = make(map[string]string)
+	}
+	w.links[filename] = source
+}
+
+// LinkedTo returns the filename of the file that filename was last written
+// as a hard link to with Dedup, or "" if it was written as a file of its
+// own.
+func (w *DefaultFileWriter) LinkedTo(filename string) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.links[filename]
+}
+
+// unchanged reports whether the existing regular file path, described by
+// info, already has content and the requested mode.
+func unchanged(fsys FS, path string, info os.FileInfo, content []byte, mode os.FileMode) bool {
+	if info.Size() != int64(len(content)) || (mode != 0 && info.Mode().Perm() != mode.Perm()) {
+		return false
 	}
+	current, err := readFile(fsys, path)
+	return err == nil && bytes.Equal(current, content)
+}
 
+// linkFile atomically replaces target with a hard link to source.
+func linkFile(fsys LinkFS, source, target string) error {
+	tmpFile := target + ".tmp"
+	fsys.Remove(tmpFile)
+	if err := fsys.Link(source, tmpFile); err != nil {
+		return err
+	}
+	if err := fsys.Rename(tmpFile, target); err != nil {
+		fsys.Remove(tmpFile)
+		return err
+	}
 	return nil
 }
 
+// writeInPlace truncates and rewrites the existing file at path, keeping its
+// inode and therefore its owner and extended attributes.
+func writeInPlace(fsys FS, path string, content []byte, mode os.FileMode) error {
+	f, err := fsys.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s for writing: %w", path, err)
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	if mode != 0 {
+		if err := fsys.Chmod(path, mode.Perm()); err != nil {
+			return fmt.Errorf("failed to set mode %04o on %s: %w", mode.Perm(), path, err)
+		}
+	}
+	return nil
+}
+
+// WriteDir creates the directory dirname and its parents with mode, or
+// DirMode if mode is 0; the umask applies as with mkdir, and existing
+// directories are left unchanged. dirname is validated like the filenames of
+// WriteFile, and a symbolic link at its path is only accepted with
+// SymlinkFollow.
+func (w *DefaultFileWriter) WriteDir(dirname string, mode os.FileMode) error {
+	cleanDir, err := w.resolve(dirname)
+	if err != nil {
+		return err
+	}
+	fsys := w.fs()
+	follow, err := w.checkSymlinks(fsys, cleanDir)
+	if err != nil {
+		return err
+	}
+	if info, err := fsys.Lstat(cleanDir); err == nil && !follow {
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to create directory %s over symbolic link", cleanDir)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("cannot create directory %s: a file with that name exists", cleanDir)
+		}
+	}
+	if err := fsys.MkdirAll(cleanDir, w.dirMode(mode)); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", cleanDir, err)
+	}
+	return nil
+}
+
+// Exists reports whether filename, resolved like in WriteFile, already exists
+// on the writer's filesystem.
+func (w *DefaultFileWriter) Exists(filename string) (bool, error) {
+	cleanFilename, err := w.resolve(filename)
+	if err != nil {
+		return false, err
+	}
+	if _, err := w.fs().Lstat(cleanFilename); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to stat %s: %w", cleanFilename, err)
+	}
+	return true, nil
+}
+
+// resolve validates filename and returns the cleaned path it refers to,
+// joined with the base directory if one is set.
+func (w *DefaultFileWriter) resolve(filename string) (string, error) {
+	if filename == "" {
+		return "", fmt.Errorf("filename cannot be empty")
+	}
+
+	// Check for path traversal attempts before joining with base dir
+	// This catches patterns like "../" or "..\\"
+	if strings.Contains(filename, "..") {
+		return "", fmt.Errorf("path traversal not allowed in filename: %s", filename)
+	}
+
+	// Join with base directory if set
+	fullPath := filename
+	if w.baseDir != "" {
+		fullPath = filepath.Join(w.baseDir, filename)
+	}
+
+	// Sanitize the full path
+	cleanFilename := filepath.Clean(fullPath)
+
+	// Verify the resolved path is still within baseDir (defense in depth)
+	if w.baseDir != "" {
+		relPath, err := filepath.Rel(w.baseDir, cleanFilename)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			return "", fmt.Errorf("resolved path %s is outside output directory", cleanFilename)
+		}
+	}
+
+	return cleanFilename, nil
+}
+
 // MemoryFileWriter is a test implementation of FileWriter that stores files
 // in memory rather than writing to the filesystem. This enables fast, isolated
-// testing without filesystem side effects.
+// testing without filesystem side effects. It is safe for concurrent use.
 type MemoryFileWriter struct {
-	Files   map[string][]byte
-	baseDir string
+	Files    map[string][]byte
+	Modes    map[string]os.FileMode // Requested mode per file (0 = default)
+	Segments map[string]SegmentInfo // Segment each file was generated from, if known
+	Dirs     map[string]os.FileMode // Requested mode per directory of DIR directives (0 = default)
+	baseDir  string
+
+	mu sync.Mutex // guards Files, Modes, Segments and Dirs during writes
 }
 
 // SetBaseDir sets the base directory for file writes in memory.
@@ -131,23 +630,72 @@ func (w *MemoryFileWriter) SetBaseDir(dir string) error {
 	return nil
 }
 
-// WriteFile stores the content in memory under the given filename.
-// If a base directory is set, the filename is joined with it.
-func (w *MemoryFileWriter) WriteFile(filename string, content []byte) error {
+// WriteFile stores the content in memory under the given filename and
+// records the requested mode. If a base directory is set, the filename is
+// joined with it.
+func (w *MemoryFileWriter) WriteFile(filename string, content []byte, mode os.FileMode) error {
 	if filename == "" {
 		return fmt.Errorf("filename cannot be empty")
 	}
 
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
 	if w.Files == nil {
 		w.Files = make(map[string][]byte)
 	}
+	if w.Modes == nil {
+		w.Modes = make(map[string]os.FileMode)
+	}
 
-	// Join with base directory if set
-	fullPath := filename
+	fullPath := w.fullPath(filename)
+	w.Files[fullPath] = content
+	w.Modes[fullPath] = mode
+	return nil
+}
+
+// WriteSegment is like WriteFile and also records info in Segments.
+func (w *MemoryFileWriter) WriteSegment(filename string, content []byte, info SegmentInfo) error {
+	if err := w.WriteFile(filename, content, info.Mode); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.Segments == nil {
+		w.Segments = make(map[string]SegmentInfo)
+	}
+	w.Segments[w.fullPath(filename)] = info
+	return nil
+}
+
+// fullPath returns filename joined with the base directory, if set.
+func (w *MemoryFileWriter) fullPath(filename string) string {
 	if w.baseDir != "" {
-		fullPath = filepath.Join(w.baseDir, filename)
+		return filepath.Join(w.baseDir, filename)
 	}
+	return filename
+}
 
-	w.Files[fullPath] = content
+// WriteDir records dirname in Dirs with the requested mode. If a base
+// directory is set, dirname is joined with it.
+func (w *MemoryFileWriter) WriteDir(dirname string, mode os.FileMode) error {
+	if dirname == "" {
+		return fmt.Errorf("directory name cannot be empty")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.Dirs == nil {
+		w.Dirs = make(map[string]os.FileMode)
+	}
+	w.Dirs[w.fullPath(dirname)] = mode
 	return nil
 }
+
+// Exists reports whether content has been stored under filename.
+func (w *MemoryFileWriter) Exists(filename string) (bool, error) {
+	fullPath := w.fullPath(filename)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, exists := w.Files[fullPath]
+	return exists, nil
+}
@@ -1,8 +1,12 @@
 package template
 
 import (
+	"bytes"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -10,7 +14,7 @@ func TestMemoryFileWriter_WriteFile(t *testing.T) {
 	writer := &MemoryFileWriter{Files: make(map[string][]byte)}
 
 	content := []byte("test content")
-	err := writer.WriteFile("test.txt", content)
+	err := writer.WriteFile("test.txt", content, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -32,7 +36,7 @@ func TestMemoryFileWriter_WriteFile(t *testing.T) {
 func TestMemoryFileWriter_EmptyFilename(t *testing.T) {
 	writer := &MemoryFileWriter{Files: make(map[string][]byte)}
 
-	err := writer.WriteFile("", []byte("content"))
+	err := writer.WriteFile("", []byte("content"), 0)
 	if err == nil {
 		t.Fatal("expected error for empty filename, got nil")
 	}
@@ -48,7 +52,7 @@ func TestMemoryFileWriter_MultipleFiles(t *testing.T) {
 	}
 
 	for filename, content := range files {
-		if err := writer.WriteFile(filename, content); err != nil {
+		if err := writer.WriteFile(filename, content, 0); err != nil {
 			t.Fatalf("unexpected error writing %s: %v", filename, err)
 		}
 	}
@@ -72,8 +76,8 @@ func TestMemoryFileWriter_MultipleFiles(t *testing.T) {
 func TestMemoryFileWriter_Overwrite(t *testing.T) {
 	writer := &MemoryFileWriter{Files: make(map[string][]byte)}
 
-	writer.WriteFile("test.txt", []byte("first"))
-	writer.WriteFile("test.txt", []byte("second"))
+	writer.WriteFile("test.txt", []byte("first"), 0)
+	writer.WriteFile("test.txt", []byte("second"), 0)
 
 	if string(writer.Files["test.txt"]) != "second" {
 		t.Errorf("expected file to be overwritten with 'second', got %q", writer.Files["test.txt"])
@@ -92,7 +96,7 @@ func TestDefaultFileWriter_WriteFile(t *testing.T) {
 	filename := filepath.Join(tmpDir, "test.txt")
 	content := []byte("test content")
 
-	err = writer.WriteFile(filename, content)
+	err = writer.WriteFile(filename, content, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -130,7 +134,7 @@ func TestDefaultFileWriter_DirectoryCreation(t *testing.T) {
 	filename := filepath.Join(tmpDir, "subdir", "nested", "test.txt")
 	content := []byte("nested content")
 
-	err = writer.WriteFile(filename, content)
+	err = writer.WriteFile(filename, content, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -159,7 +163,7 @@ func TestDefaultFileWriter_DirectoryCreation(t *testing.T) {
 func TestDefaultFileWriter_EmptyFilename(t *testing.T) {
 	writer := &DefaultFileWriter{}
 
-	err := writer.WriteFile("", []byte("content"))
+	err := writer.WriteFile("", []byte("content"), 0)
 	if err == nil {
 		t.Fatal("expected error for empty filename, got nil")
 	}
@@ -177,7 +181,7 @@ func TestDefaultFileWriter_PathTraversal(t *testing.T) {
 	}
 
 	for _, filename := range pathTraversalAttempts {
-		err := writer.WriteFile(filename, []byte("malicious"))
+		err := writer.WriteFile(filename, []byte("malicious"), 0)
 		if err == nil {
 			t.Errorf("expected error for path traversal attempt %q, got nil", filename)
 		}
@@ -198,7 +202,7 @@ func TestDefaultFileWriter_AtomicWrite(t *testing.T) {
 	filename := filepath.Join(tmpDir, "atomic.txt")
 
 	// Write file
-	err = writer.WriteFile(filename, []byte("content"))
+	err = writer.WriteFile(filename, []byte("content"), 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -221,13 +225,13 @@ func TestDefaultFileWriter_Overwrite(t *testing.T) {
 	filename := filepath.Join(tmpDir, "overwrite.txt")
 
 	// Write first version
-	err = writer.WriteFile(filename, []byte("first"))
+	err = writer.WriteFile(filename, []byte("first"), 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
 	// Overwrite with second version
-	err = writer.WriteFile(filename, []byte("second"))
+	err = writer.WriteFile(filename, []byte("second"), 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -255,7 +259,7 @@ func TestDefaultFileWriter_WithBaseDir(t *testing.T) {
 
 	// Write a file relative to base dir
 	filename := "test.txt"
-	err = writer.WriteFile(filename, []byte("content"))
+	err = writer.WriteFile(filename, []byte("content"), 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -284,7 +288,7 @@ func TestDefaultFileWriter_WithBaseDir_NestedPath(t *testing.T) {
 
 	// Write a file with nested path
 	filename := "subdir/nested/test.txt"
-	err = writer.WriteFile(filename, []byte("nested content"))
+	err = writer.WriteFile(filename, []byte("nested content"), 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -312,7 +316,7 @@ func TestDefaultFileWriter_BaseDir_PathTraversal(t *testing.T) {
 	}
 
 	// Try path traversal with base dir set
-	err = writer.WriteFile("../escape.txt", []byte("bad"))
+	err = writer.WriteFile("../escape.txt", []byte("bad"), 0)
 	if err == nil {
 		t.Fatal("expected error for path traversal, got nil")
 	}
@@ -349,7 +353,7 @@ func TestMemoryFileWriter_WithBaseDir(t *testing.T) {
 	}
 
 	// Write a file
-	err = writer.WriteFile("test.txt", []byte("content"))
+	err = writer.WriteFile("test.txt", []byte("content"), 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -366,6 +370,62 @@ func TestMemoryFileWriter_WithBaseDir(t *testing.T) {
 	}
 }
 
+func TestDefaultFileWriter_Mode(t *testing.T) {
+	writer := &DefaultFileWriter{}
+	if err := writer.SetBaseDir(t.TempDir()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := writer.WriteFile("run.sh", []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.WriteFile("secret.key", []byte("key"), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, want := range map[string]os.FileMode{"run.sh": 0755, "secret.key": 0600} {
+		info, err := os.Stat(filepath.Join(writer.baseDir, name))
+		if err != nil {
+			t.Fatalf("failed to stat %s: %v", name, err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s: expected permissions %v, got %v", name, want, info.Mode().Perm())
+		}
+	}
+}
+
+func TestMemoryFileWriter_Mode(t *testing.T) {
+	writer := &MemoryFileWriter{}
+	if err := writer.WriteFile("run.sh", []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if writer.Modes["run.sh"] != 0755 {
+		t.Errorf("expected mode 0755, got %04o", writer.Modes["run.sh"])
+	}
+}
+
+func TestDefaultFileWriter_Exists(t *testing.T) {
+	writer := &DefaultFileWriter{}
+	if err := writer.SetBaseDir(t.TempDir()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exists, err := writer.Exists("config.yml")
+	if err != nil || exists {
+		t.Fatalf("expected missing file, got exists=%v err=%v", exists, err)
+	}
+	if err := writer.WriteFile("config.yml", []byte("x"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exists, err = writer.Exists("config.yml")
+	if err != nil || !exists {
+		t.Fatalf("expected existing file, got exists=%v err=%v", exists, err)
+	}
+	if _, err := writer.Exists("../outside.yml"); err == nil {
+		t.Error("expected path traversal error, got nil")
+	}
+}
+
 func mapKeys(m map[string][]byte) []string {
 	keys := make([]string, 0, len(m))
 	for k := range m {
@@ -373,3 +433,263 @@ func mapKeys(m map[string][]byte) []string {
 	}
 	return keys
 }
+
+func TestDefaultFileWriter_PreservesMode(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "run.sh")
+	if err := os.WriteFile(path, []byte("old"), 0700); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	if err := os.Chmod(path, 0750); err != nil {
+		t.Fatalf("failed to chmod file: %v", err)
+	}
+
+	writer := &DefaultFileWriter{}
+	if err := writer.SetBaseDir(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.WriteFile("run.sh", []byte("new"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0750 {
+		t.Errorf("expected preserved permissions 0750, got %v", info.Mode().Perm())
+	}
+
+	// An explicit mode still wins over the existing one
+	if err := writer.WriteFile("run.sh", []byte("new"), 0700); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0700 {
+		t.Errorf("expected requested permissions 0700, got %v", info.Mode().Perm())
+	}
+
+	writer.NoPreserveMetadata = true
+	if err := writer.WriteFile("run.sh", []byte("new"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != defaultFileMode {
+		t.Errorf("expected default permissions without preservation, got %v", info.Mode().Perm())
+	}
+}
+
+func TestDefaultFileWriter_Dedup(t *testing.T) {
+	dir := t.TempDir()
+	writer := &DefaultFileWriter{Dedup: true}
+	if err := writer.SetBaseDir(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+	}{
+		{"a/config.yml", "same", 0},
+		{"b/config.yml", "same", 0},
+		{"c/config.yml", "other", 0},
+		{"d/config.yml", "same", 0600},
+	}
+	for _, f := range files {
+		if err := writer.WriteFile(f.name, []byte(f.content), f.mode); err != nil {
+			t.Fatalf("unexpected error writing %s: %v", f.name, err)
+		}
+	}
+
+	stat := func(name string) os.FileInfo {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("failed to stat %s: %v", name, err)
+		}
+		return info
+	}
+	if !os.SameFile(stat("a/config.yml"), stat("b/config.yml")) {
+		t.Error("expected identical files to be hard linked")
+	}
+	if os.SameFile(stat("a/config.yml"), stat("c/config.yml")) {
+		t.Error("expected different content not to be linked")
+	}
+	if os.SameFile(stat("a/config.yml"), stat("d/config.yml")) {
+		t.Error("expected a different mode not to be linked")
+	}
+	for name, want := range map[string]string{"a/config.yml": "", "b/config.yml": "a/config.yml", "c/config.yml": ""} {
+		if got := writer.LinkedTo(name); got != want {
+			t.Errorf("%s: expected link to %q, got %q", name, want, got)
+		}
+	}
+
+	// Overwriting the link source must not affect later duplicates
+	if err := writer.WriteFile("a/config.yml", []byte("changed"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.WriteFile("e/config.yml", []byte("same"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "e/config.yml")); string(content) != "same" {
+		t.Errorf("expected e/config.yml to contain 'same', got %q", content)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "b/config.yml")); string(content) != "same" {
+		t.Errorf("expected b/config.yml to keep its content, got %q", content)
+	}
+}
+
+func TestDefaultFileWriter_DirMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		dirMode os.FileMode
+		want    os.FileMode
+	}{
+		{"default", 0, 0755},
+		{"group restricted", 0750, 0750},
+		{"type bits ignored", os.ModeDir | 0700, 0700},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := &MemFS{}
+			writer := &DefaultFileWriter{FS: fsys, DirMode: tt.dirMode}
+			if err := writer.SetBaseDir("out"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := writer.WriteFile("conf/app/config.yml", []byte("x"), 0); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, dir := range []string{"out", "out/conf", "out/conf/app"} {
+				info, err := fsys.Stat(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != tt.want {
+					t.Errorf("%s: expected %04o, got %04o", dir, tt.want, info.Mode().Perm())
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultFileWriter_FileMode(t *testing.T) {
+	fsys := &MemFS{}
+	writer := &DefaultFileWriter{FS: fsys, FileMode: 0600}
+	if err := writer.WriteFile("existing.env", []byte("old"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Chmod("existing.env", 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]os.FileMode{"new.env": 0, "existing.env": 0, "run.sh": 0755}
+	for name, mode := range files {
+		if err := writer.WriteFile(name, []byte("x"), mode); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	want := map[string]os.FileMode{"new.env": 0600, "existing.env": 0600, "run.sh": 0755}
+	for name, mode := range want {
+		info, err := fsys.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("%s: expected %04o, got %04o", name, mode, info.Mode().Perm())
+		}
+	}
+}
+
+func TestFileModeOptions(t *testing.T) {
+	fsys := &MemFS{}
+	writer := &DefaultFileWriter{FS: fsys}
+	segments, err := ParseSegments([]byte("#FILE:secrets/db.env#x#FILE##FILE:bin/run.sh:0755#y#FILE#"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := RenderSegments(segments, map[string]any{}, writer, io.Discard, WithFileMode(0600), WithDirMode(0700))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]os.FileMode{"secrets": 0700, "secrets/db.env": 0600, "bin": 0700, "bin/run.sh": 0755}
+	for name, mode := range want {
+		info, err := fsys.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("%s: expected %04o, got %04o", name, mode, info.Mode().Perm())
+		}
+	}
+	if report.Files[0].Mode != 0600 || report.Files[1].Mode != 0755 {
+		t.Errorf("expected reported modes 0600 and 0755, got %04o and %04o", report.Files[0].Mode, report.Files[1].Mode)
+	}
+}
+
+func TestDefaultFileWriter_SkipUnchanged(t *testing.T) {
+	fsys := &MemFS{}
+	writer := &DefaultFileWriter{FS: fsys, SkipUnchanged: true}
+	tmpl := []byte("#FILE:same.conf#same#FILE##FILE:changed.conf#{{.version}}#FILE##FILE:run.sh:{{.mode}}#run#FILE#")
+	render := func(version, mode string) map[string]WriteStatus {
+		t.Helper()
+		segments, err := ParseSegments([]byte(strings.ReplaceAll(string(tmpl), "{{.mode}}", mode)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err := RenderSegments(segments, map[string]any{"version": version}, writer, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		statuses := make(map[string]WriteStatus)
+		for _, f := range report.Files {
+			statuses[f.Path] = f.Status
+		}
+		return statuses
+	}
+
+	want := map[string]WriteStatus{"same.conf": WriteCreated, "changed.conf": WriteCreated, "run.sh": WriteCreated}
+	if got := render("1", "0755"); !reflect.DeepEqual(got, want) {
+		t.Errorf("first render: expected %v, got %v", want, got)
+	}
+	before, err := fsys.Stat("same.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = map[string]WriteStatus{"same.conf": WriteUnchanged, "changed.conf": WriteUpdated, "run.sh": WriteUpdated}
+	if got := render("2", "0700"); !reflect.DeepEqual(got, want) {
+		t.Errorf("second render: expected %v, got %v", want, got)
+	}
+	after, err := fsys.Stat("same.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("expected the modification time of an unchanged file to be kept")
+	}
+	if content, _ := fsys.ReadFile("changed.conf"); string(content) != "2" {
+		t.Errorf("expected changed.conf to be updated, got %q", content)
+	}
+	if info, _ := fsys.Stat("run.sh"); info.Mode().Perm() != 0700 {
+		t.Errorf("expected a mode change to rewrite run.sh, got %04o", info.Mode().Perm())
+	}
+
+	writer.SkipUnchanged = false
+	if got := render("2", "0700"); got["same.conf"] != WriteUpdated {
+		t.Errorf("expected files to be rewritten without SkipUnchanged, got %v", got)
+	}
+}
+
+func TestSegmentWriter(t *testing.T) {
+	writer := &MemoryFileWriter{}
+	tmpl := []byte("intro\n#FILE:app.sh:0755 skip-empty#run#FILE#\n#FILE-EACH:.services:{{ .name }}.txt if-missing#{{ .name }}#FILE#")
+	data := map[string]any{"services": []any{map[string]any{"name": "api"}}}
+	// Metadata is passed on through wrapping writers
+	recorder := NewManifestRecorder(writer)
+	if err := ExecuteWithFiles(AnyProvider(data), tmpl, &bytes.Buffer{}, recorder, WithTemplateName("site.tmpl")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]SegmentInfo{
+		"app.sh":  {Template: "site.tmpl", Line: 2, Mode: 0755, SkipEmpty: true},
+		"api.txt": {Template: "site.tmpl", Line: 3, IfMissing: true, Each: ".services"},
+	}
+	if !reflect.DeepEqual(writer.Segments, want) {
+		t.Errorf("expected segments %+v, got %+v", want, writer.Segments)
+	}
+	if writer.Modes["app.sh"] != 0755 {
+		t.Errorf("expected mode 0755, got %04o", writer.Modes["app.sh"])
+	}
+}